@@ -0,0 +1,115 @@
+// Package dbtest gives tests a migrated PostgreSQL schema of their own, for
+// exercising services' SQL. Tests using it are skipped unless
+// TEST_DATABASE_URL names a database they may create schemas in.
+package dbtest
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/database"
+)
+
+// New returns a pool whose search_path is a new schema with every migration
+// applied. The schema is dropped when the test ends.
+func New(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	admin, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("failed to connect to TEST_DATABASE_URL: %v", err)
+	}
+	if _, err := admin.Exec(ctx, `CREATE SCHEMA `+schema); err != nil {
+		admin.Close()
+		t.Fatalf("failed to create schema: %v", err)
+	}
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	db, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := admin.Exec(ctx, `DROP SCHEMA `+schema+` CASCADE`); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+		admin.Close()
+	})
+
+	if err := database.Migrate(ctx, db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+// User inserts a user with a verified email and returns its ID. The Clerk ID
+// is "clerk_" + name and the email name@example.com.
+func User(t testing.TB, db *pgxpool.Pool, name string) uuid.UUID {
+	t.Helper()
+
+	id := uuid.New()
+	if _, err := db.Exec(context.Background(), `
+	INSERT INTO users (id, clerk_id, email, username, email_verified)
+	VALUES ($1, $2, $3, $4, TRUE)
+	`, id, "clerk_"+name, name+"@example.com", name); err != nil {
+		t.Fatalf("failed to insert user %s: %v", name, err)
+	}
+	return id
+}
+
+// Device inserts a device owned by ownerID, or unowned when ownerID is
+// uuid.Nil.
+func Device(t testing.TB, db *pgxpool.Pool, id string, ownerID uuid.UUID) {
+	t.Helper()
+
+	var owner *uuid.UUID
+	if ownerID != uuid.Nil {
+		owner = &ownerID
+	}
+	if _, err := db.Exec(context.Background(), `
+	INSERT INTO devices (id, owner_id, friendly_name) VALUES ($1, $2, $1)
+	`, id, owner); err != nil {
+		t.Fatalf("failed to insert device %s: %v", id, err)
+	}
+}
+
+// Exec runs a statement that sets up a test, failing it on error.
+func Exec(t testing.TB, db *pgxpool.Pool, sql string, args ...any) {
+	t.Helper()
+
+	if _, err := db.Exec(context.Background(), sql, args...); err != nil {
+		t.Fatalf("%s: %v", strings.TrimSpace(sql), err)
+	}
+}
+
+// Count returns the single integer sql selects.
+func Count(t testing.TB, db *pgxpool.Pool, sql string, args ...any) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow(context.Background(), sql, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", strings.TrimSpace(sql), err)
+	}
+	return n
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is an arbitrary pg_advisory_lock key so only one instance
+// applies migrations at a time.
+const migrationLockID = 727274
+
+type migration struct {
+	Version string
+	SQL     string
+}
+
+func loadMigrations() ([]migration, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	migrations := make([]migration, 0, len(names))
+	for _, name := range names {
+		body, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+		migrations = append(migrations, migration{Version: version, SQL: string(body)})
+	}
+	return migrations, nil
+}
+
+func ensureMigrationsTable(ctx context.Context, db *pgxpool.Pool) error {
+	_, err := db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`)
+	return err
+}
+
+func appliedVersions(ctx context.Context, db *pgxpool.Pool) (map[string]bool, error) {
+	rows, err := db.Query(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// Migrate applies every embedded migration that hasn't been recorded in
+// schema_migrations, each in its own transaction.
+func Migrate(ctx context.Context, db *pgxpool.Pool) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, m.SQL); err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("migration %s failed: %w", m.Version, err)
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, m.Version); err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("failed to record migration %s: %w", m.Version, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to commit migration %s: %w", m.Version, err)
+		}
+
+		log.Printf("Applied migration %s", m.Version)
+	}
+
+	return nil
+}
+
+// PendingMigrations lists embedded migrations not yet applied to the database.
+func PendingMigrations(ctx context.Context, db *pgxpool.Pool) ([]string, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	if err := db.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+
+	applied := map[string]bool{}
+	if exists {
+		if applied, err = appliedVersions(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+
+	var pending []string
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m.Version)
+		}
+	}
+	return pending, nil
+}
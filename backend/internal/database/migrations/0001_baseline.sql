@@ -0,0 +1,51 @@
+-- Baseline of the tables that existed before migrations were tracked.
+-- IF NOT EXISTS keeps this a no-op on databases created by hand.
+
+CREATE TABLE IF NOT EXISTS users (
+    id             UUID PRIMARY KEY,
+    clerk_id       TEXT NOT NULL UNIQUE,
+    email          TEXT NOT NULL,
+    username       TEXT NOT NULL,
+    first_name     TEXT NOT NULL DEFAULT '',
+    last_name      TEXT NOT NULL DEFAULT '',
+    image_url      TEXT,
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS friendships (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    friend_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status     TEXT NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, friend_id)
+);
+
+CREATE TABLE IF NOT EXISTS devices (
+    id            TEXT PRIMARY KEY,
+    owner_id      UUID REFERENCES users(id) ON DELETE CASCADE,
+    friendly_name TEXT NOT NULL DEFAULT '',
+    is_online     BOOLEAN NOT NULL DEFAULT FALSE,
+    last_seen     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    local_ip      TEXT NOT NULL DEFAULT '',
+    version       TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_devices_owner_id ON devices(owner_id);
+
+CREATE TABLE IF NOT EXISTS file_metadata (
+    id         BIGSERIAL PRIMARY KEY,
+    device_id  TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    file_name  TEXT NOT NULL,
+    file_path  TEXT NOT NULL,
+    file_type  TEXT NOT NULL DEFAULT '',
+    file_size  BIGINT NOT NULL DEFAULT 0,
+    is_starred BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_metadata_device_id ON file_metadata(device_id);
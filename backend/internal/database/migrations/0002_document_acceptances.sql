@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS document_acceptances (
+    user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    document    TEXT NOT NULL,
+    version     TEXT NOT NULL,
+    accepted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ip_address  TEXT NOT NULL DEFAULT '',
+    user_agent  TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (user_id, document, version)
+);
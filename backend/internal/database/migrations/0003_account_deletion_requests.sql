@@ -0,0 +1,22 @@
+-- Keyed by clerk_id rather than a users FK so the row survives the deletion it
+-- records.
+CREATE TABLE IF NOT EXISTS account_deletion_requests (
+    id                UUID PRIMARY KEY,
+    clerk_id          TEXT NOT NULL,
+    email             TEXT NOT NULL,
+    status            TEXT NOT NULL DEFAULT 'pending_verification',
+    code_hash         TEXT NOT NULL,
+    code_expires_at   TIMESTAMPTZ NOT NULL,
+    attempts          INT NOT NULL DEFAULT 0,
+    cancel_token_hash TEXT NOT NULL DEFAULT '',
+    scheduled_for     TIMESTAMPTZ,
+    completed_at      TIMESTAMPTZ,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_deletion_requests_due
+    ON account_deletion_requests(scheduled_for) WHERE status = 'scheduled';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_deletion_requests_active
+    ON account_deletion_requests(clerk_id) WHERE status = 'scheduled';
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id           UUID PRIMARY KEY,
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status       TEXT NOT NULL DEFAULT 'queued',
+    file_size    BIGINT NOT NULL DEFAULT 0,
+    error        TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at   TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    expires_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_user_id ON export_jobs(user_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_queued
+    ON export_jobs(created_at) WHERE status = 'queued';
+
+-- One export in flight per user; repeated requests return the active job
+CREATE UNIQUE INDEX IF NOT EXISTS idx_export_jobs_active
+    ON export_jobs(user_id) WHERE status IN ('queued', 'running');
@@ -0,0 +1,48 @@
+-- Users without a row are on the free plan.
+CREATE TABLE IF NOT EXISTS subscriptions (
+    user_id              UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    plan                 TEXT NOT NULL DEFAULT 'free',
+    status               TEXT NOT NULL DEFAULT 'active',
+    current_period_end   TIMESTAMPTZ,
+    cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at           TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Secret the device authenticates with once paired, stored hashed
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS token_hash TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS device_pairings (
+    id         UUID PRIMARY KEY,
+    device_id  TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    code_hash  TEXT NOT NULL UNIQUE,
+    token_hash TEXT NOT NULL,
+    status     TEXT NOT NULL DEFAULT 'pending',
+    expires_at TIMESTAMPTZ NOT NULL,
+    claimed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    claimed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_pairings_device_id ON device_pairings(device_id);
+
+CREATE TABLE IF NOT EXISTS shares (
+    id         UUID PRIMARY KEY,
+    device_id  TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    owner_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind       TEXT NOT NULL,
+    grantee_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT UNIQUE,
+    path       TEXT NOT NULL DEFAULT '/',
+    permission TEXT NOT NULL DEFAULT 'read',
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((kind = 'user' AND grantee_id IS NOT NULL) OR (kind = 'link' AND token_hash IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_shares_device_id ON shares(device_id);
+CREATE INDEX IF NOT EXISTS idx_shares_owner_id ON shares(owner_id);
+CREATE INDEX IF NOT EXISTS idx_shares_grantee_id ON shares(grantee_id) WHERE grantee_id IS NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shares_user_path
+    ON shares(device_id, grantee_id, path) WHERE kind = 'user';
@@ -0,0 +1,35 @@
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT '';
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS provider_customer_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS provider_subscription_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_provider_subscription
+    ON subscriptions(provider, provider_subscription_id) WHERE provider_subscription_id IS NOT NULL;
+
+-- Orders outlive the buyer's account: they are accounting records.
+CREATE TABLE IF NOT EXISTS orders (
+    id                   UUID PRIMARY KEY,
+    user_id              UUID REFERENCES users(id) ON DELETE SET NULL,
+    email                TEXT NOT NULL,
+    provider             TEXT NOT NULL,
+    provider_checkout_id TEXT NOT NULL,
+    provider_payment_id  TEXT NOT NULL DEFAULT '',
+    status               TEXT NOT NULL DEFAULT 'paid',
+    amount_total         BIGINT NOT NULL,
+    amount_refunded      BIGINT NOT NULL DEFAULT 0,
+    currency             TEXT NOT NULL,
+    created_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, provider_checkout_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders(user_id);
+CREATE INDEX IF NOT EXISTS idx_orders_payment ON orders(provider, provider_payment_id);
+
+-- Providers deliver at least once; processed event IDs make handling idempotent
+CREATE TABLE IF NOT EXISTS payment_events (
+    provider    TEXT NOT NULL,
+    event_id    TEXT NOT NULL,
+    type        TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, event_id)
+);
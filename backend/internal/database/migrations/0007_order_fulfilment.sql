@@ -0,0 +1,34 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_status TEXT NOT NULL DEFAULT 'pending';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS carrier TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tracking_number TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipped_at TIMESTAMPTZ;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS order_items (
+    id          BIGSERIAL PRIMARY KEY,
+    order_id    UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    sku         TEXT NOT NULL,
+    name        TEXT NOT NULL DEFAULT '',
+    quantity    INT NOT NULL,
+    unit_amount BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
+
+-- One row per shipped unit, recorded at fulfilment. device_id is set when the
+-- unit is paired.
+CREATE TABLE IF NOT EXISTS order_units (
+    serial     TEXT PRIMARY KEY,
+    order_id   UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    item_id    BIGINT NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    device_id  TEXT REFERENCES devices(id) ON DELETE SET NULL,
+    paired_at  TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_units_order_id ON order_units(order_id);
+
+-- Reported by the device when it asks for a pairing code
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS serial TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_devices_serial ON devices(serial) WHERE serial <> '';
@@ -0,0 +1,18 @@
+-- Downloadable artifacts. Files live under ./assets/releases and are served
+-- by the static file server; the row is what makes a file a release.
+CREATE TABLE IF NOT EXISTS releases (
+    id         UUID PRIMARY KEY,
+    product    TEXT NOT NULL,
+    version    TEXT NOT NULL,
+    channel    TEXT NOT NULL,
+    platform   TEXT NOT NULL,
+    filename   TEXT NOT NULL,
+    size       BIGINT NOT NULL,
+    sha256     TEXT NOT NULL,
+    signature  TEXT NOT NULL DEFAULT '',
+    notes      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (product, platform, channel, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_releases_lookup ON releases(product, platform, channel);
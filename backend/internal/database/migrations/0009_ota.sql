@@ -0,0 +1,33 @@
+-- Admin-assigned group for targeting rollouts, e.g. 'internal' or 'early-access'
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS cohort TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS rollouts (
+    id                UUID PRIMARY KEY,
+    release_id        UUID NOT NULL REFERENCES releases(id) ON DELETE CASCADE,
+    percentage        INT NOT NULL CHECK (percentage BETWEEN 0 AND 100),
+    cohort            TEXT NOT NULL DEFAULT '',
+    status            TEXT NOT NULL DEFAULT 'active',
+    failure_threshold DOUBLE PRECISION NOT NULL,
+    min_reports       INT NOT NULL,
+    halted_reason     TEXT NOT NULL DEFAULT '',
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rollouts_active ON rollouts(release_id) WHERE status = 'active';
+
+-- Progress of one device through one rollout, as reported by the device
+CREATE TABLE IF NOT EXISTS device_updates (
+    device_id  TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    rollout_id UUID NOT NULL REFERENCES rollouts(id) ON DELETE CASCADE,
+    state      TEXT NOT NULL DEFAULT 'pending',
+    error      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (device_id, rollout_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_updates_rollout ON device_updates(rollout_id, state);
+
+-- Device-facing endpoints authenticate by token from here on
+CREATE INDEX IF NOT EXISTS idx_devices_token_hash ON devices(token_hash) WHERE token_hash <> '';
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS device_commands (
+    id           UUID PRIMARY KEY,
+    device_id    TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    issued_by    UUID REFERENCES users(id) ON DELETE SET NULL,
+    type         TEXT NOT NULL,
+    params       JSONB NOT NULL DEFAULT '{}',
+    status       TEXT NOT NULL DEFAULT 'queued',
+    result       JSONB,
+    error        TEXT NOT NULL DEFAULT '',
+    attempts     INT NOT NULL DEFAULT 0,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ,
+    acked_at     TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    expires_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_commands_device ON device_commands(device_id, created_at DESC);
+
+-- Commands the device still has to pick up, or pick up again
+CREATE INDEX IF NOT EXISTS idx_device_commands_pending
+    ON device_commands(device_id, created_at) WHERE status IN ('queued', 'delivered');
@@ -0,0 +1,11 @@
+-- Bytes relayed to and from each device per calendar month (UTC). Rows
+-- belong to the owner at the time, so unpairing a device doesn't reset the
+-- owner's usage.
+CREATE TABLE IF NOT EXISTS relay_usage (
+    user_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id TEXT NOT NULL,
+    month     DATE NOT NULL,
+    bytes_in  BIGINT NOT NULL DEFAULT 0,
+    bytes_out BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, device_id, month)
+);
@@ -0,0 +1,17 @@
+-- Connection attempts between a client and a device, and the path each one
+-- ended up using
+CREATE TABLE IF NOT EXISTS p2p_sessions (
+    id                UUID PRIMARY KEY,
+    device_id         TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    user_id           UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_candidates JSONB NOT NULL DEFAULT '[]',
+    device_candidates JSONB NOT NULL DEFAULT '[]',
+    status            TEXT NOT NULL DEFAULT 'pending',
+    path              TEXT NOT NULL DEFAULT '',
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    answered_at       TIMESTAMPTZ,
+    completed_at      TIMESTAMPTZ,
+    expires_at        TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_p2p_sessions_device ON p2p_sessions(device_id, created_at DESC);
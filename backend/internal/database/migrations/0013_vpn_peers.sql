@@ -0,0 +1,23 @@
+-- WireGuard peers of the managed VPN: one per device that joined it, and one
+-- per user client of a device. Revoked peers stay for the record, but their
+-- addresses and keys are free again.
+CREATE TABLE IF NOT EXISTS vpn_peers (
+    id          UUID PRIMARY KEY,
+    device_id   TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    user_id     UUID REFERENCES users(id) ON DELETE CASCADE,
+    kind        TEXT NOT NULL CHECK (kind IN ('device', 'client')),
+    public_key  TEXT NOT NULL,
+    -- Only for clients, whose keys the portal generates so their config can
+    -- be downloaded again
+    private_key TEXT,
+    address     TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at  TIMESTAMPTZ,
+    CHECK ((kind = 'client') = (user_id IS NOT NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_vpn_peers_device ON vpn_peers(device_id) WHERE kind = 'device' AND revoked_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_vpn_peers_client ON vpn_peers(device_id, user_id) WHERE kind = 'client' AND revoked_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_vpn_peers_address ON vpn_peers(address) WHERE revoked_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_vpn_peers_public_key ON vpn_peers(public_key) WHERE revoked_at IS NULL;
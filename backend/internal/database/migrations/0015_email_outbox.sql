@@ -0,0 +1,29 @@
+-- Emails waiting to be sent. Rows are written in the transaction of the
+-- change they are about, and bodies are cleared once sent since some carry
+-- one-time codes and links.
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id              UUID PRIMARY KEY,
+    user_id         UUID REFERENCES users(id) ON DELETE CASCADE,
+    template        TEXT NOT NULL,
+    recipient       TEXT NOT NULL,
+    subject         TEXT NOT NULL,
+    text_body       TEXT NOT NULL,
+    html_body       TEXT NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        INT NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_due ON email_outbox(next_attempt_at) WHERE status = 'pending';
+
+-- Users without a row get every email
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id               UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email_shares          BOOLEAN NOT NULL DEFAULT TRUE,
+    email_friend_requests BOOLEAN NOT NULL DEFAULT TRUE,
+    email_device_alerts   BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,48 @@
+-- Latest state of each disk, replaced by every telemetry report
+CREATE TABLE IF NOT EXISTS device_disks (
+    device_id     TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    mountpoint    TEXT NOT NULL DEFAULT '',
+    total_bytes   BIGINT NOT NULL DEFAULT 0,
+    used_bytes    BIGINT NOT NULL DEFAULT 0,
+    smart_status  TEXT NOT NULL DEFAULT 'unknown',
+    smart_message TEXT NOT NULL DEFAULT '',
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (device_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id               UUID PRIMARY KEY,
+    user_id          UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id        TEXT REFERENCES devices(id) ON DELETE CASCADE,
+    kind             TEXT NOT NULL,
+    threshold        INT NOT NULL DEFAULT 0,
+    cooldown_minutes INT NOT NULL DEFAULT 60,
+    notify           BOOLEAN NOT NULL DEFAULT TRUE,
+    email            BOOLEAN NOT NULL DEFAULT TRUE,
+    enabled          BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_rules_user ON alert_rules(user_id);
+
+-- History of alerts per device. Alerts outlive their rule so the history
+-- stays complete, and belong to the user so a new owner of the device
+-- doesn't see them.
+CREATE TABLE IF NOT EXISTS device_alerts (
+    id           UUID PRIMARY KEY,
+    rule_id      UUID REFERENCES alert_rules(id) ON DELETE SET NULL,
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id    TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    kind         TEXT NOT NULL,
+    subject      TEXT NOT NULL DEFAULT '',
+    message      TEXT NOT NULL,
+    triggered_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_alerts_device ON device_alerts(device_id, user_id, triggered_at DESC);
+CREATE INDEX IF NOT EXISTS idx_device_alerts_cooldown ON device_alerts(rule_id, device_id, subject, triggered_at DESC);
+-- At most one open alert per rule, device and subject
+CREATE UNIQUE INDEX IF NOT EXISTS idx_device_alerts_open ON device_alerts(rule_id, device_id, subject) WHERE resolved_at IS NULL;
@@ -0,0 +1,20 @@
+-- Invitations emailed to people who aren't users yet. They become
+-- friendships when an account is created for the email, or when the
+-- invitee opens the signed link while signed in.
+CREATE TABLE IF NOT EXISTS friend_invites (
+    id          UUID PRIMARY KEY,
+    inviter_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email       TEXT NOT NULL,
+    status      TEXT NOT NULL DEFAULT 'pending',
+    accepted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Inviting the same email again renews the pending invite
+CREATE UNIQUE INDEX IF NOT EXISTS idx_friend_invites_pending ON friend_invites(inviter_id, LOWER(email)) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_friend_invites_email ON friend_invites(LOWER(email)) WHERE status = 'pending';
+
+-- Friend requests are looked up from both sides
+CREATE INDEX IF NOT EXISTS idx_friendships_friend ON friendships(friend_id);
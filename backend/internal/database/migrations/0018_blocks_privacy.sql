@@ -0,0 +1,21 @@
+-- Users a user has blocked. Blocks hide both users from each other's
+-- searches and lookups, so neither can send the other requests or shares.
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked ON user_blocks(blocked_id);
+
+-- Users without a row can be found by username and by email
+CREATE TABLE IF NOT EXISTS privacy_settings (
+    user_id                  UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    discoverable_by_username BOOLEAN NOT NULL DEFAULT TRUE,
+    discoverable_by_email    BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at               TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_username_lower ON users(LOWER(username) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users(LOWER(email));
@@ -0,0 +1,4 @@
+-- Unpaired devices used to be matched to orders by whatever serial they
+-- reported. Forget those serials; devices report them again, with the proof
+-- provisioned at the factory, the next time they ask for a pairing code.
+UPDATE devices SET serial = '' WHERE owner_id IS NULL AND serial <> '';
@@ -0,0 +1,7 @@
+-- Where each release's file lives below the releases directory. New uploads
+-- get a directory per release, so releases of the same version on different
+-- channels can't overwrite each other's files.
+ALTER TABLE releases ADD COLUMN IF NOT EXISTS path TEXT NOT NULL DEFAULT '';
+
+UPDATE releases SET path = product || '/' || version || '/' || platform || '/' || filename
+WHERE path = '';
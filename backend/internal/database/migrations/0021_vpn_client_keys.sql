@@ -0,0 +1,4 @@
+-- Client private keys were kept so configs could be downloaded again. Configs
+-- are now shown once and re-issued by rotating the key, so drop the stored
+-- keys; configs already downloaded keep working.
+ALTER TABLE vpn_peers DROP COLUMN IF EXISTS private_key;
@@ -0,0 +1,8 @@
+-- Providers don't deliver events in order. The creation time of the last
+-- event applied to a subscription lets older events arriving late be skipped,
+-- and the invoice that paid for the current period lets its refund end it.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS provider_event_at TIMESTAMPTZ;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS provider_invoice_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_provider_invoice
+    ON subscriptions(provider, provider_invoice_id) WHERE provider_invoice_id IS NOT NULL;
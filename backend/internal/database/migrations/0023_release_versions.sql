@@ -0,0 +1,21 @@
+-- Versions were stored as uploaded, so "v1.2.3" and "1.2.3" could be
+-- published side by side. Fold each such pair into the release published
+-- first, moving the other's rollouts over, and store versions without the
+-- prefix from here on.
+UPDATE rollouts r SET release_id = k.id
+FROM releases l
+JOIN releases k ON k.product = l.product AND k.platform = l.platform AND k.channel = l.channel
+    AND k.id <> l.id AND ltrim(k.version, 'v') = ltrim(l.version, 'v')
+    AND (k.created_at, k.id) < (l.created_at, l.id)
+WHERE r.release_id = l.id;
+
+DELETE FROM releases l
+USING releases k
+WHERE k.product = l.product AND k.platform = l.platform AND k.channel = l.channel
+    AND k.id <> l.id AND ltrim(k.version, 'v') = ltrim(l.version, 'v')
+    AND (k.created_at, k.id) < (l.created_at, l.id);
+
+UPDATE releases SET version = ltrim(version, 'v') WHERE version LIKE 'v%';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_releases_normalized_version
+    ON releases(product, platform, channel, (ltrim(version, 'v')));
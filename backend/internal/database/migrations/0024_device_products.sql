@@ -0,0 +1,16 @@
+-- Which firmware a device runs decides the releases it is offered, rather
+-- than what it asks for. Devices that were already offered updates keep the
+-- product and platform of the latest one; the rest report theirs when they
+-- next pair or check for an update.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS product TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS platform TEXT NOT NULL DEFAULT '';
+
+UPDATE devices d SET product = latest.product, platform = latest.platform
+FROM (
+    SELECT DISTINCT ON (du.device_id) du.device_id, rel.product, rel.platform
+    FROM device_updates du
+    JOIN rollouts ro ON ro.id = du.rollout_id
+    JOIN releases rel ON rel.id = ro.release_id
+    ORDER BY du.device_id, du.created_at DESC
+) latest
+WHERE d.id = latest.device_id;
@@ -0,0 +1,238 @@
+// Package devicehub keeps the WebSocket control channels of connected devices
+// and lets the rest of the portal push messages down them.
+package devicehub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	pingInterval = 25 * time.Second
+	// pongWait is how long a silent connection survives; it covers two pings
+	pongWait        = 60 * time.Second
+	writeWait       = 10 * time.Second
+	maxMessageBytes = 64 << 10
+	sendBuffer      = 32
+)
+
+var (
+	ErrNotConnected = errors.New("device is not connected")
+	ErrSendBuffer   = errors.New("device is not keeping up with messages")
+	ErrClosing      = errors.New("hub is shutting down")
+)
+
+// Hub tracks at most one connection per device; a reconnecting device
+// replaces its previous connection.
+type Hub struct {
+	mu      sync.Mutex
+	conns   map[string]*Conn
+	closing bool
+	wg      sync.WaitGroup
+}
+
+func New() *Hub {
+	return &Hub{
+		conns: make(map[string]*Conn),
+	}
+}
+
+// Attach registers ws as the device's connection. Every attached connection
+// must be passed to Detach once served.
+func (h *Hub) Attach(deviceID string, ws *websocket.Conn) (*Conn, error) {
+	c := &Conn{
+		DeviceID: deviceID,
+		ws:       ws,
+		send:     make(chan *Message, sendBuffer),
+		closed:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return nil, ErrClosing
+	}
+	if old, ok := h.conns[deviceID]; ok {
+		old.Close()
+	}
+	h.conns[deviceID] = c
+	h.wg.Add(1)
+	return c, nil
+}
+
+// Detach forgets c. If c was still the device's current connection, so the
+// device is now disconnected, onLast runs before Run is allowed to return.
+func (h *Hub) Detach(c *Conn, onLast func()) {
+	defer h.wg.Done()
+
+	h.mu.Lock()
+	last := h.conns[c.DeviceID] == c
+	if last {
+		delete(h.conns, c.DeviceID)
+	}
+	h.mu.Unlock()
+
+	if last {
+		onLast()
+	}
+}
+
+// Notify sends a notification to the device if it is connected here.
+func (h *Hub) Notify(deviceID, method string, params any) error {
+	h.mu.Lock()
+	c, ok := h.conns[deviceID]
+	h.mu.Unlock()
+	if !ok {
+		return ErrNotConnected
+	}
+	return c.Notify(method, params)
+}
+
+// Run waits for ctx to be cancelled, then closes every connection and waits
+// until they have been detached.
+func (h *Hub) Run(ctx context.Context) {
+	<-ctx.Done()
+
+	h.mu.Lock()
+	h.closing = true
+	for _, c := range h.conns {
+		c.Close()
+	}
+	h.mu.Unlock()
+
+	h.wg.Wait()
+}
+
+// Conn is one device's control channel. All writes go through a single
+// writer goroutine, as the WebSocket library requires.
+type Conn struct {
+	DeviceID string
+
+	ws        *websocket.Conn
+	send      chan *Message
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Notify queues a notification without waiting for it to be written.
+func (c *Conn) Notify(method string, params any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.enqueue(&Message{JSONRPC: "2.0", Method: method, Params: raw})
+}
+
+func (c *Conn) enqueue(msg *Message) error {
+	select {
+	case <-c.closed:
+		return ErrNotConnected
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return nil
+	default:
+		return ErrSendBuffer
+	}
+}
+
+// Close asks the connection to shut down; Serve then returns.
+func (c *Conn) Close() {
+	c.closeOnce.Do(func() { close(c.closed) })
+}
+
+// Serve runs the connection until it fails or is closed. Requests from the
+// device are answered by handle, one at a time; onPong runs whenever the
+// device answers a ping.
+func (c *Conn) Serve(handle Handler, onPong func()) error {
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		c.writeLoop()
+	}()
+
+	err := c.readLoop(handle, onPong)
+	c.Close()
+	<-writerDone
+	c.ws.Close()
+	return err
+}
+
+func (c *Conn) readLoop(handle Handler, onPong func()) error {
+	c.ws.SetReadLimit(maxMessageBytes)
+	c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	c.ws.SetPongHandler(func(string) error {
+		onPong()
+		return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			select {
+			case <-c.closed:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		var req Message
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.enqueue(&Message{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: CodeParseError, Message: "invalid JSON"}})
+			continue
+		}
+		if req.Method == "" {
+			// Responses to our notifications aren't expected; ignore them
+			continue
+		}
+
+		result, rpcErr := handle(req.Method, req.Params)
+		if len(req.ID) == 0 {
+			continue
+		}
+		resp := &Message{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+		if rpcErr == nil {
+			resp.Result = result
+		}
+		if err := c.enqueue(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Conn) writeLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.ws.WriteJSON(msg); err != nil {
+				c.Close()
+				c.ws.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				c.Close()
+				c.ws.Close()
+				return
+			}
+		case <-c.closed:
+			// Unblocks the reader, which is waiting for the device otherwise
+			c.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+			c.ws.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package devicehub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// pair returns both ends of a real WebSocket connection: the server side the
+// hub serves and the client side playing the device.
+func pair(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		conns <- ws
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return <-conns, client
+}
+
+func echo(method string, params json.RawMessage) (any, *Error) {
+	return method, nil
+}
+
+// serve runs c the way the device handler does, returning Serve's error once
+// the connection has also been detached.
+func serve(h *Hub, c *Conn, onLast func()) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		err := c.Serve(echo, func() {})
+		h.Detach(c, onLast)
+		done <- err
+	}()
+	return done
+}
+
+func readMessage(t *testing.T, client *websocket.Conn) (*Message, error) {
+	t.Helper()
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg Message
+	err := client.ReadJSON(&msg)
+	return &msg, err
+}
+
+func waitFor(t *testing.T, done <-chan error) error {
+	t.Helper()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection still served")
+		return nil
+	}
+}
+
+func TestServeAnswersRequests(t *testing.T) {
+	h := New()
+	server, client := pair(t)
+	c, err := h.Attach("dev-1", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve(h, c, func() {})
+
+	client.WriteJSON(&Message{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: "ping"})
+	resp, err := readMessage(t, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.ID) != "1" || resp.Result != "ping" || resp.Error != nil {
+		t.Errorf("response %+v, want the echoed method for id 1", resp)
+	}
+
+	client.WriteMessage(websocket.TextMessage, []byte("{"))
+	if resp, err = readMessage(t, client); err != nil || resp.Error == nil || resp.Error.Code != CodeParseError {
+		t.Errorf("invalid JSON answered with %+v, %v; want a parse error", resp, err)
+	}
+}
+
+// A reconnecting device replaces its previous connection, which is closed
+// but, no longer being current, doesn't mark the device disconnected.
+func TestAttachReplacesConnection(t *testing.T) {
+	h := New()
+	var disconnects atomic.Int32
+	onLast := func() { disconnects.Add(1) }
+
+	oldServer, oldClient := pair(t)
+	old, err := h.Attach("dev-1", oldServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDone := serve(h, old, onLast)
+
+	newServer, newClient := pair(t)
+	current, err := h.Attach("dev-1", newServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDone := serve(h, current, onLast)
+
+	if err := waitFor(t, oldDone); err != nil {
+		t.Errorf("replaced connection ended with %v, want a clean close", err)
+	}
+	if _, err := readMessage(t, oldClient); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("replaced device read %v, want a normal close", err)
+	}
+	if n := disconnects.Load(); n != 0 {
+		t.Fatalf("detaching the replaced connection ran onLast %d times", n)
+	}
+
+	if err := h.Notify("dev-1", "update.available", map[string]string{"version": "1.2.3"}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := readMessage(t, newClient)
+	if err != nil || msg.Method != "update.available" {
+		t.Fatalf("current device read %+v, %v; want the notification", msg, err)
+	}
+
+	newClient.Close()
+	waitFor(t, newDone)
+	if n := disconnects.Load(); n != 1 {
+		t.Errorf("detaching the current connection ran onLast %d times, want 1", n)
+	}
+	if err := h.Notify("dev-1", "update.available", nil); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("notifying a disconnected device: %v, want ErrNotConnected", err)
+	}
+}
+
+// Run returns only once every connection has been closed and detached, and
+// the hub takes no new ones meanwhile.
+func TestRunDrainsConnections(t *testing.T) {
+	h := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := make(chan struct{})
+	go func() {
+		h.Run(ctx)
+		close(ran)
+	}()
+
+	var detached atomic.Int32
+	var clients []*websocket.Conn
+	for _, id := range []string{"dev-1", "dev-2"} {
+		server, client := pair(t)
+		c, err := h.Attach(id, server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve(h, c, func() {
+			time.Sleep(50 * time.Millisecond)
+			detached.Add(1)
+		})
+		clients = append(clients, client)
+	}
+
+	cancel()
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return")
+	}
+	if n := detached.Load(); n != 2 {
+		t.Errorf("Run returned with %d of 2 connections detached", n)
+	}
+	for i, client := range clients {
+		if _, err := readMessage(t, client); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			t.Errorf("device %d read %v, want a normal close", i+1, err)
+		}
+	}
+
+	server, _ := pair(t)
+	if _, err := h.Attach("dev-3", server); !errors.Is(err, ErrClosing) {
+		t.Errorf("attaching during shutdown: %v, want ErrClosing", err)
+	}
+}
+
+func TestNotifyFullSendBuffer(t *testing.T) {
+	h := New()
+	server, _ := pair(t)
+	// Not served, so nothing drains the send buffer
+	c, err := h.Attach("dev-1", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < sendBuffer; i++ {
+		if err := h.Notify("dev-1", "tick", i); err != nil {
+			t.Fatalf("notification %d: %v", i+1, err)
+		}
+	}
+	if err := h.Notify("dev-1", "tick", sendBuffer); !errors.Is(err, ErrSendBuffer) {
+		t.Errorf("notification over the buffer: %v, want ErrSendBuffer", err)
+	}
+
+	c.Close()
+	if err := c.Notify("tick", nil); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("notifying a closed connection: %v, want ErrNotConnected", err)
+	}
+	h.Detach(c, func() {})
+}
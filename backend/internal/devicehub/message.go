@@ -0,0 +1,33 @@
+package devicehub
+
+import "encoding/json"
+
+// JSON-RPC 2.0 error codes used on the control channel.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// Application errors, from the range JSON-RPC leaves to servers
+	CodeNotFound = -32004
+	CodeConflict = -32009
+)
+
+// Message is a JSON-RPC 2.0 style request, notification (no ID) or response.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Handler answers one request from a device. A nil *Error means success.
+type Handler func(method string, params json.RawMessage) (any, *Error)
@@ -0,0 +1,125 @@
+package documents
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/types/document"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Documents live in content/<slug>/<version>.md with a front matter header:
+//
+//	---
+//	title: Terms of Service
+//	version: 2026-01-01
+//	effective: 2026-01-01
+//	requires_acceptance: true
+//	---
+//
+// Publishing a change means adding a new version file; older versions stay
+// available so acceptances can always be traced to the text that was shown.
+
+//go:embed content/*/*.md
+var content embed.FS
+
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// Load parses and renders every embedded document, grouped by slug and
+// ordered by effective date (oldest first).
+func Load() (map[string][]*document.Document, error) {
+	files, err := fs.Glob(content, "content/*/*.md")
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make(map[string][]*document.Document)
+	for _, file := range files {
+		raw, err := content.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err := parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		doc.Slug = path.Base(path.Dir(file))
+
+		if want := strings.TrimSuffix(path.Base(file), ".md"); doc.Version != want {
+			return nil, fmt.Errorf("%s: version %q does not match file name", file, doc.Version)
+		}
+
+		docs[doc.Slug] = append(docs[doc.Slug], doc)
+	}
+
+	for _, versions := range docs {
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i].EffectiveAt.Before(versions[j].EffectiveAt)
+		})
+	}
+
+	return docs, nil
+}
+
+func parse(raw []byte) (*document.Document, error) {
+	body, ok := bytes.CutPrefix(raw, []byte("---\n"))
+	if !ok {
+		return nil, fmt.Errorf("missing front matter")
+	}
+	header, body, ok := bytes.Cut(body, []byte("\n---\n"))
+	if !ok {
+		return nil, fmt.Errorf("unterminated front matter")
+	}
+
+	doc := &document.Document{Markdown: strings.TrimSpace(string(body))}
+
+	scanner := bufio.NewScanner(bytes.NewReader(header))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "title":
+			doc.Title = value
+		case "version":
+			doc.Version = value
+		case "effective":
+			t, err := time.Parse(time.DateOnly, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid effective date: %w", err)
+			}
+			doc.EffectiveAt = t
+		case "requires_acceptance":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid requires_acceptance: %w", err)
+			}
+			doc.RequiresAcceptance = b
+		}
+	}
+
+	if doc.Title == "" || doc.Version == "" || doc.EffectiveAt.IsZero() {
+		return nil, fmt.Errorf("title, version and effective are required")
+	}
+
+	var html bytes.Buffer
+	if err := markdown.Convert([]byte(doc.Markdown), &html); err != nil {
+		return nil, fmt.Errorf("failed to render markdown: %w", err)
+	}
+	doc.HTML = html.String()
+
+	return doc, nil
+}
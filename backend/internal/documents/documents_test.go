@@ -0,0 +1,61 @@
+package documents
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/strct-org/portal/backend/internal/types/document"
+)
+
+func TestLoad(t *testing.T) {
+	docs, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, slug := range []string{document.PrivacyPolicy, document.TermsOfServices, document.RefundPolicy, document.Pricing} {
+		versions := docs[slug]
+		if len(versions) == 0 {
+			t.Errorf("no versions of %s", slug)
+			continue
+		}
+		for i := 1; i < len(versions); i++ {
+			if versions[i].EffectiveAt.Before(versions[i-1].EffectiveAt) {
+				t.Errorf("%s versions aren't ordered by effective date", slug)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	const header = "title: Terms\nversion: 2026-01-01\neffective: 2026-01-01\n"
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{"valid", "---\n" + header + "requires_acceptance: true\n---\n# Terms\n", ""},
+		{"no front matter", "# Terms\n", "missing front matter"},
+		{"unterminated", "---\n" + header + "# Terms\n", "unterminated front matter"},
+		{"bad date", "---\ntitle: Terms\nversion: 1\neffective: January\n---\n", "invalid effective date"},
+		{"bad flag", "---\n" + header + "requires_acceptance: maybe\n---\n", "invalid requires_acceptance"},
+		{"no title", "---\nversion: 1\neffective: 2026-01-01\n---\n", "required"},
+	}
+
+	for _, tt := range tests {
+		doc, err := parse([]byte(tt.raw))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if doc.Title != "Terms" || !doc.RequiresAcceptance || !strings.Contains(doc.HTML, "<h1>Terms</h1>") {
+			t.Errorf("%s: parsed %+v", tt.name, doc)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Package events fans out per-user events to the dashboard's event streams.
+// It is in-process: a stream only sees events published by its own instance.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types on the stream.
+const (
+	TypeDeviceOnline  = "device.online"
+	TypeDeviceOffline = "device.offline"
+	TypeShareReceived = "share.received"
+	// TypeNotification carries a new inbox notification, and
+	// TypeNotificationsRead the unread count after notifications were read
+	TypeNotification      = "notification.created"
+	TypeNotificationsRead = "notification.read"
+	// TypeAlertTriggered and TypeAlertResolved carry a device alert
+	TypeAlertTriggered = "alert.triggered"
+	TypeAlertResolved  = "alert.resolved"
+	// TypeFriendRequest and TypeFriendAccepted carry the friendship as seen
+	// by the recipient
+	TypeFriendRequest  = "friend.requested"
+	TypeFriendAccepted = "friend.accepted"
+)
+
+const (
+	// retention and bufferSize bound how far back a reconnecting stream can
+	// resume from
+	retention  = 5 * time.Minute
+	bufferSize = 100
+	// subscriberBuffer is how far a stream may fall behind before it is
+	// dropped; the client then reconnects and resumes from the buffer
+	subscriberBuffer = 32
+)
+
+// DeviceStatus is the data of device.online and device.offline events.
+type DeviceStatus struct {
+	DeviceID string    `json:"deviceId"`
+	Online   bool      `json:"online"`
+	At       time.Time `json:"at"`
+}
+
+type Event struct {
+	// ID is "<instance>-<sequence>", so IDs from before a restart are
+	// recognised as unknown rather than confused with new ones
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+	At   time.Time       `json:"at"`
+
+	seq uint64
+}
+
+type subscriber struct {
+	ch chan Event
+}
+
+// buffer holds a user's recent events. dropped is the sequence of the last
+// event removed because the buffer was full or the event expired. A buffer
+// outlives its events so that dropped still tells a reconnecting stream
+// whether it missed any.
+type buffer struct {
+	events  []Event
+	dropped uint64
+}
+
+type Broker struct {
+	instance string
+
+	mu      sync.Mutex
+	seq     uint64
+	buffers map[uuid.UUID]*buffer
+	subs    map[uuid.UUID]map[*subscriber]struct{}
+	closed  bool
+}
+
+func New() *Broker {
+	return &Broker{
+		instance: strconv.FormatInt(time.Now().UnixNano(), 36),
+		buffers:  make(map[uuid.UUID]*buffer),
+		subs:     make(map[uuid.UUID]map[*subscriber]struct{}),
+	}
+}
+
+// Publish sends an event to the user's streams and keeps it for resumption.
+// data is marshalled to JSON; events that can't be are dropped.
+func (b *Broker) Publish(userID uuid.UUID, typ string, data any) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.seq++
+	ev := Event{
+		ID:   fmt.Sprintf("%s-%d", b.instance, b.seq),
+		Type: typ,
+		Data: raw,
+		At:   time.Now(),
+		seq:  b.seq,
+	}
+
+	buf := b.buffers[userID]
+	if buf == nil {
+		buf = &buffer{}
+		b.buffers[userID] = buf
+	}
+	buf.events = append(buf.events, ev)
+	if n := len(buf.events) - bufferSize; n > 0 {
+		buf.dropped = buf.events[n-1].seq
+		buf.events = append([]Event(nil), buf.events[n:]...)
+	}
+
+	for sub := range b.subs[userID] {
+		select {
+		case sub.ch <- ev:
+		default:
+			b.drop(userID, sub)
+		}
+	}
+}
+
+// Subscribe opens a stream of the user's events. When lastEventID is set,
+// the events after it are replayed first; complete is false when some of
+// them are no longer retained, so the client should refetch its state.
+// The channel is closed when the stream falls behind or the broker shuts
+// down; cancel must be called either way.
+func (b *Broker) Subscribe(userID uuid.UUID, lastEventID string) (replay []Event, events <-chan Event, complete bool, cancel func()) {
+	sub := &subscriber{ch: make(chan Event, subscriberBuffer)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if lastEventID != "" {
+		replay, complete = b.since(userID, lastEventID)
+	}
+
+	if b.closed {
+		close(sub.ch)
+	} else {
+		if b.subs[userID] == nil {
+			b.subs[userID] = make(map[*subscriber]struct{})
+		}
+		b.subs[userID][sub] = struct{}{}
+	}
+
+	return replay, sub.ch, complete, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[userID][sub]; ok {
+			b.drop(userID, sub)
+		}
+	}
+}
+
+// since returns the retained events after lastEventID, and whether none
+// after it were pruned.
+func (b *Broker) since(userID uuid.UUID, lastEventID string) ([]Event, bool) {
+	var events []Event
+	var dropped uint64
+	if buf := b.buffers[userID]; buf != nil {
+		events, dropped = buf.events, buf.dropped
+	}
+
+	instance, rawSeq, _ := strings.Cut(lastEventID, "-")
+	seq, err := strconv.ParseUint(rawSeq, 10, 64)
+	if err != nil || instance != b.instance || seq > b.seq {
+		return append([]Event(nil), events...), false
+	}
+
+	complete := seq >= dropped
+	for i, ev := range events {
+		if ev.seq > seq {
+			return append([]Event(nil), events[i:]...), complete
+		}
+	}
+	return nil, complete
+}
+
+// drop must be called with b.mu held.
+func (b *Broker) drop(userID uuid.UUID, sub *subscriber) {
+	delete(b.subs[userID], sub)
+	if len(b.subs[userID]) == 0 {
+		delete(b.subs, userID)
+	}
+	close(sub.ch)
+}
+
+// Close ends every stream and refuses new ones. Call it when the server
+// starts shutting down: streams never finish on their own, so
+// http.Server.Shutdown would otherwise wait for them until it times out.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for userID, subs := range b.subs {
+		for sub := range subs {
+			b.drop(userID, sub)
+		}
+	}
+}
+
+// Run prunes expired events until ctx is cancelled, then closes the broker.
+func (b *Broker) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			b.Close()
+			return
+		case <-ticker.C:
+			b.prune(time.Now().Add(-retention))
+		}
+	}
+}
+
+func (b *Broker) prune(cutoff time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, buf := range b.buffers {
+		i := 0
+		for i < len(buf.events) && buf.events[i].At.Before(cutoff) {
+			buf.dropped = buf.events[i].seq
+			i++
+		}
+		if i > 0 {
+			buf.events = append([]Event(nil), buf.events[i:]...)
+		}
+	}
+}
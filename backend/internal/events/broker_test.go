@@ -0,0 +1,137 @@
+package events
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCloseEndsStreams(t *testing.T) {
+	b := New()
+	user := uuid.New()
+
+	_, events, _, cancel := b.Subscribe(user, "")
+	defer cancel()
+
+	b.Close()
+	if _, ok := <-events; ok {
+		t.Fatal("stream still open after Close")
+	}
+
+	b.Publish(user, TypeDeviceOnline, nil)
+	_, late, _, cancelLate := b.Subscribe(user, "")
+	defer cancelLate()
+	if _, ok := <-late; ok {
+		t.Fatal("stream opened after Close isn't closed")
+	}
+	// Closing twice, as Run does after the server's shutdown hook, is fine
+	b.Close()
+}
+
+func TestSubscribeResumes(t *testing.T) {
+	b := New()
+	user := uuid.New()
+	for i := 0; i < 3; i++ {
+		b.Publish(user, TypeNotification, i)
+	}
+	b.Publish(uuid.New(), TypeNotification, "someone else's")
+
+	_, events, _, cancel := b.Subscribe(user, "")
+	b.Publish(user, TypeNotification, 3)
+	latest := <-events
+	cancel()
+
+	first := fmt.Sprintf("%s-1", b.instance)
+	tests := []struct {
+		name         string
+		lastEventID  string
+		wantReplay   int
+		wantComplete bool
+	}{
+		{"fresh stream", "", 0, true},
+		{"after the first", first, 3, true},
+		{"up to date", latest.ID, 0, true},
+		{"from before a restart", "old-2", 4, false},
+		{"malformed", "nonsense", 4, false},
+		{"from the future", fmt.Sprintf("%s-99", b.instance), 4, false},
+	}
+
+	for _, tt := range tests {
+		replay, _, complete, cancel := b.Subscribe(user, tt.lastEventID)
+		cancel()
+		if len(replay) != tt.wantReplay || complete != tt.wantComplete {
+			t.Errorf("%s: replayed %d, complete %v; want %d, %v", tt.name, len(replay), complete, tt.wantReplay, tt.wantComplete)
+		}
+	}
+}
+
+func TestResumeAfterPruning(t *testing.T) {
+	b := New()
+	user := uuid.New()
+	for i := 0; i < bufferSize+10; i++ {
+		b.Publish(user, TypeNotification, i)
+	}
+
+	// The first 10 events fell out of the buffer
+	replay, _, complete, cancel := b.Subscribe(user, fmt.Sprintf("%s-5", b.instance))
+	cancel()
+	if complete || len(replay) != bufferSize {
+		t.Fatalf("replayed %d, complete %v; want %d, false", len(replay), complete, bufferSize)
+	}
+
+	b.prune(time.Now().Add(time.Second))
+	replay, _, complete, cancel = b.Subscribe(user, fmt.Sprintf("%s-%d", b.instance, bufferSize+5))
+	cancel()
+	if complete || len(replay) != 0 {
+		t.Fatalf("after expiry replayed %d, complete %v; want 0, false", len(replay), complete)
+	}
+}
+
+// Expiry is tracked per user: pruning one user's events doesn't make other
+// users' streams resync, and a user whose events all expired still does.
+func TestPruningIsPerUser(t *testing.T) {
+	b := New()
+	quiet, busy := uuid.New(), uuid.New()
+
+	b.Publish(quiet, TypeNotification, "seen")
+	seen := fmt.Sprintf("%s-%d", b.instance, b.seq)
+	b.Publish(busy, TypeNotification, "old")
+	missed := fmt.Sprintf("%s-%d", b.instance, b.seq)
+	b.Publish(busy, TypeNotification, "expires unseen")
+
+	b.prune(time.Now().Add(time.Second))
+	b.Publish(busy, TypeNotification, "new")
+
+	replay, _, complete, cancel := b.Subscribe(quiet, seen)
+	cancel()
+	if !complete || len(replay) != 0 {
+		t.Errorf("quiet user replayed %d, complete %v; want 0, true", len(replay), complete)
+	}
+
+	replay, _, complete, cancel = b.Subscribe(busy, missed)
+	cancel()
+	if complete || len(replay) != 1 {
+		t.Errorf("busy user replayed %d, complete %v; want 1, false", len(replay), complete)
+	}
+}
+
+func TestSlowStreamIsDropped(t *testing.T) {
+	b := New()
+	user := uuid.New()
+	_, events, _, cancel := b.Subscribe(user, "")
+	defer cancel()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(user, TypeNotification, i)
+	}
+
+	n := 0
+	for range events {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("received %d events before the stream closed, want %d", n, subscriberBuffer)
+	}
+}
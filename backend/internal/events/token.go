@@ -0,0 +1,97 @@
+package events
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// minKeySize is the shortest EVENTS_SIGNING_KEY accepted, in bytes.
+const minKeySize = 32
+
+var (
+	ErrInvalidToken = errors.New("invalid stream token")
+	ErrExpiredToken = errors.New("stream token has expired")
+)
+
+// StreamToken opens the user's event stream from a browser, whose
+// EventSource can't send an Authorization header.
+type StreamToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// TokenSigner issues and verifies stream tokens of the form
+// <payload>.<HMAC-SHA256>, where the payload is the expiry and the user's
+// Clerk ID. They are signed with a key of their own, so they open nothing
+// but the stream.
+type TokenSigner struct {
+	key []byte
+}
+
+func NewTokenSigner(key []byte) *TokenSigner {
+	return &TokenSigner{key: key}
+}
+
+// TokenSignerFromEnv reads EVENTS_SIGNING_KEY, a base64 key of at least 32
+// bytes. It returns nil when the key is missing or invalid, which leaves the
+// stream reachable only with a Bearer token.
+func TokenSignerFromEnv() *TokenSigner {
+	raw := os.Getenv("EVENTS_SIGNING_KEY")
+	if raw == "" {
+		log.Println("WARNING: EVENTS_SIGNING_KEY not set. Browsers can't open the event stream")
+		return nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(key) < minKeySize {
+		log.Printf("WARNING: EVENTS_SIGNING_KEY must be a base64 key of at least %d bytes. Browsers can't open the event stream", minKeySize)
+		return nil
+	}
+	return NewTokenSigner(key)
+}
+
+// Sign returns a token opening clerkID's stream until expires.
+func (s *TokenSigner) Sign(clerkID string, expires time.Time) string {
+	payload := binary.BigEndian.AppendUint64(nil, uint64(expires.Unix()))
+	payload = append(payload, clerkID...)
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.mac(payload))
+}
+
+// Verify returns the Clerk ID in token if its signature is valid and it
+// hasn't expired at now.
+func (s *TokenSigner) Verify(token string, now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	rawPayload, rawSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	payload, err := enc.DecodeString(rawPayload)
+	if err != nil || len(payload) <= 8 {
+		return "", ErrInvalidToken
+	}
+	sig, err := enc.DecodeString(rawSig)
+	if err != nil || !hmac.Equal(sig, s.mac(payload)) {
+		return "", ErrInvalidToken
+	}
+
+	expires := time.Unix(int64(binary.BigEndian.Uint64(payload[:8])), 0)
+	if !now.Before(expires) {
+		return "", ErrExpiredToken
+	}
+	return string(payload[8:]), nil
+}
+
+func (s *TokenSigner) mac(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
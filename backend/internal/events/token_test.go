@@ -0,0 +1,48 @@
+package events
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	s := NewTokenSigner([]byte(strings.Repeat("k", minKeySize)))
+	now := time.Now()
+	token := s.Sign("user_1", now.Add(time.Minute))
+
+	got, err := s.Verify(token, now)
+	if err != nil || got != "user_1" {
+		t.Fatalf("Verify = %q, %v; want user_1", got, err)
+	}
+	if _, err := s.Verify(token, now.Add(time.Minute)); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Verify after expiry: %v, want ErrExpiredToken", err)
+	}
+}
+
+func TestTokenRejectsForgedTokens(t *testing.T) {
+	s := NewTokenSigner([]byte(strings.Repeat("k", minKeySize)))
+	other := NewTokenSigner([]byte(strings.Repeat("o", minKeySize)))
+	now := time.Now()
+	token := s.Sign("user_1", now.Add(time.Minute))
+	payload, sig, _ := strings.Cut(token, ".")
+
+	// Another user's token under the original signature
+	swapped, _, _ := strings.Cut(s.Sign("user_2", now.Add(time.Minute)), ".")
+
+	tests := map[string]string{
+		"other key":     other.Sign("user_1", now.Add(time.Minute)),
+		"no user":       s.Sign("", now.Add(time.Minute)),
+		"swapped":       swapped + "." + sig,
+		"no signature":  payload,
+		"bad encoding":  payload + ".!!",
+		"short payload": payload[:6] + "." + sig,
+		"empty":         "",
+	}
+	for name, token := range tests {
+		if _, err := s.Verify(token, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: Verify = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/templates"
+)
+
+// AccountDeletionHandler serves the public, server-rendered deletion pages that
+// app stores require, for users who may no longer have the app installed.
+type AccountDeletionHandler struct {
+	deletionService *services.AccountDeletionService
+}
+
+func NewAccountDeletionHandler(deletionService *services.AccountDeletionService) *AccountDeletionHandler {
+	return &AccountDeletionHandler{
+		deletionService: deletionService,
+	}
+}
+
+type deletionPage struct {
+	Step         string
+	Email        string
+	RequestID    string
+	Token        string
+	ScheduledFor *time.Time
+	Grace        string
+	Error        string
+}
+
+func (h *AccountDeletionHandler) render(w http.ResponseWriter, code int, page deletionPage) {
+	page.Grace = humanDuration(h.deletionService.GracePeriod())
+	w.Header().Set("Cache-Control", "no-store")
+	templates.Render(w, code, "delete_account.html", page)
+}
+
+func (h *AccountDeletionHandler) DeleteAccountPage(w http.ResponseWriter, r *http.Request) {
+	h.render(w, http.StatusOK, deletionPage{Step: "form"})
+}
+
+func (h *AccountDeletionHandler) DeleteAccountDetailsPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	templates.Render(w, http.StatusOK, "delete_account_details.html", deletionPage{
+		Grace: humanDuration(h.deletionService.GracePeriod()),
+	})
+}
+
+func (h *AccountDeletionHandler) RequestDeletion(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	if _, err := mail.ParseAddress(email); err != nil {
+		h.render(w, http.StatusBadRequest, deletionPage{Step: "form", Email: email, Error: "Enter a valid email address."})
+		return
+	}
+
+	id, err := h.deletionService.RequestDeletion(ctx, email)
+	if err != nil {
+		log.Printf("Error creating deletion request: %v", err)
+		h.render(w, http.StatusInternalServerError, deletionPage{Step: "form", Email: email, Error: "Something went wrong. Please try again."})
+		return
+	}
+
+	h.render(w, http.StatusOK, deletionPage{Step: "verify", Email: email, RequestID: id.String()})
+}
+
+func (h *AccountDeletionHandler) VerifyDeletion(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	rawID := r.PostFormValue("request")
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		h.render(w, http.StatusBadRequest, deletionPage{Step: "form", Error: "This link is invalid. Start again."})
+		return
+	}
+
+	req, err := h.deletionService.Verify(ctx, id, strings.TrimSpace(r.PostFormValue("code")))
+	switch {
+	case errors.Is(err, services.ErrInvalidDeletionCode):
+		h.render(w, http.StatusUnprocessableEntity, deletionPage{Step: "verify", RequestID: rawID, Error: "That code is invalid or has expired."})
+		return
+	case errors.Is(err, services.ErrDeletionNotPending):
+		h.render(w, http.StatusConflict, deletionPage{Step: "form", Error: "This request was already confirmed. Check your email for the cancellation link."})
+		return
+	case errors.Is(err, services.ErrDeletionAlreadyScheduled):
+		h.render(w, http.StatusConflict, deletionPage{Step: "form", Error: "A deletion is already scheduled for this account. Check your email for details."})
+		return
+	case err != nil:
+		log.Printf("Error verifying deletion request %s: %v", id, err)
+		h.render(w, http.StatusInternalServerError, deletionPage{Step: "verify", RequestID: rawID, Error: "Something went wrong. Please try again."})
+		return
+	}
+
+	h.render(w, http.StatusOK, deletionPage{Step: "scheduled", ScheduledFor: req.ScheduledFor})
+}
+
+// CancelDeletionPage is the target of the emailed link. It only renders a
+// confirmation form so link scanners that GET the URL don't cancel anything.
+func (h *AccountDeletionHandler) CancelDeletionPage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if _, err := uuid.Parse(q.Get("request")); err != nil || q.Get("token") == "" {
+		h.render(w, http.StatusBadRequest, deletionPage{Step: "form", Error: "This cancellation link is invalid."})
+		return
+	}
+
+	h.render(w, http.StatusOK, deletionPage{Step: "cancel", RequestID: q.Get("request"), Token: q.Get("token")})
+}
+
+func (h *AccountDeletionHandler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	id, err := uuid.Parse(r.PostFormValue("request"))
+	if err != nil {
+		h.render(w, http.StatusBadRequest, deletionPage{Step: "form", Error: "This cancellation link is invalid."})
+		return
+	}
+
+	err = h.deletionService.Cancel(ctx, id, r.PostFormValue("token"))
+	switch {
+	case errors.Is(err, services.ErrDeletionRequestNotFound):
+		h.render(w, http.StatusNotFound, deletionPage{Step: "form", Error: "This cancellation link is invalid."})
+		return
+	case errors.Is(err, services.ErrDeletionNotScheduled):
+		h.render(w, http.StatusConflict, deletionPage{Step: "form", Error: "This deletion can no longer be cancelled."})
+		return
+	case err != nil:
+		log.Printf("Error cancelling deletion request %s: %v", id, err)
+		h.render(w, http.StatusInternalServerError, deletionPage{Step: "form", Error: "Something went wrong. Please try again."})
+		return
+	}
+
+	h.render(w, http.StatusOK, deletionPage{Step: "cancelled"})
+}
+
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+}
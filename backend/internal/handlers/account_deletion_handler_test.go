@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/services"
+)
+
+// These requests are rejected before the deletion service touches the
+// database, so they run without one.
+func TestAccountDeletionRejectsInvalidForms(t *testing.T) {
+	h := NewAccountDeletionHandler(services.NewAccountDeletionService(nil, nil, nil, 7*24*time.Hour, "http://localhost"))
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		form    url.Values
+		want    int
+	}{
+		{"request without email", h.RequestDeletion, http.MethodPost, "/", url.Values{}, http.StatusBadRequest},
+		{"request with invalid email", h.RequestDeletion, http.MethodPost, "/", url.Values{"email": {"not-an-email"}}, http.StatusBadRequest},
+		{"verify without request", h.VerifyDeletion, http.MethodPost, "/", url.Values{"code": {"123456"}}, http.StatusBadRequest},
+		{"verify with invalid request", h.VerifyDeletion, http.MethodPost, "/", url.Values{"request": {"nope"}, "code": {"123456"}}, http.StatusBadRequest},
+		{"cancel page without token", h.CancelDeletionPage, http.MethodGet, "/?request=9b2f6f0e-8d1e-4c55-9a43-2f1c3c4b7a10", nil, http.StatusBadRequest},
+		{"cancel page with invalid request", h.CancelDeletionPage, http.MethodGet, "/?request=nope&token=abc", nil, http.StatusBadRequest},
+		{"cancel page", h.CancelDeletionPage, http.MethodGet, "/?request=9b2f6f0e-8d1e-4c55-9a43-2f1c3c4b7a10&token=abc", nil, http.StatusOK},
+		{"cancel with invalid request", h.CancelDeletion, http.MethodPost, "/", url.Values{"request": {"nope"}, "token": {"abc"}}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		tt.handler(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("%s: Cache-Control = %q, want no-store", tt.name, got)
+		}
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{7 * 24 * time.Hour, "7 days"},
+		{48 * time.Hour, "2 days"},
+		{47 * time.Hour, "47 hours"},
+		{2 * time.Hour, "2 hours"},
+		{90 * time.Minute, "90 minutes"},
+	}
+
+	for _, tt := range tests {
+		if got := humanDuration(tt.d); got != tt.want {
+			t.Errorf("humanDuration(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
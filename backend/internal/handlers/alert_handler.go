@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/alert"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+const (
+	defaultAlertCooldown = 60
+	// maxAlertMinutes is a week, the longest offline threshold or cooldown
+	maxAlertMinutes = 7 * 24 * 60
+)
+
+type AlertHandler struct {
+	alertService *services.AlertService
+}
+
+func NewAlertHandler(alertService *services.AlertService) *AlertHandler {
+	return &AlertHandler{
+		alertService: alertService,
+	}
+}
+
+func (h *AlertHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	rules, err := h.alertService.ListRules(ctx, clerkID)
+	if err != nil {
+		log.Printf("Error listing alert rules: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list alert rules")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, rules)
+}
+
+func (h *AlertHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req alert.RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := normalizeRuleRequest(&req); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	rule, err := h.alertService.CreateRule(ctx, clerkID, &req)
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating alert rule: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create alert rule")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, rule)
+}
+
+// UpdateRule replaces a rule; fields left out take their defaults, as when
+// creating one.
+func (h *AlertHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Alert rule not found")
+		return
+	}
+
+	var req alert.RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := normalizeRuleRequest(&req); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	rule, err := h.alertService.UpdateRule(ctx, clerkID, id, &req)
+	switch {
+	case errors.Is(err, services.ErrAlertRuleNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Alert rule not found")
+		return
+	case errors.Is(err, services.ErrDeviceNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	case err != nil:
+		log.Printf("Error updating alert rule %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update alert rule")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, rule)
+}
+
+func (h *AlertHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Alert rule not found")
+		return
+	}
+
+	err = h.alertService.DeleteRule(ctx, clerkID, id)
+	if errors.Is(err, services.ErrAlertRuleNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Alert rule not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting alert rule %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete alert rule")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeviceAlerts returns the device's alert history, open alerts included.
+func (h *AlertHandler) ListDeviceAlerts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	alerts, err := h.alertService.ListDeviceAlerts(ctx, clerkID, mux.Vars(r)["id"])
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing device alerts: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list alerts")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, alerts)
+}
+
+// normalizeRuleRequest validates req in place, filling in defaults, and
+// returns why it is invalid, or "".
+func normalizeRuleRequest(req *alert.RuleRequest) string {
+	switch req.Kind {
+	case alert.KindOffline:
+		if req.Threshold < 1 || req.Threshold > maxAlertMinutes {
+			return "threshold must be between 1 and 10080 minutes"
+		}
+	case alert.KindDiskUsage:
+		if req.Threshold < 1 || req.Threshold > 100 {
+			return "threshold must be a percentage between 1 and 100"
+		}
+	case alert.KindSMARTWarning, alert.KindUpdateFailed:
+		req.Threshold = 0
+	default:
+		return "kind must be offline, disk_usage, smart_warning or update_failed"
+	}
+
+	if req.DeviceID != nil && *req.DeviceID == "" {
+		req.DeviceID = nil
+	}
+	if req.CooldownMinutes == nil {
+		cooldown := defaultAlertCooldown
+		req.CooldownMinutes = &cooldown
+	}
+	if *req.CooldownMinutes < 0 || *req.CooldownMinutes > maxAlertMinutes {
+		return "cooldownMinutes must be between 0 and 10080"
+	}
+	for _, b := range []**bool{&req.Notify, &req.Email, &req.Enabled} {
+		if *b == nil {
+			t := true
+			*b = &t
+		}
+	}
+	return ""
+}
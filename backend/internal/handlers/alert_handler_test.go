@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/strct-org/portal/backend/internal/types/alert"
+)
+
+func TestNormalizeRuleRequest(t *testing.T) {
+	intp := func(n int) *int { return &n }
+	strp := func(s string) *string { return &s }
+
+	tests := []struct {
+		name string
+		req  alert.RuleRequest
+		ok   bool
+	}{
+		{"offline", alert.RuleRequest{Kind: alert.KindOffline, Threshold: 15}, true},
+		{"offline a week", alert.RuleRequest{Kind: alert.KindOffline, Threshold: maxAlertMinutes}, true},
+		{"offline without threshold", alert.RuleRequest{Kind: alert.KindOffline}, false},
+		{"offline over a week", alert.RuleRequest{Kind: alert.KindOffline, Threshold: maxAlertMinutes + 1}, false},
+		{"disk usage", alert.RuleRequest{Kind: alert.KindDiskUsage, Threshold: 90}, true},
+		{"disk usage over 100", alert.RuleRequest{Kind: alert.KindDiskUsage, Threshold: 101}, false},
+		{"smart warning", alert.RuleRequest{Kind: alert.KindSMARTWarning, Threshold: 50}, true},
+		{"update failed", alert.RuleRequest{Kind: alert.KindUpdateFailed}, true},
+		{"unknown kind", alert.RuleRequest{Kind: "cpu", Threshold: 50}, false},
+		{"no cooldown", alert.RuleRequest{Kind: alert.KindUpdateFailed, CooldownMinutes: intp(0)}, true},
+		{"negative cooldown", alert.RuleRequest{Kind: alert.KindUpdateFailed, CooldownMinutes: intp(-1)}, false},
+		{"cooldown over a week", alert.RuleRequest{Kind: alert.KindUpdateFailed, CooldownMinutes: intp(maxAlertMinutes + 1)}, false},
+		{"empty device", alert.RuleRequest{Kind: alert.KindUpdateFailed, DeviceID: strp("")}, true},
+	}
+
+	for _, tt := range tests {
+		req := tt.req
+		msg := normalizeRuleRequest(&req)
+		if (msg == "") != tt.ok {
+			t.Errorf("%s: got %q, want ok %v", tt.name, msg, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeRuleRequestDefaults(t *testing.T) {
+	off := false
+	req := alert.RuleRequest{Kind: alert.KindSMARTWarning, Threshold: 50, DeviceID: new(string), Email: &off}
+	if msg := normalizeRuleRequest(&req); msg != "" {
+		t.Fatalf("normalizeRuleRequest = %q", msg)
+	}
+
+	if req.Threshold != 0 {
+		t.Errorf("Threshold = %d, want 0 for a kind without one", req.Threshold)
+	}
+	if req.DeviceID != nil {
+		t.Errorf("DeviceID = %q, want nil for every device", *req.DeviceID)
+	}
+	if req.CooldownMinutes == nil || *req.CooldownMinutes != defaultAlertCooldown {
+		t.Errorf("CooldownMinutes = %v, want %d", req.CooldownMinutes, defaultAlertCooldown)
+	}
+	if !*req.Notify || !*req.Enabled {
+		t.Error("Notify and Enabled should default to true")
+	}
+	if *req.Email {
+		t.Error("Email was set to false and should stay false")
+	}
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/command"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+const (
+	defaultCommandTimeout = 5 * time.Minute
+	maxCommandTimeout     = 24 * time.Hour
+	// maxCommandPollWait stays well inside the server's write timeout
+	maxCommandPollWait = 30 * time.Second
+	maxCommandResult   = 64 << 10
+)
+
+type CommandHandler struct {
+	commandService *services.CommandService
+}
+
+func NewCommandHandler(commandService *services.CommandService) *CommandHandler {
+	return &CommandHandler{
+		commandService: commandService,
+	}
+}
+
+func (h *CommandHandler) CreateCommand(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req command.CreateCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := normalizeCommandRequest(&req); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	cmd, err := h.commandService.Enqueue(ctx, clerkID, mux.Vars(r)["id"], &req)
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error queueing command: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to queue command")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusAccepted, cmd)
+}
+
+// normalizeCommandRequest checks the params of each command type and fills
+// defaults. It returns a message describing the first problem, or "".
+func normalizeCommandRequest(req *command.CreateCommandRequest) string {
+	params := bytes.TrimSpace(req.Params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		params = []byte("{}")
+	}
+
+	switch req.Type {
+	case command.TypeReboot, command.TypeRescanStorage:
+		var extra map[string]any
+		if err := json.Unmarshal(params, &extra); err != nil || len(extra) > 0 {
+			return req.Type + " takes no params"
+		}
+		params = []byte("{}")
+	case command.TypeRenameShare:
+		var p command.RenameShareParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return "params must be {\"from\": ..., \"to\": ...}"
+		}
+		p.From, p.To = strings.TrimSpace(p.From), strings.TrimSpace(p.To)
+		if p.From == "" || p.To == "" {
+			return "rename_share needs from and to"
+		}
+		params, _ = json.Marshal(p)
+	default:
+		return "type must be reboot, rescan_storage or rename_share"
+	}
+	req.Params = params
+
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	switch {
+	case req.TimeoutSeconds == 0:
+		timeout = defaultCommandTimeout
+	case timeout < 0 || timeout > maxCommandTimeout:
+		return "timeoutSeconds must be between 1 and 86400"
+	}
+	req.TimeoutSeconds = int(timeout.Seconds())
+
+	return ""
+}
+
+func (h *CommandHandler) ListCommands(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	cmds, err := h.commandService.ListCommands(ctx, clerkID, mux.Vars(r)["id"])
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing commands: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list commands")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, cmds)
+}
+
+func (h *CommandHandler) GetCommand(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := uuid.Parse(vars["commandId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Command not found")
+		return
+	}
+
+	cmd, err := h.commandService.GetCommand(ctx, clerkID, vars["id"], id)
+	if errors.Is(err, services.ErrCommandNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Command not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting command %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get command")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, cmd)
+}
+
+// PollCommands is the device's long-poll. It answers as soon as commands are
+// pending, or with an empty list after ?wait= seconds (default and max 30).
+func (h *CommandHandler) PollCommands(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := middleware.GetDeviceID(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	wait := maxCommandPollWait
+	if raw := r.URL.Query().Get("wait"); raw != "" {
+		secs, err := strconv.Atoi(raw)
+		if err != nil || secs < 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "wait must be a number of seconds")
+			return
+		}
+		wait = min(time.Duration(secs)*time.Second, maxCommandPollWait)
+	}
+
+	cmds, err := h.commandService.Poll(r.Context(), deviceID, wait)
+	if err != nil {
+		log.Printf("Error polling commands for device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to poll commands")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, cmds)
+}
+
+func (h *CommandHandler) AcknowledgeCommand(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deviceID, ok := middleware.GetDeviceID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Command not found")
+		return
+	}
+
+	err = h.commandService.Acknowledge(ctx, deviceID, id)
+	if h.respondCommandError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error acknowledging command %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to acknowledge command")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CommandHandler) ReportCommandResult(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deviceID, ok := middleware.GetDeviceID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Command not found")
+		return
+	}
+
+	var req command.ResultReport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCommandResult)).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Status != command.StatusSucceeded && req.Status != command.StatusFailed {
+		utils.RespondWithError(w, http.StatusBadRequest, "status must be succeeded or failed")
+		return
+	}
+
+	err = h.commandService.Complete(ctx, deviceID, id, &req)
+	if h.respondCommandError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error recording result of command %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to record result")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondCommandError writes the response for errors devices can cause and
+// reports whether it did.
+func (h *CommandHandler) respondCommandError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrCommandNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Command not found")
+	case errors.Is(err, services.ErrCommandFinished):
+		utils.RespondWithError(w, http.StatusConflict, "Command already finished or timed out")
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/command"
+)
+
+func TestNormalizeCommandRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         command.CreateCommandRequest
+		valid       bool
+		wantParams  string
+		wantTimeout int
+	}{
+		{"reboot", command.CreateCommandRequest{Type: command.TypeReboot}, true, `{}`, 300},
+		{"reboot with null params", command.CreateCommandRequest{Type: command.TypeReboot, Params: json.RawMessage(`null`)}, true, `{}`, 300},
+		{"reboot with params", command.CreateCommandRequest{Type: command.TypeReboot, Params: json.RawMessage(`{"force":true}`)}, false, "", 0},
+		{"rescan with timeout", command.CreateCommandRequest{Type: command.TypeRescanStorage, TimeoutSeconds: 60}, true, `{}`, 60},
+		{"rename", command.CreateCommandRequest{Type: command.TypeRenameShare, Params: json.RawMessage(`{"from":" a ","to":"b"}`)}, true, `{"from":"a","to":"b"}`, 300},
+		{"rename without to", command.CreateCommandRequest{Type: command.TypeRenameShare, Params: json.RawMessage(`{"from":"a","to":"  "}`)}, false, "", 0},
+		{"rename with malformed params", command.CreateCommandRequest{Type: command.TypeRenameShare, Params: json.RawMessage(`[1]`)}, false, "", 0},
+		{"unknown type", command.CreateCommandRequest{Type: "format_disk"}, false, "", 0},
+		{"longest timeout", command.CreateCommandRequest{Type: command.TypeReboot, TimeoutSeconds: 86400}, true, `{}`, 86400},
+		{"timeout too long", command.CreateCommandRequest{Type: command.TypeReboot, TimeoutSeconds: 86401}, false, "", 0},
+		{"negative timeout", command.CreateCommandRequest{Type: command.TypeReboot, TimeoutSeconds: -1}, false, "", 0},
+	}
+
+	for _, tt := range tests {
+		req := tt.req
+		msg := normalizeCommandRequest(&req)
+		if (msg == "") != tt.valid {
+			t.Errorf("%s: message %q, want valid %v", tt.name, msg, tt.valid)
+			continue
+		}
+		if !tt.valid {
+			continue
+		}
+		if string(req.Params) != tt.wantParams || req.TimeoutSeconds != tt.wantTimeout {
+			t.Errorf("%s: params %s, timeout %d; want %s, %d", tt.name, req.Params, req.TimeoutSeconds, tt.wantParams, tt.wantTimeout)
+		}
+	}
+}
+
+func TestRespondCommandError(t *testing.T) {
+	tests := []struct {
+		err     error
+		handled bool
+		want    int
+	}{
+		{services.ErrCommandNotFound, true, http.StatusNotFound},
+		{services.ErrCommandFinished, true, http.StatusConflict},
+		{errors.New("connection refused"), false, 0},
+		{nil, false, 0},
+	}
+
+	h := &CommandHandler{}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		if handled := h.respondCommandError(rec, tt.err); handled != tt.handled || (handled && rec.Code != tt.want) {
+			t.Errorf("%v: handled %v with %d, want %v with %d", tt.err, handled, rec.Code, tt.handled, tt.want)
+		}
+	}
+}
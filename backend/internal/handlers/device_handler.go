@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/device"
+	"github.com/strct-org/portal/backend/internal/types/release"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+const (
+	maxReportedDisks = 64
+	maxDiskName      = 128
+)
+
+type DeviceHandler struct {
+	deviceService *services.DeviceService
+}
+
+func NewDeviceHandler(deviceService *services.DeviceService) *DeviceHandler {
+	return &DeviceHandler{
+		deviceService: deviceService,
+	}
+}
+
+// RequestPairing is called by an unpaired device, which shows the returned
+// code to its owner.
+func (h *DeviceHandler) RequestPairing(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var req device.PairingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.DeviceID) == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Request body must include deviceId")
+		return
+	}
+	if req.Product != "" || req.Platform != "" {
+		if msg := validateReleaseKey(req.Product, req.Platform, release.ChannelStable); msg != "" {
+			utils.RespondWithError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+
+	resp, err := h.deviceService.RequestPairing(ctx, &req)
+	if errors.Is(err, services.ErrDeviceAlreadyPaired) {
+		utils.RespondWithError(w, http.StatusConflict, "Device is paired to an account. Remove it from that account first")
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating pairing for device %s: %v", req.DeviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create pairing code")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, resp)
+}
+
+// GetPairingStatus is polled by the device with its device token until the
+// code is claimed or expires.
+func (h *DeviceHandler) GetPairingStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if err != nil || token == "" {
+		utils.RespondWithError(w, http.StatusNotFound, "Pairing not found")
+		return
+	}
+
+	status, err := h.deviceService.PairingStatus(ctx, id, token)
+	if errors.Is(err, services.ErrPairingNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Pairing not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading pairing %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to load pairing")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, status)
+}
+
+func (h *DeviceHandler) ClaimDevice(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req device.ClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Code = strings.TrimSpace(req.Code)
+	if req.Code == "" && req.DeviceID == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Request body must include code or deviceId")
+		return
+	}
+
+	d, err := h.deviceService.ClaimDevice(ctx, clerkID, &req)
+	if respondEntitlementError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrInvalidPairingCode) && req.Code == "":
+		utils.RespondWithError(w, http.StatusUnprocessableEntity, "That device is not waiting to be paired from one of your orders")
+		return
+	case errors.Is(err, services.ErrInvalidPairingCode):
+		utils.RespondWithError(w, http.StatusUnprocessableEntity, "That code is invalid or has expired")
+		return
+	case errors.Is(err, services.ErrDeviceAlreadyPaired):
+		utils.RespondWithError(w, http.StatusConflict, "Device is already paired")
+		return
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	case err != nil:
+		log.Printf("Error claiming device: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to pair device")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, d)
+}
+
+func (h *DeviceHandler) ListDevices(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	devices, err := h.deviceService.ListDevices(ctx, clerkID)
+	if err != nil {
+		log.Printf("Error listing devices: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list devices")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, devices)
+}
+
+func (h *DeviceHandler) GetDevice(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	d, err := h.deviceService.GetOwnedDevice(ctx, clerkID, mux.Vars(r)["id"])
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading device: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to load device")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, d)
+}
+
+func (h *DeviceHandler) UnpairDevice(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	err := h.deviceService.UnpairDevice(ctx, clerkID, mux.Vars(r)["id"])
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error unpairing device: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to remove device")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDisks returns the disks the device last reported.
+func (h *DeviceHandler) ListDisks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	disks, err := h.deviceService.ListDisks(ctx, clerkID, mux.Vars(r)["id"])
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing disks: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list disks")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, disks)
+}
+
+// ReportTelemetry is called by devices without a socket connection; the
+// others send the same report as telemetry.report.
+func (h *DeviceHandler) ReportTelemetry(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deviceID, ok := middleware.GetDeviceID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	var req device.TelemetryReport
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := normalizeTelemetry(&req); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := h.deviceService.ReportTelemetry(ctx, deviceID, &req); err != nil {
+		log.Printf("Error recording telemetry of device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to record telemetry")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// normalizeTelemetry validates a report in place and returns why it is
+// invalid, or "".
+func normalizeTelemetry(report *device.TelemetryReport) string {
+	if len(report.Disks) > maxReportedDisks {
+		return "at most 64 disks are allowed"
+	}
+	seen := make(map[string]bool, len(report.Disks))
+	for i := range report.Disks {
+		d := &report.Disks[i]
+		d.Name = strings.TrimSpace(d.Name)
+		if d.Name == "" || len(d.Name) > maxDiskName {
+			return "disk name must be between 1 and 128 characters"
+		}
+		if seen[d.Name] {
+			return "disk names must be unique"
+		}
+		seen[d.Name] = true
+		if d.TotalBytes < 0 || d.UsedBytes < 0 || d.UsedBytes > d.TotalBytes {
+			return "disk usedBytes must be between 0 and totalBytes"
+		}
+		switch d.SMARTStatus {
+		case "":
+			d.SMARTStatus = device.SMARTUnknown
+		case device.SMARTOK, device.SMARTWarning, device.SMARTFailing, device.SMARTUnknown:
+		default:
+			return "disk smartStatus must be ok, warning, failing or unknown"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/strct-org/portal/backend/internal/types/device"
+)
+
+func TestNormalizeTelemetry(t *testing.T) {
+	many := make([]device.Disk, maxReportedDisks+1)
+	for i := range many {
+		many[i] = device.Disk{Name: fmt.Sprintf("sd%d", i)}
+	}
+
+	tests := []struct {
+		name  string
+		disks []device.Disk
+		ok    bool
+	}{
+		{"no disks", nil, true},
+		{"healthy disk", []device.Disk{{Name: "sda", TotalBytes: 100, UsedBytes: 40, SMARTStatus: device.SMARTOK}}, true},
+		{"full disk", []device.Disk{{Name: "sda", TotalBytes: 100, UsedBytes: 100, SMARTStatus: device.SMARTFailing}}, true},
+		{"too many disks", many, false},
+		{"blank name", []device.Disk{{Name: "  "}}, false},
+		{"long name", []device.Disk{{Name: strings.Repeat("a", maxDiskName+1)}}, false},
+		{"duplicate name", []device.Disk{{Name: "sda"}, {Name: " sda "}}, false},
+		{"negative size", []device.Disk{{Name: "sda", TotalBytes: -1}}, false},
+		{"used over total", []device.Disk{{Name: "sda", TotalBytes: 100, UsedBytes: 101}}, false},
+		{"unknown SMART status", []device.Disk{{Name: "sda", SMARTStatus: "bad"}}, false},
+	}
+
+	for _, tt := range tests {
+		report := device.TelemetryReport{Disks: tt.disks}
+		msg := normalizeTelemetry(&report)
+		if (msg == "") != tt.ok {
+			t.Errorf("%s: got %q, want ok %v", tt.name, msg, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeTelemetryDefaults(t *testing.T) {
+	report := device.TelemetryReport{Disks: []device.Disk{{Name: " sda ", TotalBytes: 100}}}
+	if msg := normalizeTelemetry(&report); msg != "" {
+		t.Fatalf("normalizeTelemetry = %q", msg)
+	}
+
+	d := report.Disks[0]
+	if d.Name != "sda" {
+		t.Errorf("Name = %q, want it trimmed", d.Name)
+	}
+	if d.SMARTStatus != device.SMARTUnknown {
+		t.Errorf("SMARTStatus = %q, want %q", d.SMARTStatus, device.SMARTUnknown)
+	}
+}
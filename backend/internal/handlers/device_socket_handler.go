@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/strct-org/portal/backend/internal/devicehub"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/command"
+	"github.com/strct-org/portal/backend/internal/types/device"
+	"github.com/strct-org/portal/backend/internal/types/p2p"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+var deviceUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// Devices don't send an Origin; anything that does is a browser, which
+	// has no business holding a device token
+	CheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == ""
+	},
+}
+
+// DeviceSocketHandler serves the devices' persistent control channel. Queued
+// commands are pushed down it as "command.run" notifications, and devices
+// answer with "command.ack" and "command.result" requests. Connection offers
+// arrive as "p2p.offer" and are answered with "p2p.answer". Devices send disk
+// state as "telemetry.report" requests.
+type DeviceSocketHandler struct {
+	hub            *devicehub.Hub
+	deviceService  *services.DeviceService
+	commandService *services.CommandService
+	p2pService     *services.P2PService
+}
+
+func NewDeviceSocketHandler(hub *devicehub.Hub, deviceService *services.DeviceService, commandService *services.CommandService, p2pService *services.P2PService) *DeviceSocketHandler {
+	return &DeviceSocketHandler{
+		hub:            hub,
+		deviceService:  deviceService,
+		commandService: commandService,
+		p2pService:     p2pService,
+	}
+}
+
+// commandReport is the params of "command.ack" and "command.result".
+type commandReport struct {
+	ID uuid.UUID `json:"id"`
+	command.ResultReport
+}
+
+// p2pAnswer is the params of "p2p.answer".
+type p2pAnswer struct {
+	SessionID uuid.UUID `json:"sessionId"`
+	p2p.AnswerRequest
+}
+
+func (h *DeviceSocketHandler) Connect(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := middleware.GetDeviceID(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	// Reflexive candidates use the address the device connected from
+	deviceIP := middleware.ClientIP(r)
+
+	// Upgrade has already written an error response when it fails
+	ws, err := deviceUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	conn, err := h.hub.Attach(deviceID, ws)
+	if err != nil {
+		ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "shutting down"), time.Now().Add(time.Second))
+		ws.Close()
+		return
+	}
+	defer h.hub.Detach(conn, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := h.deviceService.MarkOffline(ctx, deviceID); err != nil {
+			log.Printf("Error marking device %s offline: %v", deviceID, err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var pump sync.WaitGroup
+	pump.Add(1)
+	go func() {
+		defer pump.Done()
+		h.pumpCommands(ctx, conn)
+	}()
+
+	err = conn.Serve(
+		func(method string, params json.RawMessage) (any, *devicehub.Error) {
+			return h.handle(ctx, deviceID, deviceIP, method, params)
+		},
+		func() {
+			touchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			if err := h.deviceService.Touch(touchCtx, deviceID); err != nil {
+				log.Printf("Error recording device %s as seen: %v", deviceID, err)
+			}
+		},
+	)
+	if err != nil && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		log.Printf("Device %s control channel closed: %v", deviceID, err)
+	}
+
+	cancel()
+	pump.Wait()
+}
+
+// socketCommandWait bounds each poll of a connected device's pump. Unlike
+// HTTP long-polls it isn't limited by the server's write timeout, and Poll
+// re-checks the queue every few minutes while it waits anyway.
+const socketCommandWait = 24 * time.Hour
+
+// pumpCommands pushes the device's commands down the connection as they are
+// queued, until ctx is cancelled. Enqueue wakes it on whichever instance the
+// command was queued through, so the database is only queried when there is
+// something to deliver, plus the occasional recheck.
+func (h *DeviceSocketHandler) pumpCommands(ctx context.Context, conn *devicehub.Conn) {
+	for ctx.Err() == nil {
+		cmds, err := h.commandService.Poll(ctx, conn.DeviceID, socketCommandWait)
+		if err != nil {
+			log.Printf("Error polling commands for device %s: %v", conn.DeviceID, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		for _, cmd := range cmds {
+			// Commands that don't make it are handed out again once
+			// unacknowledged for long enough
+			if err := conn.Notify("command.run", cmd); err != nil {
+				log.Printf("Error pushing command %s to device %s: %v", cmd.ID, conn.DeviceID, err)
+				return
+			}
+		}
+	}
+}
+
+func (h *DeviceSocketHandler) handle(ctx context.Context, deviceID, deviceIP, method string, params json.RawMessage) (any, *devicehub.Error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var err error
+	switch method {
+	case "command.ack", "command.result":
+		var req commandReport
+		if err := json.Unmarshal(params, &req); err != nil || req.ID == uuid.Nil {
+			return nil, &devicehub.Error{Code: devicehub.CodeInvalidParams, Message: "params must include the command id"}
+		}
+		if method == "command.ack" {
+			err = h.commandService.Acknowledge(ctx, deviceID, req.ID)
+			break
+		}
+		if req.Status != command.StatusSucceeded && req.Status != command.StatusFailed {
+			return nil, &devicehub.Error{Code: devicehub.CodeInvalidParams, Message: "status must be succeeded or failed"}
+		}
+		err = h.commandService.Complete(ctx, deviceID, req.ID, &req.ResultReport)
+	case "p2p.answer":
+		var req p2pAnswer
+		if err := json.Unmarshal(params, &req); err != nil || req.SessionID == uuid.Nil {
+			return nil, &devicehub.Error{Code: devicehub.CodeInvalidParams, Message: "params must include the session id"}
+		}
+		if msg := normalizeCandidates(req.Candidates); msg != "" {
+			return nil, &devicehub.Error{Code: devicehub.CodeInvalidParams, Message: msg}
+		}
+		err = h.p2pService.Answer(ctx, deviceID, req.SessionID, deviceIP, req.Candidates)
+	case "telemetry.report":
+		var req device.TelemetryReport
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, &devicehub.Error{Code: devicehub.CodeInvalidParams, Message: "params must be a telemetry report"}
+		}
+		if msg := normalizeTelemetry(&req); msg != "" {
+			return nil, &devicehub.Error{Code: devicehub.CodeInvalidParams, Message: msg}
+		}
+		err = h.deviceService.ReportTelemetry(ctx, deviceID, &req)
+	default:
+		return nil, &devicehub.Error{Code: devicehub.CodeMethodNotFound, Message: "unknown method " + method}
+	}
+
+	switch {
+	case errors.Is(err, services.ErrCommandNotFound):
+		return nil, &devicehub.Error{Code: devicehub.CodeNotFound, Message: "Command not found"}
+	case errors.Is(err, services.ErrCommandFinished):
+		return nil, &devicehub.Error{Code: devicehub.CodeConflict, Message: "Command already finished or timed out"}
+	case errors.Is(err, services.ErrSessionNotFound):
+		return nil, &devicehub.Error{Code: devicehub.CodeNotFound, Message: "Session not found"}
+	case errors.Is(err, services.ErrSessionCompleted):
+		return nil, &devicehub.Error{Code: devicehub.CodeConflict, Message: "Session already answered, completed or expired"}
+	case err != nil:
+		log.Printf("Error handling %s from device %s: %v", method, deviceID, err)
+		return nil, &devicehub.Error{Code: devicehub.CodeInternalError, Message: "Internal error"}
+	}
+	return struct{}{}, nil
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/templates"
+	"github.com/strct-org/portal/backend/internal/types/document"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+type DocumentHandler struct {
+	documentService *services.DocumentService
+}
+
+func NewDocumentHandler(documentService *services.DocumentService) *DocumentHandler {
+	return &DocumentHandler{
+		documentService: documentService,
+	}
+}
+
+func (h *DocumentHandler) ServePrivacyPolicy(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, document.PrivacyPolicy)
+}
+
+func (h *DocumentHandler) ServeTermsOfServices(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, document.TermsOfServices)
+}
+
+func (h *DocumentHandler) ServeRefundPolicy(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, document.RefundPolicy)
+}
+
+func (h *DocumentHandler) ServePricing(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, document.Pricing)
+}
+
+// serve returns the version in effect, or ?version=<v> for a specific one, as
+// JSON by default or as a standalone page with ?format=html.
+func (h *DocumentHandler) serve(w http.ResponseWriter, r *http.Request, slug string) {
+	var (
+		doc *document.DocumentResponse
+		err error
+	)
+	if version := r.URL.Query().Get("version"); version != "" {
+		doc, err = h.documentService.Version(slug, version)
+	} else {
+		doc, err = h.documentService.Current(slug, time.Now())
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Document not found")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		utils.RespondWithJSON(w, http.StatusOK, doc)
+	case "html":
+		templates.Render(w, http.StatusOK, "document.html", struct {
+			*document.DocumentResponse
+			Body template.HTML
+		}{doc, template.HTML(doc.HTML)})
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "Unsupported format, use json or html")
+	}
+}
+
+func (h *DocumentHandler) GetAcceptances(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	statuses, err := h.documentService.AcceptanceStatuses(ctx, clerkID)
+	if err != nil {
+		log.Printf("Error loading document acceptances: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to load acceptances")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, statuses)
+}
+
+func (h *DocumentHandler) AcceptDocument(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req document.AcceptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Request body must include version")
+		return
+	}
+
+	slug := mux.Vars(r)["slug"]
+	err := h.documentService.Accept(ctx, clerkID, slug, req.Version, middleware.ClientIP(r), r.UserAgent())
+	switch {
+	case errors.Is(err, services.ErrDocumentNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Document not found")
+		return
+	case errors.Is(err, services.ErrVersionNotCurrent):
+		utils.RespondWithError(w, http.StatusConflict, "A newer version of this document is in effect")
+		return
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	case err != nil:
+		log.Printf("Error recording acceptance: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to record acceptance")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/document"
+)
+
+func TestServeDocument(t *testing.T) {
+	h := NewDocumentHandler(services.NewDocumentService(nil, map[string][]*document.Document{
+		document.PrivacyPolicy: {{Slug: document.PrivacyPolicy, Title: "Privacy", Version: "v1", EffectiveAt: time.Now().Add(-time.Hour), HTML: "<p>text</p>"}},
+	}))
+
+	tests := []struct {
+		name     string
+		target   string
+		want     int
+		wantType string
+	}{
+		{"current", "/privacy-policy", http.StatusOK, "application/json"},
+		{"by version", "/privacy-policy?version=v1", http.StatusOK, "application/json"},
+		{"as page", "/privacy-policy?format=html", http.StatusOK, "text/html; charset=utf-8"},
+		{"unknown version", "/privacy-policy?version=v9", http.StatusNotFound, ""},
+		{"unknown format", "/privacy-policy?format=pdf", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServePrivacyPolicy(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d (%s)", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+		if tt.wantType != "" && rec.Header().Get("Content-Type") != tt.wantType {
+			t.Errorf("%s: content type %q, want %q", tt.name, rec.Header().Get("Content-Type"), tt.wantType)
+		}
+	}
+
+	// Nothing is published under the other slugs
+	rec := httptest.NewRecorder()
+	h.ServePricing(rec, httptest.NewRequest(http.MethodGet, "/pricing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unpublished document: got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
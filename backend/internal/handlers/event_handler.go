@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+const (
+	// eventHeartbeat keeps proxies from closing idle streams
+	eventHeartbeat = 25 * time.Second
+	eventWriteWait = 10 * time.Second
+	// eventRetry is the reconnection delay suggested to the browser, in ms
+	eventRetry = 3000
+
+	// streamTokenTTL is how long a token from CreateStreamToken opens the
+	// stream. EventSource reconnects with the same URL, so it outlasts most
+	// dropped connections; an open stream isn't cut when it expires.
+	streamTokenTTL   = time.Hour
+	streamTokenParam = "token"
+	// lastEventIDParam stands in for Last-Event-ID, which a new EventSource
+	// can't send, when the browser opens the stream again with a new token
+	lastEventIDParam = "lastEventId"
+)
+
+// EventHandler streams the user's events as Server-Sent Events. Reconnecting
+// clients send Last-Event-ID and get what they missed; when that isn't
+// possible they get a "resync" event and should refetch their state.
+//
+// API clients authenticate with a Bearer token. Browsers' EventSource can't
+// send one, so they open the stream with a token from CreateStreamToken in
+// ?token= instead, and get a new one when the stream fails with 401.
+type EventHandler struct {
+	broker      *events.Broker
+	userService *services.UserService
+	tokens      *events.TokenSigner
+}
+
+// NewEventHandler only accepts Bearer tokens when tokens is nil.
+func NewEventHandler(broker *events.Broker, userService *services.UserService, tokens *events.TokenSigner) *EventHandler {
+	return &EventHandler{
+		broker:      broker,
+		userService: userService,
+		tokens:      tokens,
+	}
+}
+
+// CreateStreamToken returns a token that opens the user's event stream.
+func (h *EventHandler) CreateStreamToken(w http.ResponseWriter, r *http.Request) {
+	clerkID, ok := middleware.GetClerkID(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	if h.tokens == nil {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Stream tokens are not configured")
+		return
+	}
+
+	expires := time.Now().Add(streamTokenTTL)
+	utils.RespondWithJSON(w, http.StatusOK, events.StreamToken{
+		Token:     h.tokens.Sign(clerkID, expires),
+		ExpiresAt: expires,
+	})
+}
+
+// Authenticate authenticates the stream with a Bearer token, or a token from
+// CreateStreamToken in the query.
+func (h *EventHandler) Authenticate(next http.Handler) http.Handler {
+	bearer := middleware.ClerkAuthMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get(streamTokenParam)
+		if token == "" || r.Header.Get("Authorization") != "" || h.tokens == nil {
+			bearer.ServeHTTP(w, r)
+			return
+		}
+
+		clerkID, err := h.tokens.Verify(token, time.Now())
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired stream token")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), middleware.ClerkIDKey, clerkID)))
+	})
+}
+
+func (h *EventHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	clerkID, ok := middleware.GetClerkID(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	user, err := h.userService.GetUserByClerkID(ctx, clerkID)
+	cancel()
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user for event stream: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to open event stream")
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get(lastEventIDParam)
+	}
+	replay, stream, complete, unsubscribe := h.broker.Subscribe(user.ID, lastEventID)
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	// The server's read timeout would otherwise end the stream
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("Warning: can't clear read deadline for event stream: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stops nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(chunk string) bool {
+		if err := rc.SetWriteDeadline(time.Now().Add(eventWriteWait)); err != nil {
+			log.Printf("Warning: can't set write deadline for event stream: %v", err)
+		}
+		if _, err := fmt.Fprint(w, chunk); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	head := fmt.Sprintf("retry: %d\n\n", eventRetry)
+	if !complete {
+		head += "event: resync\ndata: {}\n\n"
+	}
+	for _, e := range replay {
+		head += formatEvent(e)
+	}
+	if !send(head) {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e, ok := <-stream:
+			if !ok {
+				// Fell behind or shutting down; the client reconnects
+				// with Last-Event-ID
+				return
+			}
+			if !send(formatEvent(e)) {
+				return
+			}
+		case <-heartbeat.C:
+			if !send(": ping\n\n") {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func formatEvent(e events.Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "id: %s\nevent: %s\n", e.ID, e.Type)
+	// Data is compact JSON, but split anyway in case it ever isn't
+	for _, line := range strings.Split(string(e.Data), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
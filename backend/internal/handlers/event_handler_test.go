@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/middleware"
+)
+
+func TestEventStreamAuthentication(t *testing.T) {
+	tokens := events.NewTokenSigner([]byte(strings.Repeat("k", 32)))
+	h := NewEventHandler(events.New(), nil, tokens)
+
+	var got string
+	stream := h.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = middleware.GetClerkID(r.Context())
+	}))
+
+	tests := []struct {
+		name        string
+		token       string
+		wantStatus  int
+		wantClerkID string
+	}{
+		{"stream token", tokens.Sign("user_1", time.Now().Add(time.Minute)), http.StatusOK, "user_1"},
+		{"expired token", tokens.Sign("user_1", time.Now().Add(-time.Second)), http.StatusUnauthorized, ""},
+		{"forged token", "dXNlcl8x.c2ln", http.StatusUnauthorized, ""},
+		{"no token or header", "", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		got = ""
+		target := "/api/v1/events"
+		if tt.token != "" {
+			target += "?token=" + tt.token
+		}
+		rec := httptest.NewRecorder()
+		stream.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if rec.Code != tt.wantStatus || got != tt.wantClerkID {
+			t.Errorf("%s: status %d for %q, want %d for %q", tt.name, rec.Code, got, tt.wantStatus, tt.wantClerkID)
+		}
+	}
+}
+
+func TestCreateStreamToken(t *testing.T) {
+	req := authenticated(httptest.NewRequest(http.MethodPost, "/api/v1/events/token", nil), "user_1")
+
+	rec := httptest.NewRecorder()
+	NewEventHandler(events.New(), nil, nil).CreateStreamToken(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("without a signing key: status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	tokens := events.NewTokenSigner([]byte(strings.Repeat("k", 32)))
+	rec = httptest.NewRecorder()
+	NewEventHandler(events.New(), nil, tokens).CreateStreamToken(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"token"`) {
+		t.Errorf("status %d, body %s; want 200 with a token", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/export"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+type ExportHandler struct {
+	exportService *services.ExportService
+}
+
+func NewExportHandler(exportService *services.ExportService) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+	}
+}
+
+// RequestExport queues a data export. Clients poll GetExport until the job
+// completes and then follow its downloadUrl.
+func (h *ExportHandler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	job, err := h.exportService.RequestExport(ctx, clerkID)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error requesting export: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to request export")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusAccepted, withDownloadURL(job))
+}
+
+func (h *ExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Export not found")
+		return
+	}
+
+	job, err := h.exportService.GetJob(ctx, clerkID, id)
+	if errors.Is(err, services.ErrExportNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Export not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading export %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to load export")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, withDownloadURL(job))
+}
+
+func (h *ExportHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	clerkID, ok := middleware.GetClerkID(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Export not found")
+		return
+	}
+
+	f, job, err := h.exportService.OpenArchive(r.Context(), clerkID, id)
+	switch {
+	case errors.Is(err, services.ErrExportNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Export not found")
+		return
+	case errors.Is(err, services.ErrExportNotReady):
+		utils.RespondWithError(w, http.StatusConflict, fmt.Sprintf("Export is %s", job.Status))
+		return
+	case err != nil:
+		log.Printf("Error opening export %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to open export")
+		return
+	}
+	defer f.Close()
+
+	filename := fmt.Sprintf("strct-export-%s.zip", job.CreatedAt.UTC().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, filename, *job.CompletedAt, f)
+}
+
+func withDownloadURL(job *export.Job) *export.Job {
+	if job.Status == export.StatusCompleted {
+		job.DownloadURL = fmt.Sprintf("/api/v1/user/export/%s/download", job.ID)
+	}
+	return job
+}
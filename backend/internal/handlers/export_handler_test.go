@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/strct-org/portal/backend/internal/types/export"
+)
+
+func TestWithDownloadURL(t *testing.T) {
+	id := uuid.New()
+	for _, status := range []string{export.StatusQueued, export.StatusRunning, export.StatusCompleted, export.StatusFailed, export.StatusExpired} {
+		job := withDownloadURL(&export.Job{ID: id, Status: status})
+
+		want := ""
+		if status == export.StatusCompleted {
+			want = "/api/v1/user/export/" + id.String() + "/download"
+		}
+		if job.DownloadURL != want {
+			t.Errorf("%s: download URL %q, want %q", status, job.DownloadURL, want)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/friend"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+type FriendHandler struct {
+	friendService *services.FriendService
+}
+
+func NewFriendHandler(friendService *services.FriendService) *FriendHandler {
+	return &FriendHandler{
+		friendService: friendService,
+	}
+}
+
+func (h *FriendHandler) ListFriends(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, friend.StatusAccepted)
+}
+
+// ListRequests returns pending friend requests, received and sent.
+func (h *FriendHandler) ListRequests(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, friend.StatusPending)
+}
+
+func (h *FriendHandler) list(w http.ResponseWriter, r *http.Request, status string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	friendships, err := h.friendService.List(ctx, clerkID, status)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing %s friendships: %v", status, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list friends")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, friendships)
+}
+
+func (h *FriendHandler) SendRequest(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req friend.CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Recipient) == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Request body must include recipient")
+		return
+	}
+
+	f, err := h.friendService.Request(ctx, clerkID, strings.TrimSpace(req.Recipient))
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	case errors.Is(err, services.ErrFriendWithSelf):
+		utils.RespondWithError(w, http.StatusBadRequest, "You cannot send a friend request to yourself")
+		return
+	case errors.Is(err, services.ErrAlreadyFriends):
+		utils.RespondWithError(w, http.StatusConflict, "You are already friends")
+		return
+	case err != nil:
+		log.Printf("Error sending friend request: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to send friend request")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, f)
+}
+
+func (h *FriendHandler) AcceptRequest(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	userID, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Friend request not found")
+		return
+	}
+
+	f, err := h.friendService.Accept(ctx, clerkID, userID)
+	if errors.Is(err, services.ErrFriendRequestNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Friend request not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error accepting friend request from %s: %v", userID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to accept friend request")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, f)
+}
+
+// RemoveFriend unfriends a user, or declines or withdraws a friend request.
+func (h *FriendHandler) RemoveFriend(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	userID, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Friend not found")
+		return
+	}
+
+	err = h.friendService.Remove(ctx, clerkID, userID)
+	if errors.Is(err, services.ErrFriendshipNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Friend not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error removing friend %s: %v", userID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to remove friend")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *FriendHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	invites, err := h.friendService.ListInvites(ctx, clerkID)
+	if err != nil {
+		log.Printf("Error listing invites: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list invites")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, invites)
+}
+
+// CreateInvite emails an invitation to someone who isn't a user yet. Users
+// are sent friend requests instead.
+func (h *FriendHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req friend.CreateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	addr, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil || addr.Name != "" || len(addr.Address) > 254 {
+		utils.RespondWithError(w, http.StatusBadRequest, "email must be a valid email address")
+		return
+	}
+
+	inv, err := h.friendService.Invite(ctx, clerkID, addr.Address)
+	switch {
+	case errors.Is(err, services.ErrInvitesDisabled):
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Invitations are not available")
+		return
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	case errors.Is(err, services.ErrInviteeIsUser):
+		utils.RespondWithError(w, http.StatusConflict, "That email belongs to a Strct user. Send them a friend request instead")
+		return
+	case errors.Is(err, services.ErrTooManyInvites):
+		utils.RespondWithError(w, http.StatusTooManyRequests, "You have sent too many invitations today")
+		return
+	case err != nil:
+		log.Printf("Error creating invite: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to send invitation")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, inv)
+}
+
+func (h *FriendHandler) CancelInvite(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Invite not found")
+		return
+	}
+
+	err = h.friendService.CancelInvite(ctx, clerkID, id)
+	if errors.Is(err, services.ErrInviteNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Invite not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error cancelling invite %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to cancel invite")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResolveInvite is the target of the emailed link. It needs no session, so
+// the app can show who invited the visitor before they sign up.
+func (h *FriendHandler) ResolveInvite(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	info, err := h.friendService.ResolveInvite(ctx, mux.Vars(r)["token"])
+	switch {
+	case errors.Is(err, services.ErrInvitesDisabled):
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Invitations are not available")
+		return
+	case errors.Is(err, services.ErrInviteNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Invitation not found or expired")
+		return
+	case err != nil:
+		log.Printf("Error resolving invite: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to load invitation")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, info)
+}
+
+// AcceptInvite makes the signed-in user friends with whoever invited them.
+func (h *FriendHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	f, err := h.friendService.AcceptInvite(ctx, clerkID, mux.Vars(r)["token"])
+	switch {
+	case errors.Is(err, services.ErrInvitesDisabled):
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Invitations are not available")
+		return
+	case errors.Is(err, services.ErrInviteNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Invitation not found or expired")
+		return
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	case errors.Is(err, services.ErrFriendWithSelf):
+		utils.RespondWithError(w, http.StatusBadRequest, "You cannot accept your own invitation")
+		return
+	case err != nil:
+		log.Printf("Error accepting invite: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to accept invitation")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, f)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/health"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+const serviceName = "strct-portal-api"
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{
+		checker: checker,
+	}
+}
+
+// Livez only reports that the process is serving HTTP; it never touches
+// dependencies so a slow database doesn't get the instance restarted.
+func (h *HealthHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"status":  health.StatusOK,
+		"service": serviceName,
+	})
+}
+
+// Readyz reports whether the instance should receive traffic, checking every
+// dependency including the database.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	h.respondReady(w, r, true)
+}
+
+// ReadyzLight is Readyz without the checks that would wake the database, for
+// load balancers probing every few seconds so NeonDB can still scale to zero.
+func (h *HealthHandler) ReadyzLight(w http.ResponseWriter, r *http.Request) {
+	h.respondReady(w, r, false)
+}
+
+func (h *HealthHandler) respondReady(w http.ResponseWriter, r *http.Request, full bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	report := h.checker.Ready(ctx, full)
+
+	code := http.StatusOK
+	if report.Status != health.StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	utils.RespondWithJSON(w, code, report)
+}
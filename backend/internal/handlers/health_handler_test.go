@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/health"
+)
+
+func TestReadyzChecksDatabase(t *testing.T) {
+	checker := health.NewChecker()
+	checker.Add("jwks", time.Second, func(context.Context) error { return nil })
+	checker.AddFull("database", time.Second, 0, func(context.Context) error { return errors.New("connection refused") })
+	checker.MarkWarm()
+	h := NewHealthHandler(checker)
+
+	tests := []struct {
+		name         string
+		handler      http.HandlerFunc
+		wantCode     int
+		wantDatabase bool
+	}{
+		{"/readyz", h.Readyz, http.StatusServiceUnavailable, true},
+		{"/readyz/light", h.ReadyzLight, http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.handler(rec, httptest.NewRequest(http.MethodGet, tt.name, nil))
+
+		var report health.Report
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		_, checked := report.Checks["database"]
+		if rec.Code != tt.wantCode || checked != tt.wantDatabase {
+			t.Errorf("%s: status %d, database checked %v; want %d, %v", tt.name, rec.Code, checked, tt.wantCode, tt.wantDatabase)
+		}
+	}
+}
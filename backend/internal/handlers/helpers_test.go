@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/strct-org/portal/backend/middleware"
+)
+
+// authenticated returns r as ClerkAuthMiddleware passes it on for clerkID.
+func authenticated(r *http.Request, clerkID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), middleware.ClerkIDKey, clerkID))
+}
+
+// asDevice returns r as DeviceAuthMiddleware passes it on for deviceID.
+func asDevice(r *http.Request, deviceID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), middleware.DeviceIDKey, deviceID))
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/notification"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+const (
+	defaultNotificationPage = 20
+	maxNotificationPage     = 100
+)
+
+type NotificationHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewNotificationHandler(notificationService *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{
+		notificationService: notificationService,
+	}
+}
+
+// ListNotifications returns the inbox newest first. ?limit= sets the page
+// size (default 20, max 100), ?cursor= continues from a previous page's
+// nextCursor and ?unread=true leaves out read notifications.
+func (h *NotificationHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	q := r.URL.Query()
+	limit := defaultNotificationPage
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxNotificationPage {
+			utils.RespondWithError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+	var cursor *uuid.UUID
+	if raw := q.Get("cursor"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		cursor = &id
+	}
+	unreadOnly, err := strconv.ParseBool(q.Get("unread"))
+	if err != nil && q.Get("unread") != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "unread must be true or false")
+		return
+	}
+
+	page, err := h.notificationService.List(ctx, clerkID, cursor, limit, unreadOnly)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing notifications: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list notifications")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, page)
+}
+
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Notification not found")
+		return
+	}
+
+	unread, err := h.notificationService.MarkRead(ctx, clerkID, id)
+	if errors.Is(err, services.ErrNotificationNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Notification not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error marking notification %s read: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to mark notification read")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, notification.UnreadCount{UnreadCount: unread})
+}
+
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	unread, err := h.notificationService.MarkAllRead(ctx, clerkID)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error marking notifications read: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to mark notifications read")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, notification.UnreadCount{UnreadCount: unread})
+}
+
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	prefs, err := h.notificationService.GetPreferences(ctx, clerkID)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting notification preferences: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get notification preferences")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, prefs)
+}
+
+// UpdatePreferences replaces the user's email preferences.
+func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req notification.Preferences
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	prefs, err := h.notificationService.UpdatePreferences(ctx, clerkID, &req)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating notification preferences: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update notification preferences")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, prefs)
+}
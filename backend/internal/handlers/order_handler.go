@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/order"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+type OrderHandler struct {
+	orderService *services.OrderService
+}
+
+func NewOrderHandler(orderService *services.OrderService) *OrderHandler {
+	return &OrderHandler{
+		orderService: orderService,
+	}
+}
+
+func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	orders, err := h.orderService.ListOrders(ctx, clerkID)
+	if err != nil {
+		log.Printf("Error listing orders: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list orders")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, orders)
+}
+
+func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	o, err := h.orderService.GetOrder(ctx, clerkID, id)
+	if errors.Is(err, services.ErrOrderNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting order %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get order")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, o)
+}
+
+// ListPairableDevices lists devices from the user's orders that are asking to
+// be paired, so the portal can offer them without a code.
+func (h *OrderHandler) ListPairableDevices(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	devices, err := h.orderService.PairableDevices(ctx, clerkID)
+	if err != nil {
+		log.Printf("Error listing pairable devices: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list pairable devices")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, devices)
+}
+
+func (h *OrderHandler) UpdateShipping(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	var req order.UpdateShippingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	switch req.Status {
+	case order.ShippingPending, order.ShippingProcessing, order.ShippingShipped, order.ShippingDelivered, order.ShippingReturned:
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "status must be pending, processing, shipped, delivered or returned")
+		return
+	}
+
+	o, err := h.orderService.UpdateShipping(ctx, id, &req)
+	if errors.Is(err, services.ErrOrderNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating shipping of order %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update shipping")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, o)
+}
+
+func (h *OrderHandler) AssignUnits(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	var req order.AssignUnitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Serials) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "serials must not be empty")
+		return
+	}
+	for _, serial := range req.Serials {
+		if strings.TrimSpace(serial) == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "serials must not be blank")
+			return
+		}
+	}
+
+	o, err := h.orderService.AssignUnits(ctx, id, &req)
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Order item not found")
+		return
+	case errors.Is(err, services.ErrTooManyUnits):
+		utils.RespondWithError(w, http.StatusUnprocessableEntity, "More serials than the item quantity")
+		return
+	case errors.Is(err, services.ErrSerialAssigned):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		log.Printf("Error assigning units to order %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to assign units")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, o)
+}
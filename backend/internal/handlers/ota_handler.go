@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/ota"
+	"github.com/strct-org/portal/backend/internal/types/release"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+type OTAHandler struct {
+	otaService *services.OTAService
+}
+
+func NewOTAHandler(otaService *services.OTAService) *OTAHandler {
+	return &OTAHandler{
+		otaService: otaService,
+	}
+}
+
+// CheckForUpdate is called by devices with their running version. Devices
+// paired without reporting their product and platform pass them here once.
+func (h *OTAHandler) CheckForUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deviceID, ok := middleware.GetDeviceID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	q := r.URL.Query()
+	product, platform, version := q.Get("product"), q.Get("platform"), q.Get("version")
+	if product != "" || platform != "" {
+		if msg := validateReleaseKey(product, platform, release.ChannelStable); msg != "" {
+			utils.RespondWithError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+	if version != "" && !versionPattern.MatchString(version) {
+		utils.RespondWithError(w, http.StatusBadRequest, "version must look like 1.2.3 or 1.2.3-beta.1")
+		return
+	}
+
+	check, err := h.otaService.CheckForUpdate(ctx, deviceID, product, platform, version)
+	if errors.Is(err, services.ErrUpdatesDisabled) {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Updates are not available right now")
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking updates for device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to check for updates")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, check)
+}
+
+func (h *OTAHandler) ReportUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deviceID, ok := middleware.GetDeviceID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	var req ota.StatusReport
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	switch req.State {
+	case ota.StateDownloading, ota.StateInstalled, ota.StateFailed:
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "state must be downloading, installed or failed")
+		return
+	}
+	if len(req.Error) > 1000 {
+		req.Error = req.Error[:1000]
+	}
+
+	err := h.otaService.ReportStatus(ctx, deviceID, &req)
+	if errors.Is(err, services.ErrRolloutNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "No such update for this device")
+		return
+	}
+	if err != nil {
+		log.Printf("Error recording update status for device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to record update status")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *OTAHandler) ListRollouts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rollouts, err := h.otaService.ListRollouts(ctx)
+	if err != nil {
+		log.Printf("Error listing rollouts: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list rollouts")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, rollouts)
+}
+
+func (h *OTAHandler) CreateRollout(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var req ota.CreateRolloutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Percentage < 0 || req.Percentage > 100 {
+		utils.RespondWithError(w, http.StatusBadRequest, "percentage must be between 0 and 100")
+		return
+	}
+	if req.FailureThreshold < 0 || req.FailureThreshold > 1 {
+		utils.RespondWithError(w, http.StatusBadRequest, "failureThreshold must be between 0 and 1")
+		return
+	}
+	if req.MinReports < 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "minReports must not be negative")
+		return
+	}
+
+	ro, err := h.otaService.CreateRollout(ctx, &req)
+	if errors.Is(err, services.ErrReleaseNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Release not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating rollout: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create rollout")
+		return
+	}
+
+	log.Printf("Started rollout %s of %s %s at %d%%", ro.ID, ro.Product, ro.Version, ro.Percentage)
+	utils.RespondWithJSON(w, http.StatusCreated, ro)
+}
+
+func (h *OTAHandler) GetRollout(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Rollout not found")
+		return
+	}
+
+	ro, err := h.otaService.GetRollout(ctx, id)
+	if errors.Is(err, services.ErrRolloutNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Rollout not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting rollout %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get rollout")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, ro)
+}
+
+func (h *OTAHandler) UpdateRollout(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Rollout not found")
+		return
+	}
+
+	var req ota.UpdateRolloutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Percentage != nil && (*req.Percentage < 0 || *req.Percentage > 100) {
+		utils.RespondWithError(w, http.StatusBadRequest, "percentage must be between 0 and 100")
+		return
+	}
+	switch req.Status {
+	case "", ota.RolloutActive, ota.RolloutPaused, ota.RolloutHalted:
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "status must be active, paused or halted")
+		return
+	}
+
+	ro, err := h.otaService.UpdateRollout(ctx, id, &req)
+	if errors.Is(err, services.ErrRolloutNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Rollout not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating rollout %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update rollout")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, ro)
+}
+
+func (h *OTAHandler) SetDeviceCohort(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var req ota.SetCohortRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	err := h.otaService.SetCohort(ctx, mux.Vars(r)["id"], req.Cohort)
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error setting cohort: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to set cohort")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/devicehub"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/p2p"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+const maxCandidates = 16
+
+type P2PHandler struct {
+	p2pService   *services.P2PService
+	relayService *services.RelayService
+	hub          *devicehub.Hub
+}
+
+func NewP2PHandler(p2pService *services.P2PService, relayService *services.RelayService, hub *devicehub.Hub) *P2PHandler {
+	return &P2PHandler{
+		p2pService:   p2pService,
+		relayService: relayService,
+		hub:          hub,
+	}
+}
+
+// Offer starts a connection attempt to a device the user may reach through
+// the relay. Devices connected to this instance get the offer pushed as a
+// "p2p.offer" notification; others pick it up from their pending offers.
+func (h *P2PHandler) Offer(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req p2p.OfferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := normalizeCandidates(req.Candidates); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	deviceID := mux.Vars(r)["id"]
+	access, err := h.relayService.Authorize(ctx, clerkID, deviceID)
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error authorizing connection to device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to start connection")
+		return
+	}
+
+	sess, err := h.p2pService.Offer(ctx, access, middleware.ClientIP(r), req.Candidates)
+	if err != nil {
+		log.Printf("Error starting connection to device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to start connection")
+		return
+	}
+
+	if err := h.hub.Notify(deviceID, "p2p.offer", sess); err != nil && !errors.Is(err, devicehub.ErrNotConnected) {
+		log.Printf("Error pushing connection offer to device %s: %v", deviceID, err)
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, sess)
+}
+
+func (h *P2PHandler) GetSession(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	sess, err := h.p2pService.GetSession(ctx, clerkID, id)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting session %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get session")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, sess)
+}
+
+func (h *P2PHandler) RecordResult(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	var req p2p.ResultRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Path != p2p.PathDirect && req.Path != p2p.PathRelay {
+		utils.RespondWithError(w, http.StatusBadRequest, "path must be direct or relay")
+		return
+	}
+
+	sess, err := h.p2pService.RecordPath(ctx, clerkID, id, req.Path)
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	case errors.Is(err, services.ErrSessionCompleted):
+		utils.RespondWithError(w, http.StatusConflict, "Session already completed")
+		return
+	case err != nil:
+		log.Printf("Error recording path of session %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to record result")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, sess)
+}
+
+// ListOffers returns the offers a device has yet to answer, for devices that
+// aren't connected to the instance the client reached.
+func (h *P2PHandler) ListOffers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deviceID, ok := middleware.GetDeviceID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	sessions, err := h.p2pService.PendingOffers(ctx, deviceID)
+	if err != nil {
+		log.Printf("Error listing connection offers for device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list offers")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, sessions)
+}
+
+func (h *P2PHandler) Answer(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deviceID, ok := middleware.GetDeviceID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	var req p2p.AnswerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := normalizeCandidates(req.Candidates); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	err = h.p2pService.Answer(ctx, deviceID, id, middleware.ClientIP(r), req.Candidates)
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	case errors.Is(err, services.ErrSessionCompleted):
+		utils.RespondWithError(w, http.StatusConflict, "Session already answered, completed or expired")
+		return
+	case err != nil:
+		log.Printf("Error answering session %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to answer session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// normalizeCandidates checks candidates sent by clients and devices and fills
+// the default protocol. It returns a message describing the first problem, or
+// "".
+func normalizeCandidates(candidates []p2p.Candidate) string {
+	if len(candidates) > maxCandidates {
+		return "at most 16 candidates are allowed"
+	}
+	for i := range candidates {
+		c := &candidates[i]
+		if c.Type != p2p.CandidateHost && c.Type != p2p.CandidateReflexive {
+			return "candidate type must be host or srflx"
+		}
+		addr, err := netip.ParseAddr(c.Address)
+		if err != nil {
+			return "candidate address must be an IP address"
+		}
+		c.Address = addr.Unmap().String()
+		if c.Port < 1 || c.Port > 65535 {
+			return "candidate port must be between 1 and 65535"
+		}
+		if c.Protocol == "" {
+			c.Protocol = "udp"
+		}
+		if c.Protocol != "udp" && c.Protocol != "tcp" {
+			return "candidate protocol must be udp or tcp"
+		}
+		if c.Priority < 0 {
+			return "candidate priority must not be negative"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/strct-org/portal/backend/internal/types/p2p"
+)
+
+func TestNormalizeCandidates(t *testing.T) {
+	host := func(addr string, port int, protocol string) p2p.Candidate {
+		return p2p.Candidate{Type: p2p.CandidateHost, Address: addr, Port: port, Protocol: protocol}
+	}
+
+	tests := []struct {
+		name       string
+		candidates []p2p.Candidate
+		valid      bool
+	}{
+		{"none", nil, true},
+		{"host", []p2p.Candidate{host("192.168.1.10", 4000, "udp")}, true},
+		{"reflexive tcp", []p2p.Candidate{{Type: p2p.CandidateReflexive, Address: "203.0.113.7", Port: 443, Protocol: "tcp"}}, true},
+		{"ipv6", []p2p.Candidate{host("2001:db8::1", 4000, "")}, true},
+		{"relay type", []p2p.Candidate{{Type: "relay", Address: "203.0.113.7", Port: 443}}, false},
+		{"hostname", []p2p.Candidate{host("nas.local", 4000, "udp")}, false},
+		{"port zero", []p2p.Candidate{host("192.168.1.10", 0, "udp")}, false},
+		{"port too high", []p2p.Candidate{host("192.168.1.10", 65536, "udp")}, false},
+		{"sctp", []p2p.Candidate{host("192.168.1.10", 4000, "sctp")}, false},
+		{"negative priority", []p2p.Candidate{{Type: p2p.CandidateHost, Address: "192.168.1.10", Port: 4000, Priority: -1}}, false},
+		{"too many", make([]p2p.Candidate, 17), false},
+	}
+
+	for _, tt := range tests {
+		if msg := normalizeCandidates(tt.candidates); (msg == "") != tt.valid {
+			t.Errorf("%s: message %q, want valid %v", tt.name, msg, tt.valid)
+		}
+	}
+
+	mapped := []p2p.Candidate{host("::ffff:192.168.1.10", 4000, "")}
+	if msg := normalizeCandidates(mapped); msg != "" {
+		t.Fatal(msg)
+	}
+	if mapped[0].Address != "192.168.1.10" || mapped[0].Protocol != "udp" {
+		t.Errorf("normalized to %+v, want the unmapped IPv4 address over udp", mapped[0])
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/strct-org/portal/backend/internal/metrics"
+	"github.com/strct-org/portal/backend/internal/payments"
+	"github.com/strct-org/portal/backend/internal/services"
+)
+
+// maxPaymentWebhookBody is well above any event the providers send.
+const maxPaymentWebhookBody = 1 << 20
+
+// paymentEvents is the part of services.PaymentService the handler uses.
+type paymentEvents interface {
+	CheckoutCompleted(ctx context.Context, provider string, ev *payments.Event) error
+	InvoicePaid(ctx context.Context, provider string, ev *payments.Event) error
+	SubscriptionCancelled(ctx context.Context, provider string, ev *payments.Event) error
+	Refunded(ctx context.Context, provider string, ev *payments.Event) error
+}
+
+type PaymentWebhookHandler struct {
+	provider       payments.Provider
+	paymentService paymentEvents
+}
+
+// NewPaymentWebhookHandler rejects every delivery when provider is nil, i.e.
+// when no webhook secret is configured.
+func NewPaymentWebhookHandler(provider payments.Provider, paymentService *services.PaymentService) *PaymentWebhookHandler {
+	return &PaymentWebhookHandler{
+		provider:       provider,
+		paymentService: paymentService,
+	}
+}
+
+func (h *PaymentWebhookHandler) HandlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if h.provider == nil {
+		http.Error(w, "Payments not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPaymentWebhookBody))
+	if err != nil {
+		log.Printf("Error reading payment webhook body: %v", err)
+		h.record("unknown", metrics.WebhookOutcomeBadRequest)
+		http.Error(w, "Error reading body", http.StatusBadRequest)
+		return
+	}
+
+	event, err := h.provider.ParseWebhook(r.Header, payload)
+	switch {
+	case errors.Is(err, payments.ErrInvalidSignature):
+		log.Printf("Payment webhook signature verification failed")
+		h.record("unknown", metrics.WebhookOutcomeInvalidSignature)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	case errors.Is(err, payments.ErrUnsupportedEvent):
+		log.Printf("Unhandled payment webhook event type: %s", event.ProviderType)
+		h.record(event.ProviderType, metrics.WebhookOutcomeUnhandled)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"success": true}`))
+		return
+	case err != nil:
+		log.Printf("Error parsing payment webhook: %v", err)
+		h.record("unknown", metrics.WebhookOutcomeBadRequest)
+		http.Error(w, "Error parsing webhook", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Received payment webhook event: %s (%s)", event.Type, event.ID)
+
+	ctx := r.Context()
+	provider := h.provider.Name()
+
+	switch event.Type {
+	case payments.CheckoutCompleted:
+		err = h.paymentService.CheckoutCompleted(ctx, provider, event)
+	case payments.InvoicePaid:
+		err = h.paymentService.InvoicePaid(ctx, provider, event)
+	case payments.SubscriptionCancelled:
+		err = h.paymentService.SubscriptionCancelled(ctx, provider, event)
+	case payments.Refunded:
+		err = h.paymentService.Refunded(ctx, provider, event)
+	}
+
+	switch {
+	case errors.Is(err, services.ErrDuplicatePaymentEvent):
+		log.Printf("Payment event %s already processed", event.ID)
+		h.record(string(event.Type), metrics.WebhookOutcomeDuplicate)
+	case errors.Is(err, services.ErrUnknownPlan), errors.Is(err, services.ErrOrderNotFound):
+		// Redelivery can't fix these; acknowledge and leave them to support
+		log.Printf("WARNING: Ignoring payment event %s: %v", event.ID, err)
+		h.record(string(event.Type), metrics.WebhookOutcomeUnhandled)
+	case err != nil:
+		// Includes events that arrive before the account or subscription
+		// they refer to, which succeed once the provider redelivers them
+		log.Printf("Error handling payment event %s (%s): %v", event.ID, event.Type, err)
+		h.record(string(event.Type), metrics.WebhookOutcomeError)
+		http.Error(w, "Error processing webhook", http.StatusInternalServerError)
+		return
+	default:
+		h.record(string(event.Type), metrics.WebhookOutcomeProcessed)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"success": true}`))
+}
+
+func (h *PaymentWebhookHandler) record(eventType, outcome string) {
+	metrics.WebhookEvents.WithLabelValues(h.provider.Name(), eventType, outcome).Inc()
+}
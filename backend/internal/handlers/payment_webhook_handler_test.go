@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/strct-org/portal/backend/internal/payments"
+	"github.com/strct-org/portal/backend/internal/services"
+)
+
+// These cases are all decided before the event reaches the payment service,
+// so they run without a database.
+func TestHandlePaymentWebhookRejectsBeforeProcessing(t *testing.T) {
+	fake := payments.NewFakeProvider("whsec_test")
+
+	unsupported, unsupportedHeader, err := fake.Webhook(&payments.Event{ID: "evt_1", Type: "customer.created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refund, _, err := fake.Webhook(&payments.Event{ID: "evt_2", Type: payments.Refunded, Refund: &payments.Refund{PaymentID: "pi_1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	malformed := []byte(`{"id":`)
+
+	tests := []struct {
+		name     string
+		provider payments.Provider
+		payload  []byte
+		header   http.Header
+		want     int
+	}{
+		{"not configured", nil, refund, fake.Sign(refund), http.StatusServiceUnavailable},
+		{"unsigned", fake, refund, http.Header{}, http.StatusUnauthorized},
+		{"signed by someone else", fake, refund, payments.NewFakeProvider("whsec_other").Sign(refund), http.StatusUnauthorized},
+		{"tampered", fake, append(bytes.Clone(refund), ' '), fake.Sign(refund), http.StatusUnauthorized},
+		{"malformed", fake, malformed, fake.Sign(malformed), http.StatusBadRequest},
+		{"unsupported type", fake, unsupported, unsupportedHeader, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		h := NewPaymentWebhookHandler(tt.provider, nil)
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook/payments", bytes.NewReader(tt.payload))
+		req.Header = tt.header
+		rec := httptest.NewRecorder()
+		h.HandlePaymentWebhook(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d (%s)", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+}
+
+// fakePaymentEvents fails each event with the next error in errs, then
+// succeeds.
+type fakePaymentEvents struct {
+	errs []error
+}
+
+func (f *fakePaymentEvents) next() error {
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *fakePaymentEvents) CheckoutCompleted(context.Context, string, *payments.Event) error {
+	return f.next()
+}
+
+func (f *fakePaymentEvents) InvoicePaid(context.Context, string, *payments.Event) error {
+	return f.next()
+}
+
+func (f *fakePaymentEvents) SubscriptionCancelled(context.Context, string, *payments.Event) error {
+	return f.next()
+}
+
+func (f *fakePaymentEvents) Refunded(context.Context, string, *payments.Event) error {
+	return f.next()
+}
+
+func TestHandlePaymentWebhookOutcomes(t *testing.T) {
+	fake := payments.NewFakeProvider("whsec_test")
+	checkout, header, err := fake.Webhook(&payments.Event{ID: "evt_1", Type: payments.CheckoutCompleted, Checkout: &payments.Checkout{
+		SessionID:      "cs_1",
+		Mode:           payments.ModeSubscription,
+		ClerkID:        "user_1",
+		SubscriptionID: "sub_1",
+		Plan:           "plus",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"processed", nil, http.StatusOK},
+		{"duplicate", services.ErrDuplicatePaymentEvent, http.StatusOK},
+		{"unknown plan", services.ErrUnknownPlan, http.StatusOK},
+		{"order not found", services.ErrOrderNotFound, http.StatusOK},
+		{"account not created yet", services.ErrUserNotFound, http.StatusInternalServerError},
+		{"subscription not created yet", services.ErrSubscriptionNotFound, http.StatusInternalServerError},
+		{"database down", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		h := &PaymentWebhookHandler{provider: fake, paymentService: &fakePaymentEvents{errs: []error{tt.err}}}
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook/payments", bytes.NewReader(checkout))
+		req.Header = header.Clone()
+		rec := httptest.NewRecorder()
+		h.HandlePaymentWebhook(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+// A subscription checkout that beats Clerk's user.created webhook must be
+// retried rather than acknowledged, or the subscription is never recorded.
+func TestHandlePaymentWebhookRetriesCheckoutBeforeSignUp(t *testing.T) {
+	fake := payments.NewFakeProvider("whsec_test")
+	checkout, header, err := fake.Webhook(&payments.Event{ID: "evt_1", Type: payments.CheckoutCompleted, Checkout: &payments.Checkout{
+		SessionID:      "cs_1",
+		Mode:           payments.ModeSubscription,
+		Email:          "new@example.com",
+		SubscriptionID: "sub_1",
+		Plan:           "plus",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &fakePaymentEvents{errs: []error{services.ErrUserNotFound}}
+	h := &PaymentWebhookHandler{provider: fake, paymentService: svc}
+
+	for i, want := range []int{http.StatusInternalServerError, http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/payments", bytes.NewReader(checkout))
+		req.Header = header.Clone()
+		rec := httptest.NewRecorder()
+		h.HandlePaymentWebhook(rec, req)
+
+		if rec.Code != want {
+			t.Fatalf("delivery %d: got %d, want %d", i+1, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/privacy"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+const (
+	defaultSearchResults = 20
+	maxSearchResults     = 50
+	minSearchQuery       = 2
+	maxSearchQuery       = 254
+)
+
+type PrivacyHandler struct {
+	privacyService *services.PrivacyService
+}
+
+func NewPrivacyHandler(privacyService *services.PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{
+		privacyService: privacyService,
+	}
+}
+
+// SearchUsers finds users by username prefix or exact email. ?q= is the
+// query and ?limit= the number of results (default 20, max 50).
+func (h *PrivacyHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	q := r.URL.Query()
+	query := strings.TrimSpace(q.Get("q"))
+	if len(query) < minSearchQuery || len(query) > maxSearchQuery {
+		utils.RespondWithError(w, http.StatusBadRequest, "q must be between 2 and 254 characters")
+		return
+	}
+	limit := defaultSearchResults
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSearchResults {
+			utils.RespondWithError(w, http.StatusBadRequest, "limit must be between 1 and 50")
+			return
+		}
+		limit = n
+	}
+
+	users, err := h.privacyService.Search(ctx, clerkID, query, limit)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error searching users: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to search users")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, users)
+}
+
+func (h *PrivacyHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	settings, err := h.privacyService.GetSettings(ctx, clerkID)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting privacy settings: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get privacy settings")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the user's privacy settings.
+func (h *PrivacyHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req privacy.Settings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	settings, err := h.privacyService.UpdateSettings(ctx, clerkID, &req)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating privacy settings: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update privacy settings")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, settings)
+}
+
+func (h *PrivacyHandler) ListBlocks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	blocks, err := h.privacyService.ListBlocks(ctx, clerkID)
+	if err != nil {
+		log.Printf("Error listing blocked users: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list blocked users")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, blocks)
+}
+
+// BlockUser blocks a user, ending any friendship and shares with them.
+func (h *PrivacyHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	userID, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	err = h.privacyService.Block(ctx, clerkID, userID)
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	case errors.Is(err, services.ErrBlockSelf):
+		utils.RespondWithError(w, http.StatusBadRequest, "You cannot block yourself")
+		return
+	case err != nil:
+		log.Printf("Error blocking user %s: %v", userID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to block user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *PrivacyHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	userID, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User is not blocked")
+		return
+	}
+
+	err = h.privacyService.Unblock(ctx, clerkID, userID)
+	if errors.Is(err, services.ErrBlockNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User is not blocked")
+		return
+	}
+	if err != nil {
+		log.Printf("Error unblocking user %s: %v", userID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to unblock user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/relay"
+	"github.com/strct-org/portal/backend/internal/services"
+	relaytypes "github.com/strct-org/portal/backend/internal/types/relay"
+	"github.com/strct-org/portal/backend/internal/types/share"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+// relayTimeout replaces the server's read and write timeouts for relayed
+// requests, which may be large file transfers
+const relayTimeout = 30 * time.Minute
+
+const (
+	// relayLinkTTL is how long a link from CreateLink can be followed. It
+	// ends up in the address bar and logs, so it only has to last until the
+	// browser exchanges it for the cookie.
+	relayLinkTTL = time.Minute
+	// relaySessionTTL is how long the cookie keeps the browser signed in to
+	// the device. Access is still checked against the user's shares on every
+	// request.
+	relaySessionTTL = 12 * time.Hour
+
+	relayTokenParam = "relay_token"
+	// The __Host- prefix makes browsers refuse the cookie unless it is
+	// host-only, so no other device's subdomain can set or overwrite it
+	relayCookie = "__Host-strct_relay"
+)
+
+type relayAccessKey struct{}
+
+// RelayHandler accepts devices' relay tunnels and proxies users' requests
+// through them. Each device is served on its own host of the relay domain,
+// never on the API's origin, so pages a device serves can't read portal
+// responses or other devices'. The device receives the request as sent, with
+// these headers describing the user:
+//
+//	X-Strct-User-Id  the portal user ID
+//	X-Strct-Access   "owner" or "shared"
+//	X-Strct-Share    "<path>;<permission>", once per share, for shared access
+//
+// Shared access is limited to paths under the user's shares, and to safe
+// methods outside the ones shared for writing.
+//
+// API clients authenticate with a Bearer token. Browsers, which can't send one
+// when navigating, follow a link from CreateLink instead, whose token is
+// swapped for a host-only cookie on the device's host.
+type RelayHandler struct {
+	relay        *relay.Relay
+	relayService *services.RelayService
+	tokens       *relay.TokenSigner
+	domain       *relay.Domain
+	proxy        *httputil.ReverseProxy
+}
+
+// NewRelayHandler only accepts Bearer tokens when tokens is nil.
+func NewRelayHandler(r *relay.Relay, relayService *services.RelayService, tokens *relay.TokenSigner, domain *relay.Domain) *RelayHandler {
+	h := &RelayHandler{
+		relay:        r,
+		relayService: relayService,
+		tokens:       tokens,
+		domain:       domain,
+	}
+	h.proxy = &httputil.ReverseProxy{
+		Rewrite:   h.rewrite,
+		Transport: r.Transport(),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if errors.Is(err, relay.ErrNotConnected) {
+				utils.RespondWithError(w, http.StatusServiceUnavailable, "Device is not connected to the relay")
+				return
+			}
+			deviceID, _ := relayDeviceID(r)
+			log.Printf("Error relaying to device %s: %v", deviceID, err)
+			utils.RespondWithError(w, http.StatusBadGateway, "Device did not respond")
+		},
+	}
+	return h
+}
+
+// Connect is the device end: it upgrades to a WebSocket carrying the tunnel.
+func (h *RelayHandler) Connect(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := middleware.GetDeviceID(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	ws, err := deviceUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	if err := h.relay.Serve(deviceID, ws); err != nil && !errors.Is(err, relay.ErrClosing) {
+		log.Printf("Relay tunnel of device %s failed: %v", deviceID, err)
+	}
+}
+
+// CreateLink returns a short-lived link that opens the device in the browser.
+func (h *RelayHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
+	clerkID, ok := middleware.GetClerkID(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	if h.tokens == nil {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Relay links are not configured")
+		return
+	}
+	deviceID := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.relayService.Authorize(ctx, clerkID, deviceID); err != nil {
+		if errors.Is(err, services.ErrDeviceNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+			return
+		}
+		log.Printf("Error authorizing relay link to device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create relay link")
+		return
+	}
+
+	deviceURL, ok := h.domain.DeviceURL(deviceID)
+	if !ok {
+		utils.RespondWithError(w, http.StatusConflict, "The device ID is too long to open the device in the browser")
+		return
+	}
+	expires := time.Now().Add(relayLinkTTL)
+	utils.RespondWithJSON(w, http.StatusOK, relaytypes.Link{
+		URL:       deviceURL + "?" + relayTokenParam + "=" + url.QueryEscape(h.tokens.Sign(clerkID, deviceID, expires)),
+		ExpiresAt: expires,
+	})
+}
+
+// Authenticate authenticates the user end with a Bearer token, a link from
+// CreateLink or the cookie that link sets. The cookie is host-only and
+// SameSite=Lax, and requests carrying it from another origin are refused, so
+// other sites and other devices can link to the device but can't make
+// requests through it.
+func (h *RelayHandler) Authenticate(next http.Handler) http.Handler {
+	bearer := middleware.ClerkAuthMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deviceID, ok := relayDeviceID(r)
+		if !ok {
+			utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+			return
+		}
+		if r.Header.Get("Authorization") != "" || h.tokens == nil {
+			bearer.ServeHTTP(w, r)
+			return
+		}
+
+		if token := r.URL.Query().Get(relayTokenParam); token != "" {
+			clerkID, err := h.tokens.Verify(token, deviceID, time.Now())
+			if err != nil {
+				utils.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired relay link")
+				return
+			}
+
+			expires := time.Now().Add(relaySessionTTL)
+			http.SetCookie(w, &http.Cookie{
+				Name:     relayCookie,
+				Value:    h.tokens.Sign(clerkID, deviceID, expires),
+				Path:     "/",
+				Expires:  expires,
+				Secure:   true,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+
+			// Take the token out of the address bar before the device sees it
+			u := *r.URL
+			q := u.Query()
+			q.Del(relayTokenParam)
+			u.RawQuery = q.Encode()
+			http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+			return
+		}
+
+		cookie, err := r.Cookie(relayCookie)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Authorization header or relay link required")
+			return
+		}
+		// Devices are same-site with each other unless the relay domain is a
+		// public suffix, so SameSite alone doesn't stop one device's pages
+		// from sending requests to another
+		if origin := r.Header.Get("Origin"); origin != "" && origin != h.domain.Origin(r.Host) {
+			utils.RespondWithError(w, http.StatusForbidden, "Cross-origin requests to devices are not allowed")
+			return
+		}
+		clerkID, err := h.tokens.Verify(cookie.Value, deviceID, time.Now())
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Relay session expired, open the device again from the portal")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), middleware.ClerkIDKey, clerkID)))
+	})
+}
+
+// Proxy is the user end.
+func (h *RelayHandler) Proxy(w http.ResponseWriter, r *http.Request) {
+	clerkID, ok := middleware.GetClerkID(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	deviceID, ok := relayDeviceID(r)
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+
+	access, err := h.authorize(r.Context(), clerkID, deviceID)
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	var entErr *services.EntitlementError
+	if errors.As(err, &entErr) && access != nil && !access.Owner {
+		utils.RespondWithError(w, http.StatusForbidden, "The device owner's relay allowance for this month is used up")
+		return
+	}
+	if respondEntitlementError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error authorizing relay to device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to authorize relay")
+		return
+	}
+
+	if !access.Owner {
+		shared, writable := grantsFor(access, devicePath(r.URL.Path))
+		if !shared {
+			utils.RespondWithError(w, http.StatusForbidden, "This path of the device isn't shared with you")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !writable {
+				utils.RespondWithError(w, http.StatusForbidden, "Your share of this path is read-only")
+				return
+			}
+		}
+	}
+	// Upgraded connections would bypass the bandwidth accounting
+	if r.Header.Get("Upgrade") != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Connection upgrades are not supported through the relay")
+		return
+	}
+	if !h.relay.Connected(deviceID) {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Device is not connected to the relay")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(relayTimeout)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		log.Printf("Warning: can't extend read deadline for relay: %v", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		log.Printf("Warning: can't extend write deadline for relay: %v", err)
+	}
+
+	in := &countingReader{r: r.Body}
+	r.Body = in
+	out := &countingWriter{ResponseWriter: w}
+
+	h.proxy.ServeHTTP(out, r.WithContext(context.WithValue(r.Context(), relayAccessKey{}, access)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.relayService.RecordUsage(ctx, access, in.n.Load(), out.n.Load()); err != nil {
+		log.Printf("Error recording relay usage of device %s: %v", deviceID, err)
+	}
+}
+
+func (h *RelayHandler) authorize(ctx context.Context, clerkID, deviceID string) (*relaytypes.Access, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	access, err := h.relayService.Authorize(ctx, clerkID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return access, h.relayService.CheckAllowance(ctx, access)
+}
+
+func (h *RelayHandler) rewrite(pr *httputil.ProxyRequest) {
+	access := pr.In.Context().Value(relayAccessKey{}).(*relaytypes.Access)
+
+	pr.Out.URL.Scheme = "http"
+	pr.Out.URL.Host = relay.Host(access.DeviceID)
+	pr.Out.Host = ""
+	pr.Out.URL.Path = devicePath(pr.In.URL.Path)
+	pr.Out.URL.RawPath = ""
+	pr.SetXForwarded()
+
+	// The user's portal credentials are no business of the device, and
+	// identity headers may only come from here
+	pr.Out.Header.Del("Authorization")
+	pr.Out.Header.Del("Cookie")
+	for key := range pr.Out.Header {
+		if strings.HasPrefix(key, "X-Strct-") {
+			pr.Out.Header.Del(key)
+		}
+	}
+
+	pr.Out.Header.Set("X-Strct-User-Id", access.UserID.String())
+	if access.Owner {
+		pr.Out.Header.Set("X-Strct-Access", "owner")
+		return
+	}
+	pr.Out.Header.Set("X-Strct-Access", "shared")
+	for _, g := range access.Grants {
+		pr.Out.Header.Add("X-Strct-Share", g.Path+";"+g.Permission)
+	}
+}
+
+// relayDeviceID is the device whose relay host r was sent to.
+func relayDeviceID(r *http.Request) (string, bool) {
+	return relay.DeviceID(mux.Vars(r)["label"])
+}
+
+// devicePath is the path a relayed request asks the device for, cleaned so
+// the share check and the device see the same path. A trailing slash is
+// kept, since it matters to most web servers.
+func devicePath(urlPath string) string {
+	clean := path.Clean("/" + urlPath)
+	if strings.HasSuffix(urlPath, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+
+// grantsFor reports whether any of the user's shares covers p, and whether
+// one of those is shared for writing.
+func grantsFor(access *relaytypes.Access, p string) (shared, writable bool) {
+	for _, g := range access.Grants {
+		if g.Path != "/" && p != g.Path && !strings.HasPrefix(p, g.Path+"/") {
+			continue
+		}
+		shared = true
+		if g.Permission == share.PermissionWrite {
+			writable = true
+		}
+	}
+	return shared, writable
+}
+
+// countingReader counts request bytes sent towards the device.
+type countingReader struct {
+	r io.ReadCloser
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func (c *countingReader) Close() error { return c.r.Close() }
+
+// countingWriter counts response bytes received from the device.
+type countingWriter struct {
+	http.ResponseWriter
+	n atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach Flush on the real writer, which
+// the proxy uses to stream responses.
+func (c *countingWriter) Unwrap() http.ResponseWriter { return c.ResponseWriter }
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/relay"
+	relaytypes "github.com/strct-org/portal/backend/internal/types/relay"
+	"github.com/strct-org/portal/backend/internal/types/share"
+	"github.com/strct-org/portal/backend/middleware"
+)
+
+func TestDevicePath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/photos", "/photos"},
+		{"/photos/", "/photos/"},
+		{"/photos/../secret", "/secret"},
+		{"//photos/./a.jpg", "/photos/a.jpg"},
+		{"/../../etc", "/etc"},
+	}
+	for _, tt := range tests {
+		if got := devicePath(tt.in); got != tt.want {
+			t.Errorf("devicePath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGrantsFor(t *testing.T) {
+	access := &relaytypes.Access{Grants: []relaytypes.Grant{
+		{Path: "/photos", Permission: share.PermissionRead},
+		{Path: "/photos/uploads", Permission: share.PermissionWrite},
+	}}
+
+	tests := []struct {
+		path         string
+		wantShared   bool
+		wantWritable bool
+	}{
+		{"/photos", true, false},
+		{"/photos/", true, false},
+		{"/photos/a.jpg", true, false},
+		{"/photos/uploads/b.jpg", true, true},
+		{"/photos2", false, false},
+		{"/", false, false},
+		{"/documents/c.pdf", false, false},
+	}
+	for _, tt := range tests {
+		shared, writable := grantsFor(access, tt.path)
+		if shared != tt.wantShared || writable != tt.wantWritable {
+			t.Errorf("grantsFor(%q) = %v, %v; want %v, %v", tt.path, shared, writable, tt.wantShared, tt.wantWritable)
+		}
+	}
+
+	root := &relaytypes.Access{Grants: []relaytypes.Grant{{Path: "/", Permission: share.PermissionRead}}}
+	if shared, _ := grantsFor(root, "/anything"); !shared {
+		t.Error("a share of / doesn't cover the whole device")
+	}
+}
+
+func TestRelayAuthenticate(t *testing.T) {
+	tokens := relay.NewTokenSigner([]byte(strings.Repeat("k", 32)))
+	domain, err := relay.ParseDomain("https://strct-relay.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &RelayHandler{tokens: tokens, domain: domain}
+	now := time.Now()
+
+	deviceURL, _ := domain.DeviceURL("dev-1")
+	host := strings.TrimSuffix(strings.TrimPrefix(deviceURL, "https://"), "/")
+	label, _, _ := strings.Cut(host, ".")
+
+	var gotClerkID string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotClerkID, _ = middleware.GetClerkID(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	session := tokens.Sign("user_1", "dev-1", now.Add(time.Hour))
+
+	tests := []struct {
+		name       string
+		label      string
+		target     string
+		cookie     string
+		origin     string
+		want       int
+		wantClerk  string
+		wantCookie bool
+	}{
+		{"nothing", label, "/", "", "", http.StatusUnauthorized, "", false},
+		{"unknown host", "not-a-label", "/", session, "", http.StatusNotFound, "", false},
+		{"link", label, "/?relay_token=" + tokens.Sign("user_1", "dev-1", now.Add(time.Minute)), "", "", http.StatusSeeOther, "", true},
+		{"expired link", label, "/?relay_token=" + tokens.Sign("user_1", "dev-1", now.Add(-time.Second)), "", "", http.StatusUnauthorized, "", false},
+		{"link for another device", label, "/?relay_token=" + tokens.Sign("user_1", "dev-2", now.Add(time.Minute)), "", "", http.StatusUnauthorized, "", false},
+		{"cookie", label, "/photos", session, "", http.StatusOK, "user_1", false},
+		{"cookie from the device's origin", label, "/photos", session, "https://" + host, http.StatusOK, "user_1", false},
+		{"cookie from another device", label, "/photos", session, "https://other.strct-relay.test", http.StatusForbidden, "", false},
+		{"cookie from the portal", label, "/photos", session, "https://portal.strct.test", http.StatusForbidden, "", false},
+		{"cookie for another device", label, "/photos", tokens.Sign("user_1", "dev-2", now.Add(time.Hour)), "", http.StatusUnauthorized, "", false},
+		{"forged cookie", label, "/photos", "user_1.forged", "", http.StatusUnauthorized, "", false},
+	}
+
+	for _, tt := range tests {
+		gotClerkID = ""
+		req := httptest.NewRequest(http.MethodGet, "https://"+host+tt.target, nil)
+		req = mux.SetURLVars(req, map[string]string{"label": tt.label})
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: relayCookie, Value: tt.cookie})
+		}
+		rec := httptest.NewRecorder()
+		h.Authenticate(next).ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d (%s)", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+		if gotClerkID != tt.wantClerk {
+			t.Errorf("%s: clerk ID %q, want %q", tt.name, gotClerkID, tt.wantClerk)
+		}
+		setCookie := rec.Result().Cookies()
+		if tt.wantCookie != (len(setCookie) == 1) {
+			t.Errorf("%s: set cookies %v", tt.name, setCookie)
+			continue
+		}
+		if tt.wantCookie {
+			if c := setCookie[0]; c.Domain != "" || c.Path != "/" || !c.Secure || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode {
+				t.Errorf("%s: cookie %+v isn't host-only", tt.name, c)
+			}
+			if loc := rec.Header().Get("Location"); loc != "/" {
+				t.Errorf("%s: redirected to %q, want the link without its token", tt.name, loc)
+			}
+		}
+	}
+}
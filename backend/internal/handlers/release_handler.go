@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/release"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+const (
+	// maxReleaseUpload fits the largest firmware image with room to spare
+	maxReleaseUpload = 2 << 30
+	// releaseUploadTimeout replaces the server's read and write timeouts,
+	// which are sized for API calls rather than image uploads
+	releaseUploadTimeout = 30 * time.Minute
+)
+
+var (
+	versionPattern  = regexp.MustCompile(`^v?\d+\.\d+\.\d+(-[0-9A-Za-z.]+)?$`)
+	platformPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+	filenamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+)
+
+type ReleaseHandler struct {
+	releaseService *services.ReleaseService
+}
+
+func NewReleaseHandler(releaseService *services.ReleaseService) *ReleaseHandler {
+	return &ReleaseHandler{
+		releaseService: releaseService,
+	}
+}
+
+func (h *ReleaseHandler) GetLatestRelease(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	q := r.URL.Query()
+	product, platform, channel := q.Get("product"), q.Get("platform"), q.Get("channel")
+	if channel == "" {
+		channel = release.ChannelStable
+	}
+	if msg := validateReleaseKey(product, platform, channel); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	rel, err := h.releaseService.Latest(ctx, product, platform, channel)
+	if errors.Is(err, services.ErrReleaseNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "No release for that product and platform")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting latest release: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get release")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, rel)
+}
+
+func (h *ReleaseHandler) UploadRelease(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(releaseUploadTimeout)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		log.Printf("Warning: can't extend read deadline for release upload: %v", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		log.Printf("Warning: can't extend write deadline for release upload: %v", err)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxReleaseUpload)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Request must be a multipart form within the upload size limit")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	form := release.UploadForm{
+		Product:   r.FormValue("product"),
+		Version:   r.FormValue("version"),
+		Channel:   r.FormValue("channel"),
+		Platform:  r.FormValue("platform"),
+		SHA256:    r.FormValue("sha256"),
+		Signature: r.FormValue("signature"),
+		Notes:     r.FormValue("notes"),
+	}
+	if form.Channel == "" {
+		form.Channel = release.ChannelStable
+	}
+	if msg := validateReleaseKey(form.Product, form.Platform, form.Channel); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if !versionPattern.MatchString(form.Version) {
+		utils.RespondWithError(w, http.StatusBadRequest, "version must look like 1.2.3 or 1.2.3-beta.1")
+		return
+	}
+	if form.Signature == "" && form.Product != release.ProductDesktopSync {
+		utils.RespondWithError(w, http.StatusBadRequest, "firmware releases must be signed")
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Form must include file")
+		return
+	}
+	defer file.Close()
+	if !filenamePattern.MatchString(header.Filename) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Filename may only contain letters, digits, '.', '_' and '-'")
+		return
+	}
+
+	rel, err := h.releaseService.Publish(r.Context(), &form, header.Filename, file)
+	switch {
+	case errors.Is(err, services.ErrReleaseExists):
+		utils.RespondWithError(w, http.StatusConflict, "That version is already published for this product, platform and channel")
+		return
+	case errors.Is(err, services.ErrChecksumMismatch):
+		utils.RespondWithError(w, http.StatusUnprocessableEntity, "sha256 does not match the uploaded file")
+		return
+	case err != nil:
+		log.Printf("Error publishing release %s %s: %v", form.Product, form.Version, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to publish release")
+		return
+	}
+
+	log.Printf("Published %s %s (%s, %s)", rel.Product, rel.Version, rel.Platform, rel.Channel)
+	utils.RespondWithJSON(w, http.StatusCreated, rel)
+}
+
+// validateReleaseKey returns a message describing the first invalid field, or
+// "" when all are valid.
+func validateReleaseKey(product, platform, channel string) string {
+	if !slices.Contains(release.Products, product) {
+		return "product must be one of beestation-firmware, beedrive-firmware or desktop-sync"
+	}
+	if !platformPattern.MatchString(platform) {
+		return "platform is required, e.g. arm64 or windows-x64"
+	}
+	if channel != release.ChannelStable && channel != release.ChannelBeta {
+		return "channel must be stable or beta"
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateReleaseKey(t *testing.T) {
+	tests := []struct {
+		product, platform, channel string
+		valid                      bool
+	}{
+		{"beestation-firmware", "arm64", "stable", true},
+		{"desktop-sync", "windows-x64", "beta", true},
+
+		{"", "arm64", "stable", false},
+		{"toaster-firmware", "arm64", "stable", false},
+		{"beestation-firmware", "", "stable", false},
+		{"beestation-firmware", "../etc", "stable", false},
+		{"beestation-firmware", "ARM64", "stable", false},
+		{"beestation-firmware", "arm64", "nightly", false},
+	}
+
+	for _, tt := range tests {
+		msg := validateReleaseKey(tt.product, tt.platform, tt.channel)
+		if (msg == "") != tt.valid {
+			t.Errorf("validateReleaseKey(%q, %q, %q) = %q, want valid %v", tt.product, tt.platform, tt.channel, msg, tt.valid)
+		}
+	}
+}
+
+func TestReleasePatterns(t *testing.T) {
+	versions := map[string]bool{
+		"1.2.3":         true,
+		"v1.2.3":        true,
+		"1.2.3-beta.1":  true,
+		"1.2":           false,
+		"1.2.3/../../x": false,
+		"latest":        false,
+	}
+	for v, want := range versions {
+		if got := versionPattern.MatchString(v); got != want {
+			t.Errorf("version %q: got %v, want %v", v, got, want)
+		}
+	}
+
+	filenames := map[string]bool{
+		"firmware-1.2.3.img": true,
+		"sync_setup.exe":     true,
+		".hidden":            false,
+		"../firmware.img":    false,
+		"dir/firmware.img":   false,
+		"":                   false,
+	}
+	for f, want := range filenames {
+		if got := filenamePattern.MatchString(f); got != want {
+			t.Errorf("filename %q: got %v, want %v", f, got, want)
+		}
+	}
+}
+
+func TestGetLatestReleaseRejectsInvalidQuery(t *testing.T) {
+	h := NewReleaseHandler(nil)
+
+	for _, target := range []string{
+		"/api/v1/releases/latest",
+		"/api/v1/releases/latest?product=desktop-sync",
+		"/api/v1/releases/latest?product=desktop-sync&platform=windows-x64&channel=nightly",
+	} {
+		rec := httptest.NewRecorder()
+		h.GetLatestRelease(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", target, rec.Code)
+		}
+	}
+}
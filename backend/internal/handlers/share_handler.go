@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/share"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+type ShareHandler struct {
+	shareService *services.ShareService
+}
+
+func NewShareHandler(shareService *services.ShareService) *ShareHandler {
+	return &ShareHandler{
+		shareService: shareService,
+	}
+}
+
+func (h *ShareHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req share.CreateShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := normalizeShareRequest(&req); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	sh, err := h.shareService.CreateShare(ctx, clerkID, mux.Vars(r)["id"], &req)
+	if respondEntitlementError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrDeviceNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "No user with that username or email")
+		return
+	case errors.Is(err, services.ErrShareWithSelf):
+		utils.RespondWithError(w, http.StatusBadRequest, "You can't share a device with yourself")
+		return
+	case err != nil:
+		log.Printf("Error creating share: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create share")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, sh)
+}
+
+// normalizeShareRequest fills defaults and returns a message describing the
+// first invalid field, or "" when req is valid.
+func normalizeShareRequest(req *share.CreateShareRequest) string {
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	if !strings.HasPrefix(req.Path, "/") {
+		return "path must be absolute"
+	}
+	req.Path = path.Clean(req.Path)
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return "expiresAt must be in the future"
+	}
+
+	switch req.Kind {
+	case share.KindUser:
+		req.Grantee = strings.TrimSpace(req.Grantee)
+		if req.Grantee == "" {
+			return "grantee is required for user shares"
+		}
+		if req.Permission == "" {
+			req.Permission = share.PermissionRead
+		}
+		if req.Permission != share.PermissionRead && req.Permission != share.PermissionWrite {
+			return "permission must be read or write"
+		}
+	case share.KindLink:
+		if req.Permission != "" && req.Permission != share.PermissionRead {
+			return "public links are read-only"
+		}
+		req.Permission = share.PermissionRead
+	default:
+		return "kind must be user or link"
+	}
+
+	return ""
+}
+
+func (h *ShareHandler) ListDeviceShares(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	shares, err := h.shareService.ListDeviceShares(ctx, clerkID, mux.Vars(r)["id"])
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing device shares: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list shares")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, shares)
+}
+
+func (h *ShareHandler) ListReceivedShares(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	shares, err := h.shareService.ListReceivedShares(ctx, clerkID)
+	if err != nil {
+		log.Printf("Error listing received shares: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list shares")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, shares)
+}
+
+func (h *ShareHandler) DeleteShare(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Share not found")
+		return
+	}
+
+	err = h.shareService.DeleteShare(ctx, clerkID, id)
+	if errors.Is(err, services.ErrShareNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Share not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting share %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete share")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResolveLink is public: holding the link is the authorisation.
+func (h *ShareHandler) ResolveLink(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	info, err := h.shareService.ResolveLink(ctx, mux.Vars(r)["token"])
+	if errors.Is(err, services.ErrShareNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "This link is invalid or has expired")
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving share link: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to resolve link")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondWithJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/plans"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/subscription"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+type SubscriptionHandler struct {
+	subscriptionService *services.SubscriptionService
+}
+
+func NewSubscriptionHandler(subscriptionService *services.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		subscriptionService: subscriptionService,
+	}
+}
+
+func (h *SubscriptionHandler) ListPlans(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.RespondWithJSON(w, http.StatusOK, plans.All())
+}
+
+func (h *SubscriptionHandler) GetEntitlements(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	ent, err := h.subscriptionService.Entitlements(ctx, clerkID)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading entitlements: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to load subscription")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, ent)
+}
+
+// respondEntitlementError writes 402 when a higher plan would allow the action
+// and 403 when no plan does. It reports whether err was an entitlement error.
+func respondEntitlementError(w http.ResponseWriter, err error) bool {
+	var entErr *services.EntitlementError
+	if !errors.As(err, &entErr) {
+		return false
+	}
+
+	body := subscription.LimitExceeded{
+		Feature:   entErr.Feature,
+		Plan:      entErr.Plan,
+		Limit:     entErr.Limit,
+		UpgradeTo: entErr.UpgradeTo,
+	}
+	if entErr.UpgradeTo != "" {
+		body.Error = "Your plan's limit is reached. Upgrade to " + plans.Get(entErr.UpgradeTo).Name + " to continue."
+		utils.RespondWithJSON(w, http.StatusPaymentRequired, body)
+	} else {
+		body.Error = "You have reached the maximum your plan allows."
+		utils.RespondWithJSON(w, http.StatusForbidden, body)
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/subscription"
+)
+
+func TestRespondEntitlementError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		handled bool
+		want    int
+	}{
+		{"upgrade available", &services.EntitlementError{Feature: "devices", Plan: subscription.PlanFree, Limit: 1, UpgradeTo: subscription.PlanPlus}, true, http.StatusPaymentRequired},
+		{"top plan", &services.EntitlementError{Feature: "devices", Plan: subscription.PlanPro, Limit: 10}, true, http.StatusForbidden},
+		{"wrapped", fmt.Errorf("failed to pair: %w", &services.EntitlementError{Feature: "devices", UpgradeTo: subscription.PlanPro}), true, http.StatusPaymentRequired},
+		{"other error", errors.New("connection refused"), false, 0},
+		{"no error", nil, false, 0},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		if handled := respondEntitlementError(rec, tt.err); handled != tt.handled {
+			t.Errorf("%s: handled = %v, want %v", tt.name, handled, tt.handled)
+			continue
+		}
+		if !tt.handled {
+			continue
+		}
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		var body subscription.LimitExceeded
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Feature != "devices" || body.Error == "" {
+			t.Errorf("%s: body %+v, %v", tt.name, body, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/types/vpn"
+	wg "github.com/strct-org/portal/backend/internal/vpn"
+	"github.com/strct-org/portal/backend/middleware"
+	"github.com/strct-org/portal/backend/utils"
+)
+
+type VPNHandler struct {
+	vpnService *services.VPNService
+}
+
+func NewVPNHandler(vpnService *services.VPNService) *VPNHandler {
+	return &VPNHandler{
+		vpnService: vpnService,
+	}
+}
+
+// GetClientConfig returns the owner's wg-quick config for the device,
+// issuing a key pair on first download. The private key isn't kept, so later
+// downloads have to rotate it.
+func (h *VPNHandler) GetClientConfig(w http.ResponseWriter, r *http.Request) {
+	h.clientConfig(w, r, false)
+}
+
+// RotateClientConfig replaces the owner's client key and returns the new
+// config.
+func (h *VPNHandler) RotateClientConfig(w http.ResponseWriter, r *http.Request) {
+	h.clientConfig(w, r, true)
+}
+
+func (h *VPNHandler) clientConfig(w http.ResponseWriter, r *http.Request, rotate bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	deviceID := mux.Vars(r)["id"]
+	config, err := h.vpnService.ClientConfig(ctx, clerkID, deviceID, rotate)
+	if h.respondVPNError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error issuing vpn config for device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to issue VPN config")
+		return
+	}
+
+	// The config carries the client's private key
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="strct-vpn.conf"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(config)
+}
+
+func (h *VPNHandler) RevokeClientConfig(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	err := h.vpnService.RevokeClient(ctx, clerkID, mux.Vars(r)["id"])
+	if h.respondVPNError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking vpn client: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to revoke VPN config")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *VPNHandler) RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	err := h.vpnService.RevokeDevice(ctx, clerkID, mux.Vars(r)["id"])
+	if h.respondVPNError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking vpn device: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to remove device from the VPN")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegisterDeviceKey is called by a device to join the VPN or rotate its key.
+func (h *VPNHandler) RegisterDeviceKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deviceID, ok := middleware.GetDeviceID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	var req vpn.RegisterKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !wg.ValidKey(req.PublicKey) {
+		utils.RespondWithError(w, http.StatusBadRequest, "publicKey must be a base64 WireGuard key")
+		return
+	}
+
+	cfg, err := h.vpnService.RegisterDevice(ctx, deviceID, req.PublicKey)
+	if h.respondVPNError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error registering vpn key of device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to register key")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, cfg)
+}
+
+func (h *VPNHandler) GetDeviceConfig(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deviceID, ok := middleware.GetDeviceID(ctx)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Device not authenticated")
+		return
+	}
+
+	cfg, err := h.vpnService.DeviceConfig(ctx, deviceID)
+	if errors.Is(err, services.ErrVPNNotEnabled) {
+		utils.RespondWithError(w, http.StatusNotFound, "Register a key to join the VPN")
+		return
+	}
+	if h.respondVPNError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting vpn config of device %s: %v", deviceID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get VPN config")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, cfg)
+}
+
+// ListGatewayPeers is polled by the gateway to sync its peer list.
+func (h *VPNHandler) ListGatewayPeers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	peers, err := h.vpnService.GatewayPeers(ctx)
+	if h.respondVPNError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing vpn peers: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list VPN peers")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, peers)
+}
+
+// respondVPNError writes the response for expected VPN errors and reports
+// whether it did.
+func (h *VPNHandler) respondVPNError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrVPNDisabled):
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "The VPN is not available right now")
+	case errors.Is(err, services.ErrDeviceNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found")
+	case errors.Is(err, services.ErrVPNPeerNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "No VPN config to revoke")
+	case errors.Is(err, services.ErrVPNNotEnabled):
+		utils.RespondWithError(w, http.StatusConflict, "The device hasn't joined the VPN yet")
+	case errors.Is(err, services.ErrVPNConfigIssued):
+		utils.RespondWithError(w, http.StatusConflict, "Your VPN config was already downloaded. Rotate the key to get a new one")
+	case errors.Is(err, services.ErrVPNKeyInUse):
+		utils.RespondWithError(w, http.StatusConflict, "That key is already in use")
+	case errors.Is(err, services.ErrVPNSubnetFull):
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "No VPN addresses are left")
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/strct-org/portal/backend/internal/services"
+)
+
+func TestRespondVPNError(t *testing.T) {
+	tests := []struct {
+		err     error
+		want    int
+		handled bool
+	}{
+		{services.ErrVPNDisabled, http.StatusServiceUnavailable, true},
+		{services.ErrDeviceNotFound, http.StatusNotFound, true},
+		{services.ErrVPNPeerNotFound, http.StatusNotFound, true},
+		{services.ErrVPNNotEnabled, http.StatusConflict, true},
+		{services.ErrVPNConfigIssued, http.StatusConflict, true},
+		{services.ErrVPNKeyInUse, http.StatusConflict, true},
+		{services.ErrVPNSubnetFull, http.StatusServiceUnavailable, true},
+		{fmt.Errorf("failed to issue client config: %w", services.ErrVPNConfigIssued), http.StatusConflict, true},
+		{errors.New("connection refused"), 0, false},
+		{nil, 0, false},
+	}
+
+	h := &VPNHandler{}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		if handled := h.respondVPNError(rec, tt.err); handled != tt.handled {
+			t.Errorf("%v: handled = %v, want %v", tt.err, handled, tt.handled)
+			continue
+		}
+		if tt.handled && rec.Code != tt.want {
+			t.Errorf("%v: got %d, want %d", tt.err, rec.Code, tt.want)
+		}
+	}
+}
@@ -3,12 +3,14 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 
+	"github.com/strct-org/portal/backend/internal/metrics"
 	"github.com/strct-org/portal/backend/internal/services"
 	"github.com/strct-org/portal/backend/internal/types/clerk"
 	"github.com/strct-org/portal/backend/internal/types/user"
@@ -17,12 +19,16 @@ import (
 )
 
 type WebhookHandler struct {
-	userService *services.UserService
+	userService   *services.UserService
+	friendService *services.FriendService
+	orderService  *services.OrderService
 }
 
-func NewWebhookHandler(userService *services.UserService) *WebhookHandler {
+func NewWebhookHandler(userService *services.UserService, friendService *services.FriendService, orderService *services.OrderService) *WebhookHandler {
 	return &WebhookHandler{
-		userService: userService,
+		userService:   userService,
+		friendService: friendService,
+		orderService:  orderService,
 	}
 }
 
@@ -30,11 +36,13 @@ func (h *WebhookHandler) HandleClerkWebhook(w http.ResponseWriter, r *http.Reque
 	payload, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf("Error reading webhook body: %v", err)
+		recordClerkWebhook("unknown", metrics.WebhookOutcomeBadRequest)
 		http.Error(w, "Error reading body", http.StatusBadRequest)
 		return
 	}
 
 	if !h.verifyWebhookSignature(r.Header, payload) {
+		recordClerkWebhook("unknown", metrics.WebhookOutcomeInvalidSignature)
 		http.Error(w, "Invalid signature", http.StatusUnauthorized)
 		return
 	}
@@ -42,6 +50,7 @@ func (h *WebhookHandler) HandleClerkWebhook(w http.ResponseWriter, r *http.Reque
 	var event clerk.ClerkWebhookEvent
 	if err := json.Unmarshal(payload, &event); err != nil {
 		log.Printf("Error parsing webhook JSON: %v", err)
+		recordClerkWebhook("unknown", metrics.WebhookOutcomeBadRequest)
 		http.Error(w, "Error parsing webhook", http.StatusBadRequest)
 		return
 	}
@@ -54,6 +63,7 @@ func (h *WebhookHandler) HandleClerkWebhook(w http.ResponseWriter, r *http.Reque
 	case "user.created":
 		if err := h.handleUserCreated(ctx, event.Data); err != nil {
 			log.Printf("Error handling user.created: %v", err)
+			recordClerkWebhook(event.Type, metrics.WebhookOutcomeError)
 			http.Error(w, "Error processing webhook", http.StatusInternalServerError)
 			return
 		}
@@ -68,18 +78,28 @@ func (h *WebhookHandler) HandleClerkWebhook(w http.ResponseWriter, r *http.Reque
 	case "user.deleted":
 		if err := h.handleUserDeleted(ctx, event.Data); err != nil {
 			log.Printf("Error handling user.deleted: %v", err)
+			recordClerkWebhook(event.Type, metrics.WebhookOutcomeError)
 			http.Error(w, "Error processing webhook", http.StatusInternalServerError)
 			return
 		}
 
 	default:
 		log.Printf("Unhandled webhook event type: %s", event.Type)
+		recordClerkWebhook(event.Type, metrics.WebhookOutcomeUnhandled)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"success": true}`))
+		return
 	}
 
+	recordClerkWebhook(event.Type, metrics.WebhookOutcomeProcessed)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"success": true}`))
 }
 
+func recordClerkWebhook(eventType, outcome string) {
+	metrics.WebhookEvents.WithLabelValues("clerk", eventType, outcome).Inc()
+}
+
 func (h *WebhookHandler) verifyWebhookSignature(headers http.Header, payload []byte) bool {
 	secret := os.Getenv("CLERK_WEBHOOK_SECRET")
 	if secret == "" {
@@ -179,6 +199,20 @@ func (h *WebhookHandler) handleUserCreated(ctx context.Context, data json.RawMes
 		h.userService.UpdateEmailVerification(ctx, userData.ID, true)
 	}
 
+	// 8. Turn invitations sent to this email into friendships
+	if err := h.friendService.ClaimInvites(ctx, u.ID, email, emailVerified); err != nil {
+		return fmt.Errorf("failed to claim friend invites: %w", err)
+	}
+
+	// 9. Attach orders placed as a guest with this email
+	claimed, err := h.orderService.ClaimGuestOrders(ctx, u.ID, email, emailVerified)
+	if err != nil {
+		return fmt.Errorf("failed to claim guest orders: %w", err)
+	}
+	if claimed > 0 {
+		log.Printf("Attached %d guest orders to user %s", claimed, u.ID)
+	}
+
 	log.Printf("Successfully created user: %s", u.ID)
 	return nil
 }
@@ -224,6 +258,11 @@ func (h *WebhookHandler) handleUserDeleted(ctx context.Context, data json.RawMes
 	}
 
 	if err := h.userService.DeleteUserByClerkID(ctx, userData.ID); err != nil {
+		// Accounts deleted from the portal are removed locally before Clerk
+		if errors.Is(err, services.ErrUserNotFound) {
+			log.Printf("User already deleted: Clerk ID: %s", userData.ID)
+			return nil
+		}
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
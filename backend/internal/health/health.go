@@ -0,0 +1,165 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CheckFunc func(ctx context.Context) error
+
+type CheckResult struct {
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+	Cached     bool    `json:"cached,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+type check struct {
+	name    string
+	timeout time.Duration
+	ttl     time.Duration
+	fn      CheckFunc
+	// full checks only run on full probes
+	full bool
+
+	mu       sync.Mutex
+	last     CheckResult
+	lastTime time.Time
+}
+
+// Checker aggregates readiness checks. An instance only reports ready once it
+// has been marked warm (database reachable, migrations applied) and until it
+// starts shutting down.
+type Checker struct {
+	checks []*check
+
+	warm         atomic.Bool
+	shuttingDown atomic.Bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add registers a check that runs on every readiness probe.
+func (c *Checker) Add(name string, timeout time.Duration, fn CheckFunc) {
+	c.AddCached(name, timeout, 0, fn)
+}
+
+// AddCached registers a check whose result is reused for ttl, for checks
+// against external services that shouldn't be hit on every probe.
+func (c *Checker) AddCached(name string, timeout, ttl time.Duration, fn CheckFunc) {
+	c.checks = append(c.checks, &check{name: name, timeout: timeout, ttl: ttl, fn: fn})
+}
+
+// AddFull registers a check that light probes skip, with its result reused
+// for ttl. Use it for dependencies that scale to zero, such as NeonDB, which
+// probes every few seconds would keep awake.
+func (c *Checker) AddFull(name string, timeout, ttl time.Duration, fn CheckFunc) {
+	c.checks = append(c.checks, &check{name: name, timeout: timeout, ttl: ttl, fn: fn, full: true})
+}
+
+func (c *Checker) MarkWarm() {
+	c.warm.Store(true)
+}
+
+func (c *Checker) IsWarm() bool {
+	return c.warm.Load()
+}
+
+// MarkShuttingDown makes readiness fail so load balancers stop routing new
+// traffic while in-flight requests drain.
+func (c *Checker) MarkShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready runs the readiness checks. Checks added with AddFull are skipped
+// unless full is set.
+func (c *Checker) Ready(ctx context.Context, full bool) Report {
+	var checks []*check
+	for _, ch := range c.checks {
+		if full || !ch.full {
+			checks = append(checks, ch)
+		}
+	}
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks)+1)}
+
+	switch {
+	case c.shuttingDown.Load():
+		report.Checks["lifecycle"] = CheckResult{Status: StatusFail, Error: "shutting down"}
+	case !c.warm.Load():
+		report.Checks["lifecycle"] = CheckResult{Status: StatusFail, Error: "warming up"}
+	default:
+		report.Checks["lifecycle"] = CheckResult{Status: StatusOK}
+	}
+
+	var wg sync.WaitGroup
+	results := make([]CheckResult, len(checks))
+	for i, ch := range checks {
+		wg.Add(1)
+		go func(i int, ch *check) {
+			defer wg.Done()
+			results[i] = ch.run(ctx)
+		}(i, ch)
+	}
+	wg.Wait()
+
+	for i, ch := range checks {
+		report.Checks[ch.name] = results[i]
+	}
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+			break
+		}
+	}
+
+	return report
+}
+
+func (ch *check) run(ctx context.Context) CheckResult {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.ttl > 0 && !ch.lastTime.IsZero() && time.Since(ch.lastTime) < ch.ttl {
+		cached := ch.last
+		cached.Cached = true
+		return cached
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ch.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := ch.fn(ctx)
+	result := CheckResult{
+		Status:     StatusOK,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Error = "timed out"
+		}
+	}
+
+	ch.last = result
+	ch.lastTime = time.Now()
+	return result
+}
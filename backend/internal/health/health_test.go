@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckerReady(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name         string
+		warm         bool
+		shuttingDown bool
+		full         bool
+		database     CheckFunc
+		wantStatus   string
+		wantChecks   []string
+	}{
+		{"warming up", false, false, false, ok, StatusFail, []string{"lifecycle", "jwks"}},
+		{"ready", true, false, false, ok, StatusOK, []string{"lifecycle", "jwks"}},
+		{"database skipped on routine probes", true, false, false, down, StatusOK, []string{"lifecycle", "jwks"}},
+		{"full probe checks database", true, false, true, ok, StatusOK, []string{"lifecycle", "jwks", "database"}},
+		{"full probe reports database down", true, false, true, down, StatusFail, []string{"lifecycle", "jwks", "database"}},
+		{"shutting down", true, true, false, ok, StatusFail, []string{"lifecycle", "jwks"}},
+	}
+
+	for _, tt := range tests {
+		c := NewChecker()
+		c.Add("jwks", time.Second, ok)
+		c.AddFull("database", time.Second, 0, tt.database)
+		if tt.warm {
+			c.MarkWarm()
+		}
+		if tt.shuttingDown {
+			c.MarkShuttingDown()
+		}
+
+		report := c.Ready(context.Background(), tt.full)
+		if report.Status != tt.wantStatus {
+			t.Errorf("%s: status %q, want %q", tt.name, report.Status, tt.wantStatus)
+		}
+		if len(report.Checks) != len(tt.wantChecks) {
+			t.Errorf("%s: checks %v, want %v", tt.name, report.Checks, tt.wantChecks)
+		}
+		for _, name := range tt.wantChecks {
+			if _, ok := report.Checks[name]; !ok {
+				t.Errorf("%s: missing check %q", tt.name, name)
+			}
+		}
+	}
+}
+
+func TestCheckerCachesResults(t *testing.T) {
+	calls := 0
+	c := NewChecker()
+	c.MarkWarm()
+	c.AddFull("database", time.Second, time.Minute, func(context.Context) error {
+		calls++
+		return nil
+	})
+
+	first := c.Ready(context.Background(), true)
+	second := c.Ready(context.Background(), true)
+
+	if calls != 1 {
+		t.Fatalf("check ran %d times, want 1", calls)
+	}
+	if first.Checks["database"].Cached || !second.Checks["database"].Cached {
+		t.Fatalf("cached = %v then %v, want false then true", first.Checks["database"].Cached, second.Checks["database"].Cached)
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	c := NewChecker()
+	c.MarkWarm()
+	c.Add("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := c.Ready(context.Background(), false)
+	if got := report.Checks["slow"]; got.Status != StatusFail || got.Error != "timed out" {
+		t.Fatalf("slow check = %+v, want failed with timed out", got)
+	}
+}
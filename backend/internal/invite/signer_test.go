@@ -0,0 +1,50 @@
+package invite
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSignerRoundTrip(t *testing.T) {
+	s := NewSigner([]byte(strings.Repeat("k", minKeySize)))
+	id := uuid.New()
+	now := time.Now()
+	token := s.Sign(id, now.Add(time.Hour))
+
+	got, err := s.Verify(token, now)
+	if err != nil || got != id {
+		t.Fatalf("Verify = %s, %v; want %s", got, err, id)
+	}
+	if _, err := s.Verify(token, now.Add(time.Hour)); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Verify after expiry: %v, want ErrExpiredToken", err)
+	}
+}
+
+func TestSignerRejectsForgedTokens(t *testing.T) {
+	s := NewSigner([]byte(strings.Repeat("k", minKeySize)))
+	other := NewSigner([]byte(strings.Repeat("o", minKeySize)))
+	now := time.Now()
+	token := s.Sign(uuid.New(), now.Add(time.Hour))
+	payload, sig, _ := strings.Cut(token, ".")
+
+	// An extended expiry under the original signature
+	longer, _, _ := strings.Cut(s.Sign(uuid.New(), now.Add(24*time.Hour)), ".")
+
+	tests := map[string]string{
+		"other key":     other.Sign(uuid.New(), now.Add(time.Hour)),
+		"swapped":       longer + "." + sig,
+		"no signature":  payload,
+		"bad encoding":  payload + ".!!",
+		"short payload": payload[:10] + "." + sig,
+		"empty":         "",
+	}
+	for name, token := range tests {
+		if _, err := s.Verify(token, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: Verify = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
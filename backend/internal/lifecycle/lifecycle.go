@@ -0,0 +1,206 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type Options struct {
+	// DrainDelay is how long to keep serving after readiness starts failing,
+	// giving load balancers time to notice before listeners close.
+	DrainDelay time.Duration
+	// ShutdownTimeout bounds how long http.Server.Shutdown waits for
+	// in-flight requests before remaining connections are closed.
+	ShutdownTimeout time.Duration
+	// WorkerTimeout bounds how long workers get to stop once cancelled. It
+	// starts when the HTTP phase ends, so slow requests can't eat into it.
+	WorkerTimeout time.Duration
+}
+
+// server is the part of http.Server the manager shuts down.
+type server interface {
+	Shutdown(ctx context.Context) error
+	Close() error
+}
+
+type closer struct {
+	name string
+	fn   func()
+}
+
+// Manager owns the process lifecycle: it runs the HTTP server and background
+// workers, and on SIGINT/SIGTERM shuts them down in order:
+//
+//  1. OnShutdown hooks (e.g. readiness starts failing)
+//  2. drain delay, then http.Server.Shutdown waits for in-flight requests
+//     for up to ShutdownTimeout, after which connections are closed
+//  3. worker context is cancelled and workers get WorkerTimeout to stop
+//  4. closers run in registration order (e.g. the database pool), only once
+//     every worker has stopped
+type Manager struct {
+	opts Options
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	onStart   []func()
+	closers   []closer
+	servers   []server
+	serveErrs chan error
+}
+
+func New(opts Options) *Manager {
+	if opts.ShutdownTimeout == 0 {
+		opts.ShutdownTimeout = 30 * time.Second
+	}
+	if opts.WorkerTimeout == 0 {
+		opts.WorkerTimeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		opts:      opts,
+		ctx:       ctx,
+		cancel:    cancel,
+		serveErrs: make(chan error, 1),
+	}
+}
+
+// Context is cancelled once HTTP traffic has drained and workers should stop.
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Go runs fn as a background worker. fn must return once ctx is cancelled;
+// shutdown waits for it before closing shared resources.
+func (m *Manager) Go(name string, fn func(ctx context.Context)) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		fn(m.ctx)
+		log.Printf("Worker %s stopped", name)
+	}()
+}
+
+// OnShutdown registers a hook that runs as soon as a shutdown signal arrives.
+// Use http.Server.RegisterOnShutdown for work that should wait for the drain
+// delay, such as ending long-lived streams.
+func (m *Manager) OnShutdown(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onStart = append(m.onStart, fn)
+}
+
+// OnClose registers a resource to release after all workers have stopped.
+func (m *Manager) OnClose(name string, fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closers = append(m.closers, closer{name: name, fn: fn})
+}
+
+// Serve starts server in the background. A listener failure triggers shutdown.
+func (m *Manager) Serve(server *http.Server) {
+	m.mu.Lock()
+	m.servers = append(m.servers, server)
+	m.mu.Unlock()
+
+	go func() {
+		log.Printf("Starting server on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			select {
+			case m.serveErrs <- err:
+			default:
+			}
+		}
+	}()
+}
+
+// Wait blocks until SIGINT/SIGTERM or a server failure, then shuts everything
+// down. The returned error is the server failure, if that was the cause.
+func (m *Manager) Wait() error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	var cause error
+	select {
+	case sig := <-sigChan:
+		log.Println("Got signal:", sig)
+	case cause = <-m.serveErrs:
+		log.Printf("Server error: %v", cause)
+	}
+
+	m.shutdown()
+	return cause
+}
+
+func (m *Manager) shutdown() {
+	m.mu.Lock()
+	onStart, servers, closers := m.onStart, m.servers, m.closers
+	m.mu.Unlock()
+
+	for _, fn := range onStart {
+		fn()
+	}
+
+	if m.opts.DrainDelay > 0 {
+		log.Printf("Draining for %s before closing listeners...", m.opts.DrainDelay)
+		time.Sleep(m.opts.DrainDelay)
+	}
+
+	m.stopServers(servers)
+
+	if !m.stopWorkers() {
+		log.Println("Timed out waiting for background workers, leaving resources open")
+		return
+	}
+
+	for _, c := range closers {
+		log.Printf("Closing %s...", c.name)
+		c.fn()
+	}
+
+	log.Println("Server shutdown complete")
+}
+
+func (m *Manager) stopServers(servers []server) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.opts.ShutdownTimeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Server shutdown error: %v, closing remaining connections", err)
+			srv.Close()
+		}
+	}
+	log.Println("HTTP server stopped")
+}
+
+// stopWorkers cancels the worker context and reports whether every worker
+// returned within WorkerTimeout.
+func (m *Manager) stopWorkers() bool {
+	m.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("Background workers stopped")
+		return true
+	case <-time.After(m.opts.WorkerTimeout):
+		return false
+	}
+}
@@ -0,0 +1,91 @@
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hangingServer stands in for an http.Server with a stream that never ends:
+// Shutdown waits until its context expires.
+type hangingServer struct {
+	closed atomic.Bool
+}
+
+func (s *hangingServer) Shutdown(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *hangingServer) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+type quickServer struct{}
+
+func (quickServer) Shutdown(context.Context) error { return nil }
+func (quickServer) Close() error                   { return nil }
+
+func TestShutdownOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      server
+		workerDelay time.Duration
+		wantClosed  bool
+	}{
+		{"clean shutdown", quickServer{}, 0, true},
+		{"server uses its whole budget", &hangingServer{}, 30 * time.Millisecond, true},
+		{"worker outlives its budget", quickServer{}, time.Second, false},
+	}
+
+	for _, tt := range tests {
+		m := New(Options{ShutdownTimeout: 50 * time.Millisecond, WorkerTimeout: 200 * time.Millisecond})
+
+		var (
+			mu    sync.Mutex
+			steps []string
+		)
+		record := func(step string) {
+			mu.Lock()
+			defer mu.Unlock()
+			steps = append(steps, step)
+		}
+
+		m.servers = append(m.servers, tt.server)
+		m.OnShutdown(func() { record("hook") })
+		m.Go("worker", func(ctx context.Context) {
+			<-ctx.Done()
+			time.Sleep(tt.workerDelay)
+			record("worker")
+		})
+		m.OnClose("pool", func() { record("pool") })
+
+		m.shutdown()
+
+		mu.Lock()
+		got := append([]string(nil), steps...)
+		mu.Unlock()
+
+		want := []string{"hook", "worker", "pool"}
+		if !tt.wantClosed {
+			want = []string{"hook"}
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: steps %v, want %v", tt.name, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: steps %v, want %v", tt.name, got, want)
+				break
+			}
+		}
+
+		if s, ok := tt.server.(*hangingServer); ok && !s.closed.Load() {
+			t.Errorf("%s: server wasn't closed after its shutdown timed out", tt.name)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/mail"
+)
+
+var ErrInvalidAddress = errors.New("invalid address")
+
+// envelopeAddress extracts the bare address from "Name <addr>" for MAIL/RCPT.
+func envelopeAddress(raw string) (string, error) {
+	addr, err := mail.ParseAddress(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w %q: %v", ErrInvalidAddress, raw, err)
+	}
+	return addr.Address, nil
+}
+
+func tlsConfig(host string) *tls.Config {
+	return &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+}
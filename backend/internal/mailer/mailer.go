@@ -0,0 +1,226 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer delivers through a relay using STARTTLS when the server offers it.
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{
+		cfg: cfg,
+	}
+}
+
+// FromEnv returns an SMTP mailer configured by SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM, or a LogMailer when SMTP_HOST is
+// unset so local development doesn't need a mail server.
+func FromEnv() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Println("WARNING: SMTP_HOST not set. Emails will be logged instead of sent")
+		return LogMailer{}
+	}
+
+	cfg := SMTPConfig{
+		Host:     host,
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+	if cfg.From == "" {
+		cfg.From = "Strct <no-reply@strct.org>"
+	}
+	return NewSMTPMailer(cfg)
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	addr := net.JoinHostPort(m.cfg.Host, m.cfg.Port)
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(tlsConfig(m.cfg.Host)); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP auth failed: %w", err)
+		}
+	}
+
+	from, err := envelopeAddress(m.cfg.From)
+	if err != nil {
+		return err
+	}
+	to, err := envelopeAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("MAIL FROM rejected: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("RCPT TO rejected: %w", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA rejected: %w", err)
+	}
+	body, err := buildMessage(m.cfg.From, msg)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// Permanent reports whether err means the message will never be accepted,
+// such as an invalid or rejected recipient, rather than a failure that may
+// go away on retry.
+func Permanent(err error) bool {
+	if errors.Is(err, ErrInvalidAddress) {
+		return true
+	}
+	var smtpErr *textproto.Error
+	return errors.As(err, &smtpErr) && smtpErr.Code >= 500
+}
+
+// buildMessage renders a multipart/alternative message, or text/plain when
+// there is no HTML part.
+func buildMessage(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	headers := textproto.MIMEHeader{}
+	headers.Set("From", from)
+	headers.Set("To", msg.To)
+	headers.Set("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	headers.Set("Date", time.Now().Format(time.RFC1123Z))
+	headers.Set("Message-ID", messageID(from))
+	headers.Set("MIME-Version", "1.0")
+
+	if msg.HTML == "" {
+		headers.Set("Content-Type", "text/plain; charset=utf-8")
+		writeHeaders(&buf, headers)
+		buf.WriteString(normalizeNewlines(msg.Text))
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	headers.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	var head bytes.Buffer
+	writeHeaders(&head, headers)
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		pw.Write([]byte(normalizeNewlines(part.body)))
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return append(head.Bytes(), buf.Bytes()...), nil
+}
+
+func writeHeaders(buf *bytes.Buffer, headers textproto.MIMEHeader) {
+	for _, key := range []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type"} {
+		fmt.Fprintf(buf, "%s: %s\r\n", key, headers.Get(key))
+	}
+	buf.WriteString("\r\n")
+}
+
+func normalizeNewlines(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+func messageID(from string) string {
+	domain := "strct.org"
+	if addr, err := envelopeAddress(from); err == nil {
+		if _, d, ok := strings.Cut(addr, "@"); ok {
+			domain = d
+		}
+	}
+
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
+
+// LogMailer writes messages to the log. Used when SMTP isn't configured.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
@@ -0,0 +1,148 @@
+package mailer
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSink(t *testing.T) *Sink {
+	t.Helper()
+	sink, err := NewSink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	return sink
+}
+
+func TestSMTPMailerDeliversToSink(t *testing.T) {
+	sink := newSink(t)
+	m := NewSMTPMailer(sink.Config())
+
+	msg, err := Render(TemplateDeletionScheduled, "Ada <ada@example.com>", map[string]string{
+		"ScheduledFor": "1 March 2027 12:00 UTC",
+		"CancelURL":    "https://portal.example/cancel?request=1&token=abc",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	got := sink.Messages()
+	if len(got) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(got))
+	}
+	if to := got[0].Header.Get("To"); to != "Ada <ada@example.com>" {
+		t.Errorf("To = %q", to)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(got[0].Header.Get("Subject"))
+	if err != nil || subject != "Your Strct account is scheduled for deletion" {
+		t.Errorf("Subject = %q (%v)", subject, err)
+	}
+
+	_, params, err := mime.ParseMediaType(got[0].Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	mr := multipart.NewReader(got[0].Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(p)
+		mediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts[mediaType] = string(body)
+	}
+
+	if !strings.Contains(parts["text/plain"], "https://portal.example/cancel?request=1&token=abc") {
+		t.Errorf("text part lacks the unescaped link:\n%s", parts["text/plain"])
+	}
+	if !strings.Contains(parts["text/html"], `href="https://portal.example/cancel?request=1&amp;token=abc"`) {
+		t.Errorf("html part lacks the link:\n%s", parts["text/html"])
+	}
+}
+
+func TestSinkRejectionsArePermanentOrNot(t *testing.T) {
+	sink := newSink(t)
+	m := NewSMTPMailer(sink.Config())
+	msg := Message{To: "bob@example.com", Subject: "Hi", Text: "Hello"}
+
+	tests := []struct {
+		code      int
+		permanent bool
+	}{
+		{550, true},
+		{450, false},
+	}
+	for _, tt := range tests {
+		sink.RejectRecipients(tt.code)
+		err := m.Send(context.Background(), msg)
+		if err == nil {
+			t.Fatalf("code %d: Send succeeded", tt.code)
+		}
+		if Permanent(err) != tt.permanent {
+			t.Errorf("code %d: Permanent(%v) = %v, want %v", tt.code, err, !tt.permanent, tt.permanent)
+		}
+	}
+
+	if len(sink.Messages()) != 0 {
+		t.Errorf("sink kept rejected messages")
+	}
+	if !Permanent(m.Send(context.Background(), Message{To: "not an address"})) {
+		t.Errorf("invalid recipient should be permanent")
+	}
+}
+
+func TestRenderEscapesHTMLOnly(t *testing.T) {
+	data := map[string]string{
+		"OwnerUsername": "<b>mallory</b>",
+		"DeviceName":    "NAS & co",
+		"Path":          "/photos",
+		"Permission":    "read",
+	}
+	msg, err := Render(TemplateShareReceived, "bob@example.com", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Subject != "<b>mallory</b> shared /photos with you" {
+		t.Errorf("Subject = %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "NAS & co") {
+		t.Errorf("text part escaped: %q", msg.Text)
+	}
+	if strings.Contains(msg.HTML, "<b>mallory</b>") || !strings.Contains(msg.HTML, "&lt;b&gt;mallory&lt;/b&gt;") {
+		t.Errorf("html part not escaped:\n%s", msg.HTML)
+	}
+	if !strings.Contains(msg.HTML, "<title>&lt;b&gt;mallory&lt;/b&gt; shared /photos with you</title>") {
+		t.Errorf("html title is not the subject:\n%s", msg.HTML)
+	}
+}
+
+func TestEveryTemplateRenders(t *testing.T) {
+	for name := range templates {
+		// Missing fields render as "<no value>" rather than failing, so
+		// this catches syntax and layout errors, not typos in field names
+		if _, err := Render(name, "a@example.com", map[string]string{}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := Render("nope", "a@example.com", nil); err == nil {
+		t.Errorf("unknown template rendered")
+	}
+}
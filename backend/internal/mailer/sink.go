@@ -0,0 +1,142 @@
+package mailer
+
+import (
+	"bytes"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Sink is a minimal in-process SMTP server that keeps what it receives. It
+// stands in for a mail relay in tests and local development; point an
+// SMTPMailer at Config().
+type Sink struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	messages []*mail.Message
+	// rejectRcpt makes RCPT TO fail with this reply code, when set
+	rejectRcpt int
+
+	wg sync.WaitGroup
+}
+
+// NewSink listens on a free loopback port.
+func NewSink() (*Sink, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Sink{ln: ln, conns: make(map[net.Conn]struct{})}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Config returns settings for an SMTPMailer that delivers to the sink.
+func (s *Sink) Config() SMTPConfig {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	return SMTPConfig{Host: host, Port: port, From: "Strct <no-reply@strct.org>"}
+}
+
+// Messages returns the messages received so far.
+func (s *Sink) Messages() []*mail.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*mail.Message(nil), s.messages...)
+}
+
+// RejectRecipients makes the sink refuse every recipient with code, e.g. 550
+// for a permanent or 450 for a temporary failure. 0 accepts them again.
+func (s *Sink) RejectRecipients(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejectRcpt = code
+}
+
+// Close stops the sink and drops open connections.
+func (s *Sink) Close() error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Sink) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.serve(textproto.NewConn(conn))
+		}()
+	}
+}
+
+func (s *Sink) serve(c *textproto.Conn) {
+	c.PrintfLine("220 sink ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, _, _ := strings.Cut(strings.ToUpper(line), " ")
+
+		switch verb {
+		case "EHLO", "HELO":
+			c.PrintfLine("250 sink")
+		case "MAIL", "RSET", "NOOP":
+			c.PrintfLine("250 OK")
+		case "RCPT":
+			s.mu.Lock()
+			code := s.rejectRcpt
+			s.mu.Unlock()
+			if code != 0 {
+				c.PrintfLine("%d Recipient rejected", code)
+				continue
+			}
+			c.PrintfLine("250 OK")
+		case "DATA":
+			c.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg, err := mail.ReadMessage(bytes.NewReader(data))
+			if err != nil {
+				c.PrintfLine("554 %s", err)
+				continue
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			c.PrintfLine("250 OK")
+		case "QUIT":
+			c.PrintfLine("221 Bye")
+			return
+		default:
+			c.PrintfLine("502 %s not implemented", verb)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates of transactional emails. Each has templates/<name>.txt, which
+// defines "subject" and the plain-text body, and templates/<name>.html, which
+// defines the "body" of the HTML layout.
+const (
+	TemplateDeletionCode      = "deletion_code"
+	TemplateDeletionScheduled = "deletion_scheduled"
+	TemplateShareReceived     = "share_received"
+	TemplateFriendInvite      = "friend_invite"
+	TemplateFriendRequest     = "friend_request"
+	TemplateDeviceAlert       = "device_alert"
+)
+
+//go:embed templates/*.html templates/*.txt
+var templateFiles embed.FS
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var templates = mustParseTemplates(
+	TemplateDeletionCode,
+	TemplateDeletionScheduled,
+	TemplateShareReceived,
+	TemplateFriendInvite,
+	TemplateFriendRequest,
+	TemplateDeviceAlert,
+)
+
+func mustParseTemplates(names ...string) map[string]*emailTemplate {
+	parsed := make(map[string]*emailTemplate, len(names))
+	for _, name := range names {
+		text, err := texttemplate.ParseFS(templateFiles, "templates/"+name+".txt")
+		if err != nil {
+			panic(err)
+		}
+		// subject is replaced with the rendered subject on each render
+		html, err := htmltemplate.New("layout.html").
+			Funcs(htmltemplate.FuncMap{"subject": func() string { return "" }}).
+			ParseFS(templateFiles, "templates/layout.html", "templates/"+name+".html")
+		if err != nil {
+			panic(err)
+		}
+		parsed[name] = &emailTemplate{text: text, html: html}
+	}
+	return parsed
+}
+
+// Render builds the message for one of the Template* names. data is the
+// template's data; the HTML part escapes it, the text part doesn't.
+func Render(name, to string, data any) (Message, error) {
+	t, ok := templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s text: %w", name, err)
+	}
+
+	page, err := t.html.Clone()
+	if err != nil {
+		return Message{}, err
+	}
+	page.Funcs(htmltemplate.FuncMap{"subject": func() string { return subject.String() }})
+	if err := page.ExecuteTemplate(&html, "layout", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s html: %w", name, err)
+	}
+
+	return Message{
+		To: to,
+		// Line breaks in the subject template don't belong in the header
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterDatabaseCollectors exposes pgx pool statistics and device gauges
+// backed by the given pool.
+func RegisterDatabaseCollectors(pool *pgxpool.Pool) {
+	prometheus.MustRegister(newPoolCollector(pool))
+	prometheus.MustRegister(newDeviceCollector(pool))
+}
+
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	acquiredConns        *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	idleConns            *prometheus.Desc
+	maxConns             *prometheus.Desc
+	totalConns           *prometheus.Desc
+	newConnsCount        *prometheus.Desc
+	lifetimeDestroyCount *prometheus.Desc
+	idleDestroyCount     *prometheus.Desc
+}
+
+func newPoolCollector(pool *pgxpool.Pool) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+
+	return &poolCollector{
+		pool:                 pool,
+		acquireCount:         desc("acquire_total", "Cumulative count of successful connection acquires."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Total time spent waiting for a connection."),
+		acquiredConns:        desc("acquired_conns", "Connections currently acquired."),
+		canceledAcquireCount: desc("canceled_acquire_total", "Acquires cancelled by their context."),
+		constructingConns:    desc("constructing_conns", "Connections currently being established."),
+		emptyAcquireCount:    desc("empty_acquire_total", "Acquires that had to wait because the pool was empty."),
+		idleConns:            desc("idle_conns", "Idle connections in the pool."),
+		maxConns:             desc("max_conns", "Maximum size of the pool."),
+		totalConns:           desc("total_conns", "Total connections in the pool."),
+		newConnsCount:        desc("new_conns_total", "Cumulative count of new connections opened."),
+		lifetimeDestroyCount: desc("max_lifetime_destroy_total", "Connections closed for exceeding MaxConnLifetime."),
+		idleDestroyCount:     desc("max_idle_destroy_total", "Connections closed for exceeding MaxConnIdleTime."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireCount, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(s.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.newConnsCount, prometheus.CounterValue, float64(s.NewConnsCount()))
+	ch <- prometheus.MustNewConstMetric(c.lifetimeDestroyCount, prometheus.CounterValue, float64(s.MaxLifetimeDestroyCount()))
+	ch <- prometheus.MustNewConstMetric(c.idleDestroyCount, prometheus.CounterValue, float64(s.MaxIdleDestroyCount()))
+}
+
+// deviceCacheTTL keeps scrapes from hitting the database every few seconds,
+// which would stop NeonDB from ever scaling to zero.
+const deviceCacheTTL = time.Minute
+
+type deviceCollector struct {
+	pool *pgxpool.Pool
+
+	online *prometheus.Desc
+	total  *prometheus.Desc
+
+	mu        sync.Mutex
+	fetchedAt time.Time
+	onlineN   int64
+	totalN    int64
+}
+
+func newDeviceCollector(pool *pgxpool.Pool) *deviceCollector {
+	return &deviceCollector{
+		pool:   pool,
+		online: prometheus.NewDesc(prometheus.BuildFQName(namespace, "devices", "online"), "Paired devices currently reported online.", nil, nil),
+		total:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "devices", "total"), "Devices known to the portal.", nil, nil),
+	}
+}
+
+func (c *deviceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.online
+	ch <- c.total
+}
+
+func (c *deviceCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.fetchedAt) > deviceCacheTTL {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		query := `SELECT COUNT(*) FILTER (WHERE is_online), COUNT(*) FROM devices`
+		if err := c.pool.QueryRow(ctx, query).Scan(&c.onlineN, &c.totalN); err != nil {
+			log.Printf("metrics: failed to count devices: %v", err)
+			if c.fetchedAt.IsZero() {
+				return
+			}
+		} else {
+			c.fetchedAt = time.Now()
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.online, prometheus.GaugeValue, float64(c.onlineN))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(c.totalN))
+}
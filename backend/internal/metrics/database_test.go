@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+)
+
+func expectDevices(online, total int) string {
+	return `
+# HELP portal_devices_online Paired devices currently reported online.
+# TYPE portal_devices_online gauge
+portal_devices_online ` + strconv.Itoa(online) + `
+# HELP portal_devices_total Devices known to the portal.
+# TYPE portal_devices_total gauge
+portal_devices_total ` + strconv.Itoa(total) + `
+`
+}
+
+// Scrapes within deviceCacheTTL are answered from the last count, and a
+// failed count keeps reporting the last one rather than dropping the gauges.
+func TestDeviceCollectorCaches(t *testing.T) {
+	db := dbtest.New(t)
+	dbtest.Device(t, db, "dev-1", uuid.Nil)
+	dbtest.Device(t, db, "dev-2", uuid.Nil)
+	dbtest.Exec(t, db, `UPDATE devices SET is_online = TRUE WHERE id = 'dev-1'`)
+
+	c := newDeviceCollector(db)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expectDevices(1, 2))); err != nil {
+		t.Fatal(err)
+	}
+
+	dbtest.Device(t, db, "dev-3", uuid.Nil)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expectDevices(1, 2))); err != nil {
+		t.Errorf("scrape within the TTL: %v", err)
+	}
+
+	c.fetchedAt = time.Now().Add(-deviceCacheTTL - time.Second)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expectDevices(1, 3))); err != nil {
+		t.Errorf("scrape after the TTL: %v", err)
+	}
+
+	db.Close()
+	c.fetchedAt = time.Now().Add(-deviceCacheTTL - time.Second)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expectDevices(1, 3))); err != nil {
+		t.Errorf("scrape with the database gone: %v", err)
+	}
+}
+
+// Until the first count succeeds there is nothing to report, rather than
+// zeros that would look like every device went offline.
+func TestDeviceCollectorWithoutDatabase(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), "postgres://portal@127.0.0.1:1/portal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Close()
+
+	if n := testutil.CollectAndCount(newDeviceCollector(pool)); n != 0 {
+		t.Fatalf("collected %d metrics, want none", n)
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "portal"
+
+var (
+	// HTTPRequestDuration is labelled by the mux route template (e.g. /api/v1/user)
+	// rather than the raw path so IDs in URLs don't explode cardinality.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	})
+
+	HTTPResponseBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "response_bytes_total",
+		Help:      "Bytes written in HTTP responses by route template.",
+	}, []string{"route"})
+
+	WebhookEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "events_total",
+		Help:      "Webhook deliveries by source, event type and outcome.",
+	}, []string{"source", "type", "outcome"})
+)
+
+// Webhook outcomes used as the "outcome" label of WebhookEvents.
+const (
+	WebhookOutcomeProcessed        = "processed"
+	WebhookOutcomeDuplicate        = "duplicate"
+	WebhookOutcomeUnhandled        = "unhandled"
+	WebhookOutcomeInvalidSignature = "invalid_signature"
+	WebhookOutcomeBadRequest       = "bad_request"
+	WebhookOutcomeError            = "error"
+)
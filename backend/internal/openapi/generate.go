@@ -0,0 +1,207 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Auth string
+
+const (
+	AuthNone  Auth = ""
+	AuthClerk Auth = "clerk"
+	// AuthSignature marks webhooks whose payload signature is verified by the handler.
+	AuthSignature Auth = "signature"
+	// AuthPaymentSignature is AuthSignature for payment provider webhooks.
+	AuthPaymentSignature Auth = "payment_signature"
+	// AuthAdmin marks operator endpoints behind ADMIN_API_TOKEN.
+	AuthAdmin Auth = "admin"
+	// AuthDevice marks device endpoints authenticated by the token issued at pairing.
+	AuthDevice Auth = "device"
+)
+
+const (
+	ContentJSON = "application/json"
+	ContentHTML = "text/html"
+	ContentText = "text/plain"
+	ContentZip  = "application/zip"
+	// ContentEventStream is a Server-Sent Events stream
+	ContentEventStream = "text/event-stream"
+
+	ContentMultipart = "multipart/form-data"
+)
+
+type QueryParam struct {
+	Name        string
+	Description string
+	Required    bool
+	Type        string // "string" (default), "integer" or "boolean"
+}
+
+// Route documents one method + path template registered on the router.
+type Route struct {
+	Method  string
+	Path    string
+	Summary string
+	Tag     string
+	Auth    Auth
+	Query   []QueryParam
+
+	// Request and Response are zero values of the body types, e.g. user.User{}.
+	// A nil Response means the success response has no body.
+	Request            any
+	RequestContentType string // defaults to JSON
+	Response           any
+	Status             int    // success status, defaults to 200
+	ContentType        string // success content type, defaults to JSON
+
+	// Errors lists the error statuses the handler returns as ErrorResponse.
+	Errors []int
+}
+
+// ErrorResponse is the body written by utils.RespondWithError.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// NormalizePath strips mux regexp constraints: /devices/{id:[0-9]+} -> /devices/{id}.
+func NormalizePath(path string) string {
+	return pathParamPattern.ReplaceAllString(path, "{$1}")
+}
+
+// Generate builds the document for the given routes.
+func Generate(routes []Route) *Document {
+	reg := newSchemaRegistry()
+	errorSchema := reg.schemaFor(reflect.TypeOf(ErrorResponse{}))
+
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "Strct Portal API",
+			Version:     "1.0.0",
+			Description: "Generated from internal/openapi/routes.go. Run `go generate ./internal/openapi` after changing routes or response types.",
+		},
+		Paths: map[string]PathItem{},
+		Components: Components{
+			Schemas: reg.schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				string(AuthClerk):            {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "Clerk session token"},
+				string(AuthSignature):        {Type: "apiKey", In: "header", Name: "svix-signature", Description: "Provider webhook signature, verified against the raw body"},
+				string(AuthPaymentSignature): {Type: "apiKey", In: "header", Name: "Stripe-Signature", Description: "t=<unix>,v1=<HMAC-SHA256 of \"<t>.<body>\">"},
+				string(AuthAdmin):            {Type: "http", Scheme: "bearer", Description: "ADMIN_API_TOKEN"},
+				string(AuthDevice):           {Type: "http", Scheme: "bearer", Description: "Device token issued at pairing"},
+			},
+		},
+	}
+
+	for _, route := range routes {
+		path := NormalizePath(route.Path)
+		method := strings.ToLower(route.Method)
+
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = PathItem{}
+			doc.Paths[path] = item
+		}
+		if _, dup := item[method]; dup {
+			panic(fmt.Sprintf("openapi: %s %s documented twice", route.Method, path))
+		}
+
+		op := &Operation{
+			OperationID: operationID(route.Method, path),
+			Summary:     route.Summary,
+			Responses:   map[string]Response{},
+		}
+		if route.Tag != "" {
+			op.Tags = []string{route.Tag}
+		}
+		if route.Auth != AuthNone {
+			op.Security = []map[string][]string{{string(route.Auth): {}}}
+		}
+
+		for _, m := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+			op.Parameters = append(op.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+		for _, q := range route.Query {
+			typ := q.Type
+			if typ == "" {
+				typ = "string"
+			}
+			op.Parameters = append(op.Parameters, Parameter{Name: q.Name, In: "query", Required: q.Required, Description: q.Description, Schema: &Schema{Type: typ}})
+		}
+
+		if route.Request != nil {
+			contentType := route.RequestContentType
+			if contentType == "" {
+				contentType = ContentJSON
+			}
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{contentType: {Schema: reg.schemaFor(reflect.TypeOf(route.Request))}},
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := Response{Description: http.StatusText(status)}
+		if route.Response != nil {
+			contentType := route.ContentType
+			if contentType == "" {
+				contentType = ContentJSON
+			}
+			var schema *Schema
+			if contentType == ContentJSON {
+				schema = reg.schemaFor(reflect.TypeOf(route.Response))
+			} else {
+				schema = &Schema{Type: "string"}
+				if contentType == ContentZip {
+					schema.Format = "binary"
+				}
+			}
+			success.Content = map[string]MediaType{contentType: {Schema: schema}}
+		}
+		op.Responses[strconv.Itoa(status)] = success
+
+		for _, code := range route.Errors {
+			op.Responses[strconv.Itoa(code)] = Response{
+				Description: http.StatusText(code),
+				Content:     map[string]MediaType{ContentJSON: {Schema: errorSchema}},
+			}
+		}
+
+		item[method] = op
+	}
+
+	return doc
+}
+
+// operationID derives a stable ID such as "getApiV1DevicesId".
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '_' || r == '.'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// Operations returns "METHOD /path" keys for every documented route, sorted.
+func Operations(routes []Route) []string {
+	keys := make([]string, 0, len(routes))
+	for _, route := range routes {
+		keys = append(keys, route.Method+" "+NormalizePath(route.Path))
+	}
+	sort.Strings(keys)
+	return keys
+}
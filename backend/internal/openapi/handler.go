@@ -0,0 +1,19 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:generate go test . -run TestSpecIsUpToDate -update
+
+//go:embed openapi.json
+var specJSON []byte
+
+// Handler serves the committed specification.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(specJSON)
+}
@@ -0,0 +1,40 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite openapi.json from Routes")
+
+func TestSpecIsUpToDate(t *testing.T) {
+	generated, err := json.MarshalIndent(Generate(Routes), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated = append(generated, '\n')
+
+	if *update {
+		if err := os.WriteFile("openapi.json", generated, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if !bytes.Equal(generated, specJSON) {
+		t.Fatal("openapi.json is out of date with Routes or the response types it references; run `go generate ./internal/openapi`")
+	}
+}
+
+func TestSpecIsValidJSON(t *testing.T) {
+	var doc Document
+	if err := json.Unmarshal(specJSON, &doc); err != nil {
+		t.Fatalf("openapi.json does not parse: %v", err)
+	}
+	if doc.OpenAPI == "" || len(doc.Paths) == 0 {
+		t.Fatal("openapi.json has no paths")
+	}
+}
@@ -0,0 +1,183 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/health"
+	"github.com/strct-org/portal/backend/internal/types/alert"
+	"github.com/strct-org/portal/backend/internal/types/clerk"
+	"github.com/strct-org/portal/backend/internal/types/command"
+	"github.com/strct-org/portal/backend/internal/types/device"
+	"github.com/strct-org/portal/backend/internal/types/document"
+	"github.com/strct-org/portal/backend/internal/types/export"
+	"github.com/strct-org/portal/backend/internal/types/friend"
+	"github.com/strct-org/portal/backend/internal/types/notification"
+	"github.com/strct-org/portal/backend/internal/types/order"
+	"github.com/strct-org/portal/backend/internal/types/ota"
+	"github.com/strct-org/portal/backend/internal/types/p2p"
+	"github.com/strct-org/portal/backend/internal/types/privacy"
+	"github.com/strct-org/portal/backend/internal/types/relay"
+	"github.com/strct-org/portal/backend/internal/types/release"
+	"github.com/strct-org/portal/backend/internal/types/share"
+	"github.com/strct-org/portal/backend/internal/types/subscription"
+	"github.com/strct-org/portal/backend/internal/types/user"
+	"github.com/strct-org/portal/backend/internal/types/vpn"
+)
+
+// SuccessResponse is the acknowledgement body written by webhook handlers.
+type SuccessResponse struct {
+	Success bool `json:"success"`
+}
+
+var documentQuery = []QueryParam{
+	{Name: "format", Description: "json (default) or html"},
+	{Name: "version", Description: "Specific published version instead of the one in effect"},
+}
+
+// Routes is the API contract. Every route registered in main.go's router must
+// appear here (enforced by TestRouterMatchesSpec), and openapi.json is
+// regenerated from it.
+var Routes = []Route{
+	// Health
+	{Method: http.MethodGet, Path: "/health", Tag: "health", Summary: "Liveness (legacy alias of /livez)", Response: map[string]string{}},
+	{Method: http.MethodGet, Path: "/livez", Tag: "health", Summary: "Liveness probe", Response: map[string]string{}},
+	{Method: http.MethodGet, Path: "/readyz", Tag: "health", Summary: "Readiness probe with per-dependency timings, including the database and migrations", Response: health.Report{}, Errors: []int{http.StatusServiceUnavailable}},
+	{Method: http.MethodGet, Path: "/readyz/light", Tag: "health", Summary: "Readiness probe without the database checks, so frequent probes let it scale to zero", Response: health.Report{}, Errors: []int{http.StatusServiceUnavailable}},
+
+	// Webhooks
+	{Method: http.MethodPost, Path: "/webhook/clerk", Tag: "webhooks", Summary: "Clerk user lifecycle webhook", Auth: AuthSignature, Request: clerk.ClerkWebhookEvent{}, Response: SuccessResponse{}},
+	{Method: http.MethodPost, Path: "/webhook/payments", Tag: "webhooks", Summary: "Payment provider webhook (checkout completed, invoice paid, subscription cancelled, refund)", Auth: AuthPaymentSignature, Request: map[string]any{}, Response: SuccessResponse{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusServiceUnavailable}},
+
+	// Meta
+	{Method: http.MethodGet, Path: "/api/v1/openapi.json", Tag: "meta", Summary: "This document", Response: map[string]any{}},
+
+	// Documents
+	{Method: http.MethodGet, Path: "/api/v1/privacy-policy", Tag: "documents", Summary: "Privacy policy", Query: documentQuery, Response: document.DocumentResponse{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/terms-of-services", Tag: "documents", Summary: "Terms of service", Query: documentQuery, Response: document.DocumentResponse{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/refund-policy", Tag: "documents", Summary: "Refund policy", Query: documentQuery, Response: document.DocumentResponse{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/pricing", Tag: "documents", Summary: "Pricing", Query: documentQuery, Response: document.DocumentResponse{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/user/documents", Tag: "documents", Summary: "Acceptance status of documents the user must accept", Auth: AuthClerk, Response: []document.AcceptanceStatus{}, Errors: []int{http.StatusUnauthorized}},
+	{Method: http.MethodPost, Path: "/api/v1/user/documents/{slug}/accept", Tag: "documents", Summary: "Accept the current version of a document", Auth: AuthClerk, Request: document.AcceptRequest{}, Status: http.StatusNoContent, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict}},
+
+	// Account deletion pages (HTML forms)
+	{Method: http.MethodGet, Path: "/api/v1/delete-account-webpage", Tag: "account-deletion", Summary: "Account deletion request form", Response: "", ContentType: ContentHTML},
+	{Method: http.MethodPost, Path: "/api/v1/delete-account-webpage", Tag: "account-deletion", Summary: "Email a one-time code to the account owner (form: email)", Response: "", ContentType: ContentHTML},
+	{Method: http.MethodPost, Path: "/api/v1/delete-account-webpage/verify", Tag: "account-deletion", Summary: "Verify the code and schedule deletion (form: request, code)", Response: "", ContentType: ContentHTML},
+	{Method: http.MethodGet, Path: "/api/v1/delete-account-webpage/cancel", Tag: "account-deletion", Summary: "Confirm cancelling a scheduled deletion", Query: []QueryParam{{Name: "request", Required: true}, {Name: "token", Required: true}}, Response: "", ContentType: ContentHTML},
+	{Method: http.MethodPost, Path: "/api/v1/delete-account-webpage/cancel", Tag: "account-deletion", Summary: "Cancel a scheduled deletion (form: request, token)", Response: "", ContentType: ContentHTML},
+	{Method: http.MethodGet, Path: "/api/v1/delete-account-details-webpage", Tag: "account-deletion", Summary: "What account deletion removes and when", Response: "", ContentType: ContentHTML},
+
+	// User
+	{Method: http.MethodGet, Path: "/api/v1/user", Tag: "user", Summary: "Current user's profile", Auth: AuthClerk, Response: user.User{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusTooManyRequests}},
+
+	// Data export
+	{Method: http.MethodPost, Path: "/api/v1/user/export", Tag: "export", Summary: "Queue an export of all data stored about the user, or return the one in progress", Auth: AuthClerk, Response: export.Job{}, Status: http.StatusAccepted, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/user/export/{id}", Tag: "export", Summary: "Export job status", Auth: AuthClerk, Response: export.Job{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/user/export/{id}/download", Tag: "export", Summary: "Download a completed export as a ZIP of JSON files", Auth: AuthClerk, Response: "", ContentType: ContentZip, Errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict}},
+
+	// Plans (402/403 bodies on limited endpoints are subscription.LimitExceeded)
+	{Method: http.MethodGet, Path: "/api/v1/plans", Tag: "plans", Summary: "Plan catalogue with limits", Response: []subscription.Plan{}},
+	{Method: http.MethodGet, Path: "/api/v1/user/subscription", Tag: "plans", Summary: "Current subscription, effective plan and usage", Auth: AuthClerk, Response: subscription.Entitlements{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+
+	{Method: http.MethodGet, Path: "/api/v1/events", Tag: "events", Summary: "Stream of the user's events (Server-Sent Events); send Last-Event-ID, or ?lastEventId= from a new EventSource, to resume. Browsers authenticate with ?token= from POST /api/v1/events/token instead of a Bearer token", Auth: AuthClerk, Response: "", ContentType: ContentEventStream, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/events/token", Tag: "events", Summary: "Get a token that opens the event stream for an hour, for browsers' EventSource, which can't send an Authorization header", Auth: AuthClerk, Response: events.StreamToken{}, Errors: []int{http.StatusUnauthorized, http.StatusServiceUnavailable}},
+
+	{Method: http.MethodGet, Path: "/api/v1/notifications", Tag: "notifications", Summary: "The user's notifications, newest first, with the unread count", Auth: AuthClerk, Query: []QueryParam{
+		{Name: "limit", Type: "integer", Description: "Page size, 1 to 100 (default 20)"},
+		{Name: "cursor", Description: "nextCursor of the previous page"},
+		{Name: "unread", Type: "boolean", Description: "Only unread notifications"},
+	}, Response: notification.Page{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/notifications/{id}/read", Tag: "notifications", Summary: "Mark a notification as read", Auth: AuthClerk, Response: notification.UnreadCount{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/notifications/read-all", Tag: "notifications", Summary: "Mark all notifications as read", Auth: AuthClerk, Response: notification.UnreadCount{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/user/notification-preferences", Tag: "notifications", Summary: "Which emails the user gets", Auth: AuthClerk, Response: notification.Preferences{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPut, Path: "/api/v1/user/notification-preferences", Tag: "notifications", Summary: "Choose which emails the user gets; account emails are always sent", Auth: AuthClerk, Request: notification.Preferences{}, Response: notification.Preferences{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/user/privacy", Tag: "privacy", Summary: "How other users can find the user", Auth: AuthClerk, Response: privacy.Settings{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPut, Path: "/api/v1/user/privacy", Tag: "privacy", Summary: "Choose whether others can find the user by username and by email; friends always can", Auth: AuthClerk, Request: privacy.Settings{}, Response: privacy.Settings{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/user/blocks", Tag: "privacy", Summary: "Users the user blocked, newest first", Auth: AuthClerk, Response: []privacy.BlockedUser{}, Errors: []int{http.StatusUnauthorized}},
+	{Method: http.MethodPut, Path: "/api/v1/user/blocks/{userId}", Tag: "privacy", Summary: "Block a user; ends your friendship and shares with them, and hides you from each other", Auth: AuthClerk, Status: http.StatusNoContent, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodDelete, Path: "/api/v1/user/blocks/{userId}", Tag: "privacy", Summary: "Unblock a user", Auth: AuthClerk, Status: http.StatusNoContent, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+
+	// Device pairing (device side)
+	{Method: http.MethodPost, Path: "/api/v1/device/pairing", Tag: "devices", Summary: "Register an unpaired device and get a pairing code", Request: device.PairingRequest{}, Response: device.PairingResponse{}, Status: http.StatusCreated, Errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{Method: http.MethodGet, Path: "/api/v1/device/pairing/{id}", Tag: "devices", Summary: "Poll pairing status (Authorization: Bearer <deviceToken>)", Response: device.PairingStatus{}, Errors: []int{http.StatusNotFound}},
+
+	// Devices
+	{Method: http.MethodGet, Path: "/api/v1/devices", Tag: "devices", Summary: "Devices owned by the user", Auth: AuthClerk, Response: []device.Device{}, Errors: []int{http.StatusUnauthorized}},
+	{Method: http.MethodGet, Path: "/api/v1/devices/pairable", Tag: "orders", Summary: "Devices from the user's orders waiting to be paired", Auth: AuthClerk, Response: []order.PairableDevice{}, Errors: []int{http.StatusUnauthorized}},
+	{Method: http.MethodPost, Path: "/api/v1/devices/pair", Tag: "devices", Summary: "Pair the device showing a code, or a pairable device by ID; 402 when the plan's device limit is reached", Auth: AuthClerk, Request: device.ClaimRequest{}, Response: device.Device{}, Status: http.StatusCreated, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}},
+	{Method: http.MethodGet, Path: "/api/v1/devices/{id}", Tag: "devices", Summary: "One of the user's devices", Auth: AuthClerk, Response: device.Device{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodDelete, Path: "/api/v1/devices/{id}", Tag: "devices", Summary: "Unpair a device", Auth: AuthClerk, Status: http.StatusNoContent, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+
+	// Sharing
+	{Method: http.MethodGet, Path: "/api/v1/devices/{id}/commands", Tag: "commands", Summary: "Recent commands sent to a device", Auth: AuthClerk, Response: []command.Command{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/devices/{id}/commands", Tag: "commands", Summary: "Queue a command (reboot, rescan_storage, rename_share) for a device", Auth: AuthClerk, Request: command.CreateCommandRequest{}, Response: command.Command{}, Status: http.StatusAccepted, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/devices/{id}/commands/{commandId}", Tag: "commands", Summary: "Status and result of a command", Auth: AuthClerk, Response: command.Command{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/device/commands", Tag: "commands", Summary: "Long-poll for pending commands", Auth: AuthDevice, Query: []QueryParam{
+		{Name: "wait", Type: "integer", Description: "Seconds to wait for a command, at most 30 (default)"},
+	}, Response: []command.Command{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+	{Method: http.MethodPost, Path: "/api/v1/device/commands/{id}/ack", Tag: "commands", Summary: "Acknowledge a delivered command", Auth: AuthDevice, Status: http.StatusNoContent, Errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Path: "/api/v1/device/commands/{id}/result", Tag: "commands", Summary: "Report the outcome of a command", Auth: AuthDevice, Request: command.ResultReport{}, Status: http.StatusNoContent, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodGet, Path: "/api/v1/device/ws", Tag: "devices", Summary: "Upgrade to the JSON-RPC control channel; commands arrive as command.run notifications", Auth: AuthDevice, Status: http.StatusSwitchingProtocols, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden}},
+	{Method: http.MethodGet, Path: "/api/v1/device/relay", Tag: "relay", Summary: "Upgrade to the relay tunnel: yamux over binary WebSocket messages, the device accepting streams for requests proxied from its host on the relay domain", Auth: AuthDevice, Status: http.StatusSwitchingProtocols, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden}},
+	{Method: http.MethodGet, Path: "/api/v1/device/p2p/offers", Tag: "p2p", Summary: "Connection offers the device has yet to answer", Auth: AuthDevice, Response: []p2p.Session{}, Errors: []int{http.StatusUnauthorized}},
+	{Method: http.MethodPost, Path: "/api/v1/device/p2p/{id}/answer", Tag: "p2p", Summary: "Answer an offer with the device's candidates", Auth: AuthDevice, Request: p2p.AnswerRequest{}, Status: http.StatusNoContent, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodGet, Path: "/api/v1/device/vpn", Tag: "vpn", Summary: "The device's VPN address and gateway", Auth: AuthDevice, Response: vpn.DeviceConfig{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusServiceUnavailable}},
+	{Method: http.MethodPut, Path: "/api/v1/device/vpn", Tag: "vpn", Summary: "Join the VPN with a WireGuard public key, or rotate it", Auth: AuthDevice, Request: vpn.RegisterKeyRequest{}, Response: vpn.DeviceConfig{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict, http.StatusServiceUnavailable}},
+	{Method: http.MethodPost, Path: "/api/v1/device/telemetry", Tag: "alerts", Summary: "Report every disk's usage and SMART status; disks left out are forgotten", Auth: AuthDevice, Request: device.TelemetryReport{}, Status: http.StatusNoContent, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+	{Method: http.MethodGet, Path: "/api/v1/devices/{id}/shares", Tag: "sharing", Summary: "Active shares of a device", Auth: AuthClerk, Response: []share.Share{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/devices/{id}/shares", Tag: "sharing", Summary: "Share with a user or create a public link; 402 when the plan's link limit is reached", Auth: AuthClerk, Request: share.CreateShareRequest{}, Response: share.Share{}, Status: http.StatusCreated, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/devices/{id}/connect", Tag: "p2p", Summary: "Offer candidates for a direct connection; the relay URL is the fallback", Auth: AuthClerk, Request: p2p.OfferRequest{}, Response: p2p.Session{}, Status: http.StatusCreated, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/devices/{id}/relay-link", Tag: "relay", Summary: "Get a link that opens the device in the browser through the relay; the device has a host of its own on the relay domain, and the link must be followed within a minute to set a cookie for that host only", Auth: AuthClerk, Response: relay.Link{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable}},
+	{Method: http.MethodDelete, Path: "/api/v1/devices/{id}/vpn", Tag: "vpn", Summary: "Take a device and all its clients off the VPN", Auth: AuthClerk, Status: http.StatusNoContent, Errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusServiceUnavailable}},
+	{Method: http.MethodGet, Path: "/api/v1/devices/{id}/vpn-config", Tag: "vpn", Summary: "wg-quick config for reaching the device; issues a key pair on first download, after which the config can only be had by rotating the key", Auth: AuthClerk, Response: "", ContentType: ContentText, Errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable}},
+	{Method: http.MethodDelete, Path: "/api/v1/devices/{id}/vpn-config", Tag: "vpn", Summary: "Revoke your VPN config for the device", Auth: AuthClerk, Status: http.StatusNoContent, Errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusServiceUnavailable}},
+	{Method: http.MethodPost, Path: "/api/v1/devices/{id}/vpn-config/rotate", Tag: "vpn", Summary: "Replace your VPN key; earlier configs stop working", Auth: AuthClerk, Response: "", ContentType: ContentText, Errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable}},
+	{Method: http.MethodGet, Path: "/api/v1/devices/{id}/disks", Tag: "alerts", Summary: "Disks the device last reported", Auth: AuthClerk, Response: []device.Disk{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/devices/{id}/alerts", Tag: "alerts", Summary: "The device's latest 100 alerts, newest first; open ones have no resolvedAt", Auth: AuthClerk, Response: []alert.Alert{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/alert-rules", Tag: "alerts", Summary: "The user's alert rules", Auth: AuthClerk, Response: []alert.Rule{}, Errors: []int{http.StatusUnauthorized}},
+	{Method: http.MethodPost, Path: "/api/v1/alert-rules", Tag: "alerts", Summary: "Alert when a device is offline, a disk fills up or fails SMART, or an update fails", Auth: AuthClerk, Request: alert.RuleRequest{}, Response: alert.Rule{}, Status: http.StatusCreated, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPut, Path: "/api/v1/alert-rules/{id}", Tag: "alerts", Summary: "Replace an alert rule", Auth: AuthClerk, Request: alert.RuleRequest{}, Response: alert.Rule{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodDelete, Path: "/api/v1/alert-rules/{id}", Tag: "alerts", Summary: "Delete an alert rule; its open alerts are resolved", Auth: AuthClerk, Status: http.StatusNoContent, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/users/search", Tag: "privacy", Summary: "Find users by username prefix or exact email, among those who allow it", Auth: AuthClerk, Query: []QueryParam{
+		{Name: "q", Required: true, Description: "At least 2 characters"},
+		{Name: "limit", Type: "integer", Description: "Results to return, 1-50 (default 20)"},
+	}, Response: []privacy.UserSummary{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/friends", Tag: "friends", Summary: "The user's friends", Auth: AuthClerk, Response: []friend.Friendship{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/friends/requests", Tag: "friends", Summary: "Pending friend requests, incoming and outgoing", Auth: AuthClerk, Response: []friend.Friendship{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/friends/requests", Tag: "friends", Summary: "Send a friend request by username or email; accepts theirs if they already asked", Auth: AuthClerk, Request: friend.CreateRequest{}, Response: friend.Friendship{}, Status: http.StatusCreated, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Path: "/api/v1/friends/requests/{userId}/accept", Tag: "friends", Summary: "Accept a friend request", Auth: AuthClerk, Response: friend.Friendship{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/friends/invites", Tag: "friends", Summary: "Invitations the user emailed, newest first", Auth: AuthClerk, Response: []friend.Invite{}, Errors: []int{http.StatusUnauthorized}},
+	{Method: http.MethodPost, Path: "/api/v1/friends/invites", Tag: "friends", Summary: "Email an invitation to someone who isn't a user; they become friends when they sign up", Auth: AuthClerk, Request: friend.CreateInviteRequest{}, Response: friend.Invite{}, Status: http.StatusCreated, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests, http.StatusServiceUnavailable}},
+	{Method: http.MethodDelete, Path: "/api/v1/friends/invites/{id}", Tag: "friends", Summary: "Cancel a pending invitation", Auth: AuthClerk, Status: http.StatusNoContent, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodDelete, Path: "/api/v1/friends/{userId}", Tag: "friends", Summary: "Unfriend a user, or decline or withdraw a friend request", Auth: AuthClerk, Status: http.StatusNoContent, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/invites/{token}/accept", Tag: "friends", Summary: "Accept an emailed invitation as the signed-in user", Auth: AuthClerk, Response: friend.Friendship{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusServiceUnavailable}},
+	{Method: http.MethodGet, Path: "/api/v1/p2p/sessions/{id}", Tag: "p2p", Summary: "A connection session, with the device's candidates once it answered", Auth: AuthClerk, Response: p2p.Session{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/p2p/sessions/{id}/result", Tag: "p2p", Summary: "Record whether the session connected directly or through the relay", Auth: AuthClerk, Request: p2p.ResultRequest{}, Response: p2p.Session{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodGet, Path: "/api/v1/shares", Tag: "sharing", Summary: "Shares other users have given the user", Auth: AuthClerk, Response: []share.Share{}, Errors: []int{http.StatusUnauthorized}},
+	{Method: http.MethodDelete, Path: "/api/v1/shares/{id}", Tag: "sharing", Summary: "Revoke a share, or leave one shared with you", Auth: AuthClerk, Status: http.StatusNoContent, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/orders", Tag: "orders", Summary: "The user's hardware orders with items and shipped units", Auth: AuthClerk, Response: []order.Order{}, Errors: []int{http.StatusUnauthorized}},
+	{Method: http.MethodGet, Path: "/api/v1/orders/{id}", Tag: "orders", Summary: "One of the user's orders", Auth: AuthClerk, Response: order.Order{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPut, Path: "/api/v1/admin/orders/{id}/shipping", Tag: "orders", Summary: "Update shipping status and tracking", Auth: AuthAdmin, Request: order.UpdateShippingRequest{}, Response: order.Order{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/admin/orders/{id}/units", Tag: "orders", Summary: "Record the serials shipped for an order item", Auth: AuthAdmin, Request: order.AssignUnitsRequest{}, Response: order.Order{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}},
+	{Method: http.MethodGet, Path: "/api/v1/releases/latest", Tag: "releases", Summary: "Newest release of a product for a platform; beta includes stable", Query: []QueryParam{
+		{Name: "product", Required: true, Description: "beestation-firmware, beedrive-firmware or desktop-sync"},
+		{Name: "platform", Required: true, Description: "e.g. arm64 or windows-x64"},
+		{Name: "channel", Description: "stable (default) or beta"},
+	}, Response: release.Release{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPost, Path: "/api/v1/admin/releases", Tag: "releases", Summary: "Upload and publish a release artifact into ./assets/releases", Auth: AuthAdmin, Request: release.UploadForm{}, RequestContentType: ContentMultipart, Response: release.Release{}, Status: http.StatusCreated, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict, http.StatusUnprocessableEntity}},
+	{Method: http.MethodGet, Path: "/api/v1/device/update", Tag: "ota", Summary: "Check for an update; the manifest is signed with the OTA key", Auth: AuthDevice, Query: []QueryParam{
+		{Name: "product", Description: "beestation-firmware or beedrive-firmware; only recorded for devices that didn't report it when pairing"},
+		{Name: "platform", Description: "e.g. arm64; recorded like product"},
+		{Name: "version", Description: "Running version, recorded on the device"},
+	}, Response: ota.UpdateCheck{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusServiceUnavailable}},
+	{Method: http.MethodPost, Path: "/api/v1/device/update/status", Tag: "ota", Summary: "Report update progress; failures can halt the rollout", Auth: AuthDevice, Request: ota.StatusReport{}, Status: http.StatusNoContent, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/rollouts", Tag: "ota", Summary: "Recent rollouts with per-state device counts", Auth: AuthAdmin, Response: []ota.Rollout{}, Errors: []int{http.StatusUnauthorized}},
+	{Method: http.MethodPost, Path: "/api/v1/admin/rollouts", Tag: "ota", Summary: "Start rolling out a release", Auth: AuthAdmin, Request: ota.CreateRolloutRequest{}, Response: ota.Rollout{}, Status: http.StatusCreated, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/rollouts/{id}", Tag: "ota", Summary: "A rollout with per-state device counts", Auth: AuthAdmin, Response: ota.Rollout{}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPatch, Path: "/api/v1/admin/rollouts/{id}", Tag: "ota", Summary: "Change the percentage, or pause, resume or halt", Auth: AuthAdmin, Request: ota.UpdateRolloutRequest{}, Response: ota.Rollout{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodPut, Path: "/api/v1/admin/devices/{id}/cohort", Tag: "ota", Summary: "Assign a device to a rollout cohort", Auth: AuthAdmin, Request: ota.SetCohortRequest{}, Status: http.StatusNoContent, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/vpn/peers", Tag: "vpn", Summary: "Active VPN peers, for the gateway to sync", Auth: AuthAdmin, Response: []vpn.GatewayPeer{}, Errors: []int{http.StatusUnauthorized, http.StatusServiceUnavailable}},
+	{Method: http.MethodGet, Path: "/api/v1/shares/links/{token}", Tag: "sharing", Summary: "What a public link points at", Response: share.LinkInfo{}, Errors: []int{http.StatusNotFound}},
+	{Method: http.MethodGet, Path: "/api/v1/invites/{token}", Tag: "friends", Summary: "Who sent an emailed invitation; the link's target", Response: friend.InviteInfo{}, Errors: []int{http.StatusNotFound, http.StatusServiceUnavailable}},
+}
@@ -0,0 +1,149 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	uuidType       = reflect.TypeOf(uuid.UUID{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	fileHeaderType = reflect.TypeOf(multipart.FileHeader{})
+)
+
+// schemaRegistry turns Go types into schemas, registering named structs as
+// components so they are referenced rather than inlined.
+type schemaRegistry struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		schemas: make(map[string]*Schema),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+func (r *schemaRegistry) componentName(t reflect.Type) string {
+	if name, ok := r.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := r.schemas[name]; taken {
+		// Same type name in two packages, e.g. device.Status vs ota.Status
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	if _, taken := r.schemas[name]; taken {
+		panic(fmt.Sprintf("openapi: duplicate component name %s for %s", name, t))
+	}
+
+	r.names[t] = name
+	return name
+}
+
+func (r *schemaRegistry) schemaFor(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case rawMessageType:
+		return &Schema{}
+	case fileHeaderType:
+		return &Schema{Type: "string", Format: "binary"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := r.schemaFor(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: r.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.schemaFor(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.structSchema(t)
+		}
+		name := r.componentName(t)
+		if _, ok := r.schemas[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			r.schemas[name] = &Schema{}
+			*r.schemas[name] = *r.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	panic(fmt.Sprintf("openapi: unsupported type %s", t))
+}
+
+func (r *schemaRegistry) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	r.addFields(s, t)
+	return s
+}
+
+func (r *schemaRegistry) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				r.addFields(s, ft)
+				continue
+			}
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = r.schemaFor(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Package ota signs update manifests so devices can trust them independently
+// of the transport.
+package ota
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"log"
+	"os"
+)
+
+// Signer signs manifests with an Ed25519 key. Devices ship with the public key.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key}
+}
+
+// SignerFromEnv reads OTA_SIGNING_KEY, a base64 Ed25519 seed. It returns nil
+// when the key is missing or invalid, which disables update checks.
+func SignerFromEnv() *Signer {
+	raw := os.Getenv("OTA_SIGNING_KEY")
+	if raw == "" {
+		log.Println("WARNING: OTA_SIGNING_KEY not set. Update checks are disabled")
+		return nil
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		log.Printf("WARNING: OTA_SIGNING_KEY must be a base64 %d-byte seed. Update checks are disabled", ed25519.SeedSize)
+		return nil
+	}
+
+	s := NewSigner(ed25519.NewKeyFromSeed(seed))
+	log.Printf("OTA manifests signed with public key %s", s.PublicKey())
+	return s
+}
+
+// Sign returns the base64 signature of payload.
+func (s *Signer) Sign(payload []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload))
+}
+
+// PublicKey returns the base64 public key devices verify against.
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
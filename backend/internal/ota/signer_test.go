@@ -0,0 +1,49 @@
+package ota
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestSignerSignatureVerifies(t *testing.T) {
+	s := NewSigner(ed25519.NewKeyFromSeed([]byte(strings.Repeat("s", ed25519.SeedSize))))
+	payload := []byte(`{"version":"1.2.3"}`)
+
+	public, err := base64.StdEncoding.DecodeString(s.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(s.Sign(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(public, payload, sig) {
+		t.Fatal("signature doesn't verify against the public key")
+	}
+	if ed25519.Verify(public, []byte(`{"version":"9.9.9"}`), sig) {
+		t.Fatal("signature verifies a different manifest")
+	}
+}
+
+func TestSignerFromEnv(t *testing.T) {
+	seed := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("s", ed25519.SeedSize)))
+
+	tests := []struct {
+		name   string
+		value  string
+		wantOK bool
+	}{
+		{"unset", "", false},
+		{"not base64", "not a key!", false},
+		{"short seed", base64.StdEncoding.EncodeToString([]byte("short")), false},
+		{"valid", seed, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("OTA_SIGNING_KEY", tt.value)
+		if got := SignerFromEnv(); (got != nil) != tt.wantOK {
+			t.Errorf("%s: signer %v, want configured %v", tt.name, got, tt.wantOK)
+		}
+	}
+}
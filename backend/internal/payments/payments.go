@@ -0,0 +1,131 @@
+package payments
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// EventType is the provider-neutral kind of a payment event.
+type EventType string
+
+const (
+	CheckoutCompleted     EventType = "checkout.completed"
+	InvoicePaid           EventType = "invoice.paid"
+	SubscriptionCancelled EventType = "subscription.cancelled"
+	Refunded              EventType = "refund"
+)
+
+const (
+	ModeSubscription = "subscription"
+	ModePayment      = "payment"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrUnsupportedEvent is returned for provider events the portal ignores
+	ErrUnsupportedEvent = errors.New("unsupported event type")
+)
+
+// Provider verifies and decodes webhooks from a payment provider.
+type Provider interface {
+	Name() string
+	// ParseWebhook checks the signature on payload and returns the event in
+	// provider-neutral form. Unsigned or tampered payloads return
+	// ErrInvalidSignature; events the portal doesn't handle return an Event
+	// with only ID and ProviderType set and ErrUnsupportedEvent.
+	ParseWebhook(header http.Header, payload []byte) (*Event, error)
+}
+
+// Event is a verified payment event. Exactly one of the payload fields is set,
+// matching Type.
+type Event struct {
+	ID           string    `json:"id"`
+	Type         EventType `json:"type"`
+	ProviderType string    `json:"-"`
+	Created      time.Time `json:"created"`
+
+	Checkout     *Checkout     `json:"checkout,omitempty"`
+	Invoice      *Invoice      `json:"invoice,omitempty"`
+	Cancellation *Cancellation `json:"cancellation,omitempty"`
+	Refund       *Refund       `json:"refund,omitempty"`
+}
+
+// Checkout is a completed purchase from the /buy page. Mode is
+// ModeSubscription for plans and ModePayment for one-off hardware orders.
+// ClerkID is empty for guest checkouts.
+type Checkout struct {
+	SessionID      string `json:"sessionId"`
+	Mode           string `json:"mode"`
+	ClerkID        string `json:"clerkId,omitempty"`
+	Email          string `json:"email"`
+	CustomerID     string `json:"customerId"`
+	SubscriptionID string `json:"subscriptionId,omitempty"`
+	PaymentID      string `json:"paymentId,omitempty"`
+	Plan           string `json:"plan,omitempty"`
+	AmountTotal    int64  `json:"amountTotal"`
+	Currency       string `json:"currency"`
+
+	LineItems []LineItem `json:"lineItems,omitempty"`
+}
+
+// LineItem is one hardware product in a ModePayment checkout.
+type LineItem struct {
+	SKU        string `json:"sku"`
+	Name       string `json:"name"`
+	Quantity   int    `json:"quantity"`
+	UnitAmount int64  `json:"unitAmount"`
+}
+
+// Invoice is a paid subscription invoice, which extends the paid period.
+type Invoice struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscriptionId"`
+	CustomerID     string    `json:"customerId"`
+	Plan           string    `json:"plan,omitempty"`
+	AmountPaid     int64     `json:"amountPaid"`
+	Currency       string    `json:"currency"`
+	PeriodEnd      time.Time `json:"periodEnd"`
+}
+
+// Cancellation ends a subscription. Paid-for access continues until EndsAt.
+type Cancellation struct {
+	SubscriptionID string    `json:"subscriptionId"`
+	CustomerID     string    `json:"customerId"`
+	EndsAt         time.Time `json:"endsAt"`
+}
+
+// Refund returns money for a one-off payment or, when InvoiceID is set, a
+// subscription invoice. AmountRefunded is cumulative.
+type Refund struct {
+	ID             string `json:"id"`
+	PaymentID      string `json:"paymentId"`
+	InvoiceID      string `json:"invoiceId,omitempty"`
+	AmountRefunded int64  `json:"amountRefunded"`
+	Amount         int64  `json:"amount"`
+	Currency       string `json:"currency"`
+}
+
+// FromEnv returns the provider named by PAYMENTS_PROVIDER ("stripe", the
+// default, or "fake") keyed by PAYMENTS_WEBHOOK_SECRET, or nil when the secret
+// is missing. Unlike the Clerk webhook there is no unverified fallback.
+func FromEnv() Provider {
+	secret := os.Getenv("PAYMENTS_WEBHOOK_SECRET")
+	if secret == "" {
+		log.Println("WARNING: PAYMENTS_WEBHOOK_SECRET not set. Payment webhooks are disabled")
+		return nil
+	}
+
+	switch name := os.Getenv("PAYMENTS_PROVIDER"); name {
+	case "", "stripe":
+		return NewStripeProvider(secret)
+	case "fake":
+		log.Println("WARNING: Using the fake payment provider. Never enable this in production")
+		return NewFakeProvider(secret)
+	default:
+		log.Printf("WARNING: Unknown PAYMENTS_PROVIDER %q. Payment webhooks are disabled", name)
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testSecret = "whsec_test"
+
+func TestFakeProviderRoundTrip(t *testing.T) {
+	fake := NewFakeProvider(testSecret)
+
+	payload, header, err := fake.Webhook(&Event{
+		ID:   "evt_1",
+		Type: CheckoutCompleted,
+		Checkout: &Checkout{
+			SessionID:      "cs_1",
+			Mode:           ModeSubscription,
+			ClerkID:        "user_1",
+			SubscriptionID: "sub_1",
+			Plan:           "plus",
+			AmountTotal:    299,
+			Currency:       "eur",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev, err := fake.ParseWebhook(header, payload)
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	if ev.ID != "evt_1" || ev.Type != CheckoutCompleted || ev.Checkout == nil {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if ev.Checkout.Plan != "plus" || ev.Checkout.SubscriptionID != "sub_1" || ev.Checkout.ClerkID != "user_1" {
+		t.Errorf("unexpected checkout %+v", ev.Checkout)
+	}
+}
+
+func TestSignatureRejected(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	payload := []byte(`{"id":"evt_1","type":"refund","refund":{"paymentId":"pi_1"}}`)
+
+	tests := []struct {
+		name    string
+		header  string
+		payload []byte
+	}{
+		{"missing", "", payload},
+		{"malformed", "garbage", payload},
+		{"wrong secret", signatureHeader("other", payload, now), payload},
+		{"tampered payload", signatureHeader(testSecret, payload, now), []byte(`{"id":"evt_2"}`)},
+		{"stale", signatureHeader(testSecret, payload, now.Add(-10*time.Minute)), payload},
+		{"from the future", signatureHeader(testSecret, payload, now.Add(10*time.Minute)), payload},
+	}
+
+	fake := NewFakeProvider(testSecret)
+	fake.now = func() time.Time { return now }
+	stripe := NewStripeProvider(testSecret)
+	stripe.now = fake.now
+
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set(SignatureHeader, tt.header)
+
+		for _, p := range []Provider{fake, stripe} {
+			if _, err := p.ParseWebhook(header, tt.payload); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("%s/%s: got %v, want ErrInvalidSignature", p.Name(), tt.name, err)
+			}
+		}
+	}
+}
+
+func TestSignatureAcceptsAnyMatchingV1(t *testing.T) {
+	now := time.Now()
+	payload := []byte(`{}`)
+	valid := signatureHeader(testSecret, payload, now)
+	header := fmt.Sprintf("%s,v1=%s", valid, "deadbeef")
+
+	if err := verifySignature(testSecret, header, payload, now); err != nil {
+		t.Errorf("rolled secret: %v", err)
+	}
+}
+
+func TestStripeProviderParsesEvents(t *testing.T) {
+	stripe := NewStripeProvider(testSecret)
+	sign := func(payload string) http.Header {
+		h := http.Header{}
+		h.Set(SignatureHeader, signatureHeader(testSecret, []byte(payload), time.Now()))
+		return h
+	}
+
+	invoice := `{"id":"evt_inv","type":"invoice.paid","created":1800000000,"data":{"object":{
+		"id":"in_1","customer":"cus_1","subscription":"sub_1","amount_paid":799,"currency":"eur",
+		"lines":{"data":[
+			{"period":{"end":1800000100},"price":{"metadata":{"plan":"plus"}}},
+			{"period":{"end":1802592000},"price":{"metadata":{"plan":"pro"}}}
+		]}}}}`
+	ev, err := stripe.ParseWebhook(sign(invoice), []byte(invoice))
+	if err != nil {
+		t.Fatalf("invoice.paid: %v", err)
+	}
+	if ev.Type != InvoicePaid || ev.Invoice.SubscriptionID != "sub_1" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if ev.Invoice.Plan != "pro" || !ev.Invoice.PeriodEnd.Equal(time.Unix(1802592000, 0)) {
+		t.Errorf("want the latest line's plan and period end, got %q %v", ev.Invoice.Plan, ev.Invoice.PeriodEnd)
+	}
+
+	cancelled := `{"id":"evt_del","type":"customer.subscription.deleted","data":{"object":{
+		"id":"sub_1","customer":"cus_1","current_period_end":1802592000,"ended_at":0}}}`
+	ev, err = stripe.ParseWebhook(sign(cancelled), []byte(cancelled))
+	if err != nil {
+		t.Fatalf("customer.subscription.deleted: %v", err)
+	}
+	if ev.Type != SubscriptionCancelled || !ev.Cancellation.EndsAt.Equal(time.Unix(1802592000, 0)) {
+		t.Errorf("unexpected cancellation %+v", ev.Cancellation)
+	}
+
+	unsupported := `{"id":"evt_x","type":"customer.created","data":{"object":{}}}`
+	ev, err = stripe.ParseWebhook(sign(unsupported), []byte(unsupported))
+	if !errors.Is(err, ErrUnsupportedEvent) || ev == nil || ev.ProviderType != "customer.created" {
+		t.Errorf("customer.created: got %+v, %v", ev, err)
+	}
+}
@@ -0,0 +1,183 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// StripeProvider handles Stripe webhooks. Checkout sessions are expected to
+// carry the buyer's Clerk ID as client_reference_id and, for subscriptions,
+// the plan ID in metadata.plan; prices carry it in metadata.plan too.
+// Stripe leaves line items out of webhooks, so hardware checkouts carry the
+// cart as a JSON array of LineItem in metadata.items.
+type StripeProvider struct {
+	secret string
+	now    func() time.Time
+}
+
+func NewStripeProvider(secret string) *StripeProvider {
+	return &StripeProvider{
+		secret: secret,
+		now:    time.Now,
+	}
+}
+
+func (p *StripeProvider) Name() string {
+	return "stripe"
+}
+
+type stripeEvent struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+type stripeCheckoutSession struct {
+	ID                string            `json:"id"`
+	Mode              string            `json:"mode"`
+	ClientReferenceID string            `json:"client_reference_id"`
+	Customer          string            `json:"customer"`
+	Subscription      string            `json:"subscription"`
+	PaymentIntent     string            `json:"payment_intent"`
+	AmountTotal       int64             `json:"amount_total"`
+	Currency          string            `json:"currency"`
+	Metadata          map[string]string `json:"metadata"`
+	CustomerDetails   struct {
+		Email string `json:"email"`
+	} `json:"customer_details"`
+}
+
+type stripeInvoice struct {
+	ID           string `json:"id"`
+	Customer     string `json:"customer"`
+	Subscription string `json:"subscription"`
+	AmountPaid   int64  `json:"amount_paid"`
+	Currency     string `json:"currency"`
+	Lines        struct {
+		Data []struct {
+			Period struct {
+				End int64 `json:"end"`
+			} `json:"period"`
+			Price struct {
+				Metadata map[string]string `json:"metadata"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"lines"`
+}
+
+type stripeSubscription struct {
+	ID               string `json:"id"`
+	Customer         string `json:"customer"`
+	CurrentPeriodEnd int64  `json:"current_period_end"`
+	EndedAt          int64  `json:"ended_at"`
+}
+
+type stripeCharge struct {
+	ID             string `json:"id"`
+	PaymentIntent  string `json:"payment_intent"`
+	Invoice        string `json:"invoice"`
+	Amount         int64  `json:"amount"`
+	AmountRefunded int64  `json:"amount_refunded"`
+	Currency       string `json:"currency"`
+}
+
+func (p *StripeProvider) ParseWebhook(header http.Header, payload []byte) (*Event, error) {
+	if err := verifySignature(p.secret, header.Get(SignatureHeader), payload, p.now()); err != nil {
+		return nil, err
+	}
+
+	var raw stripeEvent
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+
+	ev := &Event{ID: raw.ID, ProviderType: raw.Type, Created: time.Unix(raw.Created, 0)}
+
+	switch raw.Type {
+	case "checkout.session.completed":
+		var s stripeCheckoutSession
+		if err := json.Unmarshal(raw.Data.Object, &s); err != nil {
+			return nil, fmt.Errorf("failed to parse checkout session: %w", err)
+		}
+		ev.Type = CheckoutCompleted
+		ev.Checkout = &Checkout{
+			SessionID:      s.ID,
+			Mode:           s.Mode,
+			ClerkID:        s.ClientReferenceID,
+			Email:          s.CustomerDetails.Email,
+			CustomerID:     s.Customer,
+			SubscriptionID: s.Subscription,
+			PaymentID:      s.PaymentIntent,
+			Plan:           s.Metadata["plan"],
+			AmountTotal:    s.AmountTotal,
+			Currency:       s.Currency,
+		}
+		if items := s.Metadata["items"]; items != "" {
+			if err := json.Unmarshal([]byte(items), &ev.Checkout.LineItems); err != nil {
+				return nil, fmt.Errorf("failed to parse metadata.items of %s: %w", s.ID, err)
+			}
+		}
+
+	case "invoice.paid":
+		var inv stripeInvoice
+		if err := json.Unmarshal(raw.Data.Object, &inv); err != nil {
+			return nil, fmt.Errorf("failed to parse invoice: %w", err)
+		}
+		ev.Type = InvoicePaid
+		ev.Invoice = &Invoice{
+			ID:             inv.ID,
+			SubscriptionID: inv.Subscription,
+			CustomerID:     inv.Customer,
+			AmountPaid:     inv.AmountPaid,
+			Currency:       inv.Currency,
+		}
+		// The subscription line ends last; proration lines end earlier
+		for _, line := range inv.Lines.Data {
+			if end := time.Unix(line.Period.End, 0); end.After(ev.Invoice.PeriodEnd) {
+				ev.Invoice.PeriodEnd = end
+				ev.Invoice.Plan = line.Price.Metadata["plan"]
+			}
+		}
+
+	case "customer.subscription.deleted":
+		var sub stripeSubscription
+		if err := json.Unmarshal(raw.Data.Object, &sub); err != nil {
+			return nil, fmt.Errorf("failed to parse subscription: %w", err)
+		}
+		ends := sub.EndedAt
+		if ends == 0 {
+			ends = sub.CurrentPeriodEnd
+		}
+		ev.Type = SubscriptionCancelled
+		ev.Cancellation = &Cancellation{
+			SubscriptionID: sub.ID,
+			CustomerID:     sub.Customer,
+			EndsAt:         time.Unix(ends, 0),
+		}
+
+	case "charge.refunded":
+		var ch stripeCharge
+		if err := json.Unmarshal(raw.Data.Object, &ch); err != nil {
+			return nil, fmt.Errorf("failed to parse charge: %w", err)
+		}
+		ev.Type = Refunded
+		ev.Refund = &Refund{
+			ID:             ch.ID,
+			PaymentID:      ch.PaymentIntent,
+			InvoiceID:      ch.Invoice,
+			Amount:         ch.Amount,
+			AmountRefunded: ch.AmountRefunded,
+			Currency:       ch.Currency,
+		}
+
+	default:
+		return ev, ErrUnsupportedEvent
+	}
+
+	return ev, nil
+}
@@ -0,0 +1,77 @@
+package plans
+
+import "github.com/strct-org/portal/backend/internal/types/subscription"
+
+const gigabyte = int64(1) << 30
+
+// Plans mirrors the pricing document. Changing a limit here changes it for
+// every subscriber, so publish a new pricing version alongside.
+var catalogue = []subscription.Plan{
+	{
+		ID:                 subscription.PlanFree,
+		Name:               "Free",
+		Currency:           "EUR",
+		MaxDevices:         1,
+		MaxPublicLinks:     5,
+		RelayBytesPerMonth: 10 * gigabyte,
+	},
+	{
+		ID:                 subscription.PlanPlus,
+		Name:               "Plus",
+		PriceCents:         299,
+		Currency:           "EUR",
+		MaxDevices:         3,
+		MaxPublicLinks:     50,
+		RelayBytesPerMonth: 200 * gigabyte,
+	},
+	{
+		ID:                 subscription.PlanPro,
+		Name:               "Pro",
+		PriceCents:         799,
+		Currency:           "EUR",
+		MaxDevices:         10,
+		MaxPublicLinks:     subscription.Unlimited,
+		RelayBytesPerMonth: 2048 * gigabyte,
+	},
+}
+
+// All returns the plans from cheapest to most expensive.
+func All() []subscription.Plan {
+	return append([]subscription.Plan(nil), catalogue...)
+}
+
+// Get returns the plan with the given ID. Unknown IDs fall back to free so a
+// bad row can never grant more than the free plan does.
+func Get(id string) subscription.Plan {
+	for _, p := range catalogue {
+		if p.ID == id {
+			return p
+		}
+	}
+	return catalogue[0]
+}
+
+// Exists reports whether id names a plan in the catalogue.
+func Exists(id string) bool {
+	for _, p := range catalogue {
+		if p.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// UpgradeFor returns the cheapest plan above current that allows more than
+// limit(current), or false when no plan does.
+func UpgradeFor(current string, limit func(subscription.Plan) int64) (subscription.Plan, bool) {
+	have := limit(Get(current))
+	if have == subscription.Unlimited {
+		return subscription.Plan{}, false
+	}
+	for _, p := range catalogue {
+		if l := limit(p); l == subscription.Unlimited || l > have {
+			return p, true
+		}
+	}
+	return subscription.Plan{}, false
+}
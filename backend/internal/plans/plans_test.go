@@ -0,0 +1,65 @@
+package plans
+
+import (
+	"testing"
+
+	"github.com/strct-org/portal/backend/internal/types/subscription"
+)
+
+func TestGet(t *testing.T) {
+	tests := map[string]string{
+		subscription.PlanFree: subscription.PlanFree,
+		subscription.PlanPlus: subscription.PlanPlus,
+		subscription.PlanPro:  subscription.PlanPro,
+		"enterprise":          subscription.PlanFree,
+		"":                    subscription.PlanFree,
+	}
+	for id, want := range tests {
+		if got := Get(id).ID; got != want {
+			t.Errorf("Get(%q) = %s, want %s", id, got, want)
+		}
+		if Exists(id) != (id == want) {
+			t.Errorf("Exists(%q) = %v", id, Exists(id))
+		}
+	}
+}
+
+func TestUpgradeFor(t *testing.T) {
+	devices := func(p subscription.Plan) int64 { return p.MaxDevices }
+	links := func(p subscription.Plan) int64 { return p.MaxPublicLinks }
+
+	tests := []struct {
+		name    string
+		current string
+		limit   func(subscription.Plan) int64
+		want    string
+		wantOK  bool
+	}{
+		{"free devices", subscription.PlanFree, devices, subscription.PlanPlus, true},
+		{"plus devices", subscription.PlanPlus, devices, subscription.PlanPro, true},
+		{"pro devices", subscription.PlanPro, devices, "", false},
+		{"plus links go unlimited", subscription.PlanPlus, links, subscription.PlanPro, true},
+		{"unlimited links", subscription.PlanPro, links, "", false},
+		{"unknown plan counts as free", "enterprise", devices, subscription.PlanPlus, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := UpgradeFor(tt.current, tt.limit)
+		if ok != tt.wantOK || got.ID != tt.want {
+			t.Errorf("%s: got %q, %v; want %q, %v", tt.name, got.ID, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestCatalogueOrderedByPrice(t *testing.T) {
+	all := All()
+	for i := 1; i < len(all); i++ {
+		if all[i].PriceCents < all[i-1].PriceCents {
+			t.Fatalf("%s is cheaper than %s", all[i].ID, all[i-1].ID)
+		}
+	}
+	all[0].MaxDevices = 100
+	if Get(all[0].ID).MaxDevices == 100 {
+		t.Fatal("All returned the catalogue itself")
+	}
+}
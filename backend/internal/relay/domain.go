@@ -0,0 +1,96 @@
+package relay
+
+import (
+	"encoding/base32"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// maxLabel is the longest DNS label, which limits device IDs reachable in
+// the browser to 39 bytes.
+const maxLabel = 63
+
+// labelEncoding turns device IDs, which aren't necessarily valid host names,
+// into DNS labels. Host names are case-insensitive, so labels are lower case
+// and decoded in upper case.
+var labelEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// Domain is where users reach devices through the relay. Every device is
+// served on its own subdomain, so content a device serves runs in an origin
+// of its own, apart from the portal and from other devices.
+//
+// It should be a registrable domain of its own, listed on the Public Suffix
+// List, rather than a subdomain of the portal's: portal cookies set for the
+// parent domain would otherwise reach pages served by devices, and devices
+// would be same-site with each other.
+type Domain struct {
+	scheme   string
+	host     string
+	hostname string
+}
+
+// ParseDomain parses the relay's base URL, such as
+// https://strct-relay.net, whose subdomains serve devices.
+func ParseDomain(rawURL string) (*Domain, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || strings.Trim(u.Path, "/") != "" {
+		return nil, fmt.Errorf("relay URL must be an http(s) origin, got %q", rawURL)
+	}
+	return &Domain{scheme: u.Scheme, host: strings.ToLower(u.Host), hostname: strings.ToLower(u.Hostname())}, nil
+}
+
+// DomainFromEnv reads RELAY_URL, falling back to relay.localhost, whose
+// subdomains browsers resolve to the local machine.
+func DomainFromEnv() *Domain {
+	raw := os.Getenv("RELAY_URL")
+	if raw == "" {
+		raw = "http://relay.localhost:3333"
+	}
+	d, err := ParseDomain(raw)
+	if err != nil {
+		log.Fatalf("Invalid RELAY_URL: %v", err)
+	}
+	return d
+}
+
+// HostTemplate matches the relay's device hosts, with the device's label as
+// the "label" variable, for mux.Route.Host.
+func (d *Domain) HostTemplate() string {
+	return "{label}." + d.hostname
+}
+
+// DeviceURL is the root of the device's origin, or false when the device ID
+// is too long to fit in a host name.
+func (d *Domain) DeviceURL(deviceID string) (string, bool) {
+	label := strings.ToLower(labelEncoding.EncodeToString([]byte(deviceID)))
+	if label == "" || len(label) > maxLabel {
+		return "", false
+	}
+	return d.scheme + "://" + label + "." + d.host + "/", true
+}
+
+// Origin is the origin a browser reports for pages served on host, a device
+// host of this domain.
+func (d *Domain) Origin(host string) string {
+	return d.scheme + "://" + strings.ToLower(host)
+}
+
+// DeviceID decodes the label of a device host. Each device has exactly one
+// label, so labels that decode but aren't how the ID encodes are rejected.
+func DeviceID(label string) (string, bool) {
+	label = strings.ToLower(label)
+	if label == "" || len(label) > maxLabel {
+		return "", false
+	}
+	id, err := labelEncoding.DecodeString(strings.ToUpper(label))
+	if err != nil || len(id) == 0 || strings.ToLower(labelEncoding.EncodeToString(id)) != label {
+		return "", false
+	}
+	return string(id), true
+}
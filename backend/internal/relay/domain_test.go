@@ -0,0 +1,63 @@
+package relay
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeviceURLRoundTrip(t *testing.T) {
+	d, err := ParseDomain("https://strct-relay.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"dev-1", "Device_ABC", "3f2b9c1e-6a4d-4e0b-9d7a-1c2e3f4a5b6c", "a.b/c"} {
+		u, ok := d.DeviceURL(id)
+		if !ok {
+			t.Errorf("DeviceURL(%q) failed", id)
+			continue
+		}
+		host := strings.TrimSuffix(strings.TrimPrefix(u, "https://"), "/")
+		label, rest, _ := strings.Cut(host, ".")
+		if rest != "strct-relay.test" || label != strings.ToLower(label) {
+			t.Errorf("DeviceURL(%q) = %q, want a lower-case subdomain of strct-relay.test", id, u)
+		}
+		if got, ok := DeviceID(label); !ok || got != id {
+			t.Errorf("DeviceID(%q) = %q, %v; want %q", label, got, ok, id)
+		}
+		if got, ok := DeviceID(strings.ToUpper(label)); !ok || got != id {
+			t.Errorf("DeviceID(%q) = %q, %v; want host names to be case-insensitive", strings.ToUpper(label), got, ok)
+		}
+	}
+
+	if _, ok := d.DeviceURL(strings.Repeat("x", 40)); ok {
+		t.Error("DeviceURL accepted an ID too long for a DNS label")
+	}
+}
+
+func TestDeviceIDRejectsOtherLabels(t *testing.T) {
+	for _, label := range []string{"", "www", "not-a-label", "cpi6", strings.Repeat("0", 64)} {
+		if id, ok := DeviceID(label); ok {
+			t.Errorf("DeviceID(%q) = %q, want it rejected", label, id)
+		}
+	}
+}
+
+func TestParseDomain(t *testing.T) {
+	d, err := ParseDomain("http://relay.localhost:3333")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.HostTemplate(); got != "{label}.relay.localhost" {
+		t.Errorf("HostTemplate = %q", got)
+	}
+	if u, _ := d.DeviceURL("a"); u != "http://c4.relay.localhost:3333/" {
+		t.Errorf("DeviceURL = %q", u)
+	}
+
+	for _, raw := range []string{"relay.localhost", "ftp://relay.test", "https://relay.test/devices", "https://"} {
+		if _, err := ParseDomain(raw); err == nil {
+			t.Errorf("ParseDomain(%q) succeeded", raw)
+		}
+	}
+}
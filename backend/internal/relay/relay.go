@@ -0,0 +1,163 @@
+// Package relay tunnels HTTP requests to devices behind NAT. Each device keeps
+// one outbound WebSocket open to the portal, multiplexed with yamux, and the
+// portal opens a stream on it for every proxied connection.
+package relay
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/yamux"
+)
+
+const hostSuffix = ".relay.internal"
+
+var (
+	ErrNotConnected = errors.New("device has no relay connection")
+	ErrClosing      = errors.New("relay is shutting down")
+)
+
+// Relay holds at most one tunnel per device; a reconnecting device replaces
+// its previous tunnel.
+type Relay struct {
+	mu       sync.Mutex
+	sessions map[string]*yamux.Session
+	closing  bool
+	wg       sync.WaitGroup
+}
+
+func New() *Relay {
+	return &Relay{
+		sessions: make(map[string]*yamux.Session),
+	}
+}
+
+// Serve runs the device's tunnel over ws until either side closes it.
+func (r *Relay) Serve(deviceID string, ws *websocket.Conn) error {
+	cfg := yamux.DefaultConfig()
+	cfg.KeepAliveInterval = 25 * time.Second
+	cfg.LogOutput = io.Discard
+	// The portal opens streams, so it is the yamux client; the device accepts
+	session, err := yamux.Client(&wsConn{ws: ws}, cfg)
+	if err != nil {
+		ws.Close()
+		return fmt.Errorf("failed to start relay session: %w", err)
+	}
+
+	r.mu.Lock()
+	if r.closing {
+		r.mu.Unlock()
+		session.Close()
+		return ErrClosing
+	}
+	if old, ok := r.sessions[deviceID]; ok {
+		old.Close()
+	}
+	r.sessions[deviceID] = session
+	r.wg.Add(1)
+	r.mu.Unlock()
+
+	defer r.wg.Done()
+	<-session.CloseChan()
+
+	r.mu.Lock()
+	if r.sessions[deviceID] == session {
+		delete(r.sessions, deviceID)
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// Connected reports whether the device has a tunnel to this instance.
+func (r *Relay) Connected(deviceID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.sessions[deviceID]
+	return ok
+}
+
+// Dial opens a new stream to the device.
+func (r *Relay) Dial(ctx context.Context, deviceID string) (net.Conn, error) {
+	r.mu.Lock()
+	session, ok := r.sessions[deviceID]
+	r.mu.Unlock()
+	if !ok {
+		return nil, ErrNotConnected
+	}
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	opened := make(chan result, 1)
+	go func() {
+		conn, err := session.Open()
+		opened <- result{conn, err}
+	}()
+
+	select {
+	case res := <-opened:
+		if errors.Is(res.err, yamux.ErrSessionShutdown) {
+			return nil, ErrNotConnected
+		}
+		return res.conn, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-opened; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// Run waits for ctx to be cancelled, then closes every tunnel and waits for
+// them to wind down.
+func (r *Relay) Run(ctx context.Context) {
+	<-ctx.Done()
+
+	r.mu.Lock()
+	r.closing = true
+	for _, session := range r.sessions {
+		session.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+}
+
+// Transport returns a transport that reaches devices through their tunnels.
+// Requests must be addressed to Host(deviceID).
+func (r *Relay) Transport() *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			deviceID, err := hex.DecodeString(strings.TrimSuffix(host, hostSuffix))
+			if err != nil {
+				return nil, fmt.Errorf("not a relay address: %s", addr)
+			}
+			return r.Dial(ctx, string(deviceID))
+		},
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       30 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}
+}
+
+// Host is the placeholder host that Transport routes to the device. Device
+// IDs are hex encoded because they aren't necessarily valid host names.
+func Host(deviceID string) string {
+	return hex.EncodeToString([]byte(deviceID)) + hostSuffix
+}
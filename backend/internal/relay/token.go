@@ -0,0 +1,96 @@
+package relay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// minKeySize is the shortest RELAY_SIGNING_KEY accepted, in bytes.
+const minKeySize = 32
+
+var (
+	ErrInvalidToken = errors.New("invalid relay token")
+	ErrExpiredToken = errors.New("relay token has expired")
+)
+
+// TokenSigner issues and verifies tokens that let a browser reach a device
+// through the relay without an Authorization header. A token is
+// <payload>.<HMAC-SHA256>, where the payload is its expiry, the device ID and
+// the user's Clerk ID, so it only opens the device it was issued for.
+type TokenSigner struct {
+	key []byte
+}
+
+func NewTokenSigner(key []byte) *TokenSigner {
+	return &TokenSigner{key: key}
+}
+
+// TokenSignerFromEnv reads RELAY_SIGNING_KEY, a base64 key of at least 32
+// bytes. It returns nil when the key is missing or invalid, which leaves the
+// relay reachable only with a Bearer token.
+func TokenSignerFromEnv() *TokenSigner {
+	raw := os.Getenv("RELAY_SIGNING_KEY")
+	if raw == "" {
+		log.Println("WARNING: RELAY_SIGNING_KEY not set. Browsers can't open devices through the relay")
+		return nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(key) < minKeySize {
+		log.Printf("WARNING: RELAY_SIGNING_KEY must be a base64 key of at least %d bytes. Browsers can't open devices through the relay", minKeySize)
+		return nil
+	}
+	return NewTokenSigner(key)
+}
+
+// Sign returns a token for clerkID to reach deviceID, valid until expires.
+func (s *TokenSigner) Sign(clerkID, deviceID string, expires time.Time) string {
+	payload := binary.BigEndian.AppendUint64(nil, uint64(expires.Unix()))
+	payload = append(payload, deviceID...)
+	payload = append(payload, 0)
+	payload = append(payload, clerkID...)
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.mac(payload))
+}
+
+// Verify returns the Clerk ID in token if its signature is valid, it was
+// issued for deviceID and it hasn't expired at now.
+func (s *TokenSigner) Verify(token, deviceID string, now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	rawPayload, rawSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	payload, err := enc.DecodeString(rawPayload)
+	if err != nil || len(payload) < 8 {
+		return "", ErrInvalidToken
+	}
+	sig, err := enc.DecodeString(rawSig)
+	if err != nil || !hmac.Equal(sig, s.mac(payload)) {
+		return "", ErrInvalidToken
+	}
+
+	tokenDevice, clerkID, ok := strings.Cut(string(payload[8:]), "\x00")
+	if !ok || tokenDevice != deviceID || clerkID == "" {
+		return "", ErrInvalidToken
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(payload[:8])), 0)
+	if !now.Before(expires) {
+		return "", ErrExpiredToken
+	}
+	return clerkID, nil
+}
+
+func (s *TokenSigner) mac(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,63 @@
+// Package serial verifies the proofs units are provisioned with at the
+// factory, so a device can't claim another unit's serial number and be
+// offered to that unit's buyer.
+package serial
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"os"
+)
+
+// minKeySize is the shortest SERIAL_SIGNING_KEY accepted, in bytes.
+const minKeySize = 32
+
+// Verifier checks proofs of the form base64url(HMAC-SHA256(key, serial)).
+// Each unit only holds the proof for its own serial, never the key.
+type Verifier struct {
+	key []byte
+}
+
+func NewVerifier(key []byte) *Verifier {
+	return &Verifier{key: key}
+}
+
+// VerifierFromEnv reads SERIAL_SIGNING_KEY, the base64 key the factory signs
+// serials with. It returns nil when the key is missing or invalid, in which
+// case serials are ignored and every device pairs with its code.
+func VerifierFromEnv() *Verifier {
+	raw := os.Getenv("SERIAL_SIGNING_KEY")
+	if raw == "" {
+		log.Println("WARNING: SERIAL_SIGNING_KEY not set. Devices won't be matched to orders by serial")
+		return nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(key) < minKeySize {
+		log.Printf("WARNING: SERIAL_SIGNING_KEY must be a base64 key of at least %d bytes. Devices won't be matched to orders by serial", minKeySize)
+		return nil
+	}
+	return NewVerifier(key)
+}
+
+// Sign returns the proof to provision a unit with serial.
+func (v *Verifier) Sign(serial string) string {
+	return base64.RawURLEncoding.EncodeToString(v.mac(serial))
+}
+
+// Verify reports whether proof was issued for serial.
+func (v *Verifier) Verify(serial, proof string) bool {
+	if serial == "" {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(proof)
+	return err == nil && hmac.Equal(sig, v.mac(serial))
+}
+
+func (v *Verifier) mac(serial string) []byte {
+	mac := hmac.New(sha256.New, v.key)
+	mac.Write([]byte(serial))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,33 @@
+package serial
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifier(t *testing.T) {
+	v := NewVerifier([]byte(strings.Repeat("k", minKeySize)))
+	other := NewVerifier([]byte(strings.Repeat("o", minKeySize)))
+	proof := v.Sign("BS-2025-000123")
+
+	tests := []struct {
+		name   string
+		serial string
+		proof  string
+		want   bool
+	}{
+		{"valid", "BS-2025-000123", proof, true},
+		{"other serial", "BS-2025-000124", proof, false},
+		{"other key", "BS-2025-000123", other.Sign("BS-2025-000123"), false},
+		{"truncated", "BS-2025-000123", proof[:len(proof)-2], false},
+		{"bad encoding", "BS-2025-000123", "!!" + proof, false},
+		{"no proof", "BS-2025-000123", "", false},
+		{"no serial", "", v.Sign(""), false},
+	}
+
+	for _, tt := range tests {
+		if got := v.Verify(tt.serial, tt.proof); got != tt.want {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
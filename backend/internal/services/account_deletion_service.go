@@ -0,0 +1,364 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"time"
+
+	clerkuser "github.com/clerk/clerk-sdk-go/v2/user"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/mailer"
+	"github.com/strct-org/portal/backend/internal/types/deletion"
+)
+
+const (
+	deletionCodeTTL         = 15 * time.Minute
+	deletionCodeMaxAttempts = 5
+)
+
+type AccountDeletionService struct {
+	db          *pgxpool.Pool
+	userService *UserService
+	emails      *EmailService
+
+	grace   time.Duration
+	baseURL string
+}
+
+// NewAccountDeletionService schedules deletions grace after ownership is
+// verified. baseURL is the public origin used for links in emails.
+func NewAccountDeletionService(db *pgxpool.Pool, userService *UserService, emails *EmailService, grace time.Duration, baseURL string) *AccountDeletionService {
+	return &AccountDeletionService{
+		db:          db,
+		userService: userService,
+		emails:      emails,
+		grace:       grace,
+		baseURL:     baseURL,
+	}
+}
+
+func (s *AccountDeletionService) GracePeriod() time.Duration {
+	return s.grace
+}
+
+// RequestDeletion emails a one-time code to the account owner. The returned ID
+// is the same shape whether or not the email belongs to an account, so the
+// form can't be used to probe for registered addresses.
+func (s *AccountDeletionService) RequestDeletion(ctx context.Context, email string) (uuid.UUID, error) {
+	id := uuid.New()
+
+	u, err := s.userService.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		return id, nil
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	code, err := randomDigits(6)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	INSERT INTO account_deletion_requests (id, clerk_id, email, code_hash, code_expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := tx.Exec(ctx, query, id, u.ClerkID, u.Email, hashSecret(code), time.Now().Add(deletionCodeTTL)); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create deletion request: %w", err)
+	}
+
+	err = s.emails.Enqueue(ctx, tx, nil, mailer.TemplateDeletionCode, u.Email, struct {
+		Email   string
+		Code    string
+		Minutes int
+	}{u.Email, code, int(deletionCodeTTL.Minutes())})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+// Verify checks the emailed code and, when it matches, schedules the deletion
+// after the grace period and emails a cancellation link.
+func (s *AccountDeletionService) Verify(ctx context.Context, id uuid.UUID, code string) (*deletion.Request, error) {
+	// Every guess uses up an attempt before it is checked, in one statement,
+	// so concurrent guesses can't get past the limit
+	var codeHash string
+	query := `
+	UPDATE account_deletion_requests
+	SET attempts = attempts + 1, updated_at = NOW()
+	WHERE id = $1 AND status = 'pending_verification' AND attempts < $2 AND code_expires_at > NOW()
+	RETURNING code_hash
+	`
+	err := s.db.QueryRow(ctx, query, id, deletionCodeMaxAttempts).Scan(&codeHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, s.verifyFailure(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record deletion code attempt: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(code)), []byte(codeHash)) != 1 {
+		return nil, ErrInvalidDeletionCode
+	}
+
+	cancelToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	update := `
+	UPDATE account_deletion_requests
+	SET status = 'scheduled', scheduled_for = $2, cancel_token_hash = $3, updated_at = NOW()
+	WHERE id = $1 AND status = 'pending_verification'
+	RETURNING id, clerk_id, email, status, scheduled_for, completed_at, created_at, updated_at
+	`
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	req := &deletion.Request{}
+	err = tx.QueryRow(ctx, update, id, time.Now().Add(s.grace), hashSecret(cancelToken)).Scan(
+		&req.ID,
+		&req.ClerkID,
+		&req.Email,
+		&req.Status,
+		&req.ScheduledFor,
+		&req.CompletedAt,
+		&req.CreatedAt,
+		&req.UpdatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrDeletionAlreadyScheduled
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrDeletionNotPending
+		}
+		return nil, fmt.Errorf("failed to schedule deletion: %w", err)
+	}
+
+	cancelURL := fmt.Sprintf("%s/api/v1/delete-account-webpage/cancel?request=%s&token=%s",
+		s.baseURL, req.ID, url.QueryEscape(cancelToken))
+
+	err = s.emails.Enqueue(ctx, tx, nil, mailer.TemplateDeletionScheduled, req.Email, struct {
+		ScheduledFor string
+		CancelURL    string
+	}{req.ScheduledFor.UTC().Format("2 January 2006 15:04 MST"), cancelURL})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// verifyFailure explains why no attempt could be recorded for request id.
+// Unknown IDs come from RequestDeletion for unregistered emails, and are
+// reported like wrong, expired or exhausted codes.
+func (s *AccountDeletionService) verifyFailure(ctx context.Context, id uuid.UUID) error {
+	var status string
+	err := s.db.QueryRow(ctx, `SELECT status FROM account_deletion_requests WHERE id = $1`, id).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidDeletionCode
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load deletion request: %w", err)
+	}
+	if status != deletion.StatusPendingVerification {
+		return ErrDeletionNotPending
+	}
+	return ErrInvalidDeletionCode
+}
+
+// Cancel stops a scheduled deletion. token is the secret from the emailed link.
+func (s *AccountDeletionService) Cancel(ctx context.Context, id uuid.UUID, token string) error {
+	var tokenHash, status string
+	err := s.db.QueryRow(ctx, `SELECT cancel_token_hash, status FROM account_deletion_requests WHERE id = $1`, id).Scan(&tokenHash, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrDeletionRequestNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load deletion request: %w", err)
+	}
+
+	if tokenHash == "" || subtle.ConstantTimeCompare([]byte(hashSecret(token)), []byte(tokenHash)) != 1 {
+		return ErrDeletionRequestNotFound
+	}
+	if status != deletion.StatusScheduled {
+		return ErrDeletionNotScheduled
+	}
+
+	result, err := s.db.Exec(ctx, `
+	UPDATE account_deletion_requests
+	SET status = 'cancelled', updated_at = NOW()
+	WHERE id = $1 AND status = 'scheduled'
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to cancel deletion: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrDeletionNotScheduled
+	}
+
+	return nil
+}
+
+func (s *AccountDeletionService) Get(ctx context.Context, id uuid.UUID) (*deletion.Request, error) {
+	query := `
+	SELECT id, clerk_id, email, status, scheduled_for, completed_at, created_at, updated_at
+	FROM account_deletion_requests
+	WHERE id = $1
+	`
+
+	req := &deletion.Request{}
+	err := s.db.QueryRow(ctx, query, id).Scan(
+		&req.ID,
+		&req.ClerkID,
+		&req.Email,
+		&req.Status,
+		&req.ScheduledFor,
+		&req.CompletedAt,
+		&req.CreatedAt,
+		&req.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeletionRequestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deletion request: %w", err)
+	}
+
+	return req, nil
+}
+
+// Run deletes accounts whose grace period has passed, until ctx is cancelled.
+func (s *AccountDeletionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.processDue(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Account deletion sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *AccountDeletionService) processDue(ctx context.Context) error {
+	rows, err := s.db.Query(ctx, `
+	SELECT id, clerk_id
+	FROM account_deletion_requests
+	WHERE status = 'scheduled' AND scheduled_for <= NOW()
+	ORDER BY scheduled_for
+	LIMIT 20
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query due deletions: %w", err)
+	}
+
+	type due struct {
+		id      uuid.UUID
+		clerkID string
+	}
+	var pending []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.clerkID); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range pending {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		err := s.userService.DeleteUserByClerkID(ctx, d.clerkID)
+		if err != nil && !errors.Is(err, ErrUserNotFound) {
+			log.Printf("Failed to delete user for deletion request %s: %v", d.id, err)
+			continue
+		}
+
+		// Remove the sign-in identity too; the resulting user.deleted webhook
+		// finds nothing left to delete.
+		if _, err := clerkuser.Delete(ctx, d.clerkID); err != nil {
+			log.Printf("Failed to delete Clerk user for deletion request %s: %v", d.id, err)
+		}
+
+		_, err = s.db.Exec(ctx, `
+		UPDATE account_deletion_requests
+		SET status = 'completed', completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'scheduled'
+		`, d.id)
+		if err != nil {
+			log.Printf("Failed to mark deletion request %s completed: %v", d.id, err)
+			continue
+		}
+
+		log.Printf("Deleted account for deletion request %s", d.id)
+	}
+
+	return nil
+}
+
+func randomDigits(n int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+	v, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", n, v), nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashSecret stores one-time codes and tokens as SHA-256 so a database leak
+// doesn't hand out working links.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
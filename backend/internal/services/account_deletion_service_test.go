@@ -0,0 +1,33 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRandomDigits(t *testing.T) {
+	for _, n := range []int{1, 6, 12} {
+		for i := 0; i < 50; i++ {
+			code, err := randomDigits(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(code) != n || strings.Trim(code, "0123456789") != "" {
+				t.Fatalf("randomDigits(%d) = %q, want %d digits", n, code, n)
+			}
+		}
+	}
+}
+
+func TestHashSecret(t *testing.T) {
+	a, b := hashSecret("123456"), hashSecret("123457")
+	if a != hashSecret("123456") {
+		t.Fatal("hashSecret is not deterministic")
+	}
+	if a == b {
+		t.Fatal("different secrets hash the same")
+	}
+	if len(a) != 64 || strings.Contains(a, "123456") {
+		t.Fatalf("hashSecret = %q, want a hex SHA-256 digest", a)
+	}
+}
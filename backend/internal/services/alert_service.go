@@ -0,0 +1,467 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/mailer"
+	"github.com/strct-org/portal/backend/internal/types/alert"
+	"github.com/strct-org/portal/backend/internal/types/notification"
+)
+
+const (
+	alertEvalInterval = time.Minute
+	alertRetention    = 180 * 24 * time.Hour
+	deviceAlertLimit  = 100
+)
+
+const alertRuleColumns = `id, device_id, kind, threshold, cooldown_minutes, notify, email, enabled, created_at, updated_at`
+
+// alertTargets pairs each enabled rule with the devices it covers.
+const alertTargets = `
+WITH targets AS (
+	SELECT r.id AS rule_id, r.user_id, u.email AS user_email, r.kind, r.threshold,
+		r.cooldown_minutes, r.notify, r.email, d.id AS device_id,
+		COALESCE(NULLIF(d.friendly_name, ''), d.id) AS device_name, d.is_online, d.last_seen
+	FROM alert_rules r
+	JOIN users u ON u.id = r.user_id
+	JOIN devices d ON d.owner_id = r.user_id AND (r.device_id IS NULL OR r.device_id = d.id)
+	WHERE r.enabled
+)
+SELECT t.rule_id, t.user_id, t.user_email, t.kind, t.cooldown_minutes, t.notify, t.email,
+	t.device_id, t.device_name, `
+
+// firingQueries select, for each rule kind, the rules whose condition holds
+// now, with a subject and a message describing it.
+var firingQueries = []string{
+	alertTargets + `'', format('%s has been offline since %s.', t.device_name,
+		to_char(t.last_seen AT TIME ZONE 'UTC', 'FMDD FMMonth YYYY HH24:MI "UTC"'))
+	FROM targets t
+	WHERE t.kind = 'offline' AND NOT t.is_online
+	AND t.last_seen < NOW() - make_interval(mins => t.threshold)`,
+
+	alertTargets + `dk.name, format('Disk %s on %s is %s%% full.', dk.name, t.device_name,
+		dk.used_bytes * 100 / dk.total_bytes)
+	FROM targets t
+	JOIN device_disks dk ON dk.device_id = t.device_id
+	WHERE t.kind = 'disk_usage' AND dk.total_bytes > 0
+	AND dk.used_bytes * 100 >= dk.total_bytes * t.threshold`,
+
+	alertTargets + `dk.name, rtrim(format('Disk %s on %s reports SMART status %s. %s', dk.name,
+		t.device_name, dk.smart_status, dk.smart_message))
+	FROM targets t
+	JOIN device_disks dk ON dk.device_id = t.device_id
+	WHERE t.kind = 'smart_warning' AND dk.smart_status IN ('warning', 'failing')`,
+
+	// Firing until a later update installs
+	alertTargets + `du.rollout_id::text, rtrim(format('Updating %s to %s failed. %s', t.device_name,
+		rel.version, du.error))
+	FROM targets t
+	JOIN LATERAL (
+		SELECT rollout_id, state, error FROM device_updates
+		WHERE device_id = t.device_id
+		ORDER BY updated_at DESC
+		LIMIT 1
+	) du ON du.state = 'failed'
+	JOIN rollouts ro ON ro.id = du.rollout_id
+	JOIN releases rel ON rel.id = ro.release_id
+	WHERE t.kind = 'update_failed'`,
+}
+
+// firing is a rule whose condition holds for a device.
+type firing struct {
+	ruleID     uuid.UUID
+	userID     uuid.UUID
+	userEmail  string
+	kind       string
+	cooldown   int
+	notify     bool
+	email      bool
+	deviceID   string
+	deviceName string
+	subject    string
+	message    string
+}
+
+type alertKey struct {
+	ruleID   uuid.UUID
+	deviceID string
+	subject  string
+}
+
+// AlertService evaluates users' alert rules against device presence,
+// telemetry and updates, and keeps the alert history of each device.
+type AlertService struct {
+	db            *pgxpool.Pool
+	notifications *NotificationService
+	emails        *EmailService
+	events        *events.Broker
+}
+
+func NewAlertService(db *pgxpool.Pool, notifications *NotificationService, emails *EmailService, broker *events.Broker) *AlertService {
+	return &AlertService{
+		db:            db,
+		notifications: notifications,
+		emails:        emails,
+		events:        broker,
+	}
+}
+
+// CreateRule adds a rule for the user. req must already be validated.
+func (s *AlertService) CreateRule(ctx context.Context, clerkID string, req *alert.RuleRequest) (*alert.Rule, error) {
+	rule, err := scanAlertRule(s.db.QueryRow(ctx, `
+	INSERT INTO alert_rules (id, user_id, device_id, kind, threshold, cooldown_minutes, notify, email, enabled)
+	SELECT $1::uuid, u.id, $3::text, $4::text, $5::int, $6::int, $7::boolean, $8::boolean, $9::boolean FROM users u
+	WHERE u.clerk_id = $2
+	AND ($3::text IS NULL OR EXISTS (SELECT 1 FROM devices WHERE id = $3 AND owner_id = u.id))
+	RETURNING `+alertRuleColumns,
+		uuid.New(), clerkID, req.DeviceID, req.Kind, req.Threshold, *req.CooldownMinutes, *req.Notify, *req.Email, *req.Enabled))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create alert rule: %w", err)
+	}
+	return rule, nil
+}
+
+func (s *AlertService) ListRules(ctx context.Context, clerkID string) ([]*alert.Rule, error) {
+	rows, err := s.db.Query(ctx, `
+	SELECT `+alertRuleColumns+` FROM alert_rules
+	WHERE user_id = (SELECT id FROM users WHERE clerk_id = $1)
+	ORDER BY created_at
+	`, clerkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []*alert.Rule{}
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan alert rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// UpdateRule replaces one of the user's rules. Open alerts of the rule are
+// re-evaluated against the new settings on the next sweep.
+func (s *AlertService) UpdateRule(ctx context.Context, clerkID string, id uuid.UUID, req *alert.RuleRequest) (*alert.Rule, error) {
+	rule, err := scanAlertRule(s.db.QueryRow(ctx, `
+	UPDATE alert_rules r SET device_id = $3, kind = $4, threshold = $5, cooldown_minutes = $6,
+		notify = $7, email = $8, enabled = $9, updated_at = NOW()
+	FROM users u
+	WHERE r.id = $1 AND u.clerk_id = $2 AND r.user_id = u.id
+	AND ($3::text IS NULL OR EXISTS (SELECT 1 FROM devices WHERE id = $3 AND owner_id = u.id))
+	RETURNING r.id, r.device_id, r.kind, r.threshold, r.cooldown_minutes, r.notify, r.email, r.enabled, r.created_at, r.updated_at
+	`, id, clerkID, req.DeviceID, req.Kind, req.Threshold, *req.CooldownMinutes, *req.Notify, *req.Email, *req.Enabled))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Either the rule or the device isn't the user's
+		var exists bool
+		if err := s.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM alert_rules WHERE id = $1 AND user_id = (SELECT id FROM users WHERE clerk_id = $2))
+		`, id, clerkID).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to look up alert rule: %w", err)
+		}
+		if !exists {
+			return nil, ErrAlertRuleNotFound
+		}
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update alert rule: %w", err)
+	}
+	return rule, nil
+}
+
+// DeleteRule removes one of the user's rules. Its alerts stay in the device
+// history, resolved.
+func (s *AlertService) DeleteRule(ctx context.Context, clerkID string, id uuid.UUID) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID uuid.UUID
+	err = tx.QueryRow(ctx, `
+	DELETE FROM alert_rules
+	WHERE id = $1 AND user_id = (SELECT id FROM users WHERE clerk_id = $2)
+	RETURNING user_id
+	`, id, clerkID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrAlertRuleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete alert rule: %w", err)
+	}
+
+	// The foreign key has already cleared rule_id, so open alerts are
+	// found through the user
+	if _, err := tx.Exec(ctx, `
+	UPDATE device_alerts SET resolved_at = NOW()
+	WHERE rule_id IS NULL AND user_id = $1 AND resolved_at IS NULL
+	`, userID); err != nil {
+		return fmt.Errorf("failed to resolve alerts of rule: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListDeviceAlerts returns the latest alerts of a device the user owns,
+// newest first.
+func (s *AlertService) ListDeviceAlerts(ctx context.Context, clerkID, deviceID string) ([]*alert.Alert, error) {
+	var userID uuid.UUID
+	err := s.db.QueryRow(ctx, `
+	SELECT u.id FROM users u
+	JOIN devices d ON d.owner_id = u.id
+	WHERE u.clerk_id = $1 AND d.id = $2
+	`, clerkID, deviceID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up device: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, `
+	SELECT id, rule_id, device_id, kind, subject, message, triggered_at, resolved_at
+	FROM device_alerts
+	WHERE device_id = $1 AND user_id = $2
+	ORDER BY triggered_at DESC
+	LIMIT $3
+	`, deviceID, userID, deviceAlertLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []*alert.Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan alert: %w", err)
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// Run evaluates every rule each minute until ctx is cancelled.
+func (s *AlertService) Run(ctx context.Context) {
+	ticker := time.NewTicker(alertEvalInterval)
+	defer ticker.Stop()
+
+	lastSweep := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.Evaluate(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Alert evaluation failed: %v", err)
+		}
+
+		if time.Since(lastSweep) >= time.Hour {
+			lastSweep = time.Now()
+			if _, err := s.db.Exec(ctx, `
+			DELETE FROM device_alerts
+			WHERE resolved_at IS NOT NULL AND triggered_at < NOW() - make_interval(secs => $1)
+			`, alertRetention.Seconds()); err != nil && ctx.Err() == nil {
+				log.Printf("Alert history sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+// Evaluate opens alerts for rules whose condition holds and resolves those
+// whose condition no longer does.
+func (s *AlertService) Evaluate(ctx context.Context) error {
+	firings := map[alertKey]*firing{}
+	for _, query := range firingQueries {
+		if err := s.collect(ctx, query, firings); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range firings {
+		if err := s.open(ctx, f); err != nil {
+			log.Printf("Error opening %s alert for device %s: %v", f.kind, f.deviceID, err)
+		}
+	}
+	return s.resolve(ctx, firings)
+}
+
+func (s *AlertService) collect(ctx context.Context, query string, firings map[alertKey]*firing) error {
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		f := &firing{}
+		if err := rows.Scan(&f.ruleID, &f.userID, &f.userEmail, &f.kind, &f.cooldown, &f.notify, &f.email,
+			&f.deviceID, &f.deviceName, &f.subject, &f.message); err != nil {
+			return fmt.Errorf("failed to scan alert condition: %w", err)
+		}
+		firings[alertKey{f.ruleID, f.deviceID, f.subject}] = f
+	}
+	return rows.Err()
+}
+
+// open records the alert unless it is already open or was raised within the
+// rule's cooldown, and delivers it if it is new.
+func (s *AlertService) open(ctx context.Context, f *firing) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := scanAlert(tx.QueryRow(ctx, `
+	INSERT INTO device_alerts (id, rule_id, user_id, device_id, kind, subject, message)
+	SELECT $1::uuid, $2::uuid, $3::uuid, $4::text, $5::text, $6::text, $7::text
+	WHERE NOT EXISTS (
+		SELECT 1 FROM device_alerts
+		WHERE rule_id = $2 AND device_id = $4 AND subject = $6
+		AND (resolved_at IS NULL OR triggered_at > NOW() - make_interval(mins => $8))
+	)
+	ON CONFLICT DO NOTHING
+	RETURNING id, rule_id, device_id, kind, subject, message, triggered_at, resolved_at
+	`, uuid.New(), f.ruleID, f.userID, f.deviceID, f.kind, f.subject, f.message, f.cooldown))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record alert: %w", err)
+	}
+
+	title := alertTitle(f.kind, f.deviceName)
+	if f.email {
+		err := s.emails.Enqueue(ctx, tx, &f.userID, mailer.TemplateDeviceAlert, f.userEmail, struct {
+			Title   string
+			Message string
+		}{title, f.message})
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	s.events.Publish(f.userID, events.TypeAlertTriggered, a)
+	if f.notify {
+		typ := notification.TypeDeviceAlert
+		if f.kind == alert.KindOffline {
+			typ = notification.TypeDeviceOffline
+		}
+		return s.notifications.Notify(ctx, f.userID, &notification.Draft{
+			Type:  typ,
+			Title: title,
+			Body:  f.message,
+			Data:  map[string]any{"alertId": a.ID, "deviceId": a.DeviceID},
+		})
+	}
+	return nil
+}
+
+// resolve closes open alerts that aren't firing any more.
+func (s *AlertService) resolve(ctx context.Context, firings map[alertKey]*firing) error {
+	rows, err := s.db.Query(ctx, `
+	SELECT id, user_id, rule_id, device_id, subject FROM device_alerts WHERE resolved_at IS NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query open alerts: %w", err)
+	}
+
+	type openAlert struct {
+		id     uuid.UUID
+		userID uuid.UUID
+	}
+	var stale []openAlert
+	for rows.Next() {
+		var (
+			a      openAlert
+			ruleID *uuid.UUID
+			key    alertKey
+		)
+		if err := rows.Scan(&a.id, &a.userID, &ruleID, &key.deviceID, &key.subject); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan open alert: %w", err)
+		}
+		if ruleID != nil {
+			key.ruleID = *ruleID
+			if _, ok := firings[key]; ok {
+				continue
+			}
+		}
+		stale = append(stale, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, a := range stale {
+		resolved, err := scanAlert(s.db.QueryRow(ctx, `
+		UPDATE device_alerts SET resolved_at = NOW()
+		WHERE id = $1 AND resolved_at IS NULL
+		RETURNING id, rule_id, device_id, kind, subject, message, triggered_at, resolved_at
+		`, a.id))
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to resolve alert %s: %w", a.id, err)
+		}
+		s.events.Publish(a.userID, events.TypeAlertResolved, resolved)
+	}
+	return nil
+}
+
+func alertTitle(kind, deviceName string) string {
+	switch kind {
+	case alert.KindOffline:
+		return deviceName + " is offline"
+	case alert.KindDiskUsage:
+		return "A disk on " + deviceName + " is almost full"
+	case alert.KindSMARTWarning:
+		return "A disk on " + deviceName + " may be failing"
+	case alert.KindUpdateFailed:
+		return "An update failed on " + deviceName
+	}
+	return "Alert on " + deviceName
+}
+
+func scanAlertRule(row pgx.Row) (*alert.Rule, error) {
+	var r alert.Rule
+	err := row.Scan(&r.ID, &r.DeviceID, &r.Kind, &r.Threshold, &r.CooldownMinutes,
+		&r.Notify, &r.Email, &r.Enabled, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func scanAlert(row pgx.Row) (*alert.Alert, error) {
+	var a alert.Alert
+	err := row.Scan(&a.ID, &a.RuleID, &a.DeviceID, &a.Kind, &a.Subject, &a.Message, &a.TriggeredAt, &a.ResolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
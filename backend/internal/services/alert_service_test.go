@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/types/alert"
+	"github.com/strct-org/portal/backend/internal/types/device"
+)
+
+func TestAlertTitle(t *testing.T) {
+	tests := []struct {
+		kind string
+		want string
+	}{
+		{alert.KindOffline, "NAS is offline"},
+		{alert.KindDiskUsage, "A disk on NAS is almost full"},
+		{alert.KindSMARTWarning, "A disk on NAS may be failing"},
+		{alert.KindUpdateFailed, "An update failed on NAS"},
+		{"cpu", "Alert on NAS"},
+	}
+
+	for _, tt := range tests {
+		if got := alertTitle(tt.kind, "NAS"); got != tt.want {
+			t.Errorf("alertTitle(%q) = %q, want %q", tt.kind, got, tt.want)
+		}
+	}
+}
+
+func newTestAlertService(db *pgxpool.Pool) *AlertService {
+	broker := events.New()
+	return NewAlertService(db, NewNotificationService(db, broker), NewEmailService(db, nil), broker)
+}
+
+// ruleRequest is a validated request, as the handler passes it on.
+func ruleRequest(kind string, threshold, cooldown int, deviceID *string) *alert.RuleRequest {
+	on := true
+	return &alert.RuleRequest{DeviceID: deviceID, Kind: kind, Threshold: threshold, CooldownMinutes: &cooldown, Notify: &on, Email: &on, Enabled: &on}
+}
+
+// Rules and alert history belong to the user, and rules only cover their
+// own devices.
+func TestAlertRuleOwnership(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := newTestAlertService(db)
+	alice := dbtest.User(t, db, "alice")
+	bob := dbtest.User(t, db, "bob")
+	dbtest.Device(t, db, "dev-alice", alice)
+	dbtest.Device(t, db, "dev-bob", bob)
+	alicesDevice, bobsDevice := "dev-alice", "dev-bob"
+
+	if _, err := s.CreateRule(ctx, "clerk_alice", ruleRequest(alert.KindUpdateFailed, 0, 60, &bobsDevice)); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("rule for someone else's device: %v, want ErrDeviceNotFound", err)
+	}
+	rule, err := s.CreateRule(ctx, "clerk_alice", ruleRequest(alert.KindUpdateFailed, 0, 60, &alicesDevice))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.UpdateRule(ctx, "clerk_bob", rule.ID, ruleRequest(alert.KindUpdateFailed, 0, 60, nil)); !errors.Is(err, ErrAlertRuleNotFound) {
+		t.Errorf("updating someone else's rule: %v, want ErrAlertRuleNotFound", err)
+	}
+	if _, err := s.UpdateRule(ctx, "clerk_alice", rule.ID, ruleRequest(alert.KindUpdateFailed, 0, 60, &bobsDevice)); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("moving a rule to someone else's device: %v, want ErrDeviceNotFound", err)
+	}
+	if _, err := s.ListDeviceAlerts(ctx, "clerk_bob", alicesDevice); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("someone else's alert history: %v, want ErrDeviceNotFound", err)
+	}
+	if err := s.DeleteRule(ctx, "clerk_bob", rule.ID); !errors.Is(err, ErrAlertRuleNotFound) {
+		t.Errorf("deleting someone else's rule: %v, want ErrAlertRuleNotFound", err)
+	}
+	if rules, err := s.ListRules(ctx, "clerk_bob"); err != nil || len(rules) != 0 {
+		t.Errorf("bob's rules = %d, %v; want none", len(rules), err)
+	}
+}
+
+// An alert opens once while its condition holds, resolves when it stops, and
+// doesn't open again within the cooldown.
+func TestEvaluateDiskUsage(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := newTestAlertService(db)
+	devices := NewDeviceService(db, NewSubscriptionService(db), events.New(), nil)
+	alice := dbtest.User(t, db, "alice")
+	dbtest.Device(t, db, "dev-1", alice)
+	dbtest.Exec(t, db, `UPDATE devices SET is_online = TRUE WHERE id = 'dev-1'`)
+
+	rule, err := s.CreateRule(ctx, "clerk_alice", ruleRequest(alert.KindDiskUsage, 90, 60, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := func(used int64) {
+		t.Helper()
+		disks := []device.Disk{{Name: "sda", TotalBytes: 100, UsedBytes: used, SMARTStatus: device.SMARTOK}}
+		if err := devices.ReportTelemetry(ctx, "dev-1", &device.TelemetryReport{Disks: disks}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Evaluate(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alerts := func() (open, total int) {
+		t.Helper()
+		history, err := s.ListDeviceAlerts(ctx, "clerk_alice", "dev-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range history {
+			if a.ResolvedAt == nil {
+				open++
+			}
+		}
+		return open, len(history)
+	}
+
+	steps := []struct {
+		name      string
+		used      int64
+		wantOpen  int
+		wantTotal int
+	}{
+		{"full", 95, 1, 1},
+		{"still full", 97, 1, 1},
+		{"freed up", 50, 0, 1},
+		{"full within the cooldown", 95, 0, 1},
+	}
+	for _, step := range steps {
+		report(step.used)
+		if open, total := alerts(); open != step.wantOpen || total != step.wantTotal {
+			t.Errorf("%s: %d open of %d, want %d of %d", step.name, open, total, step.wantOpen, step.wantTotal)
+		}
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM notifications WHERE user_id = $1`, alice); n != 1 {
+		t.Errorf("%d notifications, want 1", n)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM email_outbox WHERE user_id = $1`, alice); n != 1 {
+		t.Errorf("%d emails, want 1", n)
+	}
+
+	// Without a cooldown it opens again, and deleting the rule resolves it
+	if _, err := s.UpdateRule(ctx, "clerk_alice", rule.ID, ruleRequest(alert.KindDiskUsage, 90, 0, nil)); err != nil {
+		t.Fatal(err)
+	}
+	report(95)
+	if open, total := alerts(); open != 1 || total != 2 {
+		t.Errorf("without a cooldown: %d open of %d, want 1 of 2", open, total)
+	}
+	if err := s.DeleteRule(ctx, "clerk_alice", rule.ID); err != nil {
+		t.Fatal(err)
+	}
+	if open, total := alerts(); open != 0 || total != 2 {
+		t.Errorf("after deleting the rule: %d open of %d, want 0 of 2", open, total)
+	}
+
+	// A disk left out of a report is gone
+	if err := devices.ReportTelemetry(ctx, "dev-1", &device.TelemetryReport{}); err != nil {
+		t.Fatal(err)
+	}
+	if disks, err := devices.ListDisks(ctx, "clerk_alice", "dev-1"); err != nil || len(disks) != 0 {
+		t.Errorf("disks after an empty report = %d, %v; want none", len(disks), err)
+	}
+}
@@ -0,0 +1,395 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/types/command"
+)
+
+const (
+	commandColumns = `id, device_id, type, params, status, result, error, created_at, delivered_at, acked_at, completed_at, expires_at`
+	// A delivered command that isn't acknowledged within this is handed out
+	// again, in case the poll response never reached the device
+	commandRedeliverAfter = 30 * time.Second
+	// Queued commands wake waiting polls on every instance through
+	// commandChannel. Polls still re-check the table this often, for
+	// notifications lost while an instance's listener was reconnecting
+	commandRecheckInterval = 5 * time.Minute
+	// commandChannel is the NOTIFY channel Enqueue announces commands on,
+	// with the device ID as payload
+	commandChannel     = "device_commands"
+	commandListenRetry = 5 * time.Second
+	commandBatchSize   = 10
+	commandRetention   = 30 * 24 * time.Hour
+)
+
+// CommandService queues commands from owners to their devices. Devices pick
+// them up by long-polling, acknowledge them and report the outcome.
+type CommandService struct {
+	db *pgxpool.Pool
+
+	mu      sync.Mutex
+	waiters map[string][]chan struct{}
+}
+
+func NewCommandService(db *pgxpool.Pool) *CommandService {
+	return &CommandService{
+		db:      db,
+		waiters: make(map[string][]chan struct{}),
+	}
+}
+
+// Enqueue queues a command for a device the user owns.
+func (s *CommandService) Enqueue(ctx context.Context, clerkID, deviceID string, req *command.CreateCommandRequest) (*command.Command, error) {
+	cmd, err := scanCommand(s.db.QueryRow(ctx, `
+	INSERT INTO device_commands (id, device_id, issued_by, type, params, expires_at)
+	SELECT $1, d.id, d.owner_id, $4, $5, NOW() + make_interval(secs => $6)
+	FROM devices d
+	WHERE d.id = $2 AND d.owner_id = (SELECT id FROM users WHERE clerk_id = $3)
+	RETURNING `+commandColumns,
+		uuid.New(), deviceID, clerkID, req.Type, req.Params, req.TimeoutSeconds))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue command: %w", err)
+	}
+
+	// Polls here wake at once, the notification reaches other instances
+	s.wake(deviceID)
+	if _, err := s.db.Exec(ctx, `SELECT pg_notify($1, $2)`, commandChannel, deviceID); err != nil {
+		log.Printf("Error announcing command %s for device %s: %v", cmd.ID, deviceID, err)
+	}
+	return cmd, nil
+}
+
+// GetCommand returns a command sent to one of the user's devices.
+func (s *CommandService) GetCommand(ctx context.Context, clerkID, deviceID string, id uuid.UUID) (*command.Command, error) {
+	cmd, err := scanCommand(s.db.QueryRow(ctx, `
+	SELECT `+commandColumns+` FROM device_commands
+	WHERE id = $1 AND device_id = $2
+	AND device_id IN (SELECT id FROM devices WHERE owner_id = (SELECT id FROM users WHERE clerk_id = $3))
+	`, id, deviceID, clerkID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCommandNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get command: %w", err)
+	}
+	return cmd, nil
+}
+
+// ListCommands returns the device's recent commands, newest first.
+func (s *CommandService) ListCommands(ctx context.Context, clerkID, deviceID string) ([]*command.Command, error) {
+	var owned bool
+	if err := s.db.QueryRow(ctx, `
+	SELECT EXISTS (SELECT 1 FROM devices WHERE id = $1 AND owner_id = (SELECT id FROM users WHERE clerk_id = $2))
+	`, deviceID, clerkID).Scan(&owned); err != nil {
+		return nil, fmt.Errorf("failed to look up device: %w", err)
+	}
+	if !owned {
+		return nil, ErrDeviceNotFound
+	}
+
+	rows, err := s.db.Query(ctx, `
+	SELECT `+commandColumns+` FROM device_commands
+	WHERE device_id = $1
+	ORDER BY created_at DESC
+	LIMIT 50
+	`, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query commands: %w", err)
+	}
+	return collectCommands(rows)
+}
+
+// Poll hands out the device's pending commands, waiting up to wait for one to
+// be queued. It returns an empty slice when none arrived. While waiting it
+// only queries the database when a command is queued for the device.
+func (s *CommandService) Poll(ctx context.Context, deviceID string, wait time.Duration) ([]*command.Command, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		// Subscribe before claiming so a command queued in between still
+		// wakes this poll
+		woken, unsubscribe := s.subscribe(deviceID)
+
+		cmds, err := s.claim(ctx, deviceID)
+		if err != nil || len(cmds) > 0 {
+			unsubscribe()
+			return cmds, err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			unsubscribe()
+			return cmds, nil
+		}
+
+		timer := time.NewTimer(min(remaining, commandRecheckInterval))
+		select {
+		case <-ctx.Done():
+		case <-woken:
+		case <-timer.C:
+		}
+		timer.Stop()
+		unsubscribe()
+
+		if ctx.Err() != nil {
+			return []*command.Command{}, nil
+		}
+	}
+}
+
+// claim marks up to commandBatchSize pending commands delivered and returns
+// them oldest first.
+func (s *CommandService) claim(ctx context.Context, deviceID string) ([]*command.Command, error) {
+	rows, err := s.db.Query(ctx, `
+	UPDATE device_commands
+	SET status = 'delivered', delivered_at = NOW(), attempts = attempts + 1
+	WHERE id IN (
+		SELECT id FROM device_commands
+		WHERE device_id = $1 AND expires_at > NOW()
+		AND (status = 'queued' OR (status = 'delivered' AND delivered_at < NOW() - make_interval(secs => $2)))
+		ORDER BY created_at
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING `+commandColumns,
+		deviceID, commandRedeliverAfter.Seconds(), commandBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim commands: %w", err)
+	}
+
+	cmds, err := collectCommands(rows)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(cmds, func(a, b *command.Command) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return cmds, nil
+}
+
+// Acknowledge records that the device received the command and started on
+// it. Repeating an acknowledgement is harmless.
+func (s *CommandService) Acknowledge(ctx context.Context, deviceID string, id uuid.UUID) error {
+	result, err := s.db.Exec(ctx, `
+	UPDATE device_commands SET status = 'acknowledged', acked_at = NOW()
+	WHERE id = $1 AND device_id = $2 AND status IN ('queued', 'delivered') AND expires_at > NOW()
+	`, id, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge command: %w", err)
+	}
+	if result.RowsAffected() > 0 {
+		return nil
+	}
+
+	status, err := s.commandStatus(ctx, deviceID, id)
+	if err != nil {
+		return err
+	}
+	if status == command.StatusAcknowledged {
+		return nil
+	}
+	return ErrCommandFinished
+}
+
+// Complete records the outcome the device reported.
+func (s *CommandService) Complete(ctx context.Context, deviceID string, id uuid.UUID, report *command.ResultReport) error {
+	result, err := s.db.Exec(ctx, `
+	UPDATE device_commands SET status = $3, result = $4, error = $5, completed_at = NOW()
+	WHERE id = $1 AND device_id = $2 AND status IN ('queued', 'delivered', 'acknowledged')
+	`, id, deviceID, report.Status, report.Result, report.Error)
+	if err != nil {
+		return fmt.Errorf("failed to complete command: %w", err)
+	}
+	if result.RowsAffected() > 0 {
+		return nil
+	}
+
+	if _, err := s.commandStatus(ctx, deviceID, id); err != nil {
+		return err
+	}
+	return ErrCommandFinished
+}
+
+func (s *CommandService) commandStatus(ctx context.Context, deviceID string, id uuid.UUID) (string, error) {
+	var status string
+	err := s.db.QueryRow(ctx, `
+	SELECT status FROM device_commands WHERE id = $1 AND device_id = $2
+	`, id, deviceID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrCommandNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up command: %w", err)
+	}
+	return status, nil
+}
+
+// Run times out unfinished commands past their deadline and purges old ones,
+// until ctx is cancelled.
+func (s *CommandService) Run(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.sweep(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Command sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+// Listen wakes polls waiting on this instance when a command for their
+// device is queued through any instance, until ctx is cancelled. LISTEN needs
+// a session of its own, so it connects directly rather than through the pool;
+// DATABASE_URL must not point at a transaction-mode pooler.
+func (s *CommandService) Listen(ctx context.Context) {
+	for {
+		err := s.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Command listener failed, reconnecting: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(commandListenRetry):
+		}
+	}
+}
+
+func (s *CommandService) listen(ctx context.Context) error {
+	conn, err := pgx.ConnectConfig(ctx, s.db.Config().ConnConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, `LISTEN `+commandChannel); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	// Commands may have been queued while nothing was listening
+	s.wakeAll()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		s.wake(n.Payload)
+	}
+}
+
+func (s *CommandService) sweep(ctx context.Context) error {
+	if _, err := s.db.Exec(ctx, `
+	UPDATE device_commands SET status = 'timed_out', completed_at = NOW()
+	WHERE status IN ('queued', 'delivered', 'acknowledged') AND expires_at <= NOW()
+	`); err != nil {
+		return fmt.Errorf("failed to time out commands: %w", err)
+	}
+
+	if _, err := s.db.Exec(ctx, `
+	DELETE FROM device_commands
+	WHERE completed_at < NOW() - make_interval(secs => $1)
+	`, commandRetention.Seconds()); err != nil {
+		return fmt.Errorf("failed to purge commands: %w", err)
+	}
+	return nil
+}
+
+func (s *CommandService) subscribe(deviceID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	s.mu.Lock()
+	s.waiters[deviceID] = append(s.waiters[deviceID], ch)
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		waiters := slices.DeleteFunc(s.waiters[deviceID], func(c chan struct{}) bool { return c == ch })
+		if len(waiters) == 0 {
+			delete(s.waiters, deviceID)
+		} else {
+			s.waiters[deviceID] = waiters
+		}
+	}
+}
+
+// wake tells polls waiting on this instance that the device may have a
+// command.
+func (s *CommandService) wake(deviceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range s.waiters[deviceID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *CommandService) wakeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, waiters := range s.waiters {
+		for _, ch := range waiters {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func collectCommands(rows pgx.Rows) ([]*command.Command, error) {
+	defer rows.Close()
+
+	cmds := []*command.Command{}
+	for rows.Next() {
+		cmd, err := scanCommand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan command: %w", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, rows.Err()
+}
+
+func scanCommand(row pgx.Row) (*command.Command, error) {
+	cmd := &command.Command{}
+	err := row.Scan(
+		&cmd.ID,
+		&cmd.DeviceID,
+		&cmd.Type,
+		&cmd.Params,
+		&cmd.Status,
+		&cmd.Result,
+		&cmd.Error,
+		&cmd.CreatedAt,
+		&cmd.DeliveredAt,
+		&cmd.AckedAt,
+		&cmd.CompletedAt,
+		&cmd.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
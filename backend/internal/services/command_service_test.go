@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/types/command"
+)
+
+func TestCommandWake(t *testing.T) {
+	s := NewCommandService(nil)
+
+	woken, unsubscribe := s.subscribe("dev-1")
+	other, unsubscribeOther := s.subscribe("dev-2")
+	defer unsubscribeOther()
+
+	s.wake("dev-1")
+	// A second wake before the waiter runs mustn't block Enqueue
+	s.wake("dev-1")
+
+	select {
+	case <-woken:
+	default:
+		t.Fatal("waiter for dev-1 wasn't woken")
+	}
+	select {
+	case <-other:
+		t.Fatal("waiter for dev-2 was woken by a command for dev-1")
+	default:
+	}
+
+	unsubscribe()
+	if _, ok := s.waiters["dev-1"]; ok {
+		t.Fatal("unsubscribed waiter is still registered")
+	}
+	s.wake("dev-1")
+	select {
+	case <-woken:
+		t.Fatal("unsubscribed waiter was woken")
+	default:
+	}
+}
+
+var rebootRequest = &command.CreateCommandRequest{Type: command.TypeReboot, Params: json.RawMessage(`{}`), TimeoutSeconds: 300}
+
+// Only the owner queues and sees commands, and a waiting poll picks a new
+// one up at once.
+func TestEnqueueAndPoll(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := NewCommandService(db)
+	alice := dbtest.User(t, db, "alice")
+	dbtest.User(t, db, "bob")
+	dbtest.Device(t, db, "dev-1", alice)
+
+	if _, err := s.Enqueue(ctx, "clerk_bob", "dev-1", rebootRequest); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("queueing for someone else's device: %v, want ErrDeviceNotFound", err)
+	}
+
+	polled := make(chan []*command.Command, 1)
+	go func() {
+		cmds, err := s.Poll(ctx, "dev-1", 10*time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		polled <- cmds
+	}()
+	// Let the poll find the queue empty and start waiting
+	time.Sleep(100 * time.Millisecond)
+
+	cmd, err := s.Enqueue(ctx, "clerk_alice", "dev-1", rebootRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cmds := <-polled:
+		if len(cmds) != 1 || cmds[0].ID != cmd.ID || cmds[0].Status != command.StatusDelivered {
+			t.Fatalf("poll returned %+v, want the command delivered", cmds)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the waiting poll wasn't woken")
+	}
+
+	if _, err := s.GetCommand(ctx, "clerk_bob", "dev-1", cmd.ID); !errors.Is(err, ErrCommandNotFound) {
+		t.Errorf("another user's command: %v, want ErrCommandNotFound", err)
+	}
+	if _, err := s.ListCommands(ctx, "clerk_bob", "dev-1"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("another user's device: %v, want ErrDeviceNotFound", err)
+	}
+
+	// A delivery the device never acknowledged is handed out again, but only
+	// once it's had time to arrive
+	if cmds, err := s.Poll(ctx, "dev-1", 0); err != nil || len(cmds) != 0 {
+		t.Fatalf("poll right after delivery = %d commands, %v; want none", len(cmds), err)
+	}
+	dbtest.Exec(t, db, `UPDATE device_commands SET delivered_at = NOW() - INTERVAL '1 minute' WHERE id = $1`, cmd.ID)
+	if cmds, err := s.Poll(ctx, "dev-1", 0); err != nil || len(cmds) != 1 {
+		t.Fatalf("poll after a lost delivery = %d commands, %v; want it again", len(cmds), err)
+	}
+}
+
+// Acknowledging is repeatable, results are final, and commands past their
+// deadline time out.
+// A command queued through one instance wakes the poll waiting on another.
+func TestPollWokenAcrossInstances(t *testing.T) {
+	db := dbtest.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	alice := dbtest.User(t, db, "alice")
+	dbtest.Device(t, db, "dev-1", alice)
+
+	api, socket := NewCommandService(db), NewCommandService(db)
+	listening := make(chan struct{})
+	go func() {
+		socket.Listen(ctx)
+		close(listening)
+	}()
+	defer func() {
+		cancel()
+		<-listening
+	}()
+
+	polled := make(chan []*command.Command, 1)
+	go func() {
+		cmds, err := socket.Poll(ctx, "dev-1", time.Minute)
+		if err != nil {
+			t.Error(err)
+		}
+		polled <- cmds
+	}()
+	// Let the listener connect and the poll start waiting
+	time.Sleep(500 * time.Millisecond)
+
+	cmd, err := api.Enqueue(ctx, "clerk_alice", "dev-1", rebootRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cmds := <-polled:
+		if len(cmds) != 1 || cmds[0].ID != cmd.ID {
+			t.Fatalf("poll returned %+v, want the command", cmds)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the poll on the other instance wasn't woken")
+	}
+}
+
+func TestCommandLifecycle(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := NewCommandService(db)
+	alice := dbtest.User(t, db, "alice")
+	dbtest.Device(t, db, "dev-1", alice)
+	dbtest.Device(t, db, "dev-2", alice)
+
+	cmd, err := s.Enqueue(ctx, "clerk_alice", "dev-1", rebootRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := s.Enqueue(ctx, "clerk_alice", "dev-1", rebootRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	succeeded := &command.ResultReport{Status: command.StatusSucceeded, Result: json.RawMessage(`{"ok":true}`)}
+	steps := []struct {
+		name     string
+		deviceID string
+		do       func(deviceID string) error
+		wantErr  error
+	}{
+		{"ack from another device", "dev-2", func(d string) error { return s.Acknowledge(ctx, d, cmd.ID) }, ErrCommandNotFound},
+		{"ack", "dev-1", func(d string) error { return s.Acknowledge(ctx, d, cmd.ID) }, nil},
+		{"ack again", "dev-1", func(d string) error { return s.Acknowledge(ctx, d, cmd.ID) }, nil},
+		{"result", "dev-1", func(d string) error { return s.Complete(ctx, d, cmd.ID, succeeded) }, nil},
+		{"result again", "dev-1", func(d string) error { return s.Complete(ctx, d, cmd.ID, succeeded) }, ErrCommandFinished},
+		{"ack after the result", "dev-1", func(d string) error { return s.Acknowledge(ctx, d, cmd.ID) }, ErrCommandFinished},
+	}
+	for _, step := range steps {
+		if err := step.do(step.deviceID); !errors.Is(err, step.wantErr) {
+			t.Errorf("%s: %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+
+	dbtest.Exec(t, db, `UPDATE device_commands SET expires_at = NOW() - INTERVAL '1 second' WHERE id = $1`, stale.ID)
+	if err := s.sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[*command.Command]string{cmd: command.StatusSucceeded, stale: command.StatusTimedOut} {
+		got, err := s.GetCommand(ctx, "clerk_alice", "dev-1", id.ID)
+		if err != nil || got.Status != want {
+			t.Errorf("command %s = %+v, %v; want %s", id.ID, got, err, want)
+		}
+	}
+	if err := s.Complete(ctx, "dev-1", stale.ID, succeeded); !errors.Is(err, ErrCommandFinished) {
+		t.Errorf("result after timing out: %v, want ErrCommandFinished", err)
+	}
+}
@@ -0,0 +1,516 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/serial"
+	"github.com/strct-org/portal/backend/internal/types/device"
+)
+
+const (
+	pairingCodeTTL = 10 * time.Minute
+	// No 0/O or 1/I so codes read off a small screen survive retyping
+	pairingAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	deviceColumns   = `id, owner_id, friendly_name, is_online, last_seen, local_ip, version, created_at, updated_at`
+	// Devices that haven't been heard from for this long are shown offline.
+	// Connected devices answer a ping every 25s; polling ones call in every 30s.
+	deviceOfflineAfter = 90 * time.Second
+)
+
+type DeviceService struct {
+	db            *pgxpool.Pool
+	subscriptions *SubscriptionService
+	events        *events.Broker
+	serials       *serial.Verifier
+}
+
+// NewDeviceService trusts the serials devices report only when serials
+// verifies their proof. A nil serials ignores them.
+func NewDeviceService(db *pgxpool.Pool, subscriptions *SubscriptionService, broker *events.Broker, serials *serial.Verifier) *DeviceService {
+	return &DeviceService{
+		db:            db,
+		subscriptions: subscriptions,
+		events:        broker,
+		serials:       serials,
+	}
+}
+
+// RequestPairing registers an unpaired device and issues a short code for its
+// owner to enter. Earlier codes for the device stop working. The device's
+// serial is only recorded, and the device offered to the unit's buyer, when
+// it comes with a valid factory proof.
+func (s *DeviceService) RequestPairing(ctx context.Context, req *device.PairingRequest) (*device.PairingResponse, error) {
+	unitSerial := strings.TrimSpace(req.Serial)
+	if unitSerial != "" && (s.serials == nil || !s.serials.Verify(unitSerial, req.SerialProof)) {
+		if s.serials != nil {
+			log.Printf("WARNING: Device %s reported serial %q without a valid proof, ignoring it", req.DeviceID, unitSerial)
+		}
+		unitSerial = ""
+	}
+
+	code, err := pairingCode()
+	if err != nil {
+		return nil, err
+	}
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var ownerID *uuid.UUID
+	err = tx.QueryRow(ctx, `
+	INSERT INTO devices (id, local_ip, version, serial, product, platform)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (id) DO UPDATE SET
+		local_ip = EXCLUDED.local_ip,
+		version = EXCLUDED.version,
+		serial = COALESCE(NULLIF(EXCLUDED.serial, ''), devices.serial),
+		product = COALESCE(NULLIF(EXCLUDED.product, ''), devices.product),
+		platform = COALESCE(NULLIF(EXCLUDED.platform, ''), devices.platform),
+		updated_at = NOW()
+	RETURNING owner_id
+	`, req.DeviceID, req.LocalIP, req.Version, unitSerial, req.Product, req.Platform).Scan(&ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register device: %w", err)
+	}
+	if ownerID != nil {
+		return nil, ErrDeviceAlreadyPaired
+	}
+
+	if _, err := tx.Exec(ctx, `
+	UPDATE device_pairings SET status = 'expired'
+	WHERE device_id = $1 AND status = 'pending'
+	`, req.DeviceID); err != nil {
+		return nil, fmt.Errorf("failed to expire old pairing codes: %w", err)
+	}
+
+	resp := &device.PairingResponse{
+		PairingID:   uuid.New(),
+		Code:        code,
+		DeviceToken: token,
+		ExpiresAt:   time.Now().Add(pairingCodeTTL),
+	}
+	if _, err := tx.Exec(ctx, `
+	INSERT INTO device_pairings (id, device_id, code_hash, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`, resp.PairingID, req.DeviceID, hashSecret(normalizePairingCode(code)), hashSecret(token), resp.ExpiresAt); err != nil {
+		return nil, fmt.Errorf("failed to create pairing: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// PairingStatus lets the device poll until its code is claimed. token is the
+// device token from RequestPairing.
+func (s *DeviceService) PairingStatus(ctx context.Context, id uuid.UUID, token string) (*device.PairingStatus, error) {
+	var (
+		tokenHash string
+		expiresAt time.Time
+		status    = &device.PairingStatus{}
+	)
+	err := s.db.QueryRow(ctx, `
+	SELECT device_id, status, token_hash, expires_at FROM device_pairings WHERE id = $1
+	`, id).Scan(&status.DeviceID, &status.Status, &tokenHash, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPairingNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pairing: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(token)), []byte(tokenHash)) != 1 {
+		return nil, ErrPairingNotFound
+	}
+	if status.Status == device.PairingPending && time.Now().After(expiresAt) {
+		status.Status = device.PairingExpired
+	}
+	return status, nil
+}
+
+// ClaimDevice pairs the device showing code to the user, subject to the
+// device limit of their plan. Without a code, a device whose serial is an
+// unpaired unit of one of the user's orders can be claimed by its ID.
+func (s *DeviceService) ClaimDevice(ctx context.Context, clerkID string, req *device.ClaimRequest) (*device.Device, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID uuid.UUID
+	err = tx.QueryRow(ctx, `SELECT id FROM users WHERE clerk_id = $1`, clerkID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if err := lockUser(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	var pairingID uuid.UUID
+	var deviceID, tokenHash string
+	if req.Code == "" && req.DeviceID != "" {
+		err = tx.QueryRow(ctx, `
+		SELECT p.id, p.device_id, p.token_hash FROM device_pairings p
+		WHERE p.device_id = $2 AND p.status = 'pending' AND p.expires_at > NOW()
+		AND EXISTS (SELECT 1 FROM (`+pairableQuery+`) pairable WHERE pairable.device_id = $2)
+		FOR UPDATE
+		`, clerkID, req.DeviceID).Scan(&pairingID, &deviceID, &tokenHash)
+	} else {
+		err = tx.QueryRow(ctx, `
+		SELECT id, device_id, token_hash FROM device_pairings
+		WHERE code_hash = $1 AND status = 'pending' AND expires_at > NOW()
+		FOR UPDATE
+		`, hashSecret(normalizePairingCode(req.Code))).Scan(&pairingID, &deviceID, &tokenHash)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidPairingCode
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pairing: %w", err)
+	}
+
+	if err := s.subscriptions.CheckDeviceLimit(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.FriendlyName)
+	if name == "" {
+		name = "BeeStation"
+	}
+
+	d, err := scanDevice(tx.QueryRow(ctx, `
+	UPDATE devices
+	SET owner_id = $2, friendly_name = $3, token_hash = $4, updated_at = NOW()
+	WHERE id = $1 AND owner_id IS NULL
+	RETURNING `+deviceColumns, deviceID, userID, name, tokenHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceAlreadyPaired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to pair device: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+	UPDATE device_pairings SET status = 'claimed', claimed_by = $2, claimed_at = NOW()
+	WHERE id = $1
+	`, pairingID, userID); err != nil {
+		return nil, fmt.Errorf("failed to mark pairing claimed: %w", err)
+	}
+
+	// Link the unit from the user's order, however the device was claimed
+	if _, err := tx.Exec(ctx, `
+	UPDATE order_units SET device_id = $1, paired_at = NOW()
+	WHERE serial = (SELECT serial FROM devices WHERE id = $1) AND serial <> ''
+	AND device_id IS NULL
+	AND order_id IN (SELECT id FROM orders WHERE user_id = $2)
+	`, deviceID, userID); err != nil {
+		return nil, fmt.Errorf("failed to link order unit: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// AuthenticateDevice returns the ID of the paired device token belongs to,
+// and records that the device was seen.
+func (s *DeviceService) AuthenticateDevice(ctx context.Context, token string) (string, error) {
+	var (
+		id         string
+		ownerID    uuid.UUID
+		wasOffline bool
+	)
+	err := s.db.QueryRow(ctx, `
+	UPDATE devices d SET is_online = TRUE, last_seen = NOW()
+	FROM devices prev
+	WHERE prev.id = d.id AND d.token_hash = $1 AND d.owner_id IS NOT NULL
+	RETURNING d.id, d.owner_id, NOT prev.is_online
+	`, hashSecret(token)).Scan(&id, &ownerID, &wasOffline)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrDeviceNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to authenticate device: %w", err)
+	}
+
+	if wasOffline {
+		s.publishStatus(ownerID, id, true)
+	}
+	return id, nil
+}
+
+// Touch records that the device is online and was just heard from.
+func (s *DeviceService) Touch(ctx context.Context, id string) error {
+	var (
+		ownerID    uuid.UUID
+		wasOffline bool
+	)
+	err := s.db.QueryRow(ctx, `
+	UPDATE devices d SET is_online = TRUE, last_seen = NOW()
+	FROM devices prev
+	WHERE prev.id = d.id AND d.id = $1 AND d.owner_id IS NOT NULL
+	RETURNING d.owner_id, NOT prev.is_online
+	`, id).Scan(&ownerID, &wasOffline)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to touch device: %w", err)
+	}
+
+	if wasOffline {
+		s.publishStatus(ownerID, id, true)
+	}
+	return nil
+}
+
+// MarkOffline records that the device disconnected.
+func (s *DeviceService) MarkOffline(ctx context.Context, id string) error {
+	var ownerID uuid.UUID
+	err := s.db.QueryRow(ctx, `
+	UPDATE devices SET is_online = FALSE
+	WHERE id = $1 AND is_online AND owner_id IS NOT NULL
+	RETURNING owner_id
+	`, id).Scan(&ownerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mark device offline: %w", err)
+	}
+
+	s.publishStatus(ownerID, id, false)
+	return nil
+}
+
+// Run marks devices offline once they stop calling in, until ctx is
+// cancelled. It covers devices that vanish without closing their connection
+// and those connected to an instance that died.
+func (s *DeviceService) Run(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.sweepPresence(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Device presence sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *DeviceService) sweepPresence(ctx context.Context) error {
+	rows, err := s.db.Query(ctx, `
+	UPDATE devices SET is_online = FALSE
+	WHERE is_online AND last_seen < NOW() - make_interval(secs => $1)
+	RETURNING id, owner_id
+	`, deviceOfflineAfter.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to mark stale devices offline: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id      string
+			ownerID *uuid.UUID
+		)
+		if err := rows.Scan(&id, &ownerID); err != nil {
+			return fmt.Errorf("failed to scan device: %w", err)
+		}
+		if ownerID != nil {
+			s.publishStatus(*ownerID, id, false)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *DeviceService) publishStatus(ownerID uuid.UUID, deviceID string, online bool) {
+	typ := events.TypeDeviceOffline
+	if online {
+		typ = events.TypeDeviceOnline
+	}
+	s.events.Publish(ownerID, typ, events.DeviceStatus{DeviceID: deviceID, Online: online, At: time.Now()})
+}
+
+func (s *DeviceService) ListDevices(ctx context.Context, clerkID string) ([]*device.Device, error) {
+	rows, err := s.db.Query(ctx, `
+	SELECT `+deviceColumns+` FROM devices
+	WHERE owner_id = (SELECT id FROM users WHERE clerk_id = $1)
+	ORDER BY created_at
+	`, clerkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []*device.Device{}
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// GetOwnedDevice returns the device if clerkID owns it. Devices owned by
+// someone else are reported as not found.
+func (s *DeviceService) GetOwnedDevice(ctx context.Context, clerkID, id string) (*device.Device, error) {
+	d, err := scanDevice(s.db.QueryRow(ctx, `
+	SELECT `+deviceColumns+` FROM devices
+	WHERE id = $1 AND owner_id = (SELECT id FROM users WHERE clerk_id = $2)
+	`, id, clerkID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	return d, nil
+}
+
+// UnpairDevice removes the device with its shares and file metadata. The
+// device has to request a new pairing code to be added again.
+func (s *DeviceService) UnpairDevice(ctx context.Context, clerkID, id string) error {
+	result, err := s.db.Exec(ctx, `
+	DELETE FROM devices
+	WHERE id = $1 AND owner_id = (SELECT id FROM users WHERE clerk_id = $2)
+	`, id, clerkID)
+	if err != nil {
+		return fmt.Errorf("failed to unpair device: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// ReportTelemetry replaces the device's disks with the reported ones. report
+// must already be validated.
+func (s *DeviceService) ReportTelemetry(ctx context.Context, deviceID string, report *device.TelemetryReport) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	names := make([]string, 0, len(report.Disks))
+	for _, d := range report.Disks {
+		names = append(names, d.Name)
+	}
+	if _, err := tx.Exec(ctx, `
+	DELETE FROM device_disks WHERE device_id = $1 AND NOT (name = ANY($2))
+	`, deviceID, names); err != nil {
+		return fmt.Errorf("failed to remove disks: %w", err)
+	}
+
+	for _, d := range report.Disks {
+		if _, err := tx.Exec(ctx, `
+		INSERT INTO device_disks (device_id, name, mountpoint, total_bytes, used_bytes, smart_status, smart_message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (device_id, name) DO UPDATE SET
+			mountpoint = EXCLUDED.mountpoint,
+			total_bytes = EXCLUDED.total_bytes,
+			used_bytes = EXCLUDED.used_bytes,
+			smart_status = EXCLUDED.smart_status,
+			smart_message = EXCLUDED.smart_message,
+			updated_at = NOW()
+		`, deviceID, d.Name, d.Mountpoint, d.TotalBytes, d.UsedBytes, d.SMARTStatus, d.SMARTMessage); err != nil {
+			return fmt.Errorf("failed to record disk %s: %w", d.Name, err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListDisks returns the disks last reported by a device the user owns.
+func (s *DeviceService) ListDisks(ctx context.Context, clerkID, deviceID string) ([]*device.Disk, error) {
+	if _, err := s.GetOwnedDevice(ctx, clerkID, deviceID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, `
+	SELECT name, mountpoint, total_bytes, used_bytes, smart_status, smart_message, updated_at
+	FROM device_disks WHERE device_id = $1
+	ORDER BY name
+	`, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query disks: %w", err)
+	}
+	defer rows.Close()
+
+	disks := []*device.Disk{}
+	for rows.Next() {
+		d := &device.Disk{}
+		if err := rows.Scan(&d.Name, &d.Mountpoint, &d.TotalBytes, &d.UsedBytes, &d.SMARTStatus, &d.SMARTMessage, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan disk: %w", err)
+		}
+		disks = append(disks, d)
+	}
+	return disks, rows.Err()
+}
+
+func scanDevice(row pgx.Row) (*device.Device, error) {
+	d := &device.Device{}
+	err := row.Scan(
+		&d.ID,
+		&d.OwnerID,
+		&d.FriendlyName,
+		&d.IsOnline,
+		&d.LastSeen,
+		&d.LocalIP,
+		&d.Version,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// pairingCode returns a code formatted as XXXX-XXXX.
+func pairingCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = pairingAlphabet[int(b[i])%len(pairingAlphabet)]
+	}
+	return string(b[:4]) + "-" + string(b[4:]), nil
+}
+
+func normalizePairingCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/types/document"
+)
+
+type DocumentService struct {
+	db   *pgxpool.Pool
+	docs map[string][]*document.Document
+}
+
+func NewDocumentService(db *pgxpool.Pool, docs map[string][]*document.Document) *DocumentService {
+	return &DocumentService{
+		db:   db,
+		docs: docs,
+	}
+}
+
+// Current returns the version of slug in effect at now, plus the next
+// published version if one is scheduled.
+func (s *DocumentService) Current(slug string, now time.Time) (*document.DocumentResponse, error) {
+	versions := s.docs[slug]
+
+	var current *document.Document
+	var upcoming *document.VersionInfo
+	for _, doc := range versions {
+		if !doc.EffectiveAt.After(now) {
+			current = doc
+			continue
+		}
+		upcoming = &document.VersionInfo{Version: doc.Version, EffectiveAt: doc.EffectiveAt}
+		break
+	}
+
+	if current == nil {
+		return nil, ErrDocumentNotFound
+	}
+
+	return &document.DocumentResponse{Document: current, Upcoming: upcoming}, nil
+}
+
+// Version returns a specific published version of slug, including past and
+// scheduled ones.
+func (s *DocumentService) Version(slug, version string) (*document.DocumentResponse, error) {
+	for _, doc := range s.docs[slug] {
+		if doc.Version == version {
+			return &document.DocumentResponse{Document: doc}, nil
+		}
+	}
+	return nil, ErrDocumentNotFound
+}
+
+// AcceptanceStatuses reports, for every document that requires acceptance,
+// whether the user has accepted the version currently in effect.
+func (s *DocumentService) AcceptanceStatuses(ctx context.Context, clerkID string) ([]*document.AcceptanceStatus, error) {
+	query := `
+	SELECT DISTINCT ON (a.document) a.document, a.version, a.accepted_at
+	FROM document_acceptances a
+	INNER JOIN users u ON u.id = a.user_id
+	WHERE u.clerk_id = $1
+	ORDER BY a.document, a.accepted_at DESC
+	`
+
+	rows, err := s.db.Query(ctx, query, clerkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query acceptances: %w", err)
+	}
+	defer rows.Close()
+
+	latest := make(map[string]*document.Acceptance)
+	for rows.Next() {
+		var a document.Acceptance
+		if err := rows.Scan(&a.Document, &a.Version, &a.AcceptedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan acceptance: %w", err)
+		}
+		latest[a.Document] = &a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var statuses []*document.AcceptanceStatus
+	for slug := range s.docs {
+		current, err := s.Current(slug, now)
+		if err != nil || !current.RequiresAcceptance {
+			continue
+		}
+
+		status := &document.AcceptanceStatus{
+			Document:       slug,
+			Title:          current.Title,
+			CurrentVersion: current.Version,
+			EffectiveAt:    current.EffectiveAt,
+			Pending:        true,
+		}
+		if a, ok := latest[slug]; ok {
+			status.AcceptedVersion = &a.Version
+			status.AcceptedAt = &a.AcceptedAt
+			status.Pending = a.Version != current.Version
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Document < statuses[j].Document
+	})
+
+	return statuses, nil
+}
+
+// Accept records that the user accepted version of slug. Only the version in
+// effect can be accepted, so clients can't accept text they weren't shown.
+func (s *DocumentService) Accept(ctx context.Context, clerkID, slug, version, ipAddress, userAgent string) error {
+	current, err := s.Current(slug, time.Now())
+	if err != nil {
+		return err
+	}
+	if current.Version != version {
+		return ErrVersionNotCurrent
+	}
+
+	query := `
+	INSERT INTO document_acceptances (user_id, document, version, ip_address, user_agent)
+	SELECT id, $2, $3, $4, $5 FROM users WHERE clerk_id = $1
+	ON CONFLICT (user_id, document, version) DO NOTHING
+	`
+
+	result, err := s.db.Exec(ctx, query, clerkID, slug, version, ipAddress, userAgent)
+	if err != nil {
+		return fmt.Errorf("failed to record acceptance: %w", err)
+	}
+
+	// Zero rows is either an unknown user or a repeated acceptance
+	if result.RowsAffected() == 0 {
+		var exists bool
+		if err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE clerk_id = $1)`, clerkID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to look up user: %w", err)
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
+	}
+
+	return nil
+}
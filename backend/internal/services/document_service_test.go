@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/types/document"
+)
+
+func TestDocumentCurrent(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC) }
+	s := NewDocumentService(nil, map[string][]*document.Document{
+		document.TermsOfServices: {
+			{Version: "v1", EffectiveAt: day(1)},
+			{Version: "v2", EffectiveAt: day(10)},
+			{Version: "v3", EffectiveAt: day(20)},
+		},
+	})
+
+	tests := []struct {
+		name         string
+		now          time.Time
+		wantVersion  string
+		wantUpcoming string
+		wantErr      error
+	}{
+		{"before the first", day(1).Add(-time.Second), "", "", ErrDocumentNotFound},
+		{"first in effect", day(1), "v1", "v2", nil},
+		{"between", day(15), "v2", "v3", nil},
+		{"latest", day(25), "v3", "", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := s.Current(document.TermsOfServices, tt.now)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		upcoming := ""
+		if got.Upcoming != nil {
+			upcoming = got.Upcoming.Version
+		}
+		if got.Version != tt.wantVersion || upcoming != tt.wantUpcoming {
+			t.Errorf("%s: got %s (upcoming %q), want %s (upcoming %q)", tt.name, got.Version, upcoming, tt.wantVersion, tt.wantUpcoming)
+		}
+	}
+
+	if _, err := s.Current(document.Pricing, day(15)); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("unknown slug: %v, want ErrDocumentNotFound", err)
+	}
+	if got, err := s.Version(document.TermsOfServices, "v3"); err != nil || got.Version != "v3" {
+		t.Errorf("scheduled version: %v, %v", got, err)
+	}
+	if _, err := s.Version(document.TermsOfServices, "v4"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("unknown version: %v, want ErrDocumentNotFound", err)
+	}
+}
+
+// Only the version in effect can be accepted, accepting it again is a no-op,
+// and a user's acceptance doesn't count for anyone else.
+func TestAcceptDocument(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	now := time.Now()
+	s := NewDocumentService(db, map[string][]*document.Document{
+		document.TermsOfServices: {
+			{Slug: document.TermsOfServices, Version: "v1", EffectiveAt: now.Add(-48 * time.Hour), RequiresAcceptance: true},
+			{Slug: document.TermsOfServices, Version: "v2", EffectiveAt: now.Add(-time.Hour), RequiresAcceptance: true},
+		},
+		document.Pricing: {{Slug: document.Pricing, Version: "v1", EffectiveAt: now.Add(-time.Hour)}},
+	})
+	alice := dbtest.User(t, db, "alice")
+	dbtest.User(t, db, "bob")
+
+	if err := s.Accept(ctx, "clerk_alice", document.TermsOfServices, "v1", "", ""); !errors.Is(err, ErrVersionNotCurrent) {
+		t.Errorf("accepting a superseded version: %v, want ErrVersionNotCurrent", err)
+	}
+	if err := s.Accept(ctx, "clerk_nobody", document.TermsOfServices, "v2", "", ""); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("accepting as an unknown user: %v, want ErrUserNotFound", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Accept(ctx, "clerk_alice", document.TermsOfServices, "v2", "192.0.2.1", "test"); err != nil {
+			t.Fatalf("Accept #%d: %v", i+1, err)
+		}
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM document_acceptances WHERE user_id = $1`, alice); n != 1 {
+		t.Errorf("%d acceptances recorded, want 1", n)
+	}
+
+	tests := []struct {
+		clerkID     string
+		wantPending bool
+	}{
+		{"clerk_alice", false},
+		{"clerk_bob", true},
+	}
+	for _, tt := range tests {
+		statuses, err := s.AcceptanceStatuses(ctx, tt.clerkID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Pricing doesn't require acceptance, so only the terms are listed
+		if len(statuses) != 1 || statuses[0].Document != document.TermsOfServices || statuses[0].Pending != tt.wantPending {
+			t.Errorf("%s: statuses %+v, want the terms with pending %v", tt.clerkID, statuses, tt.wantPending)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/mailer"
+)
+
+const (
+	emailPollInterval = 5 * time.Second
+	emailSendTimeout  = 30 * time.Second
+	// emailLease keeps other instances off a message while it is being
+	// sent, and retries it if this one dies mid-send
+	emailLease       = 5 * time.Minute
+	emailMaxAttempts = 8
+	emailRetention   = 30 * 24 * time.Hour
+)
+
+// emailPreferences maps templates to the notification_preferences column
+// that lets users opt out of them. Templates not listed are always sent.
+var emailPreferences = map[string]string{
+	mailer.TemplateShareReceived: "email_shares",
+	mailer.TemplateFriendRequest: "email_friend_requests",
+	mailer.TemplateDeviceAlert:   "email_device_alerts",
+}
+
+// EmailService is the transactional email outbox. Producers Enqueue in the
+// transaction of the change the email is about, and Run sends what commits.
+type EmailService struct {
+	db     *pgxpool.Pool
+	mailer mailer.Mailer
+}
+
+func NewEmailService(db *pgxpool.Pool, m mailer.Mailer) *EmailService {
+	return &EmailService{
+		db:     db,
+		mailer: m,
+	}
+}
+
+// Enqueue renders a mailer template for to and adds it to the outbox through
+// q, usually a transaction. When the email is to a user, userID is set and
+// the email is dropped if they opted out of its kind.
+func (s *EmailService) Enqueue(ctx context.Context, q querier, userID *uuid.UUID, template, to string, data any) error {
+	msg, err := mailer.Render(template, to, data)
+	if err != nil {
+		return err
+	}
+
+	optOut := "FALSE"
+	if column, ok := emailPreferences[template]; ok && userID != nil {
+		optOut = `EXISTS (SELECT 1 FROM notification_preferences WHERE user_id = $2 AND NOT ` + column + `)`
+	}
+
+	var id uuid.UUID
+	err = q.QueryRow(ctx, `
+	INSERT INTO email_outbox (id, user_id, template, recipient, subject, text_body, html_body)
+	SELECT $1::uuid, $2::uuid, $3::text, $4::text, $5::text, $6::text, $7::text
+	WHERE NOT `+optOut+`
+	RETURNING id
+	`, uuid.New(), userID, template, msg.To, msg.Subject, msg.Text, msg.HTML).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to queue %s email: %w", template, err)
+	}
+	return nil
+}
+
+// Run sends queued emails until ctx is cancelled. Failed sends are retried
+// with backoff, up to emailMaxAttempts; rejected recipients aren't retried.
+func (s *EmailService) Run(ctx context.Context) {
+	ticker := time.NewTicker(emailPollInterval)
+	defer ticker.Stop()
+
+	lastSweep := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			sent, err := s.sendNext(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Email sender failed: %v", err)
+			}
+			if !sent {
+				break
+			}
+		}
+
+		if time.Since(lastSweep) >= time.Hour {
+			lastSweep = time.Now()
+			if _, err := s.db.Exec(ctx, `
+			DELETE FROM email_outbox
+			WHERE status <> 'pending' AND created_at < NOW() - make_interval(secs => $1)
+			`, emailRetention.Seconds()); err != nil && ctx.Err() == nil {
+				log.Printf("Email outbox sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+// sendNext claims the next due email and tries to send it. It reports
+// whether there was one.
+func (s *EmailService) sendNext(ctx context.Context) (bool, error) {
+	var (
+		id       uuid.UUID
+		template string
+		attempts int
+		msg      mailer.Message
+	)
+	err := s.db.QueryRow(ctx, `
+	UPDATE email_outbox
+	SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $1)
+	WHERE id = (
+		SELECT id FROM email_outbox
+		WHERE status = 'pending' AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, template, attempts, recipient, subject, text_body, html_body
+	`, emailLease.Seconds()).Scan(&id, &template, &attempts, &msg.To, &msg.Subject, &msg.Text, &msg.HTML)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim email: %w", err)
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+	sendErr := s.mailer.Send(sendCtx, msg)
+	cancel()
+
+	// Recording the outcome shouldn't be cut short by shutdown, or a sent
+	// email would go out again
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if sendErr == nil {
+		_, err = s.db.Exec(ctx, `
+		UPDATE email_outbox
+		SET status = 'sent', sent_at = NOW(), last_error = '', text_body = '', html_body = ''
+		WHERE id = $1
+		`, id)
+		if err != nil {
+			return true, fmt.Errorf("failed to mark email %s sent: %w", id, err)
+		}
+		return true, nil
+	}
+
+	if mailer.Permanent(sendErr) || attempts >= emailMaxAttempts {
+		log.Printf("Giving up on %s email %s after %d attempts: %v", template, id, attempts, sendErr)
+		_, err = s.db.Exec(ctx, `
+		UPDATE email_outbox
+		SET status = 'failed', last_error = $2, text_body = '', html_body = ''
+		WHERE id = $1
+		`, id, sendErr.Error())
+	} else {
+		log.Printf("Sending %s email %s failed (attempt %d): %v", template, id, attempts, sendErr)
+		_, err = s.db.Exec(ctx, `
+		UPDATE email_outbox
+		SET last_error = $2, next_attempt_at = NOW() + make_interval(secs => $3)
+		WHERE id = $1
+		`, id, sendErr.Error(), emailBackoff(attempts).Seconds())
+	}
+	if err != nil {
+		return true, fmt.Errorf("failed to record failure of email %s: %w", id, err)
+	}
+	return true, nil
+}
+
+// emailBackoff is the wait after the given number of failed attempts:
+// a minute, doubling up to six hours.
+func emailBackoff(attempts int) time.Duration {
+	d := time.Minute << (attempts - 1)
+	if attempts > 9 || d > 6*time.Hour {
+		return 6 * time.Hour
+	}
+	return d
+}
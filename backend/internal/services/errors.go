@@ -0,0 +1,68 @@
+package services
+
+import "errors"
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+
+	ErrDocumentNotFound  = errors.New("document not found")
+	ErrVersionNotCurrent = errors.New("version is not the current version")
+
+	ErrDeletionRequestNotFound  = errors.New("deletion request not found")
+	ErrInvalidDeletionCode      = errors.New("invalid or expired code")
+	ErrDeletionNotPending       = errors.New("deletion request already verified")
+	ErrDeletionNotScheduled     = errors.New("deletion is not scheduled")
+	ErrDeletionAlreadyScheduled = errors.New("account deletion is already scheduled")
+
+	ErrExportNotFound = errors.New("export not found")
+	ErrExportNotReady = errors.New("export is not ready")
+
+	ErrDeviceNotFound      = errors.New("device not found")
+	ErrDeviceAlreadyPaired = errors.New("device is already paired")
+	ErrPairingNotFound     = errors.New("pairing not found")
+	ErrInvalidPairingCode  = errors.New("invalid or expired pairing code")
+
+	ErrShareNotFound = errors.New("share not found")
+	ErrShareWithSelf = errors.New("cannot share with yourself")
+
+	ErrDuplicatePaymentEvent = errors.New("payment event already processed")
+	ErrUnknownPlan           = errors.New("unknown plan")
+	ErrSubscriptionNotFound  = errors.New("subscription not found")
+	ErrOrderNotFound         = errors.New("order not found")
+	ErrTooManyUnits          = errors.New("more units than the item quantity")
+	ErrSerialAssigned        = errors.New("serial is already assigned")
+
+	ErrReleaseNotFound  = errors.New("release not found")
+	ErrReleaseExists    = errors.New("release already exists")
+	ErrChecksumMismatch = errors.New("checksum does not match the uploaded file")
+	ErrRolloutNotFound  = errors.New("rollout not found")
+	ErrUpdatesDisabled  = errors.New("update signing is not configured")
+
+	ErrCommandNotFound = errors.New("command not found")
+	ErrCommandFinished = errors.New("command already finished")
+
+	ErrSessionNotFound  = errors.New("connection session not found")
+	ErrSessionCompleted = errors.New("connection session already completed")
+
+	ErrVPNDisabled     = errors.New("vpn gateway is not configured")
+	ErrVPNNotEnabled   = errors.New("device has not joined the vpn")
+	ErrVPNKeyInUse     = errors.New("public key already belongs to another peer")
+	ErrVPNSubnetFull   = errors.New("no vpn addresses left")
+	ErrVPNPeerNotFound = errors.New("vpn peer not found")
+	ErrVPNConfigIssued = errors.New("vpn client config was already issued")
+
+	ErrNotificationNotFound = errors.New("notification not found")
+	ErrAlertRuleNotFound    = errors.New("alert rule not found")
+
+	ErrFriendWithSelf        = errors.New("cannot befriend yourself")
+	ErrAlreadyFriends        = errors.New("already friends")
+	ErrFriendRequestNotFound = errors.New("friend request not found")
+	ErrFriendshipNotFound    = errors.New("friendship not found")
+	ErrInviteNotFound        = errors.New("invite not found or expired")
+	ErrInviteeIsUser         = errors.New("email already belongs to a user")
+	ErrTooManyInvites        = errors.New("too many invites sent today")
+	ErrInvitesDisabled       = errors.New("invite signing is not configured")
+
+	ErrBlockSelf     = errors.New("cannot block yourself")
+	ErrBlockNotFound = errors.New("user is not blocked")
+)
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	clerk "github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/session"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/types/export"
+)
+
+const (
+	exportPollInterval = 5 * time.Second
+	// Jobs left running this long belong to an instance that died mid-export
+	exportStaleAfter = 30 * time.Minute
+	exportJobColumns = `id, user_id, status, file_size, error, created_at, started_at, completed_at, expires_at`
+)
+
+// exportSection is one JSON file in the archive. query receives the user's ID
+// as $1 and must return a single JSON value.
+type exportSection struct {
+	file  string
+	query string
+}
+
+// exportSections lists every table holding user data. Tables added later must
+// be added here too, or the export stops being complete.
+var exportSections = []exportSection{
+	{"user.json", `SELECT row_to_json(u) FROM users u WHERE u.id = $1`},
+	{"friendships.json", `
+		SELECT COALESCE(json_agg(f ORDER BY f.created_at), '[]')
+		FROM friendships f
+		WHERE f.user_id = $1 OR f.friend_id = $1`},
+	{"friend_invites.json", `
+		SELECT COALESCE(json_agg(i ORDER BY i.created_at), '[]')
+		FROM (
+			SELECT id, email, status, expires_at, created_at
+			FROM friend_invites
+			WHERE inviter_id = $1 OR accepted_by = $1
+		) i`},
+	{"blocks.json", `
+		SELECT COALESCE(json_agg(b ORDER BY b.created_at), '[]')
+		FROM (
+			SELECT blocked_id, created_at
+			FROM user_blocks
+			WHERE blocker_id = $1
+		) b`},
+	{"privacy_settings.json", `
+		SELECT COALESCE(row_to_json(p), '{"discoverable_by_username": true, "discoverable_by_email": true}')
+		FROM (SELECT 1) one
+		LEFT JOIN (
+			SELECT discoverable_by_username, discoverable_by_email, updated_at
+			FROM privacy_settings
+			WHERE user_id = $1
+		) p ON TRUE`},
+	{"devices.json", `
+		SELECT COALESCE(json_agg(d ORDER BY d.created_at), '[]')
+		FROM (
+			SELECT id, friendly_name, is_online, last_seen, local_ip, version, created_at, updated_at
+			FROM devices
+			WHERE owner_id = $1
+		) d`},
+	{"file_metadata.json", `
+		SELECT COALESCE(json_agg(fm ORDER BY fm.device_id, fm.id), '[]')
+		FROM file_metadata fm
+		JOIN devices d ON d.id = fm.device_id
+		WHERE d.owner_id = $1`},
+	{"document_acceptances.json", `
+		SELECT COALESCE(json_agg(a ORDER BY a.accepted_at), '[]')
+		FROM document_acceptances a
+		WHERE a.user_id = $1`},
+	{"account_deletion_requests.json", `
+		SELECT COALESCE(json_agg(r ORDER BY r.created_at), '[]')
+		FROM (
+			SELECT r.id, r.email, r.status, r.scheduled_for, r.completed_at, r.created_at
+			FROM account_deletion_requests r
+			JOIN users u ON u.clerk_id = r.clerk_id
+			WHERE u.id = $1
+		) r`},
+	{"subscription.json", `
+		SELECT COALESCE(row_to_json(s), '{"plan": "free", "status": "active"}')
+		FROM (SELECT 1) one
+		LEFT JOIN (
+			SELECT plan, status, current_period_end, cancel_at_period_end, created_at, updated_at
+			FROM subscriptions
+			WHERE user_id = $1
+		) s ON TRUE`},
+	{"shares.json", `
+		SELECT COALESCE(json_agg(sh ORDER BY sh.created_at), '[]')
+		FROM (
+			SELECT id, device_id, owner_id, kind, grantee_id, path, permission, expires_at, created_at
+			FROM shares
+			WHERE owner_id = $1 OR grantee_id = $1
+		) sh`},
+	{"device_pairings.json", `
+		SELECT COALESCE(json_agg(p ORDER BY p.claimed_at), '[]')
+		FROM (
+			SELECT device_id, claimed_at
+			FROM device_pairings
+			WHERE claimed_by = $1
+		) p`},
+	{"orders.json", `
+		SELECT COALESCE(json_agg(o ORDER BY o.created_at), '[]')
+		FROM (
+			SELECT o.id, o.email, o.status, o.shipping_status, o.carrier, o.tracking_number, o.shipped_at, o.delivered_at,
+				o.amount_total, o.amount_refunded, o.currency, o.created_at, o.updated_at,
+				(
+					SELECT COALESCE(json_agg(i ORDER BY i.id), '[]')
+					FROM (
+						SELECT i.id, i.sku, i.name, i.quantity, i.unit_amount,
+							(SELECT COALESCE(json_agg(json_build_object('serial', u.serial, 'device_id', u.device_id, 'paired_at', u.paired_at)), '[]')
+							FROM order_units u WHERE u.item_id = i.id) AS units
+						FROM order_items i
+						WHERE i.order_id = o.id
+					) i
+				) AS items
+			FROM orders o
+			WHERE o.user_id = $1
+		) o`},
+	{"export_jobs.json", `
+		SELECT COALESCE(json_agg(j ORDER BY j.created_at), '[]')
+		FROM (
+			SELECT id, status, created_at, completed_at
+			FROM export_jobs
+			WHERE user_id = $1 AND status <> 'running'
+		) j`},
+}
+
+// ExportService builds data export archives in the background. Archives are
+// written to dir and deleted once retention has passed.
+type ExportService struct {
+	db        *pgxpool.Pool
+	dir       string
+	retention time.Duration
+}
+
+func NewExportService(db *pgxpool.Pool, dir string, retention time.Duration) *ExportService {
+	return &ExportService{
+		db:        db,
+		dir:       dir,
+		retention: retention,
+	}
+}
+
+// RequestExport queues an export for the user, or returns the one already in
+// progress.
+func (s *ExportService) RequestExport(ctx context.Context, clerkID string) (*export.Job, error) {
+	var userID uuid.UUID
+	err := s.db.QueryRow(ctx, `SELECT id FROM users WHERE clerk_id = $1`, clerkID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	_, err = s.db.Exec(ctx, `
+	INSERT INTO export_jobs (id, user_id)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) WHERE status IN ('queued', 'running') DO NOTHING
+	`, uuid.New(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue export: %w", err)
+	}
+
+	query := `SELECT ` + exportJobColumns + ` FROM export_jobs
+	WHERE user_id = $1 AND status IN ('queued', 'running')`
+	job, err := scanExportJob(s.db.QueryRow(ctx, query, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Finished between the insert and the select
+		return s.latest(ctx, userID)
+	}
+	return job, err
+}
+
+func (s *ExportService) latest(ctx context.Context, userID uuid.UUID) (*export.Job, error) {
+	query := `SELECT ` + exportJobColumns + ` FROM export_jobs
+	WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1`
+	job, err := scanExportJob(s.db.QueryRow(ctx, query, userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load export: %w", err)
+	}
+	return job, nil
+}
+
+// GetJob returns one of the user's export jobs.
+func (s *ExportService) GetJob(ctx context.Context, clerkID string, id uuid.UUID) (*export.Job, error) {
+	query := `SELECT ` + exportJobColumns + ` FROM export_jobs
+	WHERE id = $1 AND user_id = (SELECT id FROM users WHERE clerk_id = $2)`
+	job, err := scanExportJob(s.db.QueryRow(ctx, query, id, clerkID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export: %w", err)
+	}
+	return job, nil
+}
+
+// OpenArchive opens a completed export for download. The caller closes the file.
+func (s *ExportService) OpenArchive(ctx context.Context, clerkID string, id uuid.UUID) (*os.File, *export.Job, error) {
+	job, err := s.GetJob(ctx, clerkID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Status != export.StatusCompleted {
+		return nil, job, ErrExportNotReady
+	}
+
+	f, err := os.Open(s.archivePath(job.ID))
+	if errors.Is(err, os.ErrNotExist) {
+		// Swept from disk ahead of the status update
+		return nil, job, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, job, fmt.Errorf("failed to open archive: %w", err)
+	}
+	return f, job, nil
+}
+
+// Run processes queued exports and removes expired archives until ctx is
+// cancelled.
+func (s *ExportService) Run(ctx context.Context) {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		log.Printf("Export worker disabled, cannot create %s: %v", s.dir, err)
+		return
+	}
+
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+
+	lastSweep := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			processed, err := s.processNext(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Export worker failed: %v", err)
+			}
+			if !processed {
+				break
+			}
+		}
+
+		if time.Since(lastSweep) >= time.Hour {
+			lastSweep = time.Now()
+			if err := s.sweep(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Export sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+// processNext claims the oldest queued job. It reports whether there was one.
+func (s *ExportService) processNext(ctx context.Context) (bool, error) {
+	var id, userID uuid.UUID
+	var clerkID string
+	err := s.db.QueryRow(ctx, `
+	UPDATE export_jobs j
+	SET status = 'running', started_at = NOW()
+	FROM users u
+	WHERE u.id = j.user_id AND j.id = (
+		SELECT id FROM export_jobs
+		WHERE status = 'queued'
+		ORDER BY created_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING j.id, j.user_id, u.clerk_id
+	`).Scan(&id, &userID, &clerkID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim export job: %w", err)
+	}
+
+	start := time.Now()
+	size, err := s.build(ctx, id, userID, clerkID)
+	if err != nil {
+		log.Printf("Export %s failed: %v", id, err)
+		_, dbErr := s.db.Exec(ctx, `
+		UPDATE export_jobs SET status = 'failed', error = $2, completed_at = NOW()
+		WHERE id = $1
+		`, id, "The export could not be created. Please request a new one.")
+		return true, dbErr
+	}
+
+	_, err = s.db.Exec(ctx, `
+	UPDATE export_jobs
+	SET status = 'completed', file_size = $2, completed_at = NOW(), expires_at = $3
+	WHERE id = $1
+	`, id, size, time.Now().Add(s.retention))
+	if err != nil {
+		os.Remove(s.archivePath(id))
+		return true, fmt.Errorf("failed to mark export %s completed: %w", id, err)
+	}
+
+	log.Printf("Export %s completed in %v (%d bytes)", id, time.Since(start), size)
+	return true, nil
+}
+
+// build writes the archive to a temporary file and renames it into place, so
+// a download never sees a partial ZIP.
+func (s *ExportService) build(ctx context.Context, id, userID uuid.UUID, clerkID string) (int64, error) {
+	tmp, err := os.CreateTemp(s.dir, id.String()+"-*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := zip.NewWriter(tmp)
+	for _, section := range exportSections {
+		var data json.RawMessage
+		if err := s.db.QueryRow(ctx, section.query, userID).Scan(&data); err != nil {
+			return 0, fmt.Errorf("failed to export %s: %w", section.file, err)
+		}
+		if err := writeJSONFile(zw, section.file, data); err != nil {
+			return 0, err
+		}
+	}
+
+	sessions, err := clerkSessions(ctx, clerkID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to export sessions: %w", err)
+	}
+	if err := writeJSONFile(zw, "sessions.json", sessions); err != nil {
+		return 0, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), s.archivePath(id)); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// clerkSessions returns the user's sign-in history, which lives in Clerk
+// rather than the portal database.
+func clerkSessions(ctx context.Context, clerkID string) ([]*clerk.Session, error) {
+	var all []*clerk.Session
+	for offset := int64(0); ; {
+		list, err := session.List(ctx, &session.ListParams{
+			UserID:     clerk.String(clerkID),
+			ListParams: clerk.ListParams{Limit: clerk.Int64(100), Offset: clerk.Int64(offset)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, list.Sessions...)
+		offset += int64(len(list.Sessions))
+		if len(list.Sessions) == 0 || offset >= list.TotalCount {
+			return all, nil
+		}
+	}
+}
+
+func writeJSONFile(zw *zip.Writer, name string, v any) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// sweep expires finished archives, requeues jobs abandoned by a dead instance
+// and removes files no job points at, such as those of deleted users.
+func (s *ExportService) sweep(ctx context.Context) error {
+	if _, err := s.db.Exec(ctx, `
+	UPDATE export_jobs SET status = 'queued', started_at = NULL
+	WHERE status = 'running' AND started_at < $1
+	`, time.Now().Add(-exportStaleAfter)); err != nil {
+		return fmt.Errorf("failed to requeue stale exports: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, `
+	UPDATE export_jobs SET status = 'expired'
+	WHERE status = 'completed' AND expires_at <= NOW()
+	RETURNING id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to expire exports: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := os.Remove(s.archivePath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove expired export %s: %v", id, err)
+		}
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-s.retention)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".zip") || strings.HasSuffix(entry.Name(), ".tmp") {
+			os.Remove(filepath.Join(s.dir, entry.Name()))
+		}
+	}
+
+	return nil
+}
+
+func (s *ExportService) archivePath(id uuid.UUID) string {
+	return filepath.Join(s.dir, id.String()+".zip")
+}
+
+func scanExportJob(row pgx.Row) (*export.Job, error) {
+	job := &export.Job{}
+	err := row.Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Status,
+		&job.FileSize,
+		&job.Error,
+		&job.CreatedAt,
+		&job.StartedAt,
+		&job.CompletedAt,
+		&job.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
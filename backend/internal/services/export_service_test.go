@@ -0,0 +1,148 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/types/export"
+)
+
+func TestWriteJSONFile(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := writeJSONFile(zw, "profile.json", map[string]string{"username": "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSONFile(zw, "broken.json", func() {}); err == nil {
+		t.Fatal("writing a value that can't be encoded succeeded")
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("profile.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(raw, &got); err != nil || got["username"] != "alice" {
+		t.Fatalf("profile.json = %s, %v", raw, err)
+	}
+}
+
+// Every section's query must keep running against the current schema, or
+// exports fail for everyone.
+func TestExportSectionsQuerySchema(t *testing.T) {
+	db := dbtest.New(t)
+	alice := dbtest.User(t, db, "alice")
+
+	for _, section := range exportSections {
+		var data json.RawMessage
+		if err := db.QueryRow(context.Background(), section.query, alice).Scan(&data); err != nil {
+			t.Errorf("%s: %v", section.file, err)
+			continue
+		}
+		if !json.Valid(data) {
+			t.Errorf("%s: invalid JSON %s", section.file, data)
+		}
+	}
+}
+
+// A user has one export in flight at a time, and sees only their own.
+func TestRequestExport(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := NewExportService(db, t.TempDir(), time.Hour)
+	dbtest.User(t, db, "alice")
+	dbtest.User(t, db, "bob")
+
+	if _, err := s.RequestExport(ctx, "clerk_nobody"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unknown user: %v, want ErrUserNotFound", err)
+	}
+
+	job, err := s.RequestExport(ctx, "clerk_alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.RequestExport(ctx, "clerk_alice")
+	if err != nil || again.ID != job.ID {
+		t.Fatalf("second request = %v, %v; want the queued job %s", again, err, job.ID)
+	}
+
+	if _, err := s.GetJob(ctx, "clerk_bob", job.ID); !errors.Is(err, ErrExportNotFound) {
+		t.Errorf("another user's job: %v, want ErrExportNotFound", err)
+	}
+	if _, _, err := s.OpenArchive(ctx, "clerk_alice", job.ID); !errors.Is(err, ErrExportNotReady) {
+		t.Errorf("queued job: %v, want ErrExportNotReady", err)
+	}
+
+	// Once it's done, the next request queues a new export
+	if err := os.WriteFile(s.archivePath(job.ID), []byte("zip"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dbtest.Exec(t, db, `UPDATE export_jobs SET status = 'completed', expires_at = NOW() + INTERVAL '1 hour' WHERE id = $1`, job.ID)
+	f, _, err := s.OpenArchive(ctx, "clerk_alice", job.ID)
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	f.Close()
+	if _, _, err := s.OpenArchive(ctx, "clerk_bob", job.ID); !errors.Is(err, ErrExportNotFound) {
+		t.Errorf("another user's archive: %v, want ErrExportNotFound", err)
+	}
+
+	next, err := s.RequestExport(ctx, "clerk_alice")
+	if err != nil || next.ID == job.ID || next.Status != export.StatusQueued {
+		t.Fatalf("request after completion = %+v, %v; want a new queued job", next, err)
+	}
+}
+
+// The sweep requeues jobs abandoned mid-export and expires old archives.
+func TestExportSweep(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := NewExportService(db, t.TempDir(), time.Hour)
+	alice := dbtest.User(t, db, "alice")
+	bob := dbtest.User(t, db, "bob")
+
+	stale, expired := uuid.New(), uuid.New()
+	dbtest.Exec(t, db, `
+	INSERT INTO export_jobs (id, user_id, status, started_at) VALUES ($1, $2, 'running', $3)
+	`, stale, alice, time.Now().Add(-exportStaleAfter-time.Minute))
+	dbtest.Exec(t, db, `
+	INSERT INTO export_jobs (id, user_id, status, expires_at) VALUES ($1, $2, 'completed', NOW() - INTERVAL '1 minute')
+	`, expired, bob)
+	if err := os.WriteFile(s.archivePath(expired), []byte("zip"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if job, err := s.GetJob(ctx, "clerk_alice", stale); err != nil || job.Status != export.StatusQueued || job.StartedAt != nil {
+		t.Errorf("abandoned job = %+v, %v; want it queued again", job, err)
+	}
+	if job, err := s.GetJob(ctx, "clerk_bob", expired); err != nil || job.Status != export.StatusExpired {
+		t.Errorf("old job = %+v, %v; want it expired", job, err)
+	}
+	if _, err := os.Stat(s.archivePath(expired)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired archive still on disk: %v", err)
+	}
+}
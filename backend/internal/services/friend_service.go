@@ -0,0 +1,615 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/invite"
+	"github.com/strct-org/portal/backend/internal/mailer"
+	"github.com/strct-org/portal/backend/internal/types/friend"
+	"github.com/strct-org/portal/backend/internal/types/notification"
+)
+
+const (
+	inviteTTL       = 14 * 24 * time.Hour
+	inviteRetention = 30 * 24 * time.Hour
+	// maxDailyInvites keeps the invite form from being used to send mail
+	// to arbitrary addresses
+	maxDailyInvites = 20
+	inviteListLimit = 100
+)
+
+// friendshipSelect loads friendships as seen by user $1. Blocking dissolves
+// friendships, so notBlocked only covers a request racing a block.
+const friendshipSelect = `
+SELECT u.id, u.username, u.first_name, u.last_name, u.image_url, f.status,
+	CASE WHEN f.user_id = $1 THEN 'outgoing' ELSE 'incoming' END, f.created_at
+FROM friendships f
+JOIN users u ON u.id = CASE WHEN f.user_id = $1 THEN f.friend_id ELSE f.user_id END
+WHERE $1 IN (f.user_id, f.friend_id) AND ` + notBlocked + `
+`
+
+const inviteColumns = `id, email, status, expires_at, created_at`
+
+// FriendService manages friend requests between users, and invitations
+// emailed to people who aren't users yet.
+type FriendService struct {
+	db            *pgxpool.Pool
+	notifications *NotificationService
+	emails        *EmailService
+	events        *events.Broker
+	signer        *invite.Signer
+	baseURL       string
+}
+
+// NewFriendService builds invitation links on baseURL. A nil signer disables
+// invitations; friend requests between users still work.
+func NewFriendService(db *pgxpool.Pool, notifications *NotificationService, emails *EmailService, broker *events.Broker, signer *invite.Signer, baseURL string) *FriendService {
+	return &FriendService{
+		db:            db,
+		notifications: notifications,
+		emails:        emails,
+		events:        broker,
+		signer:        signer,
+		baseURL:       baseURL,
+	}
+}
+
+// List returns the user's friendships with the given status: accepted
+// friends, or pending requests in both directions.
+func (s *FriendService) List(ctx context.Context, clerkID, status string) ([]*friend.Friendship, error) {
+	var userID uuid.UUID
+	err := s.db.QueryRow(ctx, `SELECT id FROM users WHERE clerk_id = $1`, clerkID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, friendshipSelect+`AND f.status = $2 ORDER BY u.username`, userID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query friendships: %w", err)
+	}
+	defer rows.Close()
+
+	friendships := []*friend.Friendship{}
+	for rows.Next() {
+		f, err := scanFriendship(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan friendship: %w", err)
+		}
+		friendships = append(friendships, f)
+	}
+	return friendships, rows.Err()
+}
+
+// Request asks recipient, a username or email, to be friends. If they have
+// already asked the user, their request is accepted instead. Asking again
+// while a request is pending changes nothing.
+func (s *FriendService) Request(ctx context.Context, clerkID, recipient string) (*friend.Friendship, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		userID, recipientID uuid.UUID
+		username, email     string
+	)
+	err = tx.QueryRow(ctx, `SELECT id, username FROM users WHERE clerk_id = $1`, clerkID).Scan(&userID, &username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	recipientID, email, err = findUser(ctx, tx, userID, recipient)
+	if err != nil {
+		return nil, err
+	}
+	if recipientID == userID {
+		return nil, ErrFriendWithSelf
+	}
+
+	status, changed, err := befriend(ctx, tx, userID, recipientID, false)
+	if err != nil {
+		return nil, err
+	}
+	if status == friend.StatusAccepted && !changed {
+		return nil, ErrAlreadyFriends
+	}
+	if changed && status == friend.StatusPending {
+		err := s.emails.Enqueue(ctx, tx, &recipientID, mailer.TemplateFriendRequest, email, struct {
+			RequesterUsername string
+		}{username})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := scanFriendship(tx.QueryRow(ctx, friendshipSelect+`AND u.id = $2`, userID, recipientID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load friendship: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if changed {
+		s.announce(ctx, userID, recipientID, username, status)
+	}
+	return f, nil
+}
+
+// Accept accepts the friend request the user received from otherID.
+func (s *FriendService) Accept(ctx context.Context, clerkID string, otherID uuid.UUID) (*friend.Friendship, error) {
+	var (
+		userID   uuid.UUID
+		username string
+	)
+	err := s.db.QueryRow(ctx, `
+	UPDATE friendships f SET status = 'accepted'
+	FROM users u
+	WHERE u.clerk_id = $1 AND f.friend_id = u.id AND f.user_id = $2 AND f.status = 'pending'
+	RETURNING u.id, u.username
+	`, clerkID, otherID).Scan(&userID, &username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrFriendRequestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept friend request: %w", err)
+	}
+
+	s.announce(ctx, userID, otherID, username, friend.StatusAccepted)
+
+	f, err := scanFriendship(s.db.QueryRow(ctx, friendshipSelect+`AND u.id = $2`, userID, otherID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load friendship: %w", err)
+	}
+	return f, nil
+}
+
+// Remove ends a friendship with otherID, or declines or withdraws a pending
+// request between the two.
+func (s *FriendService) Remove(ctx context.Context, clerkID string, otherID uuid.UUID) error {
+	tag, err := s.db.Exec(ctx, `
+	DELETE FROM friendships f
+	USING users u
+	WHERE u.clerk_id = $1
+	AND ((f.user_id = u.id AND f.friend_id = $2) OR (f.user_id = $2 AND f.friend_id = u.id))
+	`, clerkID, otherID)
+	if err != nil {
+		return fmt.Errorf("failed to remove friendship: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFriendshipNotFound
+	}
+	return nil
+}
+
+// Invite emails an invitation to someone who isn't a user yet. Inviting the
+// same address again renews the pending invitation and sends it again.
+func (s *FriendService) Invite(ctx context.Context, clerkID, email string) (*friend.Invite, error) {
+	if s.signer == nil {
+		return nil, ErrInvitesDisabled
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		userID   uuid.UUID
+		username string
+		isUser   bool
+		sent     int
+	)
+	err = tx.QueryRow(ctx, `
+	SELECT u.id, u.username,
+		EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($2)),
+		(SELECT COUNT(*) FROM friend_invites WHERE inviter_id = u.id AND updated_at > NOW() - INTERVAL '1 day')
+	FROM users u WHERE u.clerk_id = $1
+	FOR UPDATE OF u
+	`, clerkID, email).Scan(&userID, &username, &isUser, &sent)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if sent >= maxDailyInvites {
+		return nil, ErrTooManyInvites
+	}
+	// Users who can't be found by this email get an invite like anyone else,
+	// so the answer doesn't reveal that they have an account, but no email
+	if isUser {
+		_, _, err := findUser(ctx, tx, userID, email)
+		if err == nil {
+			return nil, ErrInviteeIsUser
+		}
+		if !errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+	}
+
+	inv, err := scanInvite(tx.QueryRow(ctx, `
+	INSERT INTO friend_invites (id, inviter_id, email, expires_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (inviter_id, LOWER(email)) WHERE status = 'pending'
+	DO UPDATE SET expires_at = EXCLUDED.expires_at, updated_at = NOW()
+	RETURNING `+inviteColumns,
+		uuid.New(), userID, email, time.Now().Add(inviteTTL)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invite: %w", err)
+	}
+
+	if !isUser {
+		acceptURL := fmt.Sprintf("%s/api/v1/invites/%s", s.baseURL, url.PathEscape(s.signer.Sign(inv.ID, inv.ExpiresAt)))
+		err = s.emails.Enqueue(ctx, tx, nil, mailer.TemplateFriendInvite, inv.Email, struct {
+			InviterUsername string
+			AcceptURL       string
+			ExpiresAt       string
+		}{username, acceptURL, inv.ExpiresAt.UTC().Format("2 January 2006")})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// ListInvites returns the invitations the user sent, newest first.
+func (s *FriendService) ListInvites(ctx context.Context, clerkID string) ([]*friend.Invite, error) {
+	rows, err := s.db.Query(ctx, `
+	SELECT `+inviteColumns+` FROM friend_invites
+	WHERE inviter_id = (SELECT id FROM users WHERE clerk_id = $1)
+	ORDER BY created_at DESC
+	LIMIT $2
+	`, clerkID, inviteListLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invites: %w", err)
+	}
+	defer rows.Close()
+
+	invites := []*friend.Invite{}
+	for rows.Next() {
+		inv, err := scanInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invite: %w", err)
+		}
+		invites = append(invites, inv)
+	}
+	return invites, rows.Err()
+}
+
+// CancelInvite withdraws a pending invitation; its link stops working.
+func (s *FriendService) CancelInvite(ctx context.Context, clerkID string, id uuid.UUID) error {
+	tag, err := s.db.Exec(ctx, `
+	DELETE FROM friend_invites
+	WHERE id = $1 AND status = 'pending' AND inviter_id = (SELECT id FROM users WHERE clerk_id = $2)
+	`, id, clerkID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel invite: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// ResolveInvite returns who sent the invitation in token, so the link can be
+// shown before the invitee signs in.
+func (s *FriendService) ResolveInvite(ctx context.Context, token string) (*friend.InviteInfo, error) {
+	id, err := s.verifyInvite(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var info friend.InviteInfo
+	err = s.db.QueryRow(ctx, `
+	SELECT u.username, i.expires_at
+	FROM friend_invites i
+	JOIN users u ON u.id = i.inviter_id
+	WHERE i.id = $1 AND i.status = 'pending' AND i.expires_at > NOW()
+	`, id).Scan(&info.InviterUsername, &info.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load invite: %w", err)
+	}
+	return &info, nil
+}
+
+// AcceptInvite makes the user and the inviter friends. Opening the link
+// while signed in is the acceptance, whichever email the user signed up with.
+func (s *FriendService) AcceptInvite(ctx context.Context, clerkID, token string) (*friend.Friendship, error) {
+	id, err := s.verifyInvite(token)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		userID, inviterID uuid.UUID
+		username          string
+	)
+	err = tx.QueryRow(ctx, `SELECT id, username FROM users WHERE clerk_id = $1`, clerkID).Scan(&userID, &username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	err = tx.QueryRow(ctx, `
+	SELECT inviter_id FROM friend_invites
+	WHERE id = $1 AND status = 'pending' AND expires_at > NOW()
+	FOR UPDATE
+	`, id).Scan(&inviterID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load invite: %w", err)
+	}
+	if inviterID == userID {
+		return nil, ErrFriendWithSelf
+	}
+	var blocked bool
+	if err := tx.QueryRow(ctx, `
+	SELECT EXISTS (SELECT 1 FROM user_blocks WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1))
+	`, userID, inviterID).Scan(&blocked); err != nil {
+		return nil, fmt.Errorf("failed to check blocks: %w", err)
+	}
+	if blocked {
+		return nil, ErrInviteNotFound
+	}
+
+	_, changed, err := befriend(ctx, tx, inviterID, userID, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `
+	UPDATE friend_invites SET status = 'accepted', accepted_by = $2, updated_at = NOW() WHERE id = $1
+	`, id, userID); err != nil {
+		return nil, fmt.Errorf("failed to accept invite: %w", err)
+	}
+	f, err := scanFriendship(tx.QueryRow(ctx, friendshipSelect+`AND u.id = $2`, userID, inviterID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load friendship: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if changed {
+		s.announce(ctx, userID, inviterID, username, friend.StatusAccepted)
+	}
+	return f, nil
+}
+
+// ClaimInvites turns the pending invitations to email into friendships with
+// the new user it now belongs to. They are accepted when the user verified
+// the address, proving the invitation reached them, and are pending friend
+// requests otherwise. Claiming again is a no-op, so webhooks can be retried.
+func (s *FriendService) ClaimInvites(ctx context.Context, userID uuid.UUID, email string, verified bool) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+	SELECT i.id, i.inviter_id, u.username, n.username
+	FROM friend_invites i
+	JOIN users u ON u.id = i.inviter_id
+	JOIN users n ON n.id = $2
+	WHERE LOWER(i.email) = LOWER($1) AND i.status = 'pending' AND i.expires_at > NOW()
+	AND i.inviter_id <> $2
+	ORDER BY i.created_at
+	FOR UPDATE OF i
+	`, email, userID)
+	if err != nil {
+		return fmt.Errorf("failed to query invites: %w", err)
+	}
+	type claim struct {
+		inviteID, inviterID       uuid.UUID
+		inviterUsername, username string
+		status                    string
+		changed                   bool
+	}
+	var claims []*claim
+	for rows.Next() {
+		c := &claim{}
+		if err := rows.Scan(&c.inviteID, &c.inviterID, &c.inviterUsername, &c.username); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan invite: %w", err)
+		}
+		claims = append(claims, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range claims {
+		c.status, c.changed, err = befriend(ctx, tx, c.inviterID, userID, verified)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+		UPDATE friend_invites SET status = 'accepted', accepted_by = $2, updated_at = NOW() WHERE id = $1
+		`, c.inviteID, userID); err != nil {
+			return fmt.Errorf("failed to claim invite: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	for _, c := range claims {
+		if !c.changed {
+			continue
+		}
+		if c.status == friend.StatusAccepted {
+			s.announce(ctx, userID, c.inviterID, c.username, c.status)
+		} else {
+			s.announce(ctx, c.inviterID, userID, c.inviterUsername, c.status)
+		}
+	}
+	return nil
+}
+
+// Run removes invitations a while after they expire until ctx is cancelled.
+func (s *FriendService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.db.Exec(ctx, `
+			DELETE FROM friend_invites WHERE expires_at < NOW() - make_interval(secs => $1)
+			`, inviteRetention.Seconds()); err != nil && ctx.Err() == nil {
+				log.Printf("Friend invite sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *FriendService) verifyInvite(token string) (uuid.UUID, error) {
+	if s.signer == nil {
+		return uuid.Nil, ErrInvitesDisabled
+	}
+	id, err := s.signer.Verify(token, time.Now())
+	if err != nil {
+		return uuid.Nil, ErrInviteNotFound
+	}
+	return id, nil
+}
+
+// announce tells otherID that actorID sent them a friend request, when
+// status is pending, or accepted theirs.
+func (s *FriendService) announce(ctx context.Context, actorID, otherID uuid.UUID, actorUsername, status string) {
+	f, err := scanFriendship(s.db.QueryRow(ctx, friendshipSelect+`AND u.id = $2`, otherID, actorID))
+	if err != nil {
+		log.Printf("Error loading friendship of %s and %s: %v", otherID, actorID, err)
+		return
+	}
+
+	draft := &notification.Draft{
+		Type:  notification.TypeFriendRequest,
+		Title: actorUsername + " wants to be your friend",
+		Body:  "Accept the request to share files with each other.",
+		Data:  map[string]any{"userId": actorID},
+	}
+	typ := events.TypeFriendRequest
+	if status == friend.StatusAccepted {
+		draft.Type = notification.TypeFriendAccepted
+		draft.Title = actorUsername + " accepted your friend request"
+		draft.Body = "You can now share files with each other."
+		typ = events.TypeFriendAccepted
+	}
+
+	s.events.Publish(otherID, typ, f)
+	if err := s.notifications.Notify(ctx, otherID, draft); err != nil {
+		log.Printf("Error notifying %s of friendship with %s: %v", otherID, actorID, err)
+	}
+}
+
+// befriend records that from wants to be friends with to, accepting the
+// request outright when accept is set. A pending request from to is
+// accepted. It returns the resulting status and whether it changed.
+func befriend(ctx context.Context, tx pgx.Tx, from, to uuid.UUID, accept bool) (string, bool, error) {
+	// Two requests crossing each other can't both insert
+	if err := lockUserPair(ctx, tx, from, to); err != nil {
+		return "", false, err
+	}
+
+	var (
+		requesterID uuid.UUID
+		status      string
+	)
+	err := tx.QueryRow(ctx, `
+	SELECT user_id, status FROM friendships
+	WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1)
+	`, from, to).Scan(&requesterID, &status)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status = friend.StatusPending
+		if accept {
+			status = friend.StatusAccepted
+		}
+		if _, err := tx.Exec(ctx, `
+		INSERT INTO friendships (user_id, friend_id, status) VALUES ($1, $2, $3)
+		`, from, to, status); err != nil {
+			return "", false, fmt.Errorf("failed to create friendship: %w", err)
+		}
+		return status, true, nil
+	case err != nil:
+		return "", false, fmt.Errorf("failed to look up friendship: %w", err)
+	case status == friend.StatusAccepted:
+		return status, false, nil
+	case requesterID == to || accept:
+		if _, err := tx.Exec(ctx, `
+		UPDATE friendships SET status = 'accepted'
+		WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1)
+		`, from, to); err != nil {
+			return "", false, fmt.Errorf("failed to accept friendship: %w", err)
+		}
+		return friend.StatusAccepted, true, nil
+	}
+	return status, false, nil
+}
+
+// lockUserPair locks both users, in a fixed order so transactions locking
+// the same pair can't deadlock.
+func lockUserPair(ctx context.Context, tx pgx.Tx, a, b uuid.UUID) error {
+	if a.String() > b.String() {
+		a, b = b, a
+	}
+	if err := lockUser(ctx, tx, a); err != nil {
+		return err
+	}
+	return lockUser(ctx, tx, b)
+}
+
+func scanFriendship(row pgx.Row) (*friend.Friendship, error) {
+	var f friend.Friendship
+	err := row.Scan(&f.UserID, &f.Username, &f.FirstName, &f.LastName, &f.ImageURL, &f.Status, &f.Direction, &f.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func scanInvite(row pgx.Row) (*friend.Invite, error) {
+	var inv friend.Invite
+	err := row.Scan(&inv.ID, &inv.Email, &inv.Status, &inv.ExpiresAt, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/invite"
+	"github.com/strct-org/portal/backend/internal/types/friend"
+)
+
+func newTestFriendService(db *pgxpool.Pool) *FriendService {
+	broker := events.New()
+	signer := invite.NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	return NewFriendService(db, NewNotificationService(db, broker), NewEmailService(db, nil), broker, signer, "https://portal.test")
+}
+
+func TestFriendRequest(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := newTestFriendService(db)
+	alice := dbtest.User(t, db, "alice")
+	bob := dbtest.User(t, db, "bob")
+	dbtest.User(t, db, "carol")
+
+	if _, err := s.Request(ctx, "clerk_alice", "alice"); !errors.Is(err, ErrFriendWithSelf) {
+		t.Errorf("befriending yourself: %v, want ErrFriendWithSelf", err)
+	}
+	if _, err := s.Request(ctx, "clerk_alice", "nobody"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("befriending an unknown user: %v, want ErrUserNotFound", err)
+	}
+
+	// Asking twice sends one request
+	for i := 0; i < 2; i++ {
+		f, err := s.Request(ctx, "clerk_alice", "bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.UserID != bob || f.Status != friend.StatusPending || f.Direction != friend.DirectionOutgoing {
+			t.Fatalf("request #%d = %+v, want pending outgoing to bob", i+1, f)
+		}
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM email_outbox WHERE user_id = $1`, bob); n != 1 {
+		t.Errorf("bob got %d emails, want 1", n)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM notifications WHERE user_id = $1`, bob); n != 1 {
+		t.Errorf("bob got %d notifications, want 1", n)
+	}
+	pending, err := s.List(ctx, "clerk_bob", friend.StatusPending)
+	if err != nil || len(pending) != 1 || pending[0].Direction != friend.DirectionIncoming {
+		t.Fatalf("bob's pending requests = %v, %v; want alice's incoming", pending, err)
+	}
+
+	// Only the recipient can accept
+	if _, err := s.Accept(ctx, "clerk_alice", bob); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Errorf("accepting your own request: %v, want ErrFriendRequestNotFound", err)
+	}
+	if _, err := s.Accept(ctx, "clerk_carol", alice); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Errorf("accepting someone else's request: %v, want ErrFriendRequestNotFound", err)
+	}
+	f, err := s.Accept(ctx, "clerk_bob", alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.UserID != alice || f.Status != friend.StatusAccepted {
+		t.Errorf("accepted = %+v, want alice accepted", f)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM notifications WHERE user_id = $1`, alice); n != 1 {
+		t.Errorf("alice got %d notifications, want 1 for the acceptance", n)
+	}
+	if _, err := s.Accept(ctx, "clerk_bob", alice); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Errorf("accepting twice: %v, want ErrFriendRequestNotFound", err)
+	}
+	if _, err := s.Request(ctx, "clerk_alice", "bob"); !errors.Is(err, ErrAlreadyFriends) {
+		t.Errorf("asking a friend: %v, want ErrAlreadyFriends", err)
+	}
+
+	if err := s.Remove(ctx, "clerk_carol", alice); !errors.Is(err, ErrFriendshipNotFound) {
+		t.Errorf("a stranger removing: %v, want ErrFriendshipNotFound", err)
+	}
+	if err := s.Remove(ctx, "clerk_bob", alice); err != nil {
+		t.Fatal(err)
+	}
+	if friends, err := s.List(ctx, "clerk_alice", friend.StatusAccepted); err != nil || len(friends) != 0 {
+		t.Errorf("alice's friends after removal = %v, %v; want none", friends, err)
+	}
+}
+
+// Asking someone who already asked you accepts their request, leaving one
+// friendship rather than two crossing requests.
+func TestCrossingFriendRequests(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := newTestFriendService(db)
+	alice := dbtest.User(t, db, "alice")
+	dbtest.User(t, db, "bob")
+
+	if _, err := s.Request(ctx, "clerk_alice", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := s.Request(ctx, "clerk_bob", "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.UserID != alice || f.Status != friend.StatusAccepted {
+		t.Errorf("reverse request = %+v, want accepted friendship with alice", f)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM friendships`); n != 1 {
+		t.Errorf("%d friendships, want 1", n)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM email_outbox WHERE user_id = $1`, alice); n != 0 {
+		t.Errorf("alice got %d friend request emails, want none", n)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM notifications WHERE user_id = $1`, alice); n != 1 {
+		t.Errorf("alice got %d notifications, want 1 for the acceptance", n)
+	}
+}
+
+// Declining removes the request; the sender may ask again.
+func TestDeclineFriendRequest(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := newTestFriendService(db)
+	alice := dbtest.User(t, db, "alice")
+	bob := dbtest.User(t, db, "bob")
+
+	if _, err := s.Request(ctx, "clerk_alice", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(ctx, "clerk_bob", alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Accept(ctx, "clerk_bob", alice); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Errorf("accepting a declined request: %v, want ErrFriendRequestNotFound", err)
+	}
+	if err := s.Remove(ctx, "clerk_bob", alice); !errors.Is(err, ErrFriendshipNotFound) {
+		t.Errorf("declining twice: %v, want ErrFriendshipNotFound", err)
+	}
+
+	f, err := s.Request(ctx, "clerk_alice", "bob")
+	if err != nil || f.Status != friend.StatusPending {
+		t.Fatalf("asking again = %+v, %v; want a pending request", f, err)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM email_outbox WHERE user_id = $1`, bob); n != 2 {
+		t.Errorf("bob got %d emails, want 2", n)
+	}
+}
+
+// Blocked users can't find each other to send requests or use each other's
+// invitations, and a block withdraws pending requests.
+func TestFriendRequestsAndBlocks(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := newTestFriendService(db)
+	blocks := NewPrivacyService(db)
+	dbtest.User(t, db, "alice")
+	bob := dbtest.User(t, db, "bob")
+	carol := dbtest.User(t, db, "carol")
+
+	if _, err := s.Request(ctx, "clerk_carol", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := blocks.Block(ctx, "clerk_bob", carol); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := s.List(ctx, "clerk_bob", friend.StatusPending); err != nil || len(pending) != 0 {
+		t.Errorf("bob's pending requests after blocking = %v, %v; want none", pending, err)
+	}
+	if _, err := s.Accept(ctx, "clerk_bob", carol); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Errorf("accepting a blocked user's request: %v, want ErrFriendRequestNotFound", err)
+	}
+	for _, recipient := range []string{"bob", "bob@example.com"} {
+		if _, err := s.Request(ctx, "clerk_carol", recipient); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("the blocked user asking %s: %v, want ErrUserNotFound", recipient, err)
+		}
+	}
+	if _, err := s.Request(ctx, "clerk_bob", "carol"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("the blocker asking: %v, want ErrUserNotFound", err)
+	}
+
+	inv, err := s.Invite(ctx, "clerk_carol", "newcomer@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := s.signer.Sign(inv.ID, time.Now().Add(time.Hour))
+	if _, err := s.AcceptInvite(ctx, "clerk_bob", token); !errors.Is(err, ErrInviteNotFound) {
+		t.Errorf("the blocker accepting an invite: %v, want ErrInviteNotFound", err)
+	}
+	f, err := s.AcceptInvite(ctx, "clerk_alice", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.UserID != carol || f.Status != friend.StatusAccepted {
+		t.Errorf("accepting the invite = %+v, want friends with carol", f)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM friendships WHERE $1 IN (user_id, friend_id)`, bob); n != 0 {
+		t.Errorf("bob has %d friendships, want none", n)
+	}
+}
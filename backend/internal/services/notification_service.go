@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/types/notification"
+)
+
+// notificationRetention is how long notifications stay in the inbox, read
+// or not.
+const notificationRetention = 90 * 24 * time.Hour
+
+// NotificationService keeps users' in-app inboxes. Other services produce
+// notifications through Notify.
+type NotificationService struct {
+	db     *pgxpool.Pool
+	events *events.Broker
+}
+
+func NewNotificationService(db *pgxpool.Pool, broker *events.Broker) *NotificationService {
+	return &NotificationService{
+		db:     db,
+		events: broker,
+	}
+}
+
+// Notify adds a notification to the user's inbox and pushes it to their open
+// event streams. Producers call it once the change it describes is committed.
+func (s *NotificationService) Notify(ctx context.Context, userID uuid.UUID, d *notification.Draft) error {
+	data := []byte("{}")
+	if d.Data != nil {
+		var err error
+		if data, err = json.Marshal(d.Data); err != nil {
+			return fmt.Errorf("failed to encode notification data: %w", err)
+		}
+	}
+
+	n, err := scanNotification(s.db.QueryRow(ctx, `
+	INSERT INTO notifications (id, user_id, type, title, body, data)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, type, title, body, data, read_at, created_at
+	`, uuid.New(), userID, d.Type, d.Title, d.Body, data))
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	s.events.Publish(userID, events.TypeNotification, n)
+	return nil
+}
+
+// List returns a page of the user's inbox, newest first, starting after the
+// notification cursor names. unreadOnly leaves out read notifications.
+func (s *NotificationService) List(ctx context.Context, clerkID string, cursor *uuid.UUID, limit int, unreadOnly bool) (*notification.Page, error) {
+	var userID uuid.UUID
+	err := s.db.QueryRow(ctx, `SELECT id FROM users WHERE clerk_id = $1`, clerkID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	page := &notification.Page{Notifications: []*notification.Notification{}}
+	if err := s.db.QueryRow(ctx, `
+	SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL
+	`, userID).Scan(&page.UnreadCount); err != nil {
+		return nil, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	// One extra row tells whether there is a next page
+	rows, err := s.db.Query(ctx, `
+	SELECT n.id, n.type, n.title, n.body, n.data, n.read_at, n.created_at
+	FROM notifications n
+	WHERE n.user_id = $1
+	AND ($2::uuid IS NULL OR (n.created_at, n.id) < (
+		SELECT c.created_at, c.id FROM notifications c WHERE c.id = $2 AND c.user_id = $1
+	))
+	AND (NOT $3::boolean OR n.read_at IS NULL)
+	ORDER BY n.created_at DESC, n.id DESC
+	LIMIT $4
+	`, userID, cursor, unreadOnly, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		page.Notifications = append(page.Notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Notifications) > limit {
+		page.Notifications = page.Notifications[:limit]
+		page.NextCursor = page.Notifications[limit-1].ID.String()
+	}
+	return page, nil
+}
+
+// MarkRead marks one of the user's notifications as read and returns the
+// number still unread.
+func (s *NotificationService) MarkRead(ctx context.Context, clerkID string, id uuid.UUID) (int, error) {
+	var userID uuid.UUID
+	err := s.db.QueryRow(ctx, `
+	UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+	WHERE id = $1 AND user_id = (SELECT id FROM users WHERE clerk_id = $2)
+	RETURNING user_id
+	`, id, clerkID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotificationNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notification read: %w", err)
+	}
+
+	return s.unreadChanged(ctx, userID)
+}
+
+// MarkAllRead marks every notification of the user as read.
+func (s *NotificationService) MarkAllRead(ctx context.Context, clerkID string) (int, error) {
+	var userID uuid.UUID
+	err := s.db.QueryRow(ctx, `SELECT id FROM users WHERE clerk_id = $1`, clerkID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrUserNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	if _, err := s.db.Exec(ctx, `
+	UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL
+	`, userID); err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+
+	return s.unreadChanged(ctx, userID)
+}
+
+// unreadChanged tells the user's other tabs the new unread count.
+func (s *NotificationService) unreadChanged(ctx context.Context, userID uuid.UUID) (int, error) {
+	var unread int
+	if err := s.db.QueryRow(ctx, `
+	SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL
+	`, userID).Scan(&unread); err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	s.events.Publish(userID, events.TypeNotificationsRead, notification.UnreadCount{UnreadCount: unread})
+	return unread, nil
+}
+
+// GetPreferences returns the user's email preferences; users who never set
+// them get every email.
+func (s *NotificationService) GetPreferences(ctx context.Context, clerkID string) (*notification.Preferences, error) {
+	var p notification.Preferences
+	err := s.db.QueryRow(ctx, `
+	SELECT COALESCE(p.email_shares, TRUE), COALESCE(p.email_friend_requests, TRUE), COALESCE(p.email_device_alerts, TRUE)
+	FROM users u
+	LEFT JOIN notification_preferences p ON p.user_id = u.id
+	WHERE u.clerk_id = $1
+	`, clerkID).Scan(&p.EmailShares, &p.EmailFriendRequests, &p.EmailDeviceAlerts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	return &p, nil
+}
+
+func (s *NotificationService) UpdatePreferences(ctx context.Context, clerkID string, p *notification.Preferences) (*notification.Preferences, error) {
+	err := s.db.QueryRow(ctx, `
+	INSERT INTO notification_preferences (user_id, email_shares, email_friend_requests, email_device_alerts)
+	SELECT id, $2, $3, $4 FROM users WHERE clerk_id = $1
+	ON CONFLICT (user_id) DO UPDATE SET
+		email_shares = EXCLUDED.email_shares,
+		email_friend_requests = EXCLUDED.email_friend_requests,
+		email_device_alerts = EXCLUDED.email_device_alerts,
+		updated_at = NOW()
+	RETURNING email_shares, email_friend_requests, email_device_alerts
+	`, clerkID, p.EmailShares, p.EmailFriendRequests, p.EmailDeviceAlerts).Scan(&p.EmailShares, &p.EmailFriendRequests, &p.EmailDeviceAlerts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update notification preferences: %w", err)
+	}
+	return p, nil
+}
+
+// Run deletes notifications past their retention until ctx is cancelled.
+func (s *NotificationService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.db.Exec(ctx, `
+			DELETE FROM notifications WHERE created_at < NOW() - make_interval(secs => $1)
+			`, notificationRetention.Seconds()); err != nil && ctx.Err() == nil {
+				log.Printf("Notification sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+func scanNotification(row pgx.Row) (*notification.Notification, error) {
+	var n notification.Notification
+	err := row.Scan(&n.ID, &n.Type, &n.Title, &n.Body, &n.Data, &n.ReadAt, &n.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
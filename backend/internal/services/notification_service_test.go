@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/types/notification"
+)
+
+// Pages follow each other without gaps or repeats, and only the owner can
+// mark a notification read.
+func TestNotificationInbox(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	broker := events.New()
+	s := NewNotificationService(db, broker)
+	alice := dbtest.User(t, db, "alice")
+	bob := dbtest.User(t, db, "bob")
+
+	for i := 0; i < 5; i++ {
+		if err := s.Notify(ctx, alice, &notification.Draft{Type: notification.TypeShareReceived, Title: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Notify(ctx, bob, &notification.Draft{Type: notification.TypeShareReceived, Title: "bob's"}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[uuid.UUID]bool{}
+	var cursor *uuid.UUID
+	for _, want := range []int{2, 2, 1} {
+		page, err := s.List(ctx, "clerk_alice", cursor, 2, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Notifications) != want || page.UnreadCount != 5 {
+			t.Fatalf("page of %d with %d unread, want %d with 5", len(page.Notifications), page.UnreadCount, want)
+		}
+		for _, n := range page.Notifications {
+			if seen[n.ID] {
+				t.Fatalf("%s listed twice", n.ID)
+			}
+			seen[n.ID] = true
+		}
+		if page.NextCursor == "" {
+			cursor = nil
+			break
+		}
+		next := uuid.MustParse(page.NextCursor)
+		cursor = &next
+	}
+	if len(seen) != 5 || cursor != nil {
+		t.Fatalf("listed %d notifications, want all 5 and no further page", len(seen))
+	}
+
+	bobs, err := s.List(ctx, "clerk_bob", nil, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MarkRead(ctx, "clerk_alice", bobs.Notifications[0].ID); !errors.Is(err, ErrNotificationNotFound) {
+		t.Errorf("marking another user's notification: %v, want ErrNotificationNotFound", err)
+	}
+
+	_, stream, _, cancel := broker.Subscribe(alice, "")
+	defer cancel()
+
+	var first uuid.UUID
+	for id := range seen {
+		first = id
+		break
+	}
+	for i := 0; i < 2; i++ {
+		if unread, err := s.MarkRead(ctx, "clerk_alice", first); err != nil || unread != 4 {
+			t.Fatalf("MarkRead #%d = %d, %v; want 4 unread", i+1, unread, err)
+		}
+	}
+	if ev := <-stream; ev.Type != events.TypeNotificationsRead {
+		t.Errorf("event %s, want %s", ev.Type, events.TypeNotificationsRead)
+	}
+
+	unread, err := s.List(ctx, "clerk_alice", nil, 10, true)
+	if err != nil || len(unread.Notifications) != 4 {
+		t.Fatalf("unread only = %d, %v; want 4", len(unread.Notifications), err)
+	}
+	if n, err := s.MarkAllRead(ctx, "clerk_alice"); err != nil || n != 0 {
+		t.Errorf("MarkAllRead = %d, %v; want 0 unread", n, err)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, bob); n != 1 {
+		t.Errorf("bob has %d unread, want theirs untouched", n)
+	}
+}
+
+// Users without saved preferences get every email; saving twice updates the
+// same row.
+func TestNotificationPreferences(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := NewNotificationService(db, events.New())
+	alice := dbtest.User(t, db, "alice")
+
+	if _, err := s.GetPreferences(ctx, "clerk_nobody"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unknown user: %v, want ErrUserNotFound", err)
+	}
+	got, err := s.GetPreferences(ctx, "clerk_alice")
+	if err != nil || *got != (notification.Preferences{EmailShares: true, EmailFriendRequests: true, EmailDeviceAlerts: true}) {
+		t.Fatalf("defaults = %+v, %v; want every email", got, err)
+	}
+
+	updates := []notification.Preferences{
+		{EmailShares: false, EmailFriendRequests: true, EmailDeviceAlerts: true},
+		{EmailShares: true, EmailFriendRequests: false, EmailDeviceAlerts: false},
+	}
+	for _, want := range updates {
+		p := want
+		if _, err := s.UpdatePreferences(ctx, "clerk_alice", &p); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.GetPreferences(ctx, "clerk_alice")
+		if err != nil || *got != want {
+			t.Errorf("after saving %+v got %+v, %v", want, got, err)
+		}
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM notification_preferences WHERE user_id = $1`, alice); n != 1 {
+		t.Errorf("%d preference rows, want 1", n)
+	}
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/types/order"
+)
+
+const orderColumns = `id, email, status, shipping_status, carrier, tracking_number, shipped_at, delivered_at,
+	amount_total, amount_refunded, currency, created_at, updated_at`
+
+type OrderService struct {
+	db *pgxpool.Pool
+}
+
+func NewOrderService(db *pgxpool.Pool) *OrderService {
+	return &OrderService{
+		db: db,
+	}
+}
+
+// ListOrders returns the user's hardware orders, newest first.
+func (s *OrderService) ListOrders(ctx context.Context, clerkID string) ([]*order.Order, error) {
+	rows, err := s.db.Query(ctx, `
+	SELECT `+orderColumns+` FROM orders
+	WHERE user_id = (SELECT id FROM users WHERE clerk_id = $1)
+	ORDER BY created_at DESC
+	`, clerkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []*order.Order{}
+	byID := map[uuid.UUID]*order.Order{}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, o)
+		byID[o.ID] = o
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadItems(ctx, byID); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// ClaimGuestOrders gives a new user the guest checkouts made with their
+// email, so they show up in ListOrders and their units can be paired. Only a
+// verified address proves the orders are theirs. Claiming again is a no-op,
+// so webhooks can be retried.
+func (s *OrderService) ClaimGuestOrders(ctx context.Context, userID uuid.UUID, email string, verified bool) (int64, error) {
+	if !verified || email == "" {
+		return 0, nil
+	}
+	result, err := s.db.Exec(ctx, `
+	UPDATE orders SET user_id = $1, updated_at = NOW()
+	WHERE user_id IS NULL AND LOWER(email) = LOWER($2)
+	`, userID, email)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim guest orders: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// GetOrder returns one of the user's orders.
+func (s *OrderService) GetOrder(ctx context.Context, clerkID string, id uuid.UUID) (*order.Order, error) {
+	return s.get(ctx, `
+	SELECT `+orderColumns+` FROM orders
+	WHERE id = $1 AND user_id = (SELECT id FROM users WHERE clerk_id = $2)
+	`, id, clerkID)
+}
+
+func (s *OrderService) get(ctx context.Context, query string, args ...any) (*order.Order, error) {
+	o, err := scanOrder(s.db.QueryRow(ctx, query, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if err := s.loadItems(ctx, map[uuid.UUID]*order.Order{o.ID: o}); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// loadItems attaches items and their units to the given orders.
+func (s *OrderService) loadItems(ctx context.Context, orders map[uuid.UUID]*order.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(orders))
+	for id, o := range orders {
+		o.Items = []*order.Item{}
+		ids = append(ids, id)
+	}
+
+	rows, err := s.db.Query(ctx, `
+	SELECT i.order_id, i.id, i.sku, i.name, i.quantity, i.unit_amount, u.serial, u.device_id, u.paired_at
+	FROM order_items i
+	LEFT JOIN order_units u ON u.item_id = i.id
+	WHERE i.order_id = ANY($1)
+	ORDER BY i.id, u.created_at
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to query order items: %w", err)
+	}
+	defer rows.Close()
+
+	items := map[int64]*order.Item{}
+	for rows.Next() {
+		var (
+			orderID  uuid.UUID
+			item     order.Item
+			serial   *string
+			deviceID *string
+			unit     order.Unit
+		)
+		if err := rows.Scan(&orderID, &item.ID, &item.SKU, &item.Name, &item.Quantity, &item.UnitAmount, &serial, &deviceID, &unit.PairedAt); err != nil {
+			return fmt.Errorf("failed to scan order item: %w", err)
+		}
+
+		existing, ok := items[item.ID]
+		if !ok {
+			item.Units = []*order.Unit{}
+			existing = &item
+			items[item.ID] = existing
+			orders[orderID].Items = append(orders[orderID].Items, existing)
+		}
+		if serial != nil {
+			unit.Serial = *serial
+			unit.DeviceID = deviceID
+			existing.Units = append(existing.Units, &unit)
+		}
+	}
+	return rows.Err()
+}
+
+// UpdateShipping records fulfilment progress. Reaching shipped or delivered
+// stamps the matching time once.
+func (s *OrderService) UpdateShipping(ctx context.Context, id uuid.UUID, req *order.UpdateShippingRequest) (*order.Order, error) {
+	result, err := s.db.Exec(ctx, `
+	UPDATE orders
+	SET shipping_status = $2,
+		carrier = COALESCE(NULLIF($3, ''), carrier),
+		tracking_number = COALESCE(NULLIF($4, ''), tracking_number),
+		shipped_at = CASE WHEN $2 IN ('shipped', 'delivered') THEN COALESCE(shipped_at, NOW()) ELSE shipped_at END,
+		delivered_at = CASE WHEN $2 = 'delivered' THEN COALESCE(delivered_at, NOW()) ELSE delivered_at END,
+		updated_at = NOW()
+	WHERE id = $1
+	`, id, req.Status, req.Carrier, req.TrackingNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update shipping: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return nil, ErrOrderNotFound
+	}
+
+	return s.get(ctx, `SELECT `+orderColumns+` FROM orders WHERE id = $1`, id)
+}
+
+// AssignUnits records the serial numbers shipped for an order item. An item
+// can't get more units than its quantity, and a serial belongs to one unit.
+func (s *OrderService) AssignUnits(ctx context.Context, id uuid.UUID, req *order.AssignUnitsRequest) (*order.Order, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var quantity, assigned int
+	err = tx.QueryRow(ctx, `
+	SELECT i.quantity, (SELECT COUNT(*) FROM order_units u WHERE u.item_id = i.id)
+	FROM order_items i
+	WHERE i.id = $1 AND i.order_id = $2
+	FOR UPDATE
+	`, req.ItemID, id).Scan(&quantity, &assigned)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order item: %w", err)
+	}
+	if assigned+len(req.Serials) > quantity {
+		return nil, ErrTooManyUnits
+	}
+
+	for _, serial := range req.Serials {
+		_, err := tx.Exec(ctx, `
+		INSERT INTO order_units (serial, order_id, item_id) VALUES ($1, $2, $3)
+		`, strings.TrimSpace(serial), id, req.ItemID)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("%w: %s", ErrSerialAssigned, serial)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to assign unit: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, `SELECT `+orderColumns+` FROM orders WHERE id = $1`, id)
+}
+
+// PairableDevices lists devices waiting for a pairing code whose serial is a
+// unit the user bought and hasn't paired yet.
+func (s *OrderService) PairableDevices(ctx context.Context, clerkID string) ([]*order.PairableDevice, error) {
+	rows, err := s.db.Query(ctx, pairableQuery+`
+	ORDER BY requested_at DESC
+	`, clerkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pairable devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []*order.PairableDevice{}
+	for rows.Next() {
+		d := &order.PairableDevice{}
+		if err := rows.Scan(&d.DeviceID, &d.Serial, &d.OrderID, &d.ProductName, &d.RequestedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pairable device: %w", err)
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// pairableQuery selects unpaired devices with a live pairing code whose serial
+// matches an unpaired unit of a paid order of user $1 (a Clerk ID). Serials
+// are unique per unit and a device has one live code, so rows don't repeat.
+const pairableQuery = `
+SELECT d.id AS device_id, d.serial, o.id AS order_id, COALESCE(NULLIF(i.name, ''), i.sku) AS product_name, p.created_at AS requested_at
+FROM devices d
+JOIN device_pairings p ON p.device_id = d.id AND p.status = 'pending' AND p.expires_at > NOW()
+JOIN order_units u ON u.serial = d.serial AND u.device_id IS NULL
+JOIN order_items i ON i.id = u.item_id
+JOIN orders o ON o.id = u.order_id AND o.status IN ('paid', 'partially_refunded')
+WHERE d.owner_id IS NULL AND d.serial <> ''
+AND o.user_id = (SELECT id FROM users WHERE clerk_id = $1)
+`
+
+func scanOrder(row pgx.Row) (*order.Order, error) {
+	o := &order.Order{}
+	err := row.Scan(
+		&o.ID,
+		&o.Email,
+		&o.Status,
+		&o.ShippingStatus,
+		&o.Carrier,
+		&o.TrackingNumber,
+		&o.ShippedAt,
+		&o.DeliveredAt,
+		&o.AmountTotal,
+		&o.AmountRefunded,
+		&o.Currency,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
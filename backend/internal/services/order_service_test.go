@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/payments"
+	"github.com/strct-org/portal/backend/internal/types/order"
+)
+
+func guestCheckout(id, email string) *payments.Event {
+	return &payments.Event{
+		ID:      "evt_" + id,
+		Type:    payments.CheckoutCompleted,
+		Created: time.Now(),
+		Checkout: &payments.Checkout{
+			SessionID:   "cs_" + id,
+			Mode:        payments.ModePayment,
+			Email:       email,
+			AmountTotal: 19900,
+			Currency:    "eur",
+			LineItems:   []payments.LineItem{{SKU: "beestation", Name: "BeeStation", Quantity: 1, UnitAmount: 19900}},
+		},
+	}
+}
+
+// A guest buyer who signs up later sees their orders and is offered the
+// devices from them for pairing.
+func TestClaimGuestOrders(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	paymentService := NewPaymentService(db)
+	orderService := NewOrderService(db)
+
+	for _, ev := range []*payments.Event{guestCheckout("1", "Buyer@Example.com"), guestCheckout("2", "someone@example.com")} {
+		if err := paymentService.CheckoutCompleted(ctx, "fake", ev); err != nil {
+			t.Fatalf("CheckoutCompleted: %v", err)
+		}
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM orders WHERE user_id IS NULL`); n != 2 {
+		t.Fatalf("%d guest orders, want 2", n)
+	}
+
+	buyer := dbtest.User(t, db, "buyer")
+	if n, err := orderService.ClaimGuestOrders(ctx, buyer, "buyer@example.com", false); err != nil || n != 0 {
+		t.Fatalf("ClaimGuestOrders with an unverified email = %d, %v; want nothing claimed", n, err)
+	}
+	if n, err := orderService.ClaimGuestOrders(ctx, buyer, "buyer@example.com", true); err != nil || n != 1 {
+		t.Fatalf("ClaimGuestOrders = %d, %v; want 1", n, err)
+	}
+	if n, err := orderService.ClaimGuestOrders(ctx, buyer, "buyer@example.com", true); err != nil || n != 0 {
+		t.Fatalf("ClaimGuestOrders again = %d, %v; want 0", n, err)
+	}
+
+	orders, err := orderService.ListOrders(ctx, "clerk_buyer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || orders[0].Email != "Buyer@Example.com" {
+		t.Fatalf("ListOrders = %+v, want the guest order", orders)
+	}
+
+	// The shipped unit's device shows up for pre-association
+	var itemID int64
+	if err := db.QueryRow(ctx, `SELECT id FROM order_items WHERE order_id = $1`, orders[0].ID).Scan(&itemID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orderService.AssignUnits(ctx, orders[0].ID, &order.AssignUnitsRequest{ItemID: itemID, Serials: []string{"SN-1"}}); err != nil {
+		t.Fatalf("AssignUnits: %v", err)
+	}
+	dbtest.Device(t, db, "dev-1", uuid.Nil)
+	dbtest.Exec(t, db, `UPDATE devices SET serial = 'SN-1' WHERE id = 'dev-1'`)
+	dbtest.Exec(t, db, `
+	INSERT INTO device_pairings (id, device_id, code_hash, token_hash, expires_at)
+	VALUES ($1, 'dev-1', 'code', 'token', NOW() + INTERVAL '10 minutes')
+	`, uuid.New())
+
+	pairable, err := orderService.PairableDevices(ctx, "clerk_buyer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairable) != 1 || pairable[0].DeviceID != "dev-1" || pairable[0].OrderID != orders[0].ID {
+		t.Fatalf("PairableDevices = %+v, want dev-1 from the claimed order", pairable)
+	}
+	if other, _ := orderService.PairableDevices(ctx, "clerk_someone"); len(other) != 0 {
+		t.Errorf("another user is offered %+v", other)
+	}
+}
+
+// Guest checkouts only attach to an existing account whose email is verified.
+func TestGuestCheckoutMatchesVerifiedEmail(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	paymentService := NewPaymentService(db)
+
+	verified := dbtest.User(t, db, "verified")
+	unverified := dbtest.User(t, db, "unverified")
+	dbtest.Exec(t, db, `UPDATE users SET email_verified = FALSE WHERE id = $1`, unverified)
+
+	for _, ev := range []*payments.Event{guestCheckout("1", "VERIFIED@example.com"), guestCheckout("2", "unverified@example.com")} {
+		if err := paymentService.CheckoutCompleted(ctx, "fake", ev); err != nil {
+			t.Fatalf("CheckoutCompleted: %v", err)
+		}
+	}
+
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM orders WHERE user_id = $1`, verified); n != 1 {
+		t.Errorf("verified buyer has %d orders, want 1", n)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM orders WHERE user_id = $1`, unverified); n != 0 {
+		t.Errorf("unverified account got %d orders, want 0", n)
+	}
+}
+
+// Orders are only visible to their buyer, shipping times are stamped once, and
+// each serial ships as one unit of an item, up to its quantity.
+func TestOrderFulfilment(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	paymentService := NewPaymentService(db)
+	s := NewOrderService(db)
+	dbtest.User(t, db, "buyer")
+	dbtest.User(t, db, "other")
+
+	for _, id := range []string{"1", "2"} {
+		ev := guestCheckout(id, "buyer@example.com")
+		ev.Checkout.ClerkID = "clerk_buyer"
+		if err := paymentService.CheckoutCompleted(ctx, "fake", ev); err != nil {
+			t.Fatalf("CheckoutCompleted: %v", err)
+		}
+	}
+	orders, err := s.ListOrders(ctx, "clerk_buyer")
+	if err != nil || len(orders) != 2 {
+		t.Fatalf("ListOrders = %d orders, %v; want 2", len(orders), err)
+	}
+	first, second := orders[0], orders[1]
+
+	if _, err := s.GetOrder(ctx, "clerk_other", first.ID); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("another user's order: %v, want ErrOrderNotFound", err)
+	}
+
+	shipped, err := s.UpdateShipping(ctx, first.ID, &order.UpdateShippingRequest{Status: order.ShippingShipped, Carrier: "DHL", TrackingNumber: "JD1"})
+	if err != nil || shipped.ShippedAt == nil || shipped.DeliveredAt != nil {
+		t.Fatalf("shipping = %+v, %v; want shipped_at set", shipped, err)
+	}
+	delivered, err := s.UpdateShipping(ctx, first.ID, &order.UpdateShippingRequest{Status: order.ShippingDelivered})
+	if err != nil || delivered.DeliveredAt == nil || !delivered.ShippedAt.Equal(*shipped.ShippedAt) || delivered.Carrier != "DHL" {
+		t.Fatalf("delivery = %+v, %v; want delivered_at set and the shipment kept", delivered, err)
+	}
+
+	itemID := func(o *order.Order) int64 {
+		full, err := s.GetOrder(ctx, "clerk_buyer", o.ID)
+		if err != nil || len(full.Items) != 1 {
+			t.Fatalf("GetOrder = %+v, %v; want one item", full, err)
+		}
+		return full.Items[0].ID
+	}
+	firstItem, secondItem := itemID(first), itemID(second)
+
+	tests := []struct {
+		name    string
+		orderID uuid.UUID
+		itemID  int64
+		serials []string
+		wantErr error
+	}{
+		{"another order's item", second.ID, firstItem, []string{"SN-1"}, ErrOrderNotFound},
+		{"more than the quantity", first.ID, firstItem, []string{"SN-1", "SN-2"}, ErrTooManyUnits},
+		{"one unit", first.ID, firstItem, []string{"SN-1"}, nil},
+		{"a full item", first.ID, firstItem, []string{"SN-2"}, ErrTooManyUnits},
+		{"a serial already shipped", second.ID, secondItem, []string{"SN-1"}, ErrSerialAssigned},
+	}
+	for _, tt := range tests {
+		_, err := s.AssignUnits(ctx, tt.orderID, &order.AssignUnitsRequest{ItemID: tt.itemID, Serials: tt.serials})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM order_units`); n != 1 {
+		t.Errorf("%d units recorded, want 1", n)
+	}
+}
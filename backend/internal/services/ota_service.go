@@ -0,0 +1,530 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/ota"
+	"github.com/strct-org/portal/backend/internal/types/notification"
+	otatypes "github.com/strct-org/portal/backend/internal/types/ota"
+	"github.com/strct-org/portal/backend/internal/types/release"
+)
+
+const (
+	defaultFailureThreshold = 0.2
+	defaultMinReports       = 10
+)
+
+const (
+	otaSweepInterval = 10 * time.Minute
+	// Offers the device neither started nor checked for again in this time
+	// expire, and are renewed when it next checks
+	otaPendingTimeout = 24 * time.Hour
+	// Updates that started but never finished count as failed
+	otaInstallTimeout = 24 * time.Hour
+)
+
+const rolloutSelect = `
+SELECT ro.id, ro.release_id, rel.product, rel.platform, rel.version, ro.percentage, ro.cohort, ro.status,
+	ro.failure_threshold, ro.min_reports, ro.halted_reason, ro.created_at, ro.updated_at,
+	COUNT(du.device_id) FILTER (WHERE du.state = 'pending'),
+	COUNT(du.device_id) FILTER (WHERE du.state = 'downloading'),
+	COUNT(du.device_id) FILTER (WHERE du.state = 'installed'),
+	COUNT(du.device_id) FILTER (WHERE du.state = 'failed'),
+	COUNT(du.device_id) FILTER (WHERE du.state = 'expired')
+FROM rollouts ro
+JOIN releases rel ON rel.id = ro.release_id
+LEFT JOIN device_updates du ON du.rollout_id = ro.id
+`
+
+// OTAService decides which release each device should run and tracks
+// rollouts as devices report progress.
+type OTAService struct {
+	db            *pgxpool.Pool
+	releases      *ReleaseService
+	notifications *NotificationService
+	signer        *ota.Signer
+}
+
+// NewOTAService refuses update checks with ErrUpdatesDisabled when signer is
+// nil, since devices reject unsigned manifests.
+func NewOTAService(db *pgxpool.Pool, releases *ReleaseService, notifications *NotificationService, signer *ota.Signer) *OTAService {
+	return &OTAService{
+		db:            db,
+		releases:      releases,
+		notifications: notifications,
+		signer:        signer,
+	}
+}
+
+// CheckForUpdate records the running version and returns a signed manifest of
+// the newest release the device is eligible for, if it is newer. Releases
+// are chosen by the product and platform on record for the device; the ones
+// it reports are only recorded when there are none yet, for devices paired
+// before they were reported, so a device can't ask for another product's.
+func (s *OTAService) CheckForUpdate(ctx context.Context, deviceID, product, platform, version string) (*otatypes.UpdateCheck, error) {
+	if s.signer == nil {
+		return nil, ErrUpdatesDisabled
+	}
+
+	var (
+		cohort     string
+		ownerID    *uuid.UUID
+		deviceName string
+	)
+	err := s.db.QueryRow(ctx, `
+	UPDATE devices SET version = COALESCE(NULLIF($2, ''), version),
+		product = CASE WHEN product = '' THEN $3 ELSE product END,
+		platform = CASE WHEN platform = '' THEN $4 ELSE platform END,
+		updated_at = NOW()
+	WHERE id = $1
+	RETURNING version, product, platform, cohort, owner_id, friendly_name
+	`, deviceID, version, product, platform).Scan(&version, &product, &platform, &cohort, &ownerID, &deviceName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record device version: %w", err)
+	}
+	if product == "" || platform == "" {
+		return &otatypes.UpdateCheck{}, nil
+	}
+
+	// Rollouts the device already failed aren't offered again; a fixed
+	// release gets a new rollout
+	rows, err := s.db.Query(ctx, `
+	SELECT ro.id, ro.percentage, rel.product, rel.version, rel.platform,
+		rel.filename, rel.size, rel.sha256, rel.signature, rel.notes, rel.path
+	FROM rollouts ro
+	JOIN releases rel ON rel.id = ro.release_id
+	WHERE ro.status = 'active' AND rel.product = $1 AND rel.platform = $2
+	AND (ro.cohort = '' OR ro.cohort = $3)
+	AND NOT EXISTS (
+		SELECT 1 FROM device_updates du
+		WHERE du.rollout_id = ro.id AND du.device_id = $4 AND du.state = 'failed'
+	)
+	`, product, platform, cohort, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollouts: %w", err)
+	}
+	defer rows.Close()
+
+	var best *otatypes.Manifest
+	for rows.Next() {
+		var (
+			rolloutID  uuid.UUID
+			percentage int
+			rel        release.Release
+		)
+		if err := rows.Scan(&rolloutID, &percentage, &rel.Product, &rel.Version, &rel.Platform,
+			&rel.Filename, &rel.Size, &rel.SHA256, &rel.Signature, &rel.Notes, &rel.Path); err != nil {
+			return nil, fmt.Errorf("failed to scan rollout: %w", err)
+		}
+		if rolloutBucket(rolloutID, deviceID) >= percentage {
+			continue
+		}
+		if compareVersions(rel.Version, version) <= 0 {
+			continue
+		}
+		if best != nil && compareVersions(rel.Version, best.Version) <= 0 {
+			continue
+		}
+
+		s.releases.fillDownloadURL(&rel)
+		best = &otatypes.Manifest{
+			RolloutID:         rolloutID,
+			DeviceID:          deviceID,
+			Product:           rel.Product,
+			Platform:          rel.Platform,
+			Version:           rel.Version,
+			URL:               rel.DownloadURL,
+			Size:              rel.Size,
+			SHA256:            rel.SHA256,
+			ArtifactSignature: rel.Signature,
+			Notes:             rel.Notes,
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if best == nil {
+		return &otatypes.UpdateCheck{}, nil
+	}
+
+	// Checking again keeps the offer pending, or renews it once expired
+	var offered bool
+	err = s.db.QueryRow(ctx, `
+	INSERT INTO device_updates (device_id, rollout_id) VALUES ($1, $2)
+	ON CONFLICT (device_id, rollout_id) DO UPDATE SET state = 'pending', error = '', updated_at = NOW()
+	WHERE device_updates.state IN ('pending', 'expired')
+	RETURNING xmax = 0
+	`, deviceID, best.RolloutID).Scan(&offered)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to record pending update: %w", err)
+	}
+	// The owner hears about each update once, not on every check
+	if offered && ownerID != nil {
+		if deviceName == "" {
+			deviceName = deviceID
+		}
+		err := s.notifications.Notify(ctx, *ownerID, &notification.Draft{
+			Type:  notification.TypeUpdateAvailable,
+			Title: fmt.Sprintf("Update available for %s", deviceName),
+			Body:  fmt.Sprintf("Version %s is rolling out to this device.", best.Version),
+			Data:  map[string]any{"deviceId": deviceID, "version": best.Version},
+		})
+		if err != nil {
+			log.Printf("Error notifying owner of update for device %s: %v", deviceID, err)
+		}
+	}
+
+	best.IssuedAt = time.Now().UTC()
+	payload, err := json.Marshal(best)
+	if err != nil {
+		return nil, err
+	}
+	return &otatypes.UpdateCheck{
+		UpdateAvailable: true,
+		Manifest:        base64.StdEncoding.EncodeToString(payload),
+		Signature:       s.signer.Sign(payload),
+	}, nil
+}
+
+// ReportStatus moves the device through the rollout. Finished updates count
+// towards the failure rate, and the rollout halts once it crosses the
+// threshold.
+func (s *OTAService) ReportStatus(ctx context.Context, deviceID string, report *otatypes.StatusReport) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	ro, err := lockRollout(ctx, tx, report.RolloutID)
+	if err != nil {
+		return err
+	}
+
+	// Installed and failed are final; late reports don't undo them
+	result, err := tx.Exec(ctx, `
+	UPDATE device_updates SET state = $3, error = $4, updated_at = NOW()
+	WHERE device_id = $1 AND rollout_id = $2 AND state NOT IN ('installed', 'failed')
+	`, deviceID, report.RolloutID, report.State, report.Error)
+	if err != nil {
+		return fmt.Errorf("failed to record update state: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		var exists bool
+		if err := tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM device_updates WHERE device_id = $1 AND rollout_id = $2)
+		`, deviceID, report.RolloutID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to look up update: %w", err)
+		}
+		if !exists {
+			return ErrRolloutNotFound
+		}
+		return tx.Commit(ctx)
+	}
+
+	switch report.State {
+	case otatypes.StateInstalled:
+		if _, err := tx.Exec(ctx, `
+		UPDATE devices SET version = $2, updated_at = NOW() WHERE id = $1
+		`, deviceID, ro.version); err != nil {
+			return fmt.Errorf("failed to record device version: %w", err)
+		}
+
+	case otatypes.StateFailed:
+		if err := ro.haltIfFailing(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Run expires and times out updates devices stopped reporting on until ctx
+// is cancelled.
+func (s *OTAService) Run(ctx context.Context) {
+	ticker := time.NewTicker(otaSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.sweep(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Update sweep failed: %v", err)
+		}
+	}
+}
+
+// sweep expires stale offers and fails updates that never finished. The
+// failures count towards the rollout's threshold as if the devices had
+// reported them.
+func (s *OTAService) sweep(ctx context.Context) error {
+	if _, err := s.db.Exec(ctx, `
+	UPDATE device_updates SET state = 'expired', updated_at = NOW()
+	WHERE state = 'pending' AND updated_at < NOW() - make_interval(secs => $1)
+	`, otaPendingTimeout.Seconds()); err != nil {
+		return fmt.Errorf("failed to expire updates: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, `
+	SELECT DISTINCT rollout_id FROM device_updates
+	WHERE state = 'downloading' AND updated_at < NOW() - make_interval(secs => $1)
+	`, otaInstallTimeout.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to query stale updates: %w", err)
+	}
+	rolloutIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return fmt.Errorf("failed to scan stale updates: %w", err)
+	}
+
+	for _, id := range rolloutIDs {
+		if err := s.failStaleUpdates(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *OTAService) failStaleUpdates(ctx context.Context, rolloutID uuid.UUID) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	ro, err := lockRollout(ctx, tx, rolloutID)
+	if errors.Is(err, ErrRolloutNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(ctx, `
+	UPDATE device_updates SET state = 'failed', error = 'The device stopped reporting progress.', updated_at = NOW()
+	WHERE rollout_id = $1 AND state = 'downloading' AND updated_at < NOW() - make_interval(secs => $2)
+	`, rolloutID, otaInstallTimeout.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to time out updates: %w", err)
+	}
+	if result.RowsAffected() > 0 {
+		log.Printf("Timed out %d updates to %s in rollout %s", result.RowsAffected(), ro.version, rolloutID)
+		if err := ro.haltIfFailing(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// lockedRollout is a rollout locked for recording update results.
+type lockedRollout struct {
+	id         uuid.UUID
+	status     string
+	threshold  float64
+	minReports int
+	version    string
+}
+
+func lockRollout(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*lockedRollout, error) {
+	ro := &lockedRollout{id: id}
+	err := tx.QueryRow(ctx, `
+	SELECT ro.status, ro.failure_threshold, ro.min_reports, rel.version
+	FROM rollouts ro
+	JOIN releases rel ON rel.id = ro.release_id
+	WHERE ro.id = $1
+	FOR UPDATE OF ro
+	`, id).Scan(&ro.status, &ro.threshold, &ro.minReports, &ro.version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRolloutNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rollout: %w", err)
+	}
+	return ro, nil
+}
+
+// haltIfFailing halts an active rollout once enough updates have finished
+// and too many of them failed.
+func (ro *lockedRollout) haltIfFailing(ctx context.Context, tx pgx.Tx) error {
+	if ro.status != otatypes.RolloutActive {
+		return nil
+	}
+	var installed, failed int
+	if err := tx.QueryRow(ctx, `
+	SELECT COUNT(*) FILTER (WHERE state = 'installed'), COUNT(*) FILTER (WHERE state = 'failed')
+	FROM device_updates WHERE rollout_id = $1
+	`, ro.id).Scan(&installed, &failed); err != nil {
+		return fmt.Errorf("failed to count update results: %w", err)
+	}
+
+	finished := installed + failed
+	if finished < ro.minReports || float64(failed)/float64(finished) < ro.threshold {
+		return nil
+	}
+	reason := fmt.Sprintf("%d of %d updates failed (threshold %.0f%%)", failed, finished, ro.threshold*100)
+	if _, err := tx.Exec(ctx, `
+	UPDATE rollouts SET status = 'halted', halted_reason = $2, updated_at = NOW() WHERE id = $1
+	`, ro.id, reason); err != nil {
+		return fmt.Errorf("failed to halt rollout: %w", err)
+	}
+	log.Printf("WARNING: Halted rollout %s of %s: %s", ro.id, ro.version, reason)
+	return nil
+}
+
+// CreateRollout starts offering a release.
+func (s *OTAService) CreateRollout(ctx context.Context, req *otatypes.CreateRolloutRequest) (*otatypes.Rollout, error) {
+	if req.FailureThreshold == 0 {
+		req.FailureThreshold = defaultFailureThreshold
+	}
+	if req.MinReports == 0 {
+		req.MinReports = defaultMinReports
+	}
+
+	id := uuid.New()
+	_, err := s.db.Exec(ctx, `
+	INSERT INTO rollouts (id, release_id, percentage, cohort, failure_threshold, min_reports)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`, id, req.ReleaseID, req.Percentage, strings.TrimSpace(req.Cohort), req.FailureThreshold, req.MinReports)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return nil, ErrReleaseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rollout: %w", err)
+	}
+
+	return s.GetRollout(ctx, id)
+}
+
+// UpdateRollout widens or narrows a rollout, or changes its status. Resuming
+// a halted rollout clears the halt reason.
+func (s *OTAService) UpdateRollout(ctx context.Context, id uuid.UUID, req *otatypes.UpdateRolloutRequest) (*otatypes.Rollout, error) {
+	result, err := s.db.Exec(ctx, `
+	UPDATE rollouts
+	SET percentage = COALESCE($2, percentage),
+		status = COALESCE(NULLIF($3, ''), status),
+		halted_reason = CASE
+			WHEN $3 = 'active' THEN ''
+			WHEN $3 = 'halted' THEN 'halted manually'
+			ELSE halted_reason
+		END,
+		updated_at = NOW()
+	WHERE id = $1
+	`, id, req.Percentage, req.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update rollout: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return nil, ErrRolloutNotFound
+	}
+
+	return s.GetRollout(ctx, id)
+}
+
+func (s *OTAService) GetRollout(ctx context.Context, id uuid.UUID) (*otatypes.Rollout, error) {
+	ro, err := scanRollout(s.db.QueryRow(ctx, rolloutSelect+`
+	WHERE ro.id = $1
+	GROUP BY ro.id, rel.id
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRolloutNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rollout: %w", err)
+	}
+	return ro, nil
+}
+
+// ListRollouts returns rollouts newest first.
+func (s *OTAService) ListRollouts(ctx context.Context) ([]*otatypes.Rollout, error) {
+	rows, err := s.db.Query(ctx, rolloutSelect+`
+	GROUP BY ro.id, rel.id
+	ORDER BY ro.created_at DESC
+	LIMIT 100
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollouts: %w", err)
+	}
+	defer rows.Close()
+
+	rollouts := []*otatypes.Rollout{}
+	for rows.Next() {
+		ro, err := scanRollout(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rollout: %w", err)
+		}
+		rollouts = append(rollouts, ro)
+	}
+	return rollouts, rows.Err()
+}
+
+// SetCohort assigns a device to a cohort, or removes it with "".
+func (s *OTAService) SetCohort(ctx context.Context, deviceID, cohort string) error {
+	result, err := s.db.Exec(ctx, `
+	UPDATE devices SET cohort = $2, updated_at = NOW() WHERE id = $1
+	`, deviceID, strings.TrimSpace(cohort))
+	if err != nil {
+		return fmt.Errorf("failed to set cohort: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+func scanRollout(row pgx.Row) (*otatypes.Rollout, error) {
+	ro := &otatypes.Rollout{}
+	err := row.Scan(
+		&ro.ID,
+		&ro.ReleaseID,
+		&ro.Product,
+		&ro.Platform,
+		&ro.Version,
+		&ro.Percentage,
+		&ro.Cohort,
+		&ro.Status,
+		&ro.FailureThreshold,
+		&ro.MinReports,
+		&ro.HaltedReason,
+		&ro.CreatedAt,
+		&ro.UpdatedAt,
+		&ro.Stats.Pending,
+		&ro.Stats.Downloading,
+		&ro.Stats.Installed,
+		&ro.Stats.Failed,
+		&ro.Stats.Expired,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return ro, nil
+}
+
+// rolloutBucket places the device in [0, 100) for the rollout. The bucket is
+// stable, so raising the percentage keeps earlier devices in, and it differs
+// per rollout, so the same devices aren't always first.
+func rolloutBucket(rolloutID uuid.UUID, deviceID string) int {
+	h := fnv.New32a()
+	h.Write(rolloutID[:])
+	h.Write([]byte(deviceID))
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/ota"
+	otatypes "github.com/strct-org/portal/backend/internal/types/ota"
+)
+
+func TestRolloutBucket(t *testing.T) {
+	rollout, other := uuid.New(), uuid.New()
+
+	const devices = 2000
+	inAt := func(id uuid.UUID, percentage int) map[string]bool {
+		in := make(map[string]bool)
+		for i := 0; i < devices; i++ {
+			device := fmt.Sprintf("dev-%d", i)
+			b := rolloutBucket(id, device)
+			if b < 0 || b >= 100 {
+				t.Fatalf("bucket %d of %s is out of range", b, device)
+			}
+			if b != rolloutBucket(id, device) {
+				t.Fatalf("bucket of %s isn't stable", device)
+			}
+			if b < percentage {
+				in[device] = true
+			}
+		}
+		return in
+	}
+
+	ten, thirty := inAt(rollout, 10), inAt(rollout, 30)
+	for device := range ten {
+		if !thirty[device] {
+			t.Fatalf("%s left the rollout when it grew from 10%% to 30%%", device)
+		}
+	}
+	// Loose bounds: the hash only needs to spread devices roughly evenly
+	if n := len(thirty); n < devices*25/100 || n > devices*35/100 {
+		t.Errorf("%d of %d devices in a 30%% rollout", n, devices)
+	}
+
+	same := 0
+	for device := range inAt(other, 10) {
+		if ten[device] {
+			same++
+		}
+	}
+	if same == len(ten) {
+		t.Error("another rollout picked exactly the same first devices")
+	}
+}
+
+func newTestOTAService(t *testing.T, db *pgxpool.Pool) *OTAService {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewOTAService(db, NewReleaseService(db, t.TempDir(), "https://portal.test/releases"), NewNotificationService(db, events.New()), ota.NewSigner(key))
+}
+
+// insertRelease publishes an arm64 firmware release and returns its ID.
+func insertRelease(t *testing.T, db *pgxpool.Pool, version string) uuid.UUID {
+	id := uuid.New()
+	dbtest.Exec(t, db, `
+	INSERT INTO releases (id, product, version, channel, platform, filename, size, sha256, path)
+	VALUES ($1, 'beestation-firmware', $2, 'stable', 'arm64', 'firmware.bin', 1, 'sum', $2 || '/firmware.bin')
+	`, id, version)
+	return id
+}
+
+// offeredVersion checks for an update and returns the offered version, or ""
+// when there is none.
+func offeredVersion(t *testing.T, s *OTAService, deviceID string) string {
+	t.Helper()
+	check, err := s.CheckForUpdate(context.Background(), deviceID, "beestation-firmware", "arm64", "")
+	if err != nil {
+		t.Fatalf("CheckForUpdate(%s): %v", deviceID, err)
+	}
+	if !check.UpdateAvailable {
+		return ""
+	}
+	payload, err := base64.StdEncoding.DecodeString(check.Manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m otatypes.Manifest
+	if err := json.Unmarshal(payload, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m.Version
+}
+
+// Devices are offered the newest release of a rollout they're eligible for,
+// and the owner is told once.
+func TestCheckForUpdate(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := newTestOTAService(t, db)
+	alice := dbtest.User(t, db, "alice")
+	dbtest.Device(t, db, "dev-1", alice)
+	dbtest.Exec(t, db, `UPDATE devices SET version = '1.0.0' WHERE id = 'dev-1'`)
+
+	if _, err := s.CreateRollout(ctx, &otatypes.CreateRolloutRequest{ReleaseID: uuid.New(), Percentage: 100}); !errors.Is(err, ErrReleaseNotFound) {
+		t.Errorf("rollout of an unknown release: %v, want ErrReleaseNotFound", err)
+	}
+	if _, err := s.CreateRollout(ctx, &otatypes.CreateRolloutRequest{ReleaseID: insertRelease(t, db, "1.1.0"), Percentage: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateRollout(ctx, &otatypes.CreateRolloutRequest{ReleaseID: insertRelease(t, db, "1.2.0"), Percentage: 100, Cohort: "internal"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.CheckForUpdate(ctx, "dev-unknown", "beestation-firmware", "arm64", ""); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("unknown device: %v, want ErrDeviceNotFound", err)
+	}
+	for i := 0; i < 2; i++ {
+		if got := offeredVersion(t, s, "dev-1"); got != "1.1.0" {
+			t.Fatalf("check #%d offered %q, want 1.1.0", i+1, got)
+		}
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM notifications WHERE user_id = $1`, alice); n != 1 {
+		t.Errorf("owner got %d notifications, want 1", n)
+	}
+
+	// What the device is on record as wins over what it asks for
+	dbtest.Device(t, db, "dev-2", alice)
+	dbtest.Exec(t, db, `UPDATE devices SET product = 'beedrive-firmware', platform = 'arm64' WHERE id = 'dev-2'`)
+	if got := offeredVersion(t, s, "dev-2"); got != "" {
+		t.Errorf("a beedrive asking for beestation firmware was offered %q", got)
+	}
+	dbtest.Device(t, db, "dev-3", alice)
+	if check, err := s.CheckForUpdate(ctx, "dev-3", "", "", "1.0.0"); err != nil || check.UpdateAvailable {
+		t.Errorf("a device with no product on record = %+v, %v; want no update", check, err)
+	}
+
+	if err := s.SetCohort(ctx, "dev-1", " internal "); err != nil {
+		t.Fatal(err)
+	}
+	if got := offeredVersion(t, s, "dev-1"); got != "1.2.0" {
+		t.Errorf("in the cohort offered %q, want 1.2.0", got)
+	}
+}
+
+// Installs update the device's version, final states stick, and failures
+// past the threshold halt the rollout for good for the devices that failed.
+func TestReportUpdateStatus(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := newTestOTAService(t, db)
+	for _, id := range []string{"dev-1", "dev-2", "dev-3"} {
+		dbtest.Device(t, db, id, uuid.Nil)
+	}
+
+	ro, err := s.CreateRollout(ctx, &otatypes.CreateRolloutRequest{ReleaseID: insertRelease(t, db, "1.1.0"), Percentage: 100, FailureThreshold: 0.6, MinReports: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReportStatus(ctx, "dev-1", &otatypes.StatusReport{RolloutID: ro.ID, State: otatypes.StateInstalled}); !errors.Is(err, ErrRolloutNotFound) {
+		t.Errorf("report before the update was offered: %v, want ErrRolloutNotFound", err)
+	}
+	for _, id := range []string{"dev-1", "dev-2", "dev-3"} {
+		if got := offeredVersion(t, s, id); got != "1.1.0" {
+			t.Fatalf("%s offered %q, want 1.1.0", id, got)
+		}
+	}
+
+	reports := []struct {
+		deviceID string
+		state    string
+		want     string
+	}{
+		{"dev-1", otatypes.StateInstalled, otatypes.RolloutActive},
+		// Late reports don't undo a final state
+		{"dev-1", otatypes.StateFailed, otatypes.RolloutActive},
+		{"dev-2", otatypes.StateFailed, otatypes.RolloutActive},
+		{"dev-3", otatypes.StateFailed, otatypes.RolloutHalted},
+	}
+	for _, r := range reports {
+		if err := s.ReportStatus(ctx, r.deviceID, &otatypes.StatusReport{RolloutID: ro.ID, State: r.state}); err != nil {
+			t.Fatalf("%s %s: %v", r.deviceID, r.state, err)
+		}
+		got, err := s.GetRollout(ctx, ro.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != r.want {
+			t.Errorf("after %s %s: rollout %s, want %s", r.deviceID, r.state, got.Status, r.want)
+		}
+	}
+
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM devices WHERE id = 'dev-1' AND version = '1.1.0'`); n != 1 {
+		t.Error("installing didn't record the new version")
+	}
+
+	// Resumed, it isn't offered again to devices it failed on
+	resumed, err := s.UpdateRollout(ctx, ro.ID, &otatypes.UpdateRolloutRequest{Status: otatypes.RolloutActive})
+	if err != nil || resumed.HaltedReason != "" || resumed.Stats.Failed != 2 {
+		t.Fatalf("resumed rollout = %+v, %v", resumed, err)
+	}
+	if got := offeredVersion(t, s, "dev-2"); got != "" {
+		t.Errorf("a device it failed on is offered %q", got)
+	}
+}
+
+// Offers nobody acts on expire and are renewed on the next check, and
+// updates that never finish fail and count towards halting the rollout.
+func TestSweepStaleUpdates(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := newTestOTAService(t, db)
+	alice := dbtest.User(t, db, "alice")
+	for _, id := range []string{"dev-1", "dev-2", "dev-3"} {
+		dbtest.Device(t, db, id, alice)
+	}
+
+	ro, err := s.CreateRollout(ctx, &otatypes.CreateRolloutRequest{ReleaseID: insertRelease(t, db, "1.1.0"), Percentage: 100, FailureThreshold: 0.5, MinReports: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"dev-1", "dev-2", "dev-3"} {
+		if got := offeredVersion(t, s, id); got != "1.1.0" {
+			t.Fatalf("%s offered %q, want 1.1.0", id, got)
+		}
+	}
+	for _, id := range []string{"dev-2", "dev-3"} {
+		if err := s.ReportStatus(ctx, id, &otatypes.StatusReport{RolloutID: ro.ID, State: otatypes.StateDownloading}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.ReportStatus(ctx, "dev-3", &otatypes.StatusReport{RolloutID: ro.ID, State: otatypes.StateInstalled}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is stale yet
+	if err := s.sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetRollout(ctx, ro.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Stats != (otatypes.RolloutStats{Pending: 1, Downloading: 1, Installed: 1}) {
+		t.Fatalf("before the timeouts: %+v", got.Stats)
+	}
+
+	dbtest.Exec(t, db, `UPDATE device_updates SET updated_at = NOW() - INTERVAL '2 days'`)
+	if err := s.sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.GetRollout(ctx, ro.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Stats != (otatypes.RolloutStats{Installed: 1, Failed: 1, Expired: 1}) {
+		t.Errorf("after the timeouts: %+v", got.Stats)
+	}
+	if got.Status != otatypes.RolloutHalted {
+		t.Errorf("rollout %s after a timed out update, want halted", got.Status)
+	}
+
+	// Renewing an expired offer doesn't tell the owner again
+	if _, err := s.UpdateRollout(ctx, ro.ID, &otatypes.UpdateRolloutRequest{Status: otatypes.RolloutActive}); err != nil {
+		t.Fatal(err)
+	}
+	before := dbtest.Count(t, db, `SELECT COUNT(*) FROM notifications WHERE user_id = $1`, alice)
+	if got := offeredVersion(t, s, "dev-1"); got != "1.1.0" {
+		t.Errorf("an expired offer renewed as %q, want 1.1.0", got)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM device_updates WHERE device_id = 'dev-1' AND state = 'pending'`); n != 1 {
+		t.Error("the renewed offer isn't pending")
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM notifications WHERE user_id = $1`, alice); n != before {
+		t.Errorf("owner got %d more notifications, want none", n-before)
+	}
+}
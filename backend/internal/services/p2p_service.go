@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	tunnel "github.com/strct-org/portal/backend/internal/relay"
+	"github.com/strct-org/portal/backend/internal/types/p2p"
+	"github.com/strct-org/portal/backend/internal/types/relay"
+)
+
+const (
+	// The device has this long to answer before the client should give up
+	// and use the relay
+	p2pAnswerTimeout = 30 * time.Second
+	p2pRetention     = 90 * 24 * time.Hour
+
+	// ICE type preferences, shifted into the top byte of the priority
+	hostPreference      = 126
+	reflexivePreference = 100
+)
+
+// p2pColumns reports pending sessions past their deadline as expired.
+const p2pColumns = `id, device_id, client_candidates, device_candidates,
+	CASE WHEN status = 'pending' AND expires_at <= NOW() THEN 'expired' ELSE status END,
+	path, created_at, answered_at, completed_at, expires_at`
+
+// P2PService brokers direct connections between clients and devices. The
+// client offers its candidates, the device answers with its own, both try to
+// reach each other, and the client reports whether it got through or fell
+// back to the relay.
+type P2PService struct {
+	db          *pgxpool.Pool
+	relayDomain *tunnel.Domain
+}
+
+func NewP2PService(db *pgxpool.Pool, relayDomain *tunnel.Domain) *P2PService {
+	return &P2PService{
+		db:          db,
+		relayDomain: relayDomain,
+	}
+}
+
+// Offer starts a session for a user with relay access to the device.
+// clientIP is the address the portal saw the request come from.
+func (s *P2PService) Offer(ctx context.Context, access *relay.Access, clientIP string, candidates []p2p.Candidate) (*p2p.Session, error) {
+	clientCandidates, err := json.Marshal(withReflexive(candidates, clientIP))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode candidates: %w", err)
+	}
+
+	sess, err := s.scanSession(s.db.QueryRow(ctx, `
+	INSERT INTO p2p_sessions (id, device_id, user_id, client_candidates, expires_at)
+	VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5))
+	RETURNING `+p2pColumns,
+		uuid.New(), access.DeviceID, access.UserID, clientCandidates, p2pAnswerTimeout.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return sess, nil
+}
+
+// PendingOffers returns the sessions the device has yet to answer.
+func (s *P2PService) PendingOffers(ctx context.Context, deviceID string) ([]*p2p.Session, error) {
+	rows, err := s.db.Query(ctx, `
+	SELECT `+p2pColumns+` FROM p2p_sessions
+	WHERE device_id = $1 AND status = 'pending' AND expires_at > NOW()
+	ORDER BY created_at
+	`, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query offers: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*p2p.Session{}
+	for rows.Next() {
+		sess, err := s.scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+// Answer records the device's candidates. The portal adds the device's LAN
+// address as a host candidate when the device left it out, and a reflexive
+// candidate for deviceIP, the address it saw the device connect from.
+func (s *P2PService) Answer(ctx context.Context, deviceID string, id uuid.UUID, deviceIP string, candidates []p2p.Candidate) error {
+	var localIP string
+	if err := s.db.QueryRow(ctx, `SELECT local_ip FROM devices WHERE id = $1`, deviceID).Scan(&localIP); err != nil {
+		return fmt.Errorf("failed to look up device: %w", err)
+	}
+	candidates = withLocalIP(candidates, localIP)
+
+	deviceCandidates, err := json.Marshal(withReflexive(candidates, deviceIP))
+	if err != nil {
+		return fmt.Errorf("failed to encode candidates: %w", err)
+	}
+
+	result, err := s.db.Exec(ctx, `
+	UPDATE p2p_sessions SET device_candidates = $3, status = 'answered', answered_at = NOW()
+	WHERE id = $1 AND device_id = $2 AND status = 'pending' AND expires_at > NOW()
+	`, id, deviceID, deviceCandidates)
+	if err != nil {
+		return fmt.Errorf("failed to answer session: %w", err)
+	}
+	if result.RowsAffected() > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := s.db.QueryRow(ctx, `
+	SELECT EXISTS (SELECT 1 FROM p2p_sessions WHERE id = $1 AND device_id = $2)
+	`, id, deviceID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up session: %w", err)
+	}
+	if !exists {
+		return ErrSessionNotFound
+	}
+	return ErrSessionCompleted
+}
+
+// GetSession returns a session the user started.
+func (s *P2PService) GetSession(ctx context.Context, clerkID string, id uuid.UUID) (*p2p.Session, error) {
+	sess, err := s.scanSession(s.db.QueryRow(ctx, `
+	SELECT `+p2pColumns+` FROM p2p_sessions
+	WHERE id = $1 AND user_id = (SELECT id FROM users WHERE clerk_id = $2)
+	`, id, clerkID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return sess, nil
+}
+
+// RecordPath completes the session with the path the client used. Clients
+// record the relay path too, including for sessions the device never answered.
+func (s *P2PService) RecordPath(ctx context.Context, clerkID string, id uuid.UUID, path string) (*p2p.Session, error) {
+	sess, err := s.scanSession(s.db.QueryRow(ctx, `
+	UPDATE p2p_sessions SET status = 'completed', path = $3, completed_at = NOW()
+	WHERE id = $1 AND user_id = (SELECT id FROM users WHERE clerk_id = $2) AND status <> 'completed'
+	RETURNING `+p2pColumns,
+		id, clerkID, path))
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := s.GetSession(ctx, clerkID, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrSessionCompleted
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record session path: %w", err)
+	}
+	return sess, nil
+}
+
+// Run purges old sessions until ctx is cancelled.
+func (s *P2PService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.db.Exec(ctx, `
+			DELETE FROM p2p_sessions WHERE created_at < NOW() - make_interval(secs => $1)
+			`, p2pRetention.Seconds()); err != nil && ctx.Err() == nil {
+				log.Printf("P2P session sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+// withLocalIP adds the device's LAN address as a host candidate on the port
+// of its first host candidate, unless it is already listed.
+func withLocalIP(candidates []p2p.Candidate, localIP string) []p2p.Candidate {
+	addr, err := netip.ParseAddr(localIP)
+	if err != nil {
+		return candidates
+	}
+
+	var template *p2p.Candidate
+	for i, c := range candidates {
+		if c.Type != p2p.CandidateHost {
+			continue
+		}
+		if c.Address == addr.String() {
+			return candidates
+		}
+		if template == nil {
+			template = &candidates[i]
+		}
+	}
+	if template == nil {
+		return candidates
+	}
+
+	return append(candidates, p2p.Candidate{
+		Type:     p2p.CandidateHost,
+		Address:  addr.String(),
+		Port:     template.Port,
+		Protocol: template.Protocol,
+		Priority: candidatePriority(hostPreference, len(candidates)),
+	})
+}
+
+// withReflexive fills in missing priorities and pairs the observed public
+// address with the port of every host candidate. NATs that keep the source
+// port make those pairs reachable.
+func withReflexive(candidates []p2p.Candidate, observedIP string) []p2p.Candidate {
+	out := make([]p2p.Candidate, 0, 2*len(candidates))
+	seen := map[p2p.Candidate]bool{}
+	add := func(c p2p.Candidate) {
+		key := c
+		key.Priority = 0
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, c)
+		}
+	}
+
+	for i, c := range candidates {
+		if c.Priority == 0 {
+			pref := hostPreference
+			if c.Type == p2p.CandidateReflexive {
+				pref = reflexivePreference
+			}
+			c.Priority = candidatePriority(pref, i)
+		}
+		add(c)
+	}
+
+	observed, err := netip.ParseAddr(observedIP)
+	if err != nil || !observed.IsGlobalUnicast() || observed.IsPrivate() {
+		return out
+	}
+	for i, c := range candidates {
+		if c.Type != p2p.CandidateHost || c.Address == observed.String() {
+			continue
+		}
+		add(p2p.Candidate{
+			Type:     p2p.CandidateReflexive,
+			Address:  observed.String(),
+			Port:     c.Port,
+			Protocol: c.Protocol,
+			Priority: candidatePriority(reflexivePreference, i),
+		})
+	}
+	return out
+}
+
+// candidatePriority follows the ICE formula with the listing order standing
+// in for the local preference.
+func candidatePriority(typePreference, index int) int64 {
+	local := max(65535-index, 0)
+	return int64(typePreference)<<24 | int64(local)<<8 | 255
+}
+
+func (s *P2PService) scanSession(row pgx.Row) (*p2p.Session, error) {
+	sess := &p2p.Session{}
+	err := row.Scan(
+		&sess.ID,
+		&sess.DeviceID,
+		&sess.ClientCandidates,
+		&sess.DeviceCandidates,
+		&sess.Status,
+		&sess.Path,
+		&sess.CreatedAt,
+		&sess.AnsweredAt,
+		&sess.CompletedAt,
+		&sess.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	sess.RelayURL, _ = s.relayDomain.DeviceURL(sess.DeviceID)
+	return sess, nil
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	tunnel "github.com/strct-org/portal/backend/internal/relay"
+	"github.com/strct-org/portal/backend/internal/types/p2p"
+	"github.com/strct-org/portal/backend/internal/types/relay"
+)
+
+func TestWithReflexive(t *testing.T) {
+	candidates := []p2p.Candidate{
+		{Type: p2p.CandidateHost, Address: "192.168.1.10", Port: 4000, Protocol: "udp"},
+		{Type: p2p.CandidateHost, Address: "192.168.1.10", Port: 4000, Protocol: "udp"},
+		{Type: p2p.CandidateHost, Address: "10.0.0.5", Port: 5000, Protocol: "tcp"},
+	}
+
+	tests := []struct {
+		name       string
+		observedIP string
+		want       int
+	}{
+		// The duplicate host candidate collapses, and each distinct port
+		// gets a reflexive pair
+		{"public address", "203.0.113.7", 4},
+		{"private address", "192.168.1.1", 2},
+		{"unparseable", "", 2},
+		{"loopback", "127.0.0.1", 2},
+	}
+
+	for _, tt := range tests {
+		got := withReflexive(candidates, tt.observedIP)
+		if len(got) != tt.want {
+			t.Errorf("%s: %d candidates, want %d: %+v", tt.name, len(got), tt.want, got)
+			continue
+		}
+		for _, c := range got {
+			if c.Priority <= 0 {
+				t.Errorf("%s: candidate %+v has no priority", tt.name, c)
+			}
+			if c.Type == p2p.CandidateReflexive && c.Address != tt.observedIP {
+				t.Errorf("%s: reflexive candidate %+v isn't on the observed address", tt.name, c)
+			}
+		}
+	}
+}
+
+func TestWithLocalIP(t *testing.T) {
+	host := p2p.Candidate{Type: p2p.CandidateHost, Address: "192.168.1.10", Port: 4000, Protocol: "udp"}
+	reflexive := p2p.Candidate{Type: p2p.CandidateReflexive, Address: "203.0.113.7", Port: 4000, Protocol: "udp"}
+
+	tests := []struct {
+		name       string
+		candidates []p2p.Candidate
+		localIP    string
+		want       int
+	}{
+		{"adds the LAN address", []p2p.Candidate{host}, "192.168.1.20", 2},
+		{"already listed", []p2p.Candidate{host}, "192.168.1.10", 1},
+		{"no host candidate to copy the port from", []p2p.Candidate{reflexive}, "192.168.1.20", 1},
+		{"unparseable", []p2p.Candidate{host}, "nas.local", 1},
+	}
+
+	for _, tt := range tests {
+		got := withLocalIP(append([]p2p.Candidate(nil), tt.candidates...), tt.localIP)
+		if len(got) != tt.want {
+			t.Errorf("%s: %d candidates, want %d", tt.name, len(got), tt.want)
+			continue
+		}
+		if tt.want > len(tt.candidates) {
+			added := got[len(got)-1]
+			if added.Address != tt.localIP || added.Port != host.Port || added.Type != p2p.CandidateHost {
+				t.Errorf("%s: added %+v", tt.name, added)
+			}
+		}
+	}
+}
+
+func TestCandidatePriority(t *testing.T) {
+	if candidatePriority(hostPreference, 0) <= candidatePriority(reflexivePreference, 0) {
+		t.Error("host candidates don't outrank reflexive ones")
+	}
+	if candidatePriority(hostPreference, 0) <= candidatePriority(hostPreference, 1) {
+		t.Error("earlier candidates don't outrank later ones")
+	}
+	if candidatePriority(hostPreference, 100000) <= 0 {
+		t.Error("priority of a late candidate isn't positive")
+	}
+}
+
+// A session goes from the client's offer to the device's answer to the
+// client's result, each step once, and only for its own client and device.
+func TestP2PSession(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	domain, err := tunnel.ParseDomain("https://relay.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewP2PService(db, domain)
+	alice := dbtest.User(t, db, "alice")
+	dbtest.User(t, db, "bob")
+	dbtest.Device(t, db, "dev-1", alice)
+	dbtest.Device(t, db, "dev-2", alice)
+	dbtest.Exec(t, db, `UPDATE devices SET local_ip = '192.168.1.20' WHERE id = 'dev-1'`)
+
+	access := &relay.Access{DeviceID: "dev-1", OwnerID: alice, UserID: alice, Owner: true}
+	offer := []p2p.Candidate{{Type: p2p.CandidateHost, Address: "10.0.0.5", Port: 4000, Protocol: "udp"}}
+	sess, err := s.Offer(ctx, access, "203.0.113.7", offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sess.ClientCandidates) != 2 || sess.Status != p2p.StatusPending || sess.RelayURL == "" {
+		t.Fatalf("offer = %+v, want a pending session with the reflexive candidate and a relay URL", sess)
+	}
+
+	if offers, err := s.PendingOffers(ctx, "dev-2"); err != nil || len(offers) != 0 {
+		t.Errorf("another device's offers = %d, %v; want none", len(offers), err)
+	}
+	if offers, err := s.PendingOffers(ctx, "dev-1"); err != nil || len(offers) != 1 {
+		t.Fatalf("PendingOffers = %d, %v; want 1", len(offers), err)
+	}
+
+	answer := []p2p.Candidate{{Type: p2p.CandidateHost, Address: "192.168.1.21", Port: 5000, Protocol: "udp"}}
+	if err := s.Answer(ctx, "dev-2", sess.ID, "198.51.100.9", answer); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("answer from another device: %v, want ErrSessionNotFound", err)
+	}
+	if err := s.Answer(ctx, "dev-1", sess.ID, "198.51.100.9", answer); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Answer(ctx, "dev-1", sess.ID, "198.51.100.9", answer); !errors.Is(err, ErrSessionCompleted) {
+		t.Errorf("answering twice: %v, want ErrSessionCompleted", err)
+	}
+
+	if _, err := s.GetSession(ctx, "clerk_bob", sess.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("another user's session: %v, want ErrSessionNotFound", err)
+	}
+	answered, err := s.GetSession(ctx, "clerk_alice", sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The answer, the LAN address on the same port, and the reflexive
+	// candidate for that port
+	if answered.Status != p2p.StatusAnswered || len(answered.DeviceCandidates) != 3 {
+		t.Errorf("answered session = %+v, want 3 device candidates", answered)
+	}
+
+	if _, err := s.RecordPath(ctx, "clerk_bob", sess.ID, p2p.PathDirect); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("another user's result: %v, want ErrSessionNotFound", err)
+	}
+	done, err := s.RecordPath(ctx, "clerk_alice", sess.ID, p2p.PathDirect)
+	if err != nil || done.Status != p2p.StatusCompleted || done.Path != p2p.PathDirect {
+		t.Fatalf("RecordPath = %+v, %v", done, err)
+	}
+	if _, err := s.RecordPath(ctx, "clerk_alice", sess.ID, p2p.PathRelay); !errors.Is(err, ErrSessionCompleted) {
+		t.Errorf("recording twice: %v, want ErrSessionCompleted", err)
+	}
+}
+
+// An offer the device didn't answer in time expires, and the client records
+// that it used the relay instead.
+func TestP2PSessionExpires(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	domain, err := tunnel.ParseDomain("https://relay.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewP2PService(db, domain)
+	alice := dbtest.User(t, db, "alice")
+	dbtest.Device(t, db, "dev-1", alice)
+
+	sess, err := s.Offer(ctx, &relay.Access{DeviceID: "dev-1", OwnerID: alice, UserID: alice, Owner: true}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbtest.Exec(t, db, `UPDATE p2p_sessions SET expires_at = NOW() - INTERVAL '1 second' WHERE id = $1`, sess.ID)
+
+	if got, err := s.GetSession(ctx, "clerk_alice", sess.ID); err != nil || got.Status != p2p.StatusExpired {
+		t.Errorf("late session = %+v, %v; want it expired", got, err)
+	}
+	if offers, err := s.PendingOffers(ctx, "dev-1"); err != nil || len(offers) != 0 {
+		t.Errorf("PendingOffers = %d, %v; want the expired offer left out", len(offers), err)
+	}
+	if err := s.Answer(ctx, "dev-1", sess.ID, "", nil); !errors.Is(err, ErrSessionCompleted) {
+		t.Errorf("late answer: %v, want ErrSessionCompleted", err)
+	}
+	if got, err := s.RecordPath(ctx, "clerk_alice", sess.ID, p2p.PathRelay); err != nil || got.Path != p2p.PathRelay {
+		t.Errorf("relay result = %+v, %v", got, err)
+	}
+}
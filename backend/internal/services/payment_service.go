@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/payments"
+	"github.com/strct-org/portal/backend/internal/plans"
+)
+
+// PaymentService turns verified payment events into subscriptions and orders.
+// Each event is applied at most once per provider, and events older than the
+// last one applied to a subscription are skipped.
+type PaymentService struct {
+	db *pgxpool.Pool
+}
+
+func NewPaymentService(db *pgxpool.Pool) *PaymentService {
+	return &PaymentService{
+		db: db,
+	}
+}
+
+// once applies the event in a transaction together with recording its ID, so
+// a redelivery returns ErrDuplicatePaymentEvent and a failure can be retried.
+func (s *PaymentService) once(ctx context.Context, provider string, ev *payments.Event, apply func(pgx.Tx) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+	INSERT INTO payment_events (provider, event_id, type)
+	VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING
+	`, provider, ev.ID, string(ev.Type))
+	if err != nil {
+		return fmt.Errorf("failed to record payment event: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrDuplicatePaymentEvent
+	}
+
+	if err := apply(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CheckoutCompleted starts a subscription or records a one-off order. A
+// subscription checkout fails with ErrUserNotFound when it arrives before the
+// buyer's account is created, so the provider retries.
+func (s *PaymentService) CheckoutCompleted(ctx context.Context, provider string, ev *payments.Event) error {
+	c := ev.Checkout
+	return s.once(ctx, provider, ev, func(tx pgx.Tx) error {
+		userID, err := buyerID(ctx, tx, c.ClerkID, c.Email)
+		if err != nil {
+			return err
+		}
+
+		if c.Mode == payments.ModeSubscription {
+			if userID == nil {
+				return fmt.Errorf("%w: no account for subscription checkout %s", ErrUserNotFound, c.SessionID)
+			}
+			if !plans.Exists(c.Plan) {
+				return fmt.Errorf("%w: %q in checkout %s", ErrUnknownPlan, c.Plan, c.SessionID)
+			}
+
+			_, err := tx.Exec(ctx, `
+			INSERT INTO subscriptions (user_id, plan, status, provider, provider_customer_id, provider_subscription_id, provider_event_at)
+			VALUES ($1, $2, 'active', $3, $4, $5, $6)
+			ON CONFLICT (user_id) DO UPDATE SET
+				plan = EXCLUDED.plan,
+				status = 'active',
+				provider = EXCLUDED.provider,
+				provider_customer_id = EXCLUDED.provider_customer_id,
+				provider_subscription_id = EXCLUDED.provider_subscription_id,
+				provider_event_at = COALESCE(EXCLUDED.provider_event_at, subscriptions.provider_event_at),
+				cancel_at_period_end = FALSE,
+				updated_at = NOW()
+			WHERE EXCLUDED.provider_event_at IS NULL OR subscriptions.provider_event_at IS NULL
+				OR subscriptions.provider_event_at <= EXCLUDED.provider_event_at
+			`, *userID, c.Plan, provider, c.CustomerID, c.SubscriptionID, eventTime(ev))
+			if err != nil {
+				return fmt.Errorf("failed to start subscription: %w", err)
+			}
+			return nil
+		}
+
+		orderID := uuid.New()
+		result, err := tx.Exec(ctx, `
+		INSERT INTO orders (id, user_id, email, provider, provider_checkout_id, provider_payment_id, amount_total, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (provider, provider_checkout_id) DO NOTHING
+		`, orderID, userID, c.Email, provider, c.SessionID, c.PaymentID, c.AmountTotal, c.Currency)
+		if err != nil {
+			return fmt.Errorf("failed to record order: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return nil
+		}
+
+		for _, item := range c.LineItems {
+			if _, err := tx.Exec(ctx, `
+			INSERT INTO order_items (order_id, sku, name, quantity, unit_amount)
+			VALUES ($1, $2, $3, $4, $5)
+			`, orderID, item.SKU, item.Name, item.Quantity, item.UnitAmount); err != nil {
+				return fmt.Errorf("failed to record order item: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// InvoicePaid extends the paid period. It fails with ErrSubscriptionNotFound
+// when the invoice arrives before its checkout, so the provider retries.
+func (s *PaymentService) InvoicePaid(ctx context.Context, provider string, ev *payments.Event) error {
+	inv := ev.Invoice
+	plan := ""
+	if plans.Exists(inv.Plan) {
+		plan = inv.Plan
+	}
+
+	return s.once(ctx, provider, ev, func(tx pgx.Tx) error {
+		if stale, err := staleSubscriptionEvent(ctx, tx, provider, inv.SubscriptionID, ev); err != nil || stale {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `
+		UPDATE subscriptions
+		SET status = 'active', current_period_end = $3, plan = COALESCE(NULLIF($4, ''), plan),
+			provider_invoice_id = $5, provider_event_at = COALESCE($6, provider_event_at), updated_at = NOW()
+		WHERE provider = $1 AND provider_subscription_id = $2
+		`, provider, inv.SubscriptionID, inv.PeriodEnd, plan, inv.ID, eventTime(ev)); err != nil {
+			return fmt.Errorf("failed to extend subscription: %w", err)
+		}
+		return nil
+	})
+}
+
+// SubscriptionCancelled ends the subscription at the end of the paid period,
+// after which the user falls back to the free plan.
+func (s *PaymentService) SubscriptionCancelled(ctx context.Context, provider string, ev *payments.Event) error {
+	c := ev.Cancellation
+	return s.once(ctx, provider, ev, func(tx pgx.Tx) error {
+		if stale, err := staleSubscriptionEvent(ctx, tx, provider, c.SubscriptionID, ev); err != nil || stale {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `
+		UPDATE subscriptions
+		SET status = 'canceled', current_period_end = $3, cancel_at_period_end = FALSE,
+			provider_event_at = COALESCE($4, provider_event_at), updated_at = NOW()
+		WHERE provider = $1 AND provider_subscription_id = $2
+		`, provider, c.SubscriptionID, c.EndsAt, eventTime(ev)); err != nil {
+			return fmt.Errorf("failed to cancel subscription: %w", err)
+		}
+		return nil
+	})
+}
+
+// Refunded updates the order paid by the refunded payment. A full refund of
+// the invoice that paid for a subscription's current period ends the period
+// now; partial refunds and refunds of earlier periods leave access as it is.
+func (s *PaymentService) Refunded(ctx context.Context, provider string, ev *payments.Event) error {
+	rf := ev.Refund
+	return s.once(ctx, provider, ev, func(tx pgx.Tx) error {
+		if rf.InvoiceID != "" {
+			return refundInvoice(ctx, tx, provider, ev)
+		}
+
+		// The amount is cumulative, so a refund event arriving late doesn't
+		// lower it
+		result, err := tx.Exec(ctx, `
+		UPDATE orders
+		SET amount_refunded = GREATEST(amount_refunded, $3),
+			status = CASE WHEN GREATEST(amount_refunded, $3) >= amount_total THEN 'refunded' ELSE 'partially_refunded' END,
+			updated_at = NOW()
+		WHERE provider = $1 AND provider_payment_id = $2
+		`, provider, rf.PaymentID, rf.AmountRefunded)
+		if err != nil {
+			return fmt.Errorf("failed to record refund: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return ErrOrderNotFound
+		}
+		return nil
+	})
+}
+
+func refundInvoice(ctx context.Context, tx pgx.Tx, provider string, ev *payments.Event) error {
+	rf := ev.Refund
+	if rf.AmountRefunded < rf.Amount {
+		return nil
+	}
+
+	var subscriptionID string
+	err := tx.QueryRow(ctx, `
+	SELECT provider_subscription_id FROM subscriptions WHERE provider = $1 AND provider_invoice_id = $2
+	`, provider, rf.InvoiceID).Scan(&subscriptionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up refunded invoice: %w", err)
+	}
+	if stale, err := staleSubscriptionEvent(ctx, tx, provider, subscriptionID, ev); err != nil || stale {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+	UPDATE subscriptions
+	SET status = 'canceled', current_period_end = LEAST(current_period_end, NOW()), cancel_at_period_end = FALSE,
+		provider_event_at = COALESCE($3, provider_event_at), updated_at = NOW()
+	WHERE provider = $1 AND provider_subscription_id = $2
+	`, provider, subscriptionID, eventTime(ev)); err != nil {
+		return fmt.Errorf("failed to end refunded subscription: %w", err)
+	}
+	return nil
+}
+
+// staleSubscriptionEvent locks the subscription and reports whether ev was
+// created before the last event applied to it. Such events are skipped, so an
+// invoice delivered after the cancellation that followed it can't revive the
+// subscription. Events created in the same second are applied in arrival
+// order, as the providers' timestamps can't tell them apart.
+func staleSubscriptionEvent(ctx context.Context, tx pgx.Tx, provider, subscriptionID string, ev *payments.Event) (bool, error) {
+	var last *time.Time
+	err := tx.QueryRow(ctx, `
+	SELECT provider_event_at FROM subscriptions
+	WHERE provider = $1 AND provider_subscription_id = $2
+	FOR UPDATE
+	`, provider, subscriptionID).Scan(&last)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up subscription: %w", err)
+	}
+
+	if last != nil && !ev.Created.IsZero() && ev.Created.Before(*last) {
+		log.Printf("Skipping payment event %s (%s): older than the last event applied to subscription %s", ev.ID, ev.Type, subscriptionID)
+		return true, nil
+	}
+	return false, nil
+}
+
+// eventTime is the event's creation time, or nil when the provider didn't
+// give one so ordering checks let it through.
+func eventTime(ev *payments.Event) *time.Time {
+	if ev.Created.IsZero() {
+		return nil
+	}
+	return &ev.Created
+}
+
+// buyerID finds the buyer's account by Clerk ID, or by verified email for
+// guest checkouts. It returns nil when there is no account; the order is then
+// claimed when an account with that email is created.
+func buyerID(ctx context.Context, tx pgx.Tx, clerkID, email string) (*uuid.UUID, error) {
+	var id uuid.UUID
+	err := tx.QueryRow(ctx, `
+	SELECT id FROM users
+	WHERE ($1 <> '' AND clerk_id = $1) OR ($1 = '' AND $2 <> '' AND LOWER(email) = LOWER($2) AND email_verified)
+	LIMIT 1
+	`, clerkID, email).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up buyer: %w", err)
+	}
+	return &id, nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/payments"
+	"github.com/strct-org/portal/backend/internal/types/subscription"
+)
+
+// subscriptionOf returns the subscription row of the user named name.
+func subscriptionOf(t *testing.T, db *pgxpool.Pool, name string) *subscription.Subscription {
+	t.Helper()
+
+	var sub subscription.Subscription
+	if err := db.QueryRow(context.Background(), `
+	SELECT plan, status, current_period_end FROM subscriptions
+	WHERE user_id = (SELECT id FROM users WHERE clerk_id = $1)
+	`, "clerk_"+name).Scan(&sub.Plan, &sub.Status, &sub.CurrentPeriodEnd); err != nil {
+		t.Fatal(err)
+	}
+	return &sub
+}
+
+func subscribe(t *testing.T, s *PaymentService, name string, created time.Time) {
+	t.Helper()
+
+	err := s.CheckoutCompleted(context.Background(), "fake", &payments.Event{
+		ID: "evt_checkout_" + name, Type: payments.CheckoutCompleted, Created: created,
+		Checkout: &payments.Checkout{
+			SessionID: "cs_" + name, Mode: payments.ModeSubscription, ClerkID: "clerk_" + name,
+			CustomerID: "cus_" + name, SubscriptionID: "sub_" + name, Plan: "plus",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func invoicePaid(id, subscriptionID string, created, periodEnd time.Time) *payments.Event {
+	return &payments.Event{
+		ID: "evt_" + id, Type: payments.InvoicePaid, Created: created,
+		Invoice: &payments.Invoice{ID: id, SubscriptionID: subscriptionID, PeriodEnd: periodEnd},
+	}
+}
+
+// An invoice delivered after the cancellation that followed it doesn't
+// revive the subscription.
+func TestPaymentEventsOutOfOrder(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := NewPaymentService(db)
+	dbtest.User(t, db, "alice")
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	ends := start.Add(30 * time.Minute)
+
+	if err := s.InvoicePaid(ctx, "fake", invoicePaid("in_early", "sub_alice", start, ends)); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Fatalf("invoice before its checkout: %v, want ErrSubscriptionNotFound", err)
+	}
+	subscribe(t, s, "alice", start)
+
+	cancelled := &payments.Event{
+		ID: "evt_cancel", Type: payments.SubscriptionCancelled, Created: start.Add(2 * time.Minute),
+		Cancellation: &payments.Cancellation{SubscriptionID: "sub_alice", EndsAt: ends},
+	}
+	if err := s.SubscriptionCancelled(ctx, "fake", cancelled); err != nil {
+		t.Fatal(err)
+	}
+	late := invoicePaid("in_1", "sub_alice", start.Add(time.Minute), start.Add(31*24*time.Hour))
+	if err := s.InvoicePaid(ctx, "fake", late); err != nil {
+		t.Fatalf("late invoice: %v", err)
+	}
+	if sub := subscriptionOf(t, db, "alice"); sub.Status != subscription.StatusCanceled || !sub.CurrentPeriodEnd.Equal(ends) {
+		t.Errorf("after a late invoice: %s until %v, want canceled until %v", sub.Status, sub.CurrentPeriodEnd, ends)
+	}
+	if err := s.InvoicePaid(ctx, "fake", late); !errors.Is(err, ErrDuplicatePaymentEvent) {
+		t.Errorf("redelivering the skipped invoice: %v, want ErrDuplicatePaymentEvent", err)
+	}
+
+	// A checkout delivered late doesn't restart it either, but a new one does
+	stale := &payments.Event{
+		ID: "evt_checkout_stale", Type: payments.CheckoutCompleted, Created: start.Add(time.Minute),
+		Checkout: &payments.Checkout{SessionID: "cs_stale", Mode: payments.ModeSubscription, ClerkID: "clerk_alice", SubscriptionID: "sub_alice", Plan: "plus"},
+	}
+	if err := s.CheckoutCompleted(ctx, "fake", stale); err != nil {
+		t.Fatal(err)
+	}
+	if sub := subscriptionOf(t, db, "alice"); sub.Status != subscription.StatusCanceled {
+		t.Errorf("after a late checkout: %s, want canceled", sub.Status)
+	}
+	fresh := invoicePaid("in_2", "sub_alice", start.Add(3*time.Minute), start.Add(31*24*time.Hour))
+	if err := s.InvoicePaid(ctx, "fake", fresh); err != nil {
+		t.Fatal(err)
+	}
+	if sub := subscriptionOf(t, db, "alice"); sub.Status != subscription.StatusActive {
+		t.Errorf("after a newer invoice: %s, want active", sub.Status)
+	}
+}
+
+// Fully refunding the invoice that paid for the current period ends it.
+func TestSubscriptionRefund(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := NewPaymentService(db)
+	dbtest.User(t, db, "alice")
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	periodEnd := start.Add(30 * 24 * time.Hour)
+
+	subscribe(t, s, "alice", start)
+	for i, id := range []string{"in_1", "in_2"} {
+		if err := s.InvoicePaid(ctx, "fake", invoicePaid(id, "sub_alice", start.Add(time.Duration(i)*time.Minute), periodEnd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	refund := func(eventID, invoiceID string, refunded int64) error {
+		return s.Refunded(ctx, "fake", &payments.Event{
+			ID: eventID, Type: payments.Refunded, Created: start.Add(10 * time.Minute),
+			Refund: &payments.Refund{ID: "ch_" + invoiceID, InvoiceID: invoiceID, Amount: 299, AmountRefunded: refunded},
+		})
+	}
+	if err := refund("evt_partial", "in_2", 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := refund("evt_earlier", "in_1", 299); err != nil {
+		t.Fatal(err)
+	}
+	if err := refund("evt_unknown", "in_elsewhere", 299); err != nil {
+		t.Fatal(err)
+	}
+	if sub := subscriptionOf(t, db, "alice"); sub.Status != subscription.StatusActive || !sub.CurrentPeriodEnd.Equal(periodEnd) {
+		t.Fatalf("after partial and earlier refunds: %s until %v, want active until %v", sub.Status, sub.CurrentPeriodEnd, periodEnd)
+	}
+
+	if err := refund("evt_full", "in_2", 299); err != nil {
+		t.Fatal(err)
+	}
+	sub := subscriptionOf(t, db, "alice")
+	if sub.Status != subscription.StatusCanceled || sub.CurrentPeriodEnd.After(time.Now()) {
+		t.Errorf("after a full refund: %s until %v, want canceled now", sub.Status, sub.CurrentPeriodEnd)
+	}
+	if plan := EffectivePlan(sub, time.Now()); plan.ID != subscription.PlanFree {
+		t.Errorf("effective plan after a full refund = %s, want free", plan.ID)
+	}
+}
+
+// Refund events carry the cumulative amount, so one arriving late doesn't
+// lower it.
+func TestOrderRefundOutOfOrder(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := NewPaymentService(db)
+
+	err := s.CheckoutCompleted(ctx, "fake", &payments.Event{
+		ID: "evt_order", Type: payments.CheckoutCompleted,
+		Checkout: &payments.Checkout{SessionID: "cs_1", Mode: payments.ModePayment, Email: "guest@example.com", PaymentID: "pi_1", AmountTotal: 1000, Currency: "eur"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rf := range []struct {
+		id     string
+		amount int64
+	}{{"evt_refund_2", 1000}, {"evt_refund_1", 400}} {
+		if err := s.Refunded(ctx, "fake", &payments.Event{ID: rf.id, Type: payments.Refunded, Refund: &payments.Refund{PaymentID: "pi_1", Amount: 1000, AmountRefunded: rf.amount}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := dbtest.Count(t, db, `SELECT amount_refunded FROM orders WHERE status = 'refunded'`); n != 1000 {
+		t.Errorf("refunded %d, want the full 1000", n)
+	}
+}
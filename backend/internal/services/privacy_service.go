@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/types/privacy"
+)
+
+// notBlocked holds when neither user $1 nor user u has blocked the other.
+const notBlocked = `NOT EXISTS (
+	SELECT 1 FROM user_blocks b
+	WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1)
+)`
+
+// visibleTo holds when user u is user $1 or one of their friends, who find
+// each other whatever their settings.
+const visibleTo = `(u.id = $1 OR EXISTS (
+	SELECT 1 FROM friendships f
+	WHERE f.status = 'accepted' AND ((f.user_id = $1 AND f.friend_id = u.id) OR (f.user_id = u.id AND f.friend_id = $1))
+))`
+
+// PrivacyService manages who can find and contact a user: their block list
+// and discoverability settings.
+type PrivacyService struct {
+	db *pgxpool.Pool
+}
+
+func NewPrivacyService(db *pgxpool.Pool) *PrivacyService {
+	return &PrivacyService{db: db}
+}
+
+// GetSettings returns the user's privacy settings; users who never set them
+// can be found both ways.
+func (s *PrivacyService) GetSettings(ctx context.Context, clerkID string) (*privacy.Settings, error) {
+	var p privacy.Settings
+	err := s.db.QueryRow(ctx, `
+	SELECT COALESCE(p.discoverable_by_username, TRUE), COALESCE(p.discoverable_by_email, TRUE)
+	FROM users u
+	LEFT JOIN privacy_settings p ON p.user_id = u.id
+	WHERE u.clerk_id = $1
+	`, clerkID).Scan(&p.DiscoverableByUsername, &p.DiscoverableByEmail)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get privacy settings: %w", err)
+	}
+	return &p, nil
+}
+
+func (s *PrivacyService) UpdateSettings(ctx context.Context, clerkID string, p *privacy.Settings) (*privacy.Settings, error) {
+	err := s.db.QueryRow(ctx, `
+	INSERT INTO privacy_settings (user_id, discoverable_by_username, discoverable_by_email)
+	SELECT id, $2, $3 FROM users WHERE clerk_id = $1
+	ON CONFLICT (user_id) DO UPDATE SET
+		discoverable_by_username = EXCLUDED.discoverable_by_username,
+		discoverable_by_email = EXCLUDED.discoverable_by_email,
+		updated_at = NOW()
+	RETURNING discoverable_by_username, discoverable_by_email
+	`, clerkID, p.DiscoverableByUsername, p.DiscoverableByEmail).Scan(&p.DiscoverableByUsername, &p.DiscoverableByEmail)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update privacy settings: %w", err)
+	}
+	return p, nil
+}
+
+// Search finds users whose username starts with query, or whose email is
+// query, among those who let the user find them that way. Blocked users,
+// in either direction, are never found.
+func (s *PrivacyService) Search(ctx context.Context, clerkID, query string, limit int) ([]*privacy.UserSummary, error) {
+	userID, err := s.userID(ctx, clerkID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, `
+	SELECT u.id, u.username, u.first_name, u.last_name, u.image_url
+	FROM users u
+	LEFT JOIN privacy_settings p ON p.user_id = u.id
+	WHERE u.id <> $1 AND `+notBlocked+`
+	AND (
+		(LOWER(u.username) LIKE $2 ESCAPE '\' AND (COALESCE(p.discoverable_by_username, TRUE) OR `+visibleTo+`))
+		OR (LOWER(u.email) = $3 AND (COALESCE(p.discoverable_by_email, TRUE) OR `+visibleTo+`))
+	)
+	ORDER BY LOWER(u.username) = $3 DESC, LOWER(u.username)
+	LIMIT $4
+	`, userID, escapeLike(strings.ToLower(query))+"%", strings.ToLower(query), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []*privacy.UserSummary{}
+	for rows.Next() {
+		var u privacy.UserSummary
+		if err := rows.Scan(&u.UserID, &u.Username, &u.FirstName, &u.LastName, &u.ImageURL); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, &u)
+	}
+	return users, rows.Err()
+}
+
+func (s *PrivacyService) ListBlocks(ctx context.Context, clerkID string) ([]*privacy.BlockedUser, error) {
+	rows, err := s.db.Query(ctx, `
+	SELECT u.id, u.username, u.first_name, u.last_name, u.image_url, b.created_at
+	FROM user_blocks b
+	JOIN users u ON u.id = b.blocked_id
+	WHERE b.blocker_id = (SELECT id FROM users WHERE clerk_id = $1)
+	ORDER BY b.created_at DESC
+	`, clerkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blocks: %w", err)
+	}
+	defer rows.Close()
+
+	blocks := []*privacy.BlockedUser{}
+	for rows.Next() {
+		var b privacy.BlockedUser
+		if err := rows.Scan(&b.UserID, &b.Username, &b.FirstName, &b.LastName, &b.ImageURL, &b.BlockedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan block: %w", err)
+		}
+		blocks = append(blocks, &b)
+	}
+	return blocks, rows.Err()
+}
+
+// Block blocks otherID. Their friendship or pending requests with the user
+// are dissolved and shares between the two revoked, both ways. Blocking
+// again changes nothing.
+func (s *PrivacyService) Block(ctx context.Context, clerkID string, otherID uuid.UUID) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID uuid.UUID
+	err = tx.QueryRow(ctx, `
+	SELECT u.id FROM users u, users o WHERE u.clerk_id = $1 AND o.id = $2
+	`, clerkID, otherID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up users: %w", err)
+	}
+	if userID == otherID {
+		return ErrBlockSelf
+	}
+
+	// A friend request racing the block can't recreate the friendship
+	if err := lockUserPair(ctx, tx, userID, otherID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+	INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)
+	ON CONFLICT DO NOTHING
+	`, userID, otherID); err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+	DELETE FROM friendships
+	WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1)
+	`, userID, otherID); err != nil {
+		return fmt.Errorf("failed to remove friendship: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+	DELETE FROM shares
+	WHERE kind = 'user' AND ((owner_id = $1 AND grantee_id = $2) OR (owner_id = $2 AND grantee_id = $1))
+	`, userID, otherID); err != nil {
+		return fmt.Errorf("failed to revoke shares: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Unblock lifts a block. Friendships it dissolved stay dissolved.
+func (s *PrivacyService) Unblock(ctx context.Context, clerkID string, otherID uuid.UUID) error {
+	tag, err := s.db.Exec(ctx, `
+	DELETE FROM user_blocks
+	WHERE blocker_id = (SELECT id FROM users WHERE clerk_id = $1) AND blocked_id = $2
+	`, clerkID, otherID)
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBlockNotFound
+	}
+	return nil
+}
+
+func (s *PrivacyService) userID(ctx context.Context, clerkID string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := s.db.QueryRow(ctx, `SELECT id FROM users WHERE clerk_id = $1`, clerkID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, ErrUserNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	return id, nil
+}
+
+// findUser resolves a username or email to the user it names, as seen by
+// viewerID: users who turned off discovery that way, and users blocked in
+// either direction, aren't found. An exact username wins over an email.
+func findUser(ctx context.Context, q querier, viewerID uuid.UUID, recipient string) (uuid.UUID, string, error) {
+	var (
+		id    uuid.UUID
+		email string
+	)
+	err := q.QueryRow(ctx, `
+	SELECT u.id, u.email
+	FROM users u
+	LEFT JOIN privacy_settings p ON p.user_id = u.id
+	WHERE `+notBlocked+`
+	AND (
+		(LOWER(u.username) = LOWER($2) AND (COALESCE(p.discoverable_by_username, TRUE) OR `+visibleTo+`))
+		OR (LOWER(u.email) = LOWER($2) AND (COALESCE(p.discoverable_by_email, TRUE) OR `+visibleTo+`))
+	)
+	ORDER BY LOWER(u.username) = LOWER($2) DESC
+	LIMIT 1
+	`, viewerID, recipient).Scan(&id, &email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, "", ErrUserNotFound
+	}
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("failed to look up user: %w", err)
+	}
+	return id, email, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s, with \ as the escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
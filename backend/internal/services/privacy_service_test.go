@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/types/privacy"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"alice", "alice"},
+		{"100%", `100\%`},
+		{"a_b", `a\_b`},
+		{`back\slash`, `back\\slash`},
+		{`%_\`, `\%\_\\`},
+	}
+	for _, tt := range tests {
+		if got := escapeLike(tt.in); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// usernames returns the usernames clerkID finds searching for query.
+func usernames(t *testing.T, s *PrivacyService, clerkID, query string) []string {
+	t.Helper()
+	users, err := s.Search(context.Background(), clerkID, query, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, u := range users {
+		names = append(names, u.Username)
+	}
+	return names
+}
+
+// Search honours each user's discoverability settings, except between
+// friends, and treats LIKE wildcards in the query literally.
+func TestSearchUsers(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := NewPrivacyService(db)
+	alice := dbtest.User(t, db, "alice")
+	alina := dbtest.User(t, db, "alina")
+	dbtest.User(t, db, "a_c")
+	dbtest.User(t, db, "abc")
+
+	if got := usernames(t, s, "clerk_alice", "a_"); !slices.Equal(got, []string{"a_c"}) {
+		t.Errorf("searching a_ found %v, want only a_c", got)
+	}
+	if got := usernames(t, s, "clerk_abc", "al"); !slices.Equal(got, []string{"alice", "alina"}) {
+		t.Errorf("searching al found %v", got)
+	}
+
+	if _, err := s.UpdateSettings(ctx, "clerk_alina", &privacy.Settings{DiscoverableByUsername: false, DiscoverableByEmail: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(t, s, "clerk_abc", "al"); !slices.Equal(got, []string{"alice"}) {
+		t.Errorf("with alina hidden by username found %v", got)
+	}
+	if got := usernames(t, s, "clerk_abc", "ALINA@example.com"); !slices.Equal(got, []string{"alina"}) {
+		t.Errorf("searching alina's email found %v", got)
+	}
+
+	dbtest.Exec(t, db, `INSERT INTO friendships (user_id, friend_id, status) VALUES ($1, $2, 'accepted')`, alice, alina)
+	if got := usernames(t, s, "clerk_alice", "al"); !slices.Equal(got, []string{"alina"}) {
+		t.Errorf("alina's friend found %v, want alina", got)
+	}
+}
+
+// Blocking hides both users from each other and dissolves what connects
+// them; unblocking doesn't bring it back.
+func TestBlock(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := NewPrivacyService(db)
+	alice := dbtest.User(t, db, "alice")
+	bob := dbtest.User(t, db, "bob")
+	dbtest.Device(t, db, "dev-1", alice)
+	dbtest.Exec(t, db, `INSERT INTO friendships (user_id, friend_id, status) VALUES ($1, $2, 'accepted')`, alice, bob)
+	dbtest.Exec(t, db, `
+	INSERT INTO shares (id, device_id, owner_id, kind, grantee_id) VALUES ($1, 'dev-1', $2, 'user', $3)
+	`, uuid.New(), alice, bob)
+
+	if err := s.Block(ctx, "clerk_alice", alice); !errors.Is(err, ErrBlockSelf) {
+		t.Errorf("blocking yourself: %v, want ErrBlockSelf", err)
+	}
+	if err := s.Block(ctx, "clerk_alice", uuid.New()); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("blocking an unknown user: %v, want ErrUserNotFound", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Block(ctx, "clerk_alice", bob); err != nil {
+			t.Fatalf("Block #%d: %v", i+1, err)
+		}
+	}
+
+	if got := usernames(t, s, "clerk_bob", "alice"); len(got) != 0 {
+		t.Errorf("the blocked user found %v", got)
+	}
+	if got := usernames(t, s, "clerk_alice", "bob"); len(got) != 0 {
+		t.Errorf("the blocker found %v", got)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM friendships`); n != 0 {
+		t.Errorf("%d friendships left, want none", n)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM shares`); n != 0 {
+		t.Errorf("%d shares left, want none", n)
+	}
+	if blocks, err := s.ListBlocks(ctx, "clerk_alice"); err != nil || len(blocks) != 1 {
+		t.Errorf("ListBlocks = %d, %v; want bob", len(blocks), err)
+	}
+
+	if err := s.Unblock(ctx, "clerk_bob", alice); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("unblocking as the blocked user: %v, want ErrBlockNotFound", err)
+	}
+	if err := s.Unblock(ctx, "clerk_alice", bob); err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(t, s, "clerk_bob", "alice"); !slices.Equal(got, []string{"alice"}) {
+		t.Errorf("after unblocking found %v, want alice", got)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM friendships`); n != 0 {
+		t.Errorf("unblocking restored %d friendships", n)
+	}
+}
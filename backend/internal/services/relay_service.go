@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/types/relay"
+)
+
+// relayMonth is the relay_usage month of the current time.
+const relayMonth = `date_trunc('month', NOW() AT TIME ZONE 'UTC')::date`
+
+// RelayService decides who may reach a device through the relay and accounts
+// the traffic against the device owner's plan.
+type RelayService struct {
+	db            *pgxpool.Pool
+	subscriptions *SubscriptionService
+}
+
+func NewRelayService(db *pgxpool.Pool, subscriptions *SubscriptionService) *RelayService {
+	return &RelayService{
+		db:            db,
+		subscriptions: subscriptions,
+	}
+}
+
+// Authorize returns the user's access to the device. Users who neither own
+// the device nor hold an active share of it get ErrDeviceNotFound.
+func (s *RelayService) Authorize(ctx context.Context, clerkID, deviceID string) (*relay.Access, error) {
+	rows, err := s.db.Query(ctx, `
+	SELECT d.owner_id, u.id, s.path, s.permission
+	FROM devices d
+	JOIN users u ON u.clerk_id = $2
+	LEFT JOIN shares s ON s.device_id = d.id AND s.kind = 'user' AND s.grantee_id = u.id
+		AND (s.expires_at IS NULL OR s.expires_at > NOW())
+	WHERE d.id = $1 AND d.owner_id IS NOT NULL
+	AND (d.owner_id = u.id OR s.id IS NOT NULL)
+	`, deviceID, clerkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize relay: %w", err)
+	}
+	defer rows.Close()
+
+	var access *relay.Access
+	for rows.Next() {
+		var (
+			ownerID, userID  uuid.UUID
+			path, permission *string
+		)
+		if err := rows.Scan(&ownerID, &userID, &path, &permission); err != nil {
+			return nil, fmt.Errorf("failed to scan relay access: %w", err)
+		}
+		if access == nil {
+			access = &relay.Access{DeviceID: deviceID, OwnerID: ownerID, UserID: userID, Owner: ownerID == userID}
+		}
+		if !access.Owner && path != nil {
+			access.Grants = append(access.Grants, relay.Grant{Path: *path, Permission: *permission})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to authorize relay: %w", err)
+	}
+	if access == nil {
+		return nil, ErrDeviceNotFound
+	}
+	return access, nil
+}
+
+// CheckAllowance returns an *EntitlementError once the device owner's plan
+// allowance for the month is used up.
+func (s *RelayService) CheckAllowance(ctx context.Context, access *relay.Access) error {
+	return s.subscriptions.CheckRelayLimit(ctx, s.db, access.OwnerID)
+}
+
+// RecordUsage adds relayed traffic to the device owner's monthly usage. In is
+// traffic towards the device, out is traffic from it.
+func (s *RelayService) RecordUsage(ctx context.Context, access *relay.Access, in, out int64) error {
+	if in == 0 && out == 0 {
+		return nil
+	}
+	if _, err := s.db.Exec(ctx, `
+	INSERT INTO relay_usage (user_id, device_id, month, bytes_in, bytes_out)
+	VALUES ($1, $2, `+relayMonth+`, $3, $4)
+	ON CONFLICT (user_id, device_id, month) DO UPDATE
+	SET bytes_in = relay_usage.bytes_in + EXCLUDED.bytes_in,
+		bytes_out = relay_usage.bytes_out + EXCLUDED.bytes_out
+	`, access.OwnerID, access.DeviceID, in, out); err != nil {
+		return fmt.Errorf("failed to record relay usage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/types/release"
+)
+
+const releaseColumns = `id, product, version, channel, platform, filename, size, sha256, signature, notes, path, created_at`
+
+// ReleaseService publishes downloadable artifacts into dir, which the static
+// file server exposes at baseURL.
+type ReleaseService struct {
+	db      *pgxpool.Pool
+	dir     string
+	baseURL string
+}
+
+func NewReleaseService(db *pgxpool.Pool, dir, baseURL string) *ReleaseService {
+	return &ReleaseService{
+		db:      db,
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Latest returns the highest version of product for platform. The beta
+// channel also sees stable releases, so beta users are never behind.
+func (s *ReleaseService) Latest(ctx context.Context, product, platform, channel string) (*release.Release, error) {
+	channels := []string{release.ChannelStable}
+	if channel == release.ChannelBeta {
+		channels = append(channels, release.ChannelBeta)
+	}
+
+	rows, err := s.db.Query(ctx, `
+	SELECT `+releaseColumns+` FROM releases
+	WHERE product = $1 AND platform = $2 AND channel = ANY($3)
+	`, product, platform, channels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query releases: %w", err)
+	}
+	defer rows.Close()
+
+	var latest *release.Release
+	for rows.Next() {
+		rel, err := scanRelease(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan release: %w", err)
+		}
+		if latest == nil || compareVersions(rel.Version, latest.Version) > 0 {
+			latest = rel
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, ErrReleaseNotFound
+	}
+
+	s.fillDownloadURL(latest)
+	return latest, nil
+}
+
+// Publish writes the file under <product>/<version>/<platform>/<id>/ and
+// records the release. The file only becomes visible once it is complete and
+// its checksum matched, and never replaces another release's file. Versions
+// are stored without a "v" prefix, so v1.2.3 and 1.2.3 are the same release.
+func (s *ReleaseService) Publish(ctx context.Context, form *release.UploadForm, filename string, file io.Reader) (*release.Release, error) {
+	rel := &release.Release{
+		ID:        uuid.New(),
+		Product:   form.Product,
+		Version:   strings.TrimPrefix(form.Version, "v"),
+		Channel:   form.Channel,
+		Platform:  form.Platform,
+		Filename:  filename,
+		Signature: form.Signature,
+		Notes:     form.Notes,
+	}
+	rel.Path = path.Join(rel.Product, rel.Version, rel.Platform, rel.ID.String(), filename)
+
+	parent := filepath.Join(s.dir, rel.Product, rel.Version, rel.Platform)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(parent, "."+filename+"-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	rel.Size, err = io.Copy(io.MultiWriter(tmp, hash), file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store release file: %w", err)
+	}
+	rel.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if form.SHA256 != "" && !strings.EqualFold(form.SHA256, rel.SHA256) {
+		return nil, ErrChecksumMismatch
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The unique key serialises concurrent uploads of the same release, so
+	// only the winner's file is moved into place
+	err = tx.QueryRow(ctx, `
+	INSERT INTO releases (id, product, version, channel, platform, filename, size, sha256, signature, notes, path)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	RETURNING created_at
+	`, rel.ID, rel.Product, rel.Version, rel.Channel, rel.Platform, rel.Filename, rel.Size, rel.SHA256, rel.Signature, rel.Notes, rel.Path).Scan(&rel.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrReleaseExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record release: %w", err)
+	}
+
+	dst := filepath.Join(s.dir, filepath.FromSlash(rel.Path))
+	if err := os.Mkdir(filepath.Dir(dst), 0o755); err != nil {
+		return nil, err
+	}
+	// Unlike a rename, a link fails rather than replace an existing file
+	if err := os.Link(tmp.Name(), dst); err != nil {
+		os.Remove(filepath.Dir(dst))
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		os.Remove(dst)
+		os.Remove(filepath.Dir(dst))
+		return nil, err
+	}
+
+	s.fillDownloadURL(rel)
+	return rel, nil
+}
+
+func (s *ReleaseService) fillDownloadURL(rel *release.Release) {
+	rel.DownloadURL = s.baseURL + "/" + rel.Path
+}
+
+func scanRelease(row pgx.Row) (*release.Release, error) {
+	rel := &release.Release{}
+	err := row.Scan(
+		&rel.ID,
+		&rel.Product,
+		&rel.Version,
+		&rel.Channel,
+		&rel.Platform,
+		&rel.Filename,
+		&rel.Size,
+		&rel.SHA256,
+		&rel.Signature,
+		&rel.Notes,
+		&rel.Path,
+		&rel.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// compareVersions orders semantic versions like 1.4.0, v1.10.2 and
+// 2.0.0-beta.3, returning -1, 0 or 1. A pre-release sorts before its release.
+func compareVersions(a, b string) int {
+	aCore, aPre, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	bCore, bPre, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+
+	if c := compareDotted(aCore, bCore); c != 0 {
+		return c
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return compareDotted(aPre, bPre)
+}
+
+// compareDotted compares dot-separated identifiers, numerically where both
+// sides are numbers.
+func compareDotted(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		if i >= len(as) {
+			return -1
+		}
+		if i >= len(bs) {
+			return 1
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return 0
+}
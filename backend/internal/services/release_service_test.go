@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/types/release"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.4.0", "1.4.0", 0},
+		{"v1.4.0", "1.4.0", 0},
+		{"1.4.1", "1.4.0", 1},
+		{"1.10.0", "1.9.9", 1},
+		{"2.0.0", "10.0.0", -1},
+		{"1.4", "1.4.0", -1},
+		{"2.0.0-beta.1", "2.0.0", -1},
+		{"2.0.0", "2.0.0-rc.1", 1},
+		{"2.0.0-beta.2", "2.0.0-beta.10", -1},
+		{"2.0.0-alpha", "2.0.0-beta", -1},
+		{"2.0.0-beta.1", "1.9.9", 1},
+	}
+
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := compareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+// A rejected upload is refused before the database is involved, and must
+// not leave anything behind in the releases directory.
+func TestPublishChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	s := NewReleaseService(nil, dir, "http://localhost/assets/releases")
+
+	form := &release.UploadForm{
+		Product:  release.ProductDesktopSync,
+		Version:  "1.0.0",
+		Channel:  release.ChannelBeta,
+		Platform: "windows-x64",
+		SHA256:   strings.Repeat("0", 64),
+	}
+	_, err := s.Publish(context.Background(), form, "sync-setup.exe", strings.NewReader("installer"))
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Publish = %v, want ErrChecksumMismatch", err)
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			t.Errorf("left %s behind", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReleaseDownloadURL(t *testing.T) {
+	s := NewReleaseService(nil, t.TempDir(), "http://localhost/assets/releases/")
+	rel := &release.Release{Path: "desktop-sync/1.0.0/windows-x64/5b0a4a9e-3c9f-4b7e-9d3a-0c6f1f1b2a10/sync-setup.exe"}
+	s.fillDownloadURL(rel)
+
+	want := "http://localhost/assets/releases/desktop-sync/1.0.0/windows-x64/5b0a4a9e-3c9f-4b7e-9d3a-0c6f1f1b2a10/sync-setup.exe"
+	if rel.DownloadURL != want {
+		t.Fatalf("DownloadURL = %q, want %q", rel.DownloadURL, want)
+	}
+}
+
+// v1.2.3 and 1.2.3 are the same release, however it was uploaded.
+func TestPublishNormalizesVersion(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := NewReleaseService(db, t.TempDir(), "http://localhost/assets/releases")
+	publish := func(version string) (*release.Release, error) {
+		form := &release.UploadForm{Product: release.ProductDesktopSync, Version: version, Channel: release.ChannelStable, Platform: "windows-x64"}
+		return s.Publish(ctx, form, "sync-setup.exe", strings.NewReader("installer"))
+	}
+
+	rel, err := publish("v1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version != "1.2.3" || !strings.HasPrefix(rel.Path, "desktop-sync/1.2.3/") {
+		t.Errorf("published %s at %s, want 1.2.3 without the prefix", rel.Version, rel.Path)
+	}
+	if _, err := publish("1.2.3"); !errors.Is(err, ErrReleaseExists) {
+		t.Errorf("publishing 1.2.3 after v1.2.3: %v, want ErrReleaseExists", err)
+	}
+
+	// The database holds rows written some other way to the same rule
+	_, err = db.Exec(ctx, `
+	INSERT INTO releases (id, product, version, channel, platform, filename, size, sha256)
+	VALUES ($1, 'desktop-sync', 'v1.2.3', 'stable', 'windows-x64', 'sync-setup.exe', 0, '')
+	`, uuid.New())
+	if err == nil {
+		t.Error("inserted v1.2.3 next to 1.2.3")
+	}
+}
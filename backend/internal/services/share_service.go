@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/mailer"
+	"github.com/strct-org/portal/backend/internal/types/notification"
+	"github.com/strct-org/portal/backend/internal/types/share"
+)
+
+const shareSelect = `
+SELECT sh.id, sh.device_id, d.friendly_name, sh.owner_id, o.username, sh.kind, sh.grantee_id,
+	COALESCE(g.username, ''), sh.path, sh.permission, sh.expires_at, sh.created_at
+FROM shares sh
+JOIN devices d ON d.id = sh.device_id
+JOIN users o ON o.id = sh.owner_id
+LEFT JOIN users g ON g.id = sh.grantee_id
+`
+
+type ShareService struct {
+	db            *pgxpool.Pool
+	subscriptions *SubscriptionService
+	events        *events.Broker
+	notifications *NotificationService
+	emails        *EmailService
+	baseURL       string
+}
+
+// NewShareService builds public link URLs on baseURL.
+func NewShareService(db *pgxpool.Pool, subscriptions *SubscriptionService, broker *events.Broker, notifications *NotificationService, emails *EmailService, baseURL string) *ShareService {
+	return &ShareService{
+		db:            db,
+		subscriptions: subscriptions,
+		events:        broker,
+		notifications: notifications,
+		emails:        emails,
+		baseURL:       baseURL,
+	}
+}
+
+// CreateShare shares a path on one of the user's devices. req must already be
+// validated. Sharing the same path with the same user again updates the
+// existing share; public links count against the plan.
+func (s *ShareService) CreateShare(ctx context.Context, clerkID, deviceID string, req *share.CreateShareRequest) (*share.Share, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var ownerID uuid.UUID
+	err = tx.QueryRow(ctx, `
+	SELECT u.id FROM users u
+	JOIN devices d ON d.owner_id = u.id
+	WHERE u.clerk_id = $1 AND d.id = $2
+	`, clerkID, deviceID).Scan(&ownerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up device: %w", err)
+	}
+
+	id := uuid.New()
+	var (
+		linkURL      string
+		created      bool
+		granteeEmail string
+	)
+
+	switch req.Kind {
+	case share.KindUser:
+		// Users who blocked the owner, or were blocked by them, aren't found
+		granteeID, email, err := findUser(ctx, tx, ownerID, req.Grantee)
+		if err != nil {
+			return nil, err
+		}
+		granteeEmail = email
+		if granteeID == ownerID {
+			return nil, ErrShareWithSelf
+		}
+
+		err = tx.QueryRow(ctx, `
+		INSERT INTO shares (id, device_id, owner_id, kind, grantee_id, path, permission, expires_at)
+		VALUES ($1, $2, $3, 'user', $4, $5, $6, $7)
+		ON CONFLICT (device_id, grantee_id, path) WHERE kind = 'user'
+		DO UPDATE SET permission = EXCLUDED.permission, expires_at = EXCLUDED.expires_at
+		RETURNING id, xmax = 0
+		`, id, deviceID, ownerID, granteeID, req.Path, req.Permission, req.ExpiresAt).Scan(&id, &created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create share: %w", err)
+		}
+
+	case share.KindLink:
+		if err := lockUser(ctx, tx, ownerID); err != nil {
+			return nil, err
+		}
+		if err := s.subscriptions.CheckPublicLinkLimit(ctx, tx, ownerID); err != nil {
+			return nil, err
+		}
+
+		token, err := randomToken()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, `
+		INSERT INTO shares (id, device_id, owner_id, kind, token_hash, path, permission, expires_at)
+		VALUES ($1, $2, $3, 'link', $4, $5, 'read', $6)
+		`, id, deviceID, ownerID, hashSecret(token), req.Path, req.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to create link: %w", err)
+		}
+		linkURL = fmt.Sprintf("%s/api/v1/shares/links/%s", s.baseURL, url.PathEscape(token))
+
+	default:
+		return nil, fmt.Errorf("unknown share kind %q", req.Kind)
+	}
+
+	sh, err := scanShare(tx.QueryRow(ctx, shareSelect+`WHERE sh.id = $1`, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load share: %w", err)
+	}
+	if created {
+		if err := s.emails.Enqueue(ctx, tx, sh.GranteeID, mailer.TemplateShareReceived, granteeEmail, sh); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if sh.GranteeID != nil {
+		s.events.Publish(*sh.GranteeID, events.TypeShareReceived, sh)
+	}
+	// Changing the permission or expiry of a share isn't news to the grantee
+	if created {
+		err := s.notifications.Notify(ctx, *sh.GranteeID, &notification.Draft{
+			Type:  notification.TypeShareReceived,
+			Title: fmt.Sprintf("%s shared %s with you", sh.OwnerUsername, sh.Path),
+			Body:  fmt.Sprintf("On %s, with %s access.", sh.DeviceName, sh.Permission),
+			Data:  map[string]any{"shareId": sh.ID, "deviceId": sh.DeviceID},
+		})
+		if err != nil {
+			log.Printf("Error notifying grantee of share %s: %v", sh.ID, err)
+		}
+	}
+	sh.URL = linkURL
+	return sh, nil
+}
+
+// ListDeviceShares returns the active shares of a device the user owns.
+func (s *ShareService) ListDeviceShares(ctx context.Context, clerkID, deviceID string) ([]*share.Share, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx, `
+	SELECT EXISTS (
+		SELECT 1 FROM devices WHERE id = $1 AND owner_id = (SELECT id FROM users WHERE clerk_id = $2)
+	)`, deviceID, clerkID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up device: %w", err)
+	}
+	if !exists {
+		return nil, ErrDeviceNotFound
+	}
+
+	return s.list(ctx, shareSelect+`
+	WHERE sh.device_id = $1 AND (sh.expires_at IS NULL OR sh.expires_at > NOW())
+	ORDER BY sh.created_at
+	`, deviceID)
+}
+
+// ListReceivedShares returns what other users have shared with the user.
+func (s *ShareService) ListReceivedShares(ctx context.Context, clerkID string) ([]*share.Share, error) {
+	return s.list(ctx, shareSelect+`
+	WHERE sh.grantee_id = (SELECT id FROM users WHERE clerk_id = $1)
+	AND (sh.expires_at IS NULL OR sh.expires_at > NOW())
+	ORDER BY sh.created_at DESC
+	`, clerkID)
+}
+
+func (s *ShareService) list(ctx context.Context, query string, args ...any) ([]*share.Share, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []*share.Share{}
+	for rows.Next() {
+		sh, err := scanShare(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share: %w", err)
+		}
+		shares = append(shares, sh)
+	}
+	return shares, rows.Err()
+}
+
+// DeleteShare revokes a share. The owner can revoke any of their shares and a
+// grantee can remove one shared with them.
+func (s *ShareService) DeleteShare(ctx context.Context, clerkID string, id uuid.UUID) error {
+	result, err := s.db.Exec(ctx, `
+	DELETE FROM shares
+	WHERE id = $1 AND (SELECT id FROM users WHERE clerk_id = $2) IN (owner_id, grantee_id)
+	`, id, clerkID)
+	if err != nil {
+		return fmt.Errorf("failed to delete share: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+// ResolveLink returns what a public link points at.
+func (s *ShareService) ResolveLink(ctx context.Context, token string) (*share.LinkInfo, error) {
+	info := &share.LinkInfo{}
+	err := s.db.QueryRow(ctx, `
+	SELECT sh.device_id, d.friendly_name, o.username, sh.path, sh.expires_at
+	FROM shares sh
+	JOIN devices d ON d.id = sh.device_id
+	JOIN users o ON o.id = sh.owner_id
+	WHERE sh.token_hash = $1 AND sh.kind = 'link' AND (sh.expires_at IS NULL OR sh.expires_at > NOW())
+	`, hashSecret(token)).Scan(&info.DeviceID, &info.DeviceName, &info.OwnerUsername, &info.Path, &info.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve link: %w", err)
+	}
+	return info, nil
+}
+
+func scanShare(row pgx.Row) (*share.Share, error) {
+	sh := &share.Share{}
+	err := row.Scan(
+		&sh.ID,
+		&sh.DeviceID,
+		&sh.DeviceName,
+		&sh.OwnerID,
+		&sh.OwnerUsername,
+		&sh.Kind,
+		&sh.GranteeID,
+		&sh.GranteeUsername,
+		&sh.Path,
+		&sh.Permission,
+		&sh.ExpiresAt,
+		&sh.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sh, nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/database/dbtest"
+	"github.com/strct-org/portal/backend/internal/events"
+	"github.com/strct-org/portal/backend/internal/types/share"
+	"github.com/strct-org/portal/backend/internal/types/subscription"
+)
+
+func newTestShareService(db *pgxpool.Pool) *ShareService {
+	broker := events.New()
+	return NewShareService(db, NewSubscriptionService(db), broker, NewNotificationService(db, broker), NewEmailService(db, nil), "https://portal.test")
+}
+
+// Sharing the same path with a user again updates the share instead of
+// adding one, and only the first share tells the grantee.
+func TestCreateUserShare(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := newTestShareService(db)
+	alice := dbtest.User(t, db, "alice")
+	bob := dbtest.User(t, db, "bob")
+	dbtest.Device(t, db, "dev-1", alice)
+
+	read := &share.CreateShareRequest{Kind: share.KindUser, Grantee: "bob", Path: "/photos", Permission: share.PermissionRead}
+	if _, err := s.CreateShare(ctx, "clerk_bob", "dev-1", read); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("sharing someone else's device: %v, want ErrDeviceNotFound", err)
+	}
+	self := &share.CreateShareRequest{Kind: share.KindUser, Grantee: "alice", Path: "/", Permission: share.PermissionRead}
+	if _, err := s.CreateShare(ctx, "clerk_alice", "dev-1", self); !errors.Is(err, ErrShareWithSelf) {
+		t.Errorf("sharing with yourself: %v, want ErrShareWithSelf", err)
+	}
+
+	first, err := s.CreateShare(ctx, "clerk_alice", "dev-1", read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := &share.CreateShareRequest{Kind: share.KindUser, Grantee: "BOB@example.com", Path: "/photos", Permission: share.PermissionWrite}
+	second, err := s.CreateShare(ctx, "clerk_alice", "dev-1", write)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID || second.Permission != share.PermissionWrite {
+		t.Errorf("sharing again = %s with %s, want %s updated to write", second.ID, second.Permission, first.ID)
+	}
+
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM notifications WHERE user_id = $1`, bob); n != 1 {
+		t.Errorf("grantee got %d notifications, want 1", n)
+	}
+	if n := dbtest.Count(t, db, `SELECT COUNT(*) FROM email_outbox WHERE user_id = $1`, bob); n != 1 {
+		t.Errorf("grantee got %d emails, want 1", n)
+	}
+
+	// Either side can remove the share, nobody else can
+	dbtest.User(t, db, "carol")
+	if err := s.DeleteShare(ctx, "clerk_carol", first.ID); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("a stranger deleting: %v, want ErrShareNotFound", err)
+	}
+	if err := s.DeleteShare(ctx, "clerk_bob", first.ID); err != nil {
+		t.Errorf("the grantee deleting: %v", err)
+	}
+}
+
+// Live public links count against the plan; expired ones don't.
+func TestPublicLinkLimit(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	s := newTestShareService(db)
+	alice := dbtest.User(t, db, "alice")
+	dbtest.Device(t, db, "dev-1", alice)
+
+	link := &share.CreateShareRequest{Kind: share.KindLink, Path: "/public"}
+	var first *share.Share
+	for i := int64(0); i < 5; i++ {
+		sh, err := s.CreateShare(ctx, "clerk_alice", "dev-1", link)
+		if err != nil {
+			t.Fatalf("link %d: %v", i+1, err)
+		}
+		if first == nil {
+			first = sh
+		}
+	}
+
+	var entErr *EntitlementError
+	_, err := s.CreateShare(ctx, "clerk_alice", "dev-1", link)
+	if !errors.As(err, &entErr) || entErr.Feature != FeaturePublicLinks || entErr.UpgradeTo != subscription.PlanPlus {
+		t.Fatalf("link over the free limit: %v, want an entitlement error suggesting plus", err)
+	}
+
+	dbtest.Exec(t, db, `UPDATE shares SET expires_at = NOW() - INTERVAL '1 minute' WHERE id = $1`, first.ID)
+	sh, err := s.CreateShare(ctx, "clerk_alice", "dev-1", link)
+	if err != nil {
+		t.Fatalf("link after one expired: %v", err)
+	}
+	if sh.URL == "" {
+		t.Error("a new link has no URL")
+	}
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/plans"
+	"github.com/strct-org/portal/backend/internal/types/subscription"
+)
+
+const (
+	FeatureDevices     = "devices"
+	FeaturePublicLinks = "public_links"
+	FeatureRelay       = "relay_bandwidth"
+)
+
+// EntitlementError reports that an action would exceed the user's plan.
+// UpgradeTo is the cheapest plan that allows it, or empty when none does.
+type EntitlementError struct {
+	Feature   string
+	Plan      string
+	Limit     int64
+	UpgradeTo string
+}
+
+func (e *EntitlementError) Error() string {
+	return fmt.Sprintf("%s limit of %d reached on the %s plan", e.Feature, e.Limit, e.Plan)
+}
+
+// querier is satisfied by both the pool and a transaction, so limit checks can
+// run inside the transaction that consumes the entitlement.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type SubscriptionService struct {
+	db *pgxpool.Pool
+}
+
+func NewSubscriptionService(db *pgxpool.Pool) *SubscriptionService {
+	return &SubscriptionService{
+		db: db,
+	}
+}
+
+func (s *SubscriptionService) get(ctx context.Context, q querier, userID uuid.UUID) (*subscription.Subscription, error) {
+	query := `
+	SELECT plan, status, current_period_end, cancel_at_period_end
+	FROM subscriptions
+	WHERE user_id = $1
+	`
+
+	sub := &subscription.Subscription{}
+	err := q.QueryRow(ctx, query, userID).Scan(&sub.Plan, &sub.Status, &sub.CurrentPeriodEnd, &sub.CancelAtPeriodEnd)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &subscription.Subscription{Plan: subscription.PlanFree, Status: subscription.StatusActive}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	return sub, nil
+}
+
+// EffectivePlan is the plan whose limits apply now. Lapsed subscriptions keep
+// their plan until the paid period ends and drop to free after that.
+func EffectivePlan(sub *subscription.Subscription, now time.Time) subscription.Plan {
+	if sub.Status == subscription.StatusActive {
+		return plans.Get(sub.Plan)
+	}
+	if sub.CurrentPeriodEnd != nil && now.Before(*sub.CurrentPeriodEnd) {
+		return plans.Get(sub.Plan)
+	}
+	return plans.Get(subscription.PlanFree)
+}
+
+// Entitlements returns the user's subscription alongside current usage.
+func (s *SubscriptionService) Entitlements(ctx context.Context, clerkID string) (*subscription.Entitlements, error) {
+	var userID uuid.UUID
+	err := s.db.QueryRow(ctx, `SELECT id FROM users WHERE clerk_id = $1`, clerkID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	sub, err := s.get(ctx, s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	plan := EffectivePlan(sub, time.Now())
+
+	devices, err := countDevices(ctx, s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	links, err := countPublicLinks(ctx, s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	relayed, err := countRelayBytes(ctx, s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscription.Entitlements{
+		Subscription:  *sub,
+		EffectivePlan: plan,
+		Devices:       subscription.Usage{Used: devices, Limit: plan.MaxDevices},
+		PublicLinks:   subscription.Usage{Used: links, Limit: plan.MaxPublicLinks},
+		Relay:         subscription.Usage{Used: relayed, Limit: plan.RelayBytesPerMonth},
+	}, nil
+}
+
+// CheckDeviceLimit returns an *EntitlementError when the user can't pair
+// another device. Call it inside the transaction that pairs the device, after
+// lockUser, so concurrent claims can't both pass.
+func (s *SubscriptionService) CheckDeviceLimit(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	return s.check(ctx, tx, userID, FeatureDevices, countDevices, func(p subscription.Plan) int64 { return p.MaxDevices })
+}
+
+// CheckPublicLinkLimit is CheckDeviceLimit for public share links.
+func (s *SubscriptionService) CheckPublicLinkLimit(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	return s.check(ctx, tx, userID, FeaturePublicLinks, countPublicLinks, func(p subscription.Plan) int64 { return p.MaxPublicLinks })
+}
+
+// CheckRelayLimit returns an *EntitlementError once the user's devices have
+// relayed their plan's monthly allowance. It needs no lock: a request already
+// under way may overshoot the allowance a little.
+func (s *SubscriptionService) CheckRelayLimit(ctx context.Context, q querier, userID uuid.UUID) error {
+	return s.check(ctx, q, userID, FeatureRelay, countRelayBytes, func(p subscription.Plan) int64 { return p.RelayBytesPerMonth })
+}
+
+func (s *SubscriptionService) check(
+	ctx context.Context,
+	q querier,
+	userID uuid.UUID,
+	feature string,
+	count func(context.Context, querier, uuid.UUID) (int64, error),
+	limit func(subscription.Plan) int64,
+) error {
+	sub, err := s.get(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+	plan := EffectivePlan(sub, time.Now())
+	if limit(plan) == subscription.Unlimited {
+		return nil
+	}
+
+	used, err := count(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+	if used < limit(plan) {
+		return nil
+	}
+
+	entErr := &EntitlementError{Feature: feature, Plan: plan.ID, Limit: limit(plan)}
+	if upgrade, ok := plans.UpgradeFor(plan.ID, limit); ok {
+		entErr.UpgradeTo = upgrade.ID
+	}
+	return entErr
+}
+
+// lockUser serialises entitlement checks for one user until tx ends.
+func lockUser(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID)
+	return err
+}
+
+func countDevices(ctx context.Context, q querier, userID uuid.UUID) (int64, error) {
+	var n int64
+	err := q.QueryRow(ctx, `SELECT COUNT(*) FROM devices WHERE owner_id = $1`, userID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count devices: %w", err)
+	}
+	return n, nil
+}
+
+func countPublicLinks(ctx context.Context, q querier, userID uuid.UUID) (int64, error) {
+	var n int64
+	err := q.QueryRow(ctx, `
+	SELECT COUNT(*) FROM shares
+	WHERE owner_id = $1 AND kind = 'link' AND (expires_at IS NULL OR expires_at > NOW())
+	`, userID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count public links: %w", err)
+	}
+	return n, nil
+}
+
+// countRelayBytes sums traffic relayed for the user's devices this month.
+func countRelayBytes(ctx context.Context, q querier, userID uuid.UUID) (int64, error) {
+	var n int64
+	err := q.QueryRow(ctx, `
+	SELECT COALESCE(SUM(bytes_in + bytes_out), 0)::BIGINT FROM relay_usage
+	WHERE user_id = $1 AND month = `+relayMonth+`
+	`, userID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count relayed bytes: %w", err)
+	}
+	return n, nil
+}
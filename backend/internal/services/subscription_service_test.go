@@ -0,0 +1,32 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/strct-org/portal/backend/internal/types/subscription"
+)
+
+func TestEffectivePlan(t *testing.T) {
+	now := time.Now()
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		sub  subscription.Subscription
+		want string
+	}{
+		{"active", subscription.Subscription{Plan: subscription.PlanPro, Status: subscription.StatusActive}, subscription.PlanPro},
+		{"past due within period", subscription.Subscription{Plan: subscription.PlanPro, Status: subscription.StatusPastDue, CurrentPeriodEnd: &later}, subscription.PlanPro},
+		{"canceled within period", subscription.Subscription{Plan: subscription.PlanPlus, Status: subscription.StatusCanceled, CurrentPeriodEnd: &later}, subscription.PlanPlus},
+		{"canceled after period", subscription.Subscription{Plan: subscription.PlanPlus, Status: subscription.StatusCanceled, CurrentPeriodEnd: &earlier}, subscription.PlanFree},
+		{"canceled without period", subscription.Subscription{Plan: subscription.PlanPlus, Status: subscription.StatusCanceled}, subscription.PlanFree},
+		{"unknown plan", subscription.Subscription{Plan: "enterprise", Status: subscription.StatusActive}, subscription.PlanFree},
+	}
+
+	for _, tt := range tests {
+		if got := EffectivePlan(&tt.sub, now).ID; got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/types/subscription"
 	"github.com/strct-org/portal/backend/internal/types/user"
 )
 
@@ -72,14 +73,51 @@ func (s *UserService) CreateUser(ctx context.Context, req *user.CreateUserReques
 }
 
 func (s *UserService) GetUserByClerkID(ctx context.Context, clerkID string) (*user.User, error) {
+	query := `
+	SELECT u.id, u.clerk_id, u.email, u.username, u.first_name, u.last_name, u.image_url, u.email_verified, u.created_at, u.updated_at,
+		COALESCE(s.plan, 'free'), COALESCE(s.status, 'active'), s.current_period_end, COALESCE(s.cancel_at_period_end, FALSE)
+	FROM users u
+	LEFT JOIN subscriptions s ON s.user_id = u.id
+	WHERE u.clerk_id = $1
+	`
+
+	u := &user.User{Subscription: &subscription.Subscription{}}
+	err := s.db.QueryRow(ctx, query, clerkID).Scan(
+		&u.ID,
+		&u.ClerkID,
+		&u.Email,
+		&u.Username,
+		&u.FirstName,
+		&u.LastName,
+		&u.ImageURL,
+		&u.EmailVerified,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+		&u.Subscription.Plan,
+		&u.Subscription.Status,
+		&u.Subscription.CurrentPeriodEnd,
+		&u.Subscription.CancelAtPeriodEnd,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return u, nil
+}
+
+func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
 	query := `
 	SELECT id, clerk_id, email, username, first_name, last_name, image_url, email_verified, created_at, updated_at
 	FROM users
-	WHERE clerk_id = $1
+	WHERE LOWER(email) = LOWER($1)
 	`
 
 	u := &user.User{}
-	err := s.db.QueryRow(ctx, query, clerkID).Scan(
+	err := s.db.QueryRow(ctx, query, email).Scan(
 		&u.ID,
 		&u.ClerkID,
 		&u.Email,
@@ -94,7 +132,7 @@ func (s *UserService) GetUserByClerkID(ctx context.Context, clerkID string) (*us
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -113,65 +151,6 @@ func (s *UserService) UpdateEmailVerification(ctx context.Context, clerkID strin
 	return err
 }
 
-func (s *UserService) GetFriends(ctx context.Context, clerkID string) ([]*user.User, error) {
-	// Note: Ensure you have a 'friendships' table created in your schema for this to work
-	query := `
-    SELECT DISTINCT
-        u.id,
-        u.clerk_id,
-        u.email,
-        u.username,
-        u.first_name,
-        u.last_name,
-        u.image_url,
-        u.email_verified,
-        u.created_at,
-        u.updated_at
-    FROM users u
-    INNER JOIN friendships f ON (
-        (f.user_id = u.id AND f.friend_id = (SELECT id FROM users WHERE clerk_id = $1))
-        OR
-        (f.friend_id = u.id AND f.user_id = (SELECT id FROM users WHERE clerk_id = $1))
-    )
-    WHERE f.status = 'accepted'
-    AND u.clerk_id != $1
-    ORDER BY u.username
-    `
-
-	rows, err := s.db.Query(ctx, query, clerkID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query friends: %w", err)
-	}
-	defer rows.Close()
-
-	var friends []*user.User
-	for rows.Next() {
-		var u user.User
-		err := rows.Scan(
-			&u.ID,
-			&u.ClerkID,
-			&u.Email,
-			&u.Username,
-			&u.FirstName,
-			&u.LastName,
-			&u.ImageURL,
-			&u.EmailVerified,
-			&u.CreatedAt,
-			&u.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan friend: %w", err)
-		}
-		friends = append(friends, &u)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return friends, nil
-}
-
 func (s *UserService) UpdateProfileByClerkID(ctx context.Context, clerkID string, req *user.UpdateProfileRequest) (*user.User, error) {
 	// Logic: COALESCE(NULLIF($N, ''), col) means:
 	// 1. If input is empty string, convert to NULL
@@ -213,7 +192,7 @@ func (s *UserService) UpdateProfileByClerkID(ctx context.Context, clerkID string
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
@@ -230,7 +209,7 @@ func (s *UserService) DeleteUserByClerkID(ctx context.Context, clerkID string) e
 	}
 
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("user not found")
+		return ErrUserNotFound
 	}
 
 	return nil
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/strct-org/portal/backend/internal/types/vpn"
+	wg "github.com/strct-org/portal/backend/internal/vpn"
+)
+
+// vpnAllocationLock serialises address allocation across instances.
+const vpnAllocationLock = 0x76706e // "vpn"
+
+// VPNService hands out WireGuard addresses and keys. Devices register their
+// own public key; clients get a key pair generated here, one per user and
+// device, so the owner can download a ready-to-use config. Only the public
+// half is kept, so each config can be downloaded once.
+type VPNService struct {
+	db      *pgxpool.Pool
+	gateway *wg.Gateway
+}
+
+// NewVPNService returns a service that reports ErrVPNDisabled for everything
+// when gateway is nil.
+func NewVPNService(db *pgxpool.Pool, gateway *wg.Gateway) *VPNService {
+	return &VPNService{
+		db:      db,
+		gateway: gateway,
+	}
+}
+
+// RegisterDevice adds the device to the VPN, or replaces its key when it has
+// joined before. The device keeps its address across key rotations.
+func (s *VPNService) RegisterDevice(ctx context.Context, deviceID, publicKey string) (*vpn.DeviceConfig, error) {
+	if s.gateway == nil {
+		return nil, ErrVPNDisabled
+	}
+
+	err := s.inAllocation(ctx, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `
+		UPDATE vpn_peers SET public_key = $2, updated_at = NOW()
+		WHERE device_id = $1 AND kind = 'device' AND revoked_at IS NULL
+		`, deviceID, publicKey)
+		if err != nil || result.RowsAffected() > 0 {
+			return err
+		}
+
+		addr, err := s.allocate(ctx, tx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+		INSERT INTO vpn_peers (id, device_id, kind, public_key, address)
+		VALUES ($1, $2, 'device', $3, $4)
+		`, uuid.New(), deviceID, publicKey, addr.String())
+		return err
+	})
+	if err != nil {
+		return nil, vpnError("failed to register device", err)
+	}
+
+	return s.DeviceConfig(ctx, deviceID)
+}
+
+// DeviceConfig returns the device's side of the VPN.
+func (s *VPNService) DeviceConfig(ctx context.Context, deviceID string) (*vpn.DeviceConfig, error) {
+	if s.gateway == nil {
+		return nil, ErrVPNDisabled
+	}
+
+	cfg := &vpn.DeviceConfig{
+		Subnet:           s.gateway.Subnet.String(),
+		GatewayAddress:   s.gateway.GatewayAddress().String(),
+		GatewayPublicKey: s.gateway.PublicKey,
+		Endpoint:         s.gateway.Endpoint,
+	}
+	err := s.db.QueryRow(ctx, `
+	SELECT address, public_key, updated_at FROM vpn_peers
+	WHERE device_id = $1 AND kind = 'device' AND revoked_at IS NULL
+	`, deviceID).Scan(&cfg.Address, &cfg.PublicKey, &cfg.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrVPNNotEnabled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device vpn config: %w", err)
+	}
+	return cfg, nil
+}
+
+// ClientConfig returns a wg-quick config for the owner to reach the device,
+// issuing a client peer on first use. Later calls get ErrVPNConfigIssued
+// unless rotate is set, which replaces the client's key pair; configs
+// downloaded before stop working.
+func (s *VPNService) ClientConfig(ctx context.Context, clerkID, deviceID string, rotate bool) ([]byte, error) {
+	if s.gateway == nil {
+		return nil, ErrVPNDisabled
+	}
+
+	var (
+		deviceName, privateKey string
+		address, deviceAddress string
+	)
+	err := s.inAllocation(ctx, func(tx pgx.Tx) error {
+		var userID uuid.UUID
+		err := tx.QueryRow(ctx, `
+		SELECT d.owner_id, d.friendly_name, COALESCE(p.address, '')
+		FROM devices d
+		LEFT JOIN vpn_peers p ON p.device_id = d.id AND p.kind = 'device' AND p.revoked_at IS NULL
+		WHERE d.id = $1 AND d.owner_id = (SELECT id FROM users WHERE clerk_id = $2)
+		`, deviceID, clerkID).Scan(&userID, &deviceName, &deviceAddress)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrDeviceNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if deviceAddress == "" {
+			return ErrVPNNotEnabled
+		}
+
+		err = tx.QueryRow(ctx, `
+		SELECT address FROM vpn_peers
+		WHERE device_id = $1 AND user_id = $2 AND kind = 'client' AND revoked_at IS NULL
+		`, deviceID, userID).Scan(&address)
+		exists := err == nil
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if exists && !rotate {
+			return ErrVPNConfigIssued
+		}
+
+		var publicKey string
+		privateKey, publicKey, err = wg.GenerateKey()
+		if err != nil {
+			return err
+		}
+		if exists {
+			_, err = tx.Exec(ctx, `
+			UPDATE vpn_peers SET public_key = $3, updated_at = NOW()
+			WHERE device_id = $1 AND user_id = $2 AND kind = 'client' AND revoked_at IS NULL
+			`, deviceID, userID, publicKey)
+			return err
+		}
+
+		addr, err := s.allocate(ctx, tx)
+		if err != nil {
+			return err
+		}
+		address = addr.String()
+		_, err = tx.Exec(ctx, `
+		INSERT INTO vpn_peers (id, device_id, user_id, kind, public_key, address)
+		VALUES ($1, $2, $3, 'client', $4, $5)
+		`, uuid.New(), deviceID, userID, publicKey, address)
+		return err
+	})
+	if err != nil {
+		return nil, vpnError("failed to issue client config", err)
+	}
+
+	return s.gateway.ClientConfig(deviceName, privateKey, netip.MustParseAddr(address), netip.MustParseAddr(deviceAddress))
+}
+
+// RevokeClient revokes the owner's client peer for the device.
+func (s *VPNService) RevokeClient(ctx context.Context, clerkID, deviceID string) error {
+	if s.gateway == nil {
+		return ErrVPNDisabled
+	}
+
+	result, err := s.db.Exec(ctx, `
+	UPDATE vpn_peers SET revoked_at = NOW()
+	WHERE device_id = $1 AND kind = 'client' AND revoked_at IS NULL
+	AND user_id = (SELECT id FROM users WHERE clerk_id = $2)
+	`, deviceID, clerkID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke client: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrVPNPeerNotFound
+	}
+	return nil
+}
+
+// RevokeDevice takes the owner's device off the VPN along with every client
+// of it. The device has to register a key to join again.
+func (s *VPNService) RevokeDevice(ctx context.Context, clerkID, deviceID string) error {
+	if s.gateway == nil {
+		return ErrVPNDisabled
+	}
+
+	result, err := s.db.Exec(ctx, `
+	UPDATE vpn_peers SET revoked_at = NOW()
+	WHERE device_id = $1 AND revoked_at IS NULL
+	AND device_id IN (SELECT id FROM devices WHERE owner_id = (SELECT id FROM users WHERE clerk_id = $2))
+	`, deviceID, clerkID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke device: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrVPNPeerNotFound
+	}
+	return nil
+}
+
+// GatewayPeers lists every active peer for the gateway to configure.
+func (s *VPNService) GatewayPeers(ctx context.Context) ([]*vpn.GatewayPeer, error) {
+	if s.gateway == nil {
+		return nil, ErrVPNDisabled
+	}
+
+	rows, err := s.db.Query(ctx, `
+	SELECT public_key, address, kind, device_id FROM vpn_peers
+	WHERE revoked_at IS NULL
+	ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vpn peers: %w", err)
+	}
+	defer rows.Close()
+
+	peers := []*vpn.GatewayPeer{}
+	for rows.Next() {
+		var (
+			p       vpn.GatewayPeer
+			address string
+		)
+		if err := rows.Scan(&p.PublicKey, &address, &p.Kind, &p.DeviceID); err != nil {
+			return nil, fmt.Errorf("failed to scan vpn peer: %w", err)
+		}
+		p.AllowedIPs = []string{address + "/32"}
+		peers = append(peers, &p)
+	}
+	return peers, rows.Err()
+}
+
+// inAllocation runs fn in a transaction holding the allocation lock.
+func (s *VPNService) inAllocation(ctx context.Context, fn func(pgx.Tx) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, vpnAllocationLock); err != nil {
+		return fmt.Errorf("failed to lock vpn allocation: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// allocate returns the lowest free address in the subnet.
+func (s *VPNService) allocate(ctx context.Context, tx pgx.Tx) (netip.Addr, error) {
+	rows, err := tx.Query(ctx, `SELECT address FROM vpn_peers WHERE revoked_at IS NULL`)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to query addresses: %w", err)
+	}
+	taken, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to scan addresses: %w", err)
+	}
+	return lowestFree(s.gateway, taken)
+}
+
+// lowestFree returns the lowest host address of the gateway's subnet that
+// isn't in taken.
+func lowestFree(gateway *wg.Gateway, taken []string) (netip.Addr, error) {
+	used := make(map[string]bool, len(taken))
+	for _, a := range taken {
+		used[a] = true
+	}
+
+	var free netip.Addr
+	gateway.Hosts(func(addr netip.Addr) bool {
+		if used[addr.String()] {
+			return true
+		}
+		free = addr
+		return false
+	})
+	if !free.IsValid() {
+		return netip.Addr{}, ErrVPNSubnetFull
+	}
+	return free, nil
+}
+
+// vpnError passes sentinel errors through and wraps the rest.
+func vpnError(msg string, err error) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_vpn_peers_public_key":
+		return ErrVPNKeyInUse
+	case errors.Is(err, ErrDeviceNotFound), errors.Is(err, ErrVPNNotEnabled), errors.Is(err, ErrVPNSubnetFull),
+		errors.Is(err, ErrVPNConfigIssued):
+		return err
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	wg "github.com/strct-org/portal/backend/internal/vpn"
+)
+
+func TestLowestFree(t *testing.T) {
+	// 10.0.0.0/29 leaves .2 to .6 for peers: .1 is the gateway, .7 broadcast
+	gateway := &wg.Gateway{Subnet: netip.MustParsePrefix("10.0.0.0/29")}
+
+	tests := []struct {
+		name    string
+		taken   []string
+		want    string
+		wantErr error
+	}{
+		{"empty", nil, "10.0.0.2", nil},
+		{"first taken", []string{"10.0.0.2"}, "10.0.0.3", nil},
+		{"gap reused", []string{"10.0.0.2", "10.0.0.4"}, "10.0.0.3", nil},
+		{"outside the subnet ignored", []string{"10.1.0.2"}, "10.0.0.2", nil},
+		{"full", []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}, "", ErrVPNSubnetFull},
+	}
+
+	for _, tt := range tests {
+		got, err := lowestFree(gateway, tt.taken)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == nil && got.String() != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+//go:embed html/*.html
+var files embed.FS
+
+var pages = template.Must(template.ParseFS(files, "html/*.html"))
+
+// Render executes the named page template and writes it as HTML. The page is
+// rendered into a buffer first so a template error doesn't leave a half
+// written response.
+func Render(w http.ResponseWriter, code int, name string, data any) {
+	var buf bytes.Buffer
+	if err := pages.ExecuteTemplate(&buf, name, data); err != nil {
+		log.Printf("Error rendering template %s: %v", name, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+}
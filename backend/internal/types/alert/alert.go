@@ -0,0 +1,57 @@
+package alert
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Rule kinds. Threshold is minutes for KindOffline and a percentage for
+// KindDiskUsage; the others have none.
+const (
+	KindOffline      = "offline"
+	KindDiskUsage    = "disk_usage"
+	KindSMARTWarning = "smart_warning"
+	KindUpdateFailed = "update_failed"
+)
+
+// Rule raises an alert for the user's devices, or only DeviceID when set.
+// An alert stays open while its condition holds; once resolved, the same
+// condition doesn't alert again until CooldownMinutes after it last did.
+type Rule struct {
+	ID              uuid.UUID `json:"id"              db:"id"`
+	DeviceID        *string   `json:"deviceId"        db:"device_id"`
+	Kind            string    `json:"kind"            db:"kind"`
+	Threshold       int       `json:"threshold"       db:"threshold"`
+	CooldownMinutes int       `json:"cooldownMinutes" db:"cooldown_minutes"`
+	Notify          bool      `json:"notify"          db:"notify"`
+	Email           bool      `json:"email"           db:"email"`
+	Enabled         bool      `json:"enabled"         db:"enabled"`
+	CreatedAt       time.Time `json:"createdAt"       db:"created_at"`
+	UpdatedAt       time.Time `json:"updatedAt"       db:"updated_at"`
+}
+
+// RuleRequest creates or replaces a rule. CooldownMinutes defaults to 60;
+// Notify, Email and Enabled default to true.
+type RuleRequest struct {
+	DeviceID        *string `json:"deviceId,omitempty"`
+	Kind            string  `json:"kind"`
+	Threshold       int     `json:"threshold,omitempty"`
+	CooldownMinutes *int    `json:"cooldownMinutes,omitempty"`
+	Notify          *bool   `json:"notify,omitempty"`
+	Email           *bool   `json:"email,omitempty"`
+	Enabled         *bool   `json:"enabled,omitempty"`
+}
+
+// Alert is one firing of a rule for a device. Subject tells apart alerts of
+// the same rule, e.g. the disk name.
+type Alert struct {
+	ID          uuid.UUID  `json:"id"          db:"id"`
+	RuleID      *uuid.UUID `json:"ruleId"      db:"rule_id"`
+	DeviceID    string     `json:"deviceId"    db:"device_id"`
+	Kind        string     `json:"kind"        db:"kind"`
+	Subject     string     `json:"subject"     db:"subject"`
+	Message     string     `json:"message"     db:"message"`
+	TriggeredAt time.Time  `json:"triggeredAt" db:"triggered_at"`
+	ResolvedAt  *time.Time `json:"resolvedAt"  db:"resolved_at"`
+}
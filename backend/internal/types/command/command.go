@@ -0,0 +1,62 @@
+package command
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TypeReboot        = "reboot"
+	TypeRescanStorage = "rescan_storage"
+	TypeRenameShare   = "rename_share"
+)
+
+// A command is queued until a device poll hands it out, delivered until the
+// device acknowledges it, then acknowledged until the device reports the
+// outcome. Commands not finished by ExpiresAt time out.
+const (
+	StatusQueued       = "queued"
+	StatusDelivered    = "delivered"
+	StatusAcknowledged = "acknowledged"
+	StatusSucceeded    = "succeeded"
+	StatusFailed       = "failed"
+	StatusTimedOut     = "timed_out"
+)
+
+type Command struct {
+	ID          uuid.UUID       `json:"id"          db:"id"`
+	DeviceID    string          `json:"deviceId"    db:"device_id"`
+	Type        string          `json:"type"        db:"type"`
+	Params      json.RawMessage `json:"params"      db:"params"`
+	Status      string          `json:"status"      db:"status"`
+	Result      json.RawMessage `json:"result"      db:"result"`
+	Error       string          `json:"error"       db:"error"`
+	CreatedAt   time.Time       `json:"createdAt"   db:"created_at"`
+	DeliveredAt *time.Time      `json:"deliveredAt" db:"delivered_at"`
+	AckedAt     *time.Time      `json:"ackedAt"     db:"acked_at"`
+	CompletedAt *time.Time      `json:"completedAt" db:"completed_at"`
+	ExpiresAt   time.Time       `json:"expiresAt"   db:"expires_at"`
+}
+
+type CreateCommandRequest struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+	// TimeoutSeconds bounds how long the command may take to finish,
+	// including time the device is offline
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+// RenameShareParams are the params of a rename_share command.
+type RenameShareParams struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ResultReport is sent by the device when a command finishes.
+type ResultReport struct {
+	Status string          `json:"status"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
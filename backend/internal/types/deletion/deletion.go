@@ -0,0 +1,25 @@
+package deletion
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusPendingVerification = "pending_verification"
+	StatusScheduled           = "scheduled"
+	StatusCancelled           = "cancelled"
+	StatusCompleted           = "completed"
+)
+
+type Request struct {
+	ID           uuid.UUID  `json:"id"           db:"id"`
+	ClerkID      string     `json:"-"            db:"clerk_id"`
+	Email        string     `json:"email"        db:"email"`
+	Status       string     `json:"status"       db:"status"`
+	ScheduledFor *time.Time `json:"scheduledFor" db:"scheduled_for"`
+	CompletedAt  *time.Time `json:"completedAt"  db:"completed_at"`
+	CreatedAt    time.Time  `json:"createdAt"    db:"created_at"`
+	UpdatedAt    time.Time  `json:"updatedAt"    db:"updated_at"`
+}
@@ -30,3 +30,74 @@ type FileMetadata struct {
 
 	CreatedAt time.Time `json:"createdAt"    db:"created_at"`
 }
+
+const (
+	PairingPending = "pending"
+	PairingClaimed = "claimed"
+	PairingExpired = "expired"
+)
+
+// PairingRequest is sent by an unpaired device to get a code its owner types
+// into the portal.
+type PairingRequest struct {
+	DeviceID string `json:"deviceId"`
+	Version  string `json:"version,omitempty"`
+	LocalIP  string `json:"localIp,omitempty"`
+	// Serial is printed on the unit; it matches the device to a hardware order
+	Serial string `json:"serial,omitempty"`
+	// SerialProof is provisioned at the factory. Serials without a valid
+	// proof are ignored and the device pairs with its code only
+	SerialProof string `json:"serialProof,omitempty"`
+	// Product and Platform decide which firmware releases the device is
+	// offered, e.g. beestation-firmware and arm64
+	Product  string `json:"product,omitempty"`
+	Platform string `json:"platform,omitempty"`
+}
+
+// PairingResponse carries the device token once. It only starts
+// authenticating the device after the code has been claimed.
+type PairingResponse struct {
+	PairingID   uuid.UUID `json:"pairingId"`
+	Code        string    `json:"code"`
+	DeviceToken string    `json:"deviceToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+type PairingStatus struct {
+	Status   string `json:"status"`
+	DeviceID string `json:"deviceId"`
+}
+
+// ClaimRequest pairs by Code, or by DeviceID for a device the user bought
+// (see GET /devices/pairable).
+type ClaimRequest struct {
+	Code         string `json:"code,omitempty"`
+	DeviceID     string `json:"deviceId,omitempty"`
+	FriendlyName string `json:"friendlyName,omitempty"`
+}
+
+// SMART health as reported by the device; unknown means the disk doesn't
+// support SMART or it couldn't be read.
+const (
+	SMARTOK      = "ok"
+	SMARTWarning = "warning"
+	SMARTFailing = "failing"
+	SMARTUnknown = "unknown"
+)
+
+// Disk is the latest state of one of a device's disks.
+type Disk struct {
+	Name         string    `json:"name"         db:"name"`
+	Mountpoint   string    `json:"mountpoint"   db:"mountpoint"`
+	TotalBytes   int64     `json:"totalBytes"   db:"total_bytes"`
+	UsedBytes    int64     `json:"usedBytes"    db:"used_bytes"`
+	SMARTStatus  string    `json:"smartStatus"  db:"smart_status"`
+	SMARTMessage string    `json:"smartMessage" db:"smart_message"`
+	UpdatedAt    time.Time `json:"updatedAt"    db:"updated_at"`
+}
+
+// TelemetryReport is sent by devices periodically with every disk they
+// have; disks missing from a report are forgotten.
+type TelemetryReport struct {
+	Disks []Disk `json:"disks"`
+}
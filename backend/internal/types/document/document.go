@@ -0,0 +1,58 @@
+package document
+
+import (
+	"time"
+)
+
+// Slugs of the published documents, matching their public routes.
+const (
+	PrivacyPolicy   = "privacy-policy"
+	TermsOfServices = "terms-of-services"
+	RefundPolicy    = "refund-policy"
+	Pricing         = "pricing"
+)
+
+type Document struct {
+	Slug               string    `json:"slug"`
+	Title              string    `json:"title"`
+	Version            string    `json:"version"`
+	EffectiveAt        time.Time `json:"effectiveAt"`
+	RequiresAcceptance bool      `json:"requiresAcceptance"`
+	Markdown           string    `json:"markdown"`
+	HTML               string    `json:"html"`
+}
+
+// DocumentResponse is a document as served, plus any version that has been
+// published but isn't in effect yet.
+type DocumentResponse struct {
+	*Document
+	Upcoming *VersionInfo `json:"upcoming,omitempty"`
+}
+
+type VersionInfo struct {
+	Version     string    `json:"version"`
+	EffectiveAt time.Time `json:"effectiveAt"`
+}
+
+type Acceptance struct {
+	UserID     string    `json:"-"          db:"user_id"`
+	Document   string    `json:"document"   db:"document"`
+	Version    string    `json:"version"    db:"version"`
+	AcceptedAt time.Time `json:"acceptedAt" db:"accepted_at"`
+}
+
+// AcceptanceStatus tells the client whether the user must (re-)accept the
+// current version of a document before continuing.
+type AcceptanceStatus struct {
+	Document        string     `json:"document"`
+	Title           string     `json:"title"`
+	CurrentVersion  string     `json:"currentVersion"`
+	EffectiveAt     time.Time  `json:"effectiveAt"`
+	AcceptedVersion *string    `json:"acceptedVersion"`
+	AcceptedAt      *time.Time `json:"acceptedAt"`
+	Pending         bool       `json:"pending"`
+}
+
+type AcceptRequest struct {
+	Version string `json:"version"`
+}
@@ -0,0 +1,28 @@
+package export
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusExpired   = "expired"
+)
+
+type Job struct {
+	ID          uuid.UUID  `json:"id"          db:"id"`
+	UserID      uuid.UUID  `json:"-"           db:"user_id"`
+	Status      string     `json:"status"      db:"status"`
+	FileSize    int64      `json:"fileSize"    db:"file_size"`
+	Error       string     `json:"error,omitempty" db:"error"`
+	CreatedAt   time.Time  `json:"createdAt"   db:"created_at"`
+	StartedAt   *time.Time `json:"startedAt"   db:"started_at"`
+	CompletedAt *time.Time `json:"completedAt" db:"completed_at"`
+	ExpiresAt   *time.Time `json:"expiresAt"   db:"expires_at"`
+	DownloadURL string     `json:"downloadUrl,omitempty" db:"-"`
+}
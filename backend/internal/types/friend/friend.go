@@ -0,0 +1,57 @@
+package friend
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+)
+
+// Directions of a pending friendship, from the user's side.
+const (
+	DirectionIncoming = "incoming"
+	DirectionOutgoing = "outgoing"
+)
+
+// Friendship is another user as seen from one side of a friendship or of a
+// friend request.
+type Friendship struct {
+	UserID    uuid.UUID `json:"userId"    db:"user_id"`
+	Username  string    `json:"username"  db:"username"`
+	FirstName string    `json:"firstName" db:"first_name"`
+	LastName  string    `json:"lastName"  db:"last_name"`
+	ImageURL  *string   `json:"imageUrl"  db:"image_url"`
+	Status    string    `json:"status"    db:"status"`
+	// Direction tells who sent the request: incoming or outgoing
+	Direction string    `json:"direction" db:"direction"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// CreateRequest asks another user, identified by username or email, to be
+// friends.
+type CreateRequest struct {
+	Recipient string `json:"recipient"`
+}
+
+// Invite is an invitation emailed to someone who isn't a user yet.
+type Invite struct {
+	ID        uuid.UUID `json:"id"        db:"id"`
+	Email     string    `json:"email"     db:"email"`
+	Status    string    `json:"status"    db:"status"`
+	ExpiresAt time.Time `json:"expiresAt" db:"expires_at"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type CreateInviteRequest struct {
+	Email string `json:"email"`
+}
+
+// InviteInfo is what anyone holding an invitation link may see about it.
+type InviteInfo struct {
+	InviterUsername string    `json:"inviterUsername"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+}
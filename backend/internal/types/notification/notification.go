@@ -0,0 +1,57 @@
+package notification
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TypeFriendRequest   = "friend_request"
+	TypeFriendAccepted  = "friend_accepted"
+	TypeShareReceived   = "share_received"
+	TypeUpdateAvailable = "update_available"
+	TypeDeviceOffline   = "device_offline"
+	TypeDeviceAlert     = "device_alert"
+)
+
+type Notification struct {
+	ID        uuid.UUID       `json:"id"        db:"id"`
+	Type      string          `json:"type"      db:"type"`
+	Title     string          `json:"title"     db:"title"`
+	Body      string          `json:"body"      db:"body"`
+	Data      json.RawMessage `json:"data"      db:"data"`
+	ReadAt    *time.Time      `json:"readAt"    db:"read_at"`
+	CreatedAt time.Time       `json:"createdAt" db:"created_at"`
+}
+
+// Draft is what a producer supplies; Data is marshalled to JSON and tells
+// the dashboard what the notification is about, e.g. a device or share ID.
+type Draft struct {
+	Type  string
+	Title string
+	Body  string
+	Data  any
+}
+
+// Page is a page of the inbox, newest first. NextCursor is passed back as
+// ?cursor= for the next page and is empty on the last one.
+type Page struct {
+	Notifications []*Notification `json:"notifications"`
+	UnreadCount   int             `json:"unreadCount"`
+	NextCursor    string          `json:"nextCursor,omitempty"`
+}
+
+// UnreadCount is returned by the mark-read endpoints.
+type UnreadCount struct {
+	UnreadCount int `json:"unreadCount"`
+}
+
+// Preferences choose which emails the user gets besides the ones about
+// their account, which are always sent.
+type Preferences struct {
+	EmailShares         bool `json:"emailShares"`
+	EmailFriendRequests bool `json:"emailFriendRequests"`
+	EmailDeviceAlerts   bool `json:"emailDeviceAlerts"`
+}
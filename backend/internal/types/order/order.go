@@ -0,0 +1,75 @@
+package order
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusPaid              = "paid"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+)
+
+const (
+	ShippingPending    = "pending"
+	ShippingProcessing = "processing"
+	ShippingShipped    = "shipped"
+	ShippingDelivered  = "delivered"
+	ShippingReturned   = "returned"
+)
+
+type Order struct {
+	ID             uuid.UUID  `json:"id"             db:"id"`
+	Email          string     `json:"email"          db:"email"`
+	Status         string     `json:"status"         db:"status"`
+	ShippingStatus string     `json:"shippingStatus" db:"shipping_status"`
+	Carrier        string     `json:"carrier"        db:"carrier"`
+	TrackingNumber string     `json:"trackingNumber" db:"tracking_number"`
+	ShippedAt      *time.Time `json:"shippedAt"      db:"shipped_at"`
+	DeliveredAt    *time.Time `json:"deliveredAt"    db:"delivered_at"`
+	AmountTotal    int64      `json:"amountTotal"    db:"amount_total"`
+	AmountRefunded int64      `json:"amountRefunded" db:"amount_refunded"`
+	Currency       string     `json:"currency"       db:"currency"`
+	Items          []*Item    `json:"items"          db:"-"`
+	CreatedAt      time.Time  `json:"createdAt"      db:"created_at"`
+	UpdatedAt      time.Time  `json:"updatedAt"      db:"updated_at"`
+}
+
+type Item struct {
+	ID         int64   `json:"id"         db:"id"`
+	SKU        string  `json:"sku"        db:"sku"`
+	Name       string  `json:"name"       db:"name"`
+	Quantity   int     `json:"quantity"   db:"quantity"`
+	UnitAmount int64   `json:"unitAmount" db:"unit_amount"`
+	Units      []*Unit `json:"units"      db:"-"`
+}
+
+// Unit is one physical device shipped for an item.
+type Unit struct {
+	Serial   string     `json:"serial"   db:"serial"`
+	DeviceID *string    `json:"deviceId" db:"device_id"`
+	PairedAt *time.Time `json:"pairedAt" db:"paired_at"`
+}
+
+type UpdateShippingRequest struct {
+	Status         string `json:"status"`
+	Carrier        string `json:"carrier,omitempty"`
+	TrackingNumber string `json:"trackingNumber,omitempty"`
+}
+
+type AssignUnitsRequest struct {
+	ItemID  int64    `json:"itemId"`
+	Serials []string `json:"serials"`
+}
+
+// PairableDevice is a device waiting to be paired whose serial matches a unit
+// the user bought, so it can be paired without typing its code.
+type PairableDevice struct {
+	DeviceID    string    `json:"deviceId"`
+	Serial      string    `json:"serial"`
+	OrderID     uuid.UUID `json:"orderId"`
+	ProductName string    `json:"productName"`
+	RequestedAt time.Time `json:"requestedAt"`
+}
@@ -0,0 +1,105 @@
+package ota
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RolloutActive = "active"
+	RolloutPaused = "paused"
+	RolloutHalted = "halted"
+)
+
+const (
+	StatePending     = "pending"
+	StateDownloading = "downloading"
+	StateInstalled   = "installed"
+	StateFailed      = "failed"
+	// StateExpired is an offer the device stopped checking in about before
+	// starting it. It is offered again when the device next checks.
+	StateExpired = "expired"
+)
+
+// Rollout offers a release to a share of devices. Devices are picked by a
+// stable hash, so raising Percentage only adds devices. With Cohort set, only
+// devices in that cohort are eligible.
+type Rollout struct {
+	ID               uuid.UUID    `json:"id"               db:"id"`
+	ReleaseID        uuid.UUID    `json:"releaseId"        db:"release_id"`
+	Product          string       `json:"product"          db:"product"`
+	Platform         string       `json:"platform"         db:"platform"`
+	Version          string       `json:"version"          db:"version"`
+	Percentage       int          `json:"percentage"       db:"percentage"`
+	Cohort           string       `json:"cohort"           db:"cohort"`
+	Status           string       `json:"status"           db:"status"`
+	FailureThreshold float64      `json:"failureThreshold" db:"failure_threshold"`
+	MinReports       int          `json:"minReports"       db:"min_reports"`
+	HaltedReason     string       `json:"haltedReason"     db:"halted_reason"`
+	Stats            RolloutStats `json:"stats"            db:"-"`
+	CreatedAt        time.Time    `json:"createdAt"        db:"created_at"`
+	UpdatedAt        time.Time    `json:"updatedAt"        db:"updated_at"`
+}
+
+// RolloutStats counts devices by update state.
+type RolloutStats struct {
+	Pending     int `json:"pending"`
+	Downloading int `json:"downloading"`
+	Installed   int `json:"installed"`
+	Failed      int `json:"failed"`
+	Expired     int `json:"expired"`
+}
+
+type CreateRolloutRequest struct {
+	ReleaseID  uuid.UUID `json:"releaseId"`
+	Percentage int       `json:"percentage"`
+	Cohort     string    `json:"cohort,omitempty"`
+	// FailureThreshold is the failed share of finished updates (0-1] that
+	// halts the rollout, once MinReports updates have finished
+	FailureThreshold float64 `json:"failureThreshold,omitempty"`
+	MinReports       int     `json:"minReports,omitempty"`
+}
+
+// UpdateRolloutRequest changes the percentage, or pauses, resumes or halts
+// the rollout. Omitted fields are left alone.
+type UpdateRolloutRequest struct {
+	Percentage *int   `json:"percentage,omitempty"`
+	Status     string `json:"status,omitempty"`
+}
+
+type SetCohortRequest struct {
+	Cohort string `json:"cohort"`
+}
+
+// Manifest tells a device what to install. It is signed as serialized.
+type Manifest struct {
+	RolloutID uuid.UUID `json:"rolloutId"`
+	DeviceID  string    `json:"deviceId"`
+	Product   string    `json:"product"`
+	Platform  string    `json:"platform"`
+	Version   string    `json:"version"`
+	URL       string    `json:"url"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	// ArtifactSignature is the release's own signature of the file
+	ArtifactSignature string    `json:"artifactSignature"`
+	Notes             string    `json:"notes"`
+	IssuedAt          time.Time `json:"issuedAt"`
+}
+
+// UpdateCheck answers a device's update check. Manifest is the base64 of the
+// Manifest JSON that Signature (base64 Ed25519) covers; devices verify the
+// decoded bytes before parsing them.
+type UpdateCheck struct {
+	UpdateAvailable bool   `json:"updateAvailable"`
+	Manifest        string `json:"manifest,omitempty"`
+	Signature       string `json:"signature,omitempty"`
+}
+
+// StatusReport is sent by the device as an update progresses.
+type StatusReport struct {
+	RolloutID uuid.UUID `json:"rolloutId"`
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+}
@@ -0,0 +1,68 @@
+package p2p
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Candidate types, as in ICE. Reflexive candidates are the public address the
+// portal saw a request come from, paired with the port of a host candidate.
+const (
+	CandidateHost      = "host"
+	CandidateReflexive = "srflx"
+)
+
+// Paths a session can end up using.
+const (
+	PathDirect = "direct"
+	PathRelay  = "relay"
+)
+
+// A session is pending until the device answers with its candidates and
+// completed once the client reports the path it used. Pending sessions
+// expire when the device doesn't answer in time.
+const (
+	StatusPending   = "pending"
+	StatusAnswered  = "answered"
+	StatusCompleted = "completed"
+	StatusExpired   = "expired"
+)
+
+type Candidate struct {
+	Type     string `json:"type"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	Priority int64  `json:"priority"`
+}
+
+type Session struct {
+	ID               uuid.UUID   `json:"id"               db:"id"`
+	DeviceID         string      `json:"deviceId"         db:"device_id"`
+	ClientCandidates []Candidate `json:"clientCandidates" db:"client_candidates"`
+	DeviceCandidates []Candidate `json:"deviceCandidates" db:"device_candidates"`
+	Status           string      `json:"status"           db:"status"`
+	Path             string      `json:"path,omitempty"   db:"path"`
+	// RelayURL is where the client falls back to when no direct path works
+	RelayURL    string     `json:"relayUrl"    db:"-"`
+	CreatedAt   time.Time  `json:"createdAt"   db:"created_at"`
+	AnsweredAt  *time.Time `json:"answeredAt"  db:"answered_at"`
+	CompletedAt *time.Time `json:"completedAt" db:"completed_at"`
+	ExpiresAt   time.Time  `json:"expiresAt"   db:"expires_at"`
+}
+
+// OfferRequest starts a session with the client's candidates.
+type OfferRequest struct {
+	Candidates []Candidate `json:"candidates"`
+}
+
+// AnswerRequest carries the device's candidates for a session.
+type AnswerRequest struct {
+	Candidates []Candidate `json:"candidates"`
+}
+
+// ResultRequest reports the path the client ended up using.
+type ResultRequest struct {
+	Path string `json:"path"`
+}
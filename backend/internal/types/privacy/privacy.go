@@ -0,0 +1,28 @@
+package privacy
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Settings choose how other users can find the user. Friends can always
+// find each other.
+type Settings struct {
+	DiscoverableByUsername bool `json:"discoverableByUsername"`
+	DiscoverableByEmail    bool `json:"discoverableByEmail"`
+}
+
+// UserSummary is the public profile of another user.
+type UserSummary struct {
+	UserID    uuid.UUID `json:"userId"    db:"id"`
+	Username  string    `json:"username"  db:"username"`
+	FirstName string    `json:"firstName" db:"first_name"`
+	LastName  string    `json:"lastName"  db:"last_name"`
+	ImageURL  *string   `json:"imageUrl"  db:"image_url"`
+}
+
+type BlockedUser struct {
+	UserSummary
+	BlockedAt time.Time `json:"blockedAt" db:"created_at"`
+}
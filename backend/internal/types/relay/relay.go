@@ -0,0 +1,30 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Access is what a user may do on a device through the relay: everything as
+// its owner, or what their shares grant.
+type Access struct {
+	DeviceID string
+	OwnerID  uuid.UUID
+	UserID   uuid.UUID
+	Owner    bool
+	Grants   []Grant
+}
+
+// Grant is one active share of a device path with the user.
+type Grant struct {
+	Path       string
+	Permission string
+}
+
+// Link opens a device in the browser. Its token is exchanged for a cookie
+// scoped to the device on first use, so it must be followed before ExpiresAt.
+type Link struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
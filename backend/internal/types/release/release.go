@@ -0,0 +1,53 @@
+package release
+
+import (
+	"mime/multipart"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ProductBeeStationFirmware = "beestation-firmware"
+	ProductBeeDriveFirmware   = "beedrive-firmware"
+	ProductDesktopSync        = "desktop-sync"
+)
+
+const (
+	ChannelStable = "stable"
+	ChannelBeta   = "beta"
+)
+
+// Products lists every product releases can be published for.
+var Products = []string{ProductBeeStationFirmware, ProductBeeDriveFirmware, ProductDesktopSync}
+
+type Release struct {
+	ID       uuid.UUID `json:"id"       db:"id"`
+	Product  string    `json:"product"  db:"product"`
+	Version  string    `json:"version"  db:"version"`
+	Channel  string    `json:"channel"  db:"channel"`
+	Platform string    `json:"platform" db:"platform"`
+	Filename string    `json:"filename" db:"filename"`
+	Size     int64     `json:"size"     db:"size"`
+	SHA256   string    `json:"sha256"   db:"sha256"`
+	// Signature is the detached signature of the file, base64 encoded
+	Signature   string    `json:"signature"   db:"signature"`
+	Notes       string    `json:"notes"       db:"notes"`
+	DownloadURL string    `json:"downloadUrl" db:"-"`
+	CreatedAt   time.Time `json:"createdAt"   db:"created_at"`
+	// Path is where the file lives below the releases directory
+	Path string `json:"-" db:"path"`
+}
+
+// UploadForm is the multipart form of an admin upload. SHA256, when given,
+// is checked against the received file.
+type UploadForm struct {
+	Product   string                `json:"product"`
+	Version   string                `json:"version"`
+	Channel   string                `json:"channel"`
+	Platform  string                `json:"platform"`
+	SHA256    string                `json:"sha256,omitempty"`
+	Signature string                `json:"signature,omitempty"`
+	Notes     string                `json:"notes,omitempty"`
+	File      *multipart.FileHeader `json:"file"`
+}
@@ -0,0 +1,54 @@
+package share
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	KindUser = "user"
+	KindLink = "link"
+)
+
+const (
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+)
+
+type Share struct {
+	ID              uuid.UUID  `json:"id"                        db:"id"`
+	DeviceID        string     `json:"deviceId"                  db:"device_id"`
+	DeviceName      string     `json:"deviceName"                db:"friendly_name"`
+	OwnerID         uuid.UUID  `json:"ownerId"                   db:"owner_id"`
+	OwnerUsername   string     `json:"ownerUsername"             db:"owner_username"`
+	Kind            string     `json:"kind"                      db:"kind"`
+	GranteeID       *uuid.UUID `json:"granteeId,omitempty"       db:"grantee_id"`
+	GranteeUsername string     `json:"granteeUsername,omitempty" db:"grantee_username"`
+	Path            string     `json:"path"                      db:"path"`
+	Permission      string     `json:"permission"                db:"permission"`
+	ExpiresAt       *time.Time `json:"expiresAt"                 db:"expires_at"`
+	CreatedAt       time.Time  `json:"createdAt"                 db:"created_at"`
+
+	// URL is only returned when a link is created; the token isn't stored
+	URL string `json:"url,omitempty" db:"-"`
+}
+
+// CreateShareRequest shares a device path with another user, identified by
+// username or email, or creates a public read-only link.
+type CreateShareRequest struct {
+	Kind       string     `json:"kind"`
+	Grantee    string     `json:"grantee,omitempty"`
+	Path       string     `json:"path,omitempty"`
+	Permission string     `json:"permission,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// LinkInfo is what anyone holding a public link may see about it.
+type LinkInfo struct {
+	DeviceID      string     `json:"deviceId"`
+	DeviceName    string     `json:"deviceName"`
+	OwnerUsername string     `json:"ownerUsername"`
+	Path          string     `json:"path"`
+	ExpiresAt     *time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,61 @@
+package subscription
+
+import "time"
+
+const (
+	PlanFree = "free"
+	PlanPlus = "plus"
+	PlanPro  = "pro"
+)
+
+const (
+	StatusActive   = "active"
+	StatusPastDue  = "past_due"
+	StatusCanceled = "canceled"
+)
+
+// Unlimited is the limit value for features a plan doesn't cap.
+const Unlimited = -1
+
+type Plan struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	PriceCents         int    `json:"priceCents"`
+	Currency           string `json:"currency"`
+	MaxDevices         int64  `json:"maxDevices"`
+	MaxPublicLinks     int64  `json:"maxPublicLinks"`
+	RelayBytesPerMonth int64  `json:"relayBytesPerMonth"`
+}
+
+type Subscription struct {
+	Plan              string     `json:"plan"              db:"plan"`
+	Status            string     `json:"status"            db:"status"`
+	CurrentPeriodEnd  *time.Time `json:"currentPeriodEnd"  db:"current_period_end"`
+	CancelAtPeriodEnd bool       `json:"cancelAtPeriodEnd" db:"cancel_at_period_end"`
+}
+
+// Usage pairs what a user consumes with what their plan allows. Limit is
+// Unlimited when the plan doesn't cap the feature.
+type Usage struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit"`
+}
+
+// Relay usage counts bytes relayed this calendar month (UTC).
+type Entitlements struct {
+	Subscription  Subscription `json:"subscription"`
+	EffectivePlan Plan         `json:"effectivePlan"`
+	Devices       Usage        `json:"devices"`
+	PublicLinks   Usage        `json:"publicLinks"`
+	Relay         Usage        `json:"relay"`
+}
+
+// LimitExceeded is the body of 402 and 403 responses caused by plan limits.
+// UpgradeTo is set when a higher plan would allow the action.
+type LimitExceeded struct {
+	Error     string `json:"error"`
+	Feature   string `json:"feature"`
+	Plan      string `json:"plan"`
+	Limit     int64  `json:"limit"`
+	UpgradeTo string `json:"upgradeTo,omitempty"`
+}
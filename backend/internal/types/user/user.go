@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/strct-org/portal/backend/internal/types/subscription"
 )
 
 type User struct {
@@ -17,6 +18,9 @@ type User struct {
 	EmailVerified bool      `json:"emailVerified" db:"email_verified"`
 	CreatedAt     time.Time `json:"createdAt"     db:"created_at"`
 	UpdatedAt     time.Time `json:"updatedAt"     db:"updated_at"`
+
+	// Subscription is only loaded by GetUserByClerkID
+	Subscription *subscription.Subscription `json:"subscription,omitempty" db:"-"`
 }
 
 type CreateUserRequest struct {
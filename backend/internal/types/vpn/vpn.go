@@ -0,0 +1,34 @@
+package vpn
+
+import "time"
+
+const (
+	KindDevice = "device"
+	KindClient = "client"
+)
+
+// RegisterKeyRequest is sent by a device to join the VPN or rotate its key.
+// The private key never leaves the device.
+type RegisterKeyRequest struct {
+	PublicKey string `json:"publicKey"`
+}
+
+// DeviceConfig is what a device needs to set up its WireGuard interface
+// alongside its own private key.
+type DeviceConfig struct {
+	Address          string    `json:"address"`
+	Subnet           string    `json:"subnet"`
+	GatewayAddress   string    `json:"gatewayAddress"`
+	GatewayPublicKey string    `json:"gatewayPublicKey"`
+	Endpoint         string    `json:"endpoint"`
+	PublicKey        string    `json:"publicKey"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// GatewayPeer is one peer the gateway must accept.
+type GatewayPeer struct {
+	PublicKey  string   `json:"publicKey"`
+	AllowedIPs []string `json:"allowedIps"`
+	Kind       string   `json:"kind"`
+	DeviceID   string   `json:"deviceId"`
+}
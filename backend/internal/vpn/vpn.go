@@ -0,0 +1,121 @@
+// Package vpn holds the WireGuard side of the managed VPN: the gateway every
+// device and client peers with, key generation and config rendering.
+package vpn
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"text/template"
+)
+
+const defaultSubnet = "10.77.0.0/16"
+
+// Gateway is the portal-operated WireGuard endpoint. Devices and clients only
+// peer with it, and it routes between the addresses handed out here.
+type Gateway struct {
+	// Subnet is the private IPv4 range peers get addresses from. The first
+	// host address belongs to the gateway.
+	Subnet    netip.Prefix
+	PublicKey string
+	Endpoint  string
+}
+
+// GatewayFromEnv reads WG_GATEWAY_PUBLIC_KEY, WG_GATEWAY_ENDPOINT (host:port)
+// and WG_SUBNET. It returns nil when the gateway isn't configured, which
+// disables the VPN.
+func GatewayFromEnv() *Gateway {
+	publicKey, endpoint := os.Getenv("WG_GATEWAY_PUBLIC_KEY"), os.Getenv("WG_GATEWAY_ENDPOINT")
+	if publicKey == "" || endpoint == "" {
+		log.Println("WARNING: WG_GATEWAY_PUBLIC_KEY or WG_GATEWAY_ENDPOINT not set. The VPN is disabled")
+		return nil
+	}
+	if !ValidKey(publicKey) {
+		log.Println("WARNING: WG_GATEWAY_PUBLIC_KEY is not a WireGuard key. The VPN is disabled")
+		return nil
+	}
+
+	raw := os.Getenv("WG_SUBNET")
+	if raw == "" {
+		raw = defaultSubnet
+	}
+	subnet, err := netip.ParsePrefix(raw)
+	if err != nil || !subnet.Addr().Is4() || subnet.Bits() > 30 {
+		log.Printf("WARNING: WG_SUBNET=%q must be an IPv4 prefix of /30 or larger. The VPN is disabled", raw)
+		return nil
+	}
+
+	return &Gateway{Subnet: subnet.Masked(), PublicKey: publicKey, Endpoint: endpoint}
+}
+
+// GatewayAddress is the gateway's own address in the subnet.
+func (g *Gateway) GatewayAddress() netip.Addr {
+	return g.Subnet.Addr().Next()
+}
+
+// Hosts calls yield with every address peers may get, lowest first, until it
+// returns false.
+func (g *Gateway) Hosts(yield func(netip.Addr) bool) {
+	for addr := g.GatewayAddress().Next(); g.Subnet.Contains(addr); addr = addr.Next() {
+		// The last address is the broadcast address
+		if !g.Subnet.Contains(addr.Next()) {
+			return
+		}
+		if !yield(addr) {
+			return
+		}
+	}
+}
+
+// GenerateKey returns a new base64 private key and its public key.
+func GenerateKey() (privateKey, publicKey string, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key.Bytes()),
+		base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// ValidKey reports whether key is a base64 Curve25519 key.
+func ValidKey(key string) bool {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(raw) == 32
+}
+
+var clientConfig = template.Must(template.New("client").Parse(`# {{.Name}}
+[Interface]
+PrivateKey = {{.PrivateKey}}
+Address = {{.Address}}/32
+
+[Peer]
+# Strct VPN gateway
+PublicKey = {{.Gateway.PublicKey}}
+Endpoint = {{.Gateway.Endpoint}}
+AllowedIPs = {{.DeviceAddress}}/32
+PersistentKeepalive = 25
+`))
+
+// ClientConfig renders a wg-quick config that reaches one device through the
+// gateway.
+func (g *Gateway) ClientConfig(name, privateKey string, address, deviceAddress netip.Addr) ([]byte, error) {
+	var buf bytes.Buffer
+	err := clientConfig.Execute(&buf, map[string]any{
+		// Names are user input; keep them on the comment line
+		"Name":          strings.Join(strings.Fields(name), " "),
+		"PrivateKey":    privateKey,
+		"Address":       address,
+		"DeviceAddress": deviceAddress,
+		"Gateway":       g,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,57 @@
+package vpn
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestHosts(t *testing.T) {
+	g := &Gateway{Subnet: netip.MustParsePrefix("10.0.0.0/29")}
+
+	var got []string
+	g.Hosts(func(addr netip.Addr) bool {
+		got = append(got, addr.String())
+		return true
+	})
+
+	want := []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("hosts %v, want %v", got, want)
+	}
+	if gw := g.GatewayAddress().String(); gw != "10.0.0.1" {
+		t.Fatalf("gateway address %s, want 10.0.0.1", gw)
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	private, public, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ValidKey(private) || !ValidKey(public) || private == public {
+		t.Fatalf("GenerateKey = %q, %q", private, public)
+	}
+
+	for _, key := range []string{"", "not base64!", "c2hvcnQ="} {
+		if ValidKey(key) {
+			t.Errorf("ValidKey(%q) = true", key)
+		}
+	}
+}
+
+func TestClientConfigKeepsNameOnCommentLine(t *testing.T) {
+	g := &Gateway{Subnet: netip.MustParsePrefix("10.0.0.0/24"), PublicKey: "gw", Endpoint: "vpn.example.com:51820"}
+
+	config, err := g.ClientConfig("NAS\n[Peer]\nAllowedIPs = 0.0.0.0/0", "key", netip.MustParseAddr("10.0.0.3"), netip.MustParseAddr("10.0.0.2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(config), "\n")
+	if lines[0] != "# NAS [Peer] AllowedIPs = 0.0.0.0/0" {
+		t.Fatalf("first line %q", lines[0])
+	}
+	if strings.Count(string(config), "AllowedIPs") != 2 || !strings.Contains(string(config), "AllowedIPs = 10.0.0.2/32\n") {
+		t.Fatalf("config routes more than the device:\n%s", config)
+	}
+}
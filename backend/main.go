@@ -2,27 +2,42 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"os/signal"
+	"path/filepath"
+	"strings"
 	"time"
 
 	clerk "github.com/clerk/clerk-sdk-go/v2"
-	gorilllaHandlers "github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
+	"github.com/clerk/clerk-sdk-go/v2/jwks"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"github.com/strct-org/portal/backend/internal/database"
+	"github.com/strct-org/portal/backend/internal/devicehub"
+	"github.com/strct-org/portal/backend/internal/documents"
+	"github.com/strct-org/portal/backend/internal/events"
 	"github.com/strct-org/portal/backend/internal/handlers"
+	"github.com/strct-org/portal/backend/internal/health"
+	"github.com/strct-org/portal/backend/internal/invite"
+	"github.com/strct-org/portal/backend/internal/lifecycle"
+	"github.com/strct-org/portal/backend/internal/mailer"
+	"github.com/strct-org/portal/backend/internal/metrics"
+	"github.com/strct-org/portal/backend/internal/ota"
+	"github.com/strct-org/portal/backend/internal/payments"
+	"github.com/strct-org/portal/backend/internal/relay"
+	"github.com/strct-org/portal/backend/internal/serial"
 	"github.com/strct-org/portal/backend/internal/services"
+	"github.com/strct-org/portal/backend/internal/vpn"
 	"github.com/strct-org/portal/backend/middleware"
 
 	_ "net/http/pprof"
 )
 
 var (
-	dbPool              *pgxpool.Pool
-	userService         *services.UserService
+	dbPool      *pgxpool.Pool
+	userService *services.UserService
 )
 
 func main() {
@@ -37,7 +52,6 @@ func main() {
 	clerk.SetKey(clerkSecretKey)
 	log.Println("Clerk initialized")
 
-
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
 		log.Fatal("DATABASE_URL environment variable is not set")
@@ -60,83 +74,200 @@ func main() {
 	}
 	log.Println("Database pool configured (Lazy connection)")
 
-	defer func() {
-		log.Println("Closing database connection pool...")
-		dbPool.Close()
-	}()
+	app := lifecycle.New(lifecycle.Options{
+		DrainDelay:      durationFromEnv("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+		ShutdownTimeout: 30 * time.Second,
+		WorkerTimeout:   10 * time.Second,
+	})
+	app.OnClose("database connection pool", dbPool.Close)
+
+	metrics.RegisterDatabaseCollectors(dbPool)
 
 	userService = services.NewUserService(dbPool)
 
-	userHandler := handlers.NewUserHandler(userService)
-	webhookHandler := handlers.NewWebhookHandler(userService)
+	docs, err := documents.Load()
+	if err != nil {
+		log.Fatal("Failed to load documents:", err)
+	}
+	documentService := services.NewDocumentService(dbPool, docs)
+
+	emailService := services.NewEmailService(dbPool, mailer.FromEnv())
+	deletionService := services.NewAccountDeletionService(
+		dbPool,
+		userService,
+		emailService,
+		durationFromEnv("ACCOUNT_DELETION_GRACE", 7*24*time.Hour),
+		publicBaseURL(),
+	)
 
-	go func() {
-		for i := 0; i < 3; i++ {
-			time.Sleep(500 * time.Millisecond)
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			log.Printf("Background: Pinging NeonDB to wake it up (Attempt %d/3)...", i+1)
+	exportDir := os.Getenv("EXPORT_DIR")
+	if exportDir == "" {
+		exportDir = "./data/exports"
+	}
+	exportService := services.NewExportService(dbPool, exportDir, durationFromEnv("EXPORT_RETENTION", 7*24*time.Hour))
 
-			if err := dbPool.Ping(ctx); err == nil {
-				log.Println("Success: NeonDB is awake and ready")
-				cancel()
+	subscriptionService := services.NewSubscriptionService(dbPool)
+	broker := events.New()
+	notificationService := services.NewNotificationService(dbPool, broker)
+	deviceService := services.NewDeviceService(dbPool, subscriptionService, broker, serial.VerifierFromEnv())
+	commandService := services.NewCommandService(dbPool)
+	shareService := services.NewShareService(dbPool, subscriptionService, broker, notificationService, emailService, publicBaseURL())
+	alertService := services.NewAlertService(dbPool, notificationService, emailService, broker)
+	friendService := services.NewFriendService(dbPool, notificationService, emailService, broker, invite.SignerFromEnv(), publicBaseURL())
+
+	userHandler := handlers.NewUserHandler(userService)
+	docHandler := handlers.NewDocumentHandler(documentService)
+	deletionHandler := handlers.NewAccountDeletionHandler(deletionService)
+	exportHandler := handlers.NewExportHandler(exportService)
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService)
+	deviceHandler := handlers.NewDeviceHandler(deviceService)
+	shareHandler := handlers.NewShareHandler(shareService)
+	orderService := services.NewOrderService(dbPool)
+	orderHandler := handlers.NewOrderHandler(orderService)
+	releaseService := services.NewReleaseService(dbPool, filepath.Join(assetsDir, "releases"), publicBaseURL()+"/assets/releases")
+	releaseHandler := handlers.NewReleaseHandler(releaseService)
+	commandHandler := handlers.NewCommandHandler(commandService)
+	hub := devicehub.New()
+	relayDomain := relay.DomainFromEnv()
+	p2pService := services.NewP2PService(dbPool, relayDomain)
+	deviceSocketHandler := handlers.NewDeviceSocketHandler(hub, deviceService, commandService, p2pService)
+	tunnels := relay.New()
+	relayService := services.NewRelayService(dbPool, subscriptionService)
+	relayHandler := handlers.NewRelayHandler(tunnels, relayService, relay.TokenSignerFromEnv(), relayDomain)
+	p2pHandler := handlers.NewP2PHandler(p2pService, relayService, hub)
+	vpnHandler := handlers.NewVPNHandler(services.NewVPNService(dbPool, vpn.GatewayFromEnv()))
+	otaService := services.NewOTAService(dbPool, releaseService, notificationService, ota.SignerFromEnv())
+	otaHandler := handlers.NewOTAHandler(otaService)
+	eventHandler := handlers.NewEventHandler(broker, userService, events.TokenSignerFromEnv())
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	alertHandler := handlers.NewAlertHandler(alertService)
+	friendHandler := handlers.NewFriendHandler(friendService)
+	privacyHandler := handlers.NewPrivacyHandler(services.NewPrivacyService(dbPool))
+	webhookHandler := handlers.NewWebhookHandler(userService, friendService, orderService)
+	paymentWebhookHandler := handlers.NewPaymentWebhookHandler(payments.FromEnv(), services.NewPaymentService(dbPool))
+
+	checker := health.NewChecker()
+	// /readyz/light skips the database checks, so load balancers probing it
+	// let NeonDB scale to zero
+	checker.AddFull("database", 3*time.Second, 10*time.Second, dbPool.Ping)
+	checker.AddFull("migrations", 3*time.Second, 30*time.Second, func(ctx context.Context) error {
+		pending, err := database.PendingMigrations(ctx, dbPool)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations", len(pending))
+		}
+		return nil
+	})
+	checker.AddCached("clerk_jwks", 5*time.Second, 5*time.Minute, func(ctx context.Context) error {
+		_, err := jwks.Get(ctx, &jwks.GetParams{})
+		return err
+	})
+
+	healthHandler := handlers.NewHealthHandler(checker)
+	app.OnShutdown(checker.MarkShuttingDown)
+
+	// Wake NeonDB and apply migrations before reporting ready, so load
+	// balancers don't route traffic to a cold instance.
+	app.Go("neondb-warmup", func(appCtx context.Context) {
+		delay := 500 * time.Millisecond
+		for attempt := 1; ; attempt++ {
+			select {
+			case <-time.After(delay):
+			case <-appCtx.Done():
 				return
-			} else {
-				log.Printf("Ping failed: %v", err)
 			}
-			cancel()
-		}
-		log.Println("Warning: NeonDB warm-up failed after retries. First request might be slow.")
-	}()
-
-	r := mux.NewRouter()
-
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status": "healthy", "service": "outDrinkMe-api"}`))
-	}).Methods("GET")
-
-
-	standardRouter := r.PathPrefix("/").Subrouter()
-	// standardRouter.Use(middleware.RateLimitMiddleware)
-	// standardRouter.Use(middleware.MonitorMiddleware)
-
-	// standardRouter.Handle("/metrics", middleware.BasicAuthMiddleware(promhttp.Handler()))
-	// standardRouter.PathPrefix("/debug/pprof/").Handler(middleware.PprofSecurityMiddleware(http.DefaultServeMux))
-
-	assetsDir := "./assets"
-	fs := http.FileServer(http.Dir(assetsDir))
-	standardRouter.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/", fs))
-	log.Printf("Serving static files from %s at /assets/", assetsDir)
+			ctx, cancel := context.WithTimeout(appCtx, 5*time.Second)
+			log.Printf("Background: Pinging NeonDB to wake it up (Attempt %d)...", attempt)
 
-	standardRouter.HandleFunc("/webhook/clerk", webhookHandler.HandleClerkWebhook).Methods("POST")
-
-	api := standardRouter.PathPrefix("/api/v1").Subrouter()
-
-	// api.HandleFunc("/privacy-policy", docHandler.ServePrivacyPolicy).Methods("GET")
-	// api.HandleFunc("/terms-of-services", docHandler.ServeTermsOfServices).Methods("GET")
-	// api.HandleFunc("/refund-policy", docHandler.ServeRefundPolicy).Methods("GET")
-	// api.HandleFunc("/pricing", docHandler.ServePricing).Methods("GET")
-
-	// api.HandleFunc("/delete-account-webpage", userHandler.DeleteAccountPage).Methods("GET")
-	// api.HandleFunc("/delete-account-details-webpage", userHandler.UpdateAccountPage).Methods("GET")
+			err := dbPool.Ping(ctx)
+			cancel()
+			if err == nil {
+				log.Println("Success: NeonDB is awake and ready")
+				break
+			}
 
-	protected := api.PathPrefix("").Subrouter()
-	protected.Use(middleware.ClerkAuthMiddleware)
+			log.Printf("Ping failed: %v", err)
+			if delay < 30*time.Second {
+				delay *= 2
+			}
+		}
 
-	protected.HandleFunc("/user", userHandler.GetProfile).Methods("GET")
-	// protected.HandleFunc("/user", userHandler.UpdateProfile).Methods("PUT")
-	// protected.HandleFunc("/user", userHandler.DeleteAccount).Methods("DELETE")
-	
+		ctx, cancel := context.WithTimeout(appCtx, 2*time.Minute)
+		defer cancel()
+		if err := database.Migrate(ctx, dbPool); err != nil {
+			log.Printf("Error: migrations failed, instance stays unready: %v", err)
+			return
+		}
 
-
-	corsHandler := gorilllaHandlers.CORS(
-		gorilllaHandlers.AllowedOrigins([]string{"*"}),
-		gorilllaHandlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		gorilllaHandlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-Pprof-Secret"}),
-		gorilllaHandlers.ExposedHeaders([]string{"Content-Length"}),
-		gorilllaHandlers.AllowCredentials(),
-	)
+		checker.MarkWarm()
+		log.Println("Instance is ready")
+	})
+
+	webhookLimiter := middleware.NewRateLimiter(middleware.RateLimitPolicyFromEnv(middleware.WebhookRateLimit))
+	apiLimiter := middleware.NewRateLimiter(middleware.RateLimitPolicyFromEnv(middleware.APIRateLimit))
+	deviceLimiter := middleware.NewRateLimiter(middleware.RateLimitPolicyFromEnv(middleware.DeviceRateLimit))
+	publicShareLimiter := middleware.NewRateLimiter(middleware.RateLimitPolicyFromEnv(middleware.PublicShareRateLimit))
+	relayLimiter := middleware.NewRateLimiter(middleware.RateLimitPolicyFromEnv(middleware.RelayRateLimit))
+	app.Go("webhook-ratelimit-sweeper", webhookLimiter.Run)
+	app.Go("api-ratelimit-sweeper", apiLimiter.Run)
+	app.Go("device-ratelimit-sweeper", deviceLimiter.Run)
+	app.Go("public-share-ratelimit-sweeper", publicShareLimiter.Run)
+	app.Go("relay-ratelimit-sweeper", relayLimiter.Run)
+	app.Go("account-deletion-sweeper", deletionService.Run)
+	app.Go("export-worker", exportService.Run)
+	app.Go("email-sender", emailService.Run)
+	app.Go("command-sweeper", commandService.Run)
+	app.Go("command-listener", commandService.Listen)
+	app.Go("device-presence-sweeper", deviceService.Run)
+	// Closes device connections on shutdown, which the server doesn't track
+	// once they are upgraded
+	app.Go("device-hub", hub.Run)
+	app.Go("relay", tunnels.Run)
+	app.Go("p2p-session-sweeper", p2pService.Run)
+	app.Go("notification-sweeper", notificationService.Run)
+	app.Go("alert-evaluator", alertService.Run)
+	app.Go("ota-update-sweeper", otaService.Run)
+	app.Go("friend-invite-sweeper", friendService.Run)
+	app.Go("event-broker", broker.Run)
+
+	r := newRouter(routerDeps{
+		userHandler:           userHandler,
+		webhookHandler:        webhookHandler,
+		paymentWebhookHandler: paymentWebhookHandler,
+		healthHandler:         healthHandler,
+		docHandler:            docHandler,
+		deletionHandler:       deletionHandler,
+		exportHandler:         exportHandler,
+		subscriptionHandler:   subscriptionHandler,
+		deviceHandler:         deviceHandler,
+		shareHandler:          shareHandler,
+		orderHandler:          orderHandler,
+		releaseHandler:        releaseHandler,
+		otaHandler:            otaHandler,
+		commandHandler:        commandHandler,
+		deviceSocketHandler:   deviceSocketHandler,
+		relayHandler:          relayHandler,
+		p2pHandler:            p2pHandler,
+		vpnHandler:            vpnHandler,
+		eventHandler:          eventHandler,
+		notificationHandler:   notificationHandler,
+		alertHandler:          alertHandler,
+		friendHandler:         friendHandler,
+		privacyHandler:        privacyHandler,
+		authenticateDevice:    deviceService.AuthenticateDevice,
+		relayDomain:           relayDomain,
+		webhookLimiter:        webhookLimiter,
+		apiLimiter:            apiLimiter,
+		deviceLimiter:         deviceLimiter,
+		publicShareLimiter:    publicShareLimiter,
+		relayLimiter:          relayLimiter,
+	})
+
+	corsConfig := middleware.CORSConfigFromEnv()
+	log.Printf("CORS allowed origins: %v", corsConfig.AllowedOrigins)
+	corsHandler := middleware.CORS(corsConfig)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -152,25 +283,34 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
-	go func() {
-		log.Printf("Starting server on port %s", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal("Error starting server:", err)
-		}
-	}()
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
+	// Event streams only end when the broker closes them, so close it as
+	// soon as Shutdown starts rather than after the server has drained
+	server.RegisterOnShutdown(broker.Close)
 
-	sig := <-sigChan
-	log.Println("Got signal:", sig)
+	app.Serve(&server)
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer shutdownCancel()
+	if err := app.Wait(); err != nil {
+		log.Fatal("Error starting server:", err)
+	}
+}
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
 	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", key, raw, err)
+		return fallback
+	}
+	return d
+}
 
-	log.Println("Server shutdown complete")
+// publicBaseURL is the origin users reach the API on, used for links in emails.
+func publicBaseURL() string {
+	if u := os.Getenv("PUBLIC_BASE_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "http://localhost:3333"
 }
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"not configured", "", "Bearer anything", http.StatusNotFound},
+		{"no header", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "Bearer guess", http.StatusUnauthorized},
+		{"not a bearer token", "s3cret", "s3cret", http.StatusUnauthorized},
+		{"valid", "s3cret", "Bearer s3cret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("ADMIN_API_TOKEN", tt.token)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/orders", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		AdminAuthMiddleware(ok).ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
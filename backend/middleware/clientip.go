@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	trustedProxiesOnce sync.Once
+	trustedProxies     []netip.Prefix
+)
+
+// loadTrustedProxies reads TRUSTED_PROXIES, a comma separated list of IPs or
+// CIDRs (e.g. "127.0.0.1,10.0.0.0/8"). Defaults to loopback, which covers the
+// nginx instance in front of the API on the VPS.
+func loadTrustedProxies() []netip.Prefix {
+	trustedProxiesOnce.Do(func() {
+		raw := os.Getenv("TRUSTED_PROXIES")
+		if raw == "" {
+			raw = "127.0.0.0/8,::1/128"
+		}
+
+		for _, entry := range strings.Split(raw, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+
+			if !strings.Contains(entry, "/") {
+				addr, err := netip.ParseAddr(entry)
+				if err != nil {
+					log.Printf("Ignoring invalid TRUSTED_PROXIES entry %q: %v", entry, err)
+					continue
+				}
+				trustedProxies = append(trustedProxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+				continue
+			}
+
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				log.Printf("Ignoring invalid TRUSTED_PROXIES entry %q: %v", entry, err)
+				continue
+			}
+			trustedProxies = append(trustedProxies, prefix.Masked())
+		}
+	})
+	return trustedProxies
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range loadTrustedProxies() {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that made the request. When the
+// direct peer is a trusted proxy, X-Forwarded-For is walked right to left and
+// the first address that is not itself a trusted proxy wins, so clients can't
+// spoof their IP by sending their own header.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	peer = peer.Unmap()
+
+	if !isTrustedProxy(peer) {
+		return peer.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		hop = hop.Unmap()
+		if !isTrustedProxy(hop) {
+			return hop.String()
+		}
+		peer = hop
+	}
+
+	return peer.String()
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	gorilllaHandlers "github.com/gorilla/handlers"
+)
+
+// Default origin allow-lists per APP_ENV. CORS_ALLOWED_ORIGINS replaces them.
+var defaultAllowedOrigins = map[string][]string{
+	"development": {"http://localhost:3000", "http://127.0.0.1:3000"},
+	"staging":     {"https://staging.strct.org", "https://*.staging.strct.org"},
+	"production":  {"https://strct.org", "https://*.strct.org"},
+}
+
+type CORSConfig struct {
+	// AllowedOrigins are exact origins ("https://strct.org") or wildcard
+	// subdomain patterns ("https://*.strct.org"). A bare "*" is rejected
+	// because credentials are allowed.
+	AllowedOrigins []string
+	// MaxAge is how long, in seconds, browsers may cache preflight responses.
+	MaxAge int
+}
+
+// CORSConfigFromEnv builds the policy from APP_ENV (default "production"),
+// CORS_ALLOWED_ORIGINS (comma separated) and CORS_MAX_AGE.
+func CORSConfigFromEnv() CORSConfig {
+	env := os.Getenv("APP_ENV")
+	if env == "" {
+		env = "production"
+	}
+
+	cfg := CORSConfig{
+		AllowedOrigins: defaultAllowedOrigins[env],
+		MaxAge:         600,
+	}
+
+	if raw := os.Getenv("CORS_ALLOWED_ORIGINS"); raw != "" {
+		cfg.AllowedOrigins = nil
+		for _, origin := range strings.Split(raw, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				cfg.AllowedOrigins = append(cfg.AllowedOrigins, origin)
+			}
+		}
+	}
+
+	if raw := os.Getenv("CORS_MAX_AGE"); raw != "" {
+		if maxAge, err := strconv.Atoi(raw); err == nil && maxAge >= 0 {
+			cfg.MaxAge = maxAge
+		} else {
+			log.Printf("Ignoring invalid CORS_MAX_AGE=%q", raw)
+		}
+	}
+
+	return cfg
+}
+
+type originPattern struct {
+	scheme string
+	host   string // exact host, or the suffix after "*." for wildcards
+	port   string
+	wild   bool
+}
+
+func parseOriginPattern(raw string) (originPattern, bool) {
+	u, err := url.Parse(strings.ToLower(strings.TrimSuffix(raw, "/")))
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+		return originPattern{}, false
+	}
+
+	p := originPattern{scheme: u.Scheme, host: u.Hostname(), port: u.Port()}
+	if strings.HasPrefix(p.host, "*.") {
+		p.wild = true
+		p.host = strings.TrimPrefix(p.host, "*.")
+	}
+	if p.host == "" || strings.Contains(p.host, "*") {
+		return originPattern{}, false
+	}
+	return p, true
+}
+
+func (p originPattern) matches(scheme, host, port string) bool {
+	if scheme != p.scheme || port != p.port {
+		return false
+	}
+	if !p.wild {
+		return host == p.host
+	}
+	// "*.strct.org" matches "app.strct.org" and "a.b.strct.org" but not "strct.org"
+	return strings.HasSuffix(host, "."+p.host)
+}
+
+// NewOriginValidator returns a matcher for the given allow-list. Invalid
+// entries, including a bare "*", are logged and skipped.
+func NewOriginValidator(allowed []string) func(string) bool {
+	var patterns []originPattern
+	for _, raw := range allowed {
+		p, ok := parseOriginPattern(raw)
+		if !ok {
+			log.Printf("Ignoring invalid CORS origin %q", raw)
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+
+	return func(origin string) bool {
+		u, err := url.Parse(strings.ToLower(origin))
+		if err != nil || u.Host == "" || (u.Path != "" && u.Path != "/") || u.User != nil {
+			return false
+		}
+
+		host, port := u.Hostname(), u.Port()
+		for _, p := range patterns {
+			if p.matches(u.Scheme, host, port) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// CORS applies cfg with credentials allowed. Allowed origins are echoed back
+// individually, so responses always vary on Origin.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	corsHandler := gorilllaHandlers.CORS(
+		gorilllaHandlers.AllowedOriginValidator(NewOriginValidator(cfg.AllowedOrigins)),
+		gorilllaHandlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+		gorilllaHandlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-Pprof-Secret"}),
+		gorilllaHandlers.ExposedHeaders([]string{"Content-Length", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"}),
+		gorilllaHandlers.MaxAge(cfg.MaxAge),
+		gorilllaHandlers.AllowCredentials(),
+	)
+
+	return func(next http.Handler) http.Handler {
+		h := corsHandler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginValidator(t *testing.T) {
+	allowed := NewOriginValidator([]string{
+		"https://strct.org",
+		"https://*.strct.org",
+		"http://localhost:3000",
+		"*",
+	})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://strct.org", true},
+		{"https://app.strct.org", true},
+		{"https://a.b.strct.org", true},
+		{"HTTPS://App.Strct.org", true},
+		{"http://localhost:3000", true},
+
+		{"", false},
+		{"null", false},
+		{"http://strct.org", false},
+		{"https://strct.org:8443", false},
+		{"https://evilstrct.org", false},
+		{"https://strct.org.evil.com", false},
+		{"https://app.strct.org.evil.com", false},
+		{"http://localhost:3001", false},
+		{"https://example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := allowed(tt.origin); got != tt.want {
+			t.Errorf("origin %q: got %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	h := CORS(CORSConfig{AllowedOrigins: []string{"https://*.strct.org"}, MaxAge: 300})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user", nil)
+	req.Header.Set("Origin", "https://app.strct.org")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.strct.org" {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want echoed origin", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Fatalf("Access-Control-Allow-Credentials = %q, want true", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Origin" {
+		t.Fatalf("Vary = %q, want Origin", got)
+	}
+}
+
+func TestCORSDeniedOrigin(t *testing.T) {
+	h := CORS(CORSConfig{AllowedOrigins: []string{"https://strct.org"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want none", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Fatalf("Access-Control-Allow-Credentials = %q, want none", got)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	called := false
+	h := CORS(CORSConfig{AllowedOrigins: []string{"https://strct.org"}, MaxAge: 300})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/user", nil)
+	req.Header.Set("Origin", "https://strct.org")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if called {
+		t.Fatal("preflight reached the wrapped handler")
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "300" {
+		t.Fatalf("Access-Control-Max-Age = %q, want 300", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://strct.org" {
+		t.Fatalf("Access-Control-Allow-Origin = %q", got)
+	}
+
+	req.Header.Set("Origin", "https://evil.example")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("denied preflight got Access-Control-Allow-Origin = %q", got)
+	}
+}
+
+func TestCORSConfigFromEnv(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	cfg := CORSConfigFromEnv()
+	if len(cfg.AllowedOrigins) == 0 || cfg.AllowedOrigins[0] != "http://localhost:3000" {
+		t.Fatalf("development defaults = %v", cfg.AllowedOrigins)
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example, https://*.b.example")
+	t.Setenv("CORS_MAX_AGE", "120")
+	cfg = CORSConfigFromEnv()
+	if len(cfg.AllowedOrigins) != 2 || cfg.AllowedOrigins[1] != "https://*.b.example" {
+		t.Fatalf("override = %v", cfg.AllowedOrigins)
+	}
+	if cfg.MaxAge != 120 {
+		t.Fatalf("MaxAge = %d, want 120", cfg.MaxAge)
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const DeviceIDKey contextKey = "deviceID"
+
+// DeviceAuthenticator resolves a device token to the ID of the paired device
+// it belongs to, or returns an error.
+type DeviceAuthenticator func(ctx context.Context, token string) (string, error)
+
+// DeviceAuthMiddleware requires the device token issued at pairing as a
+// bearer token.
+func DeviceAuthMiddleware(authenticate DeviceAuthenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				respondWithError(w, http.StatusUnauthorized, "Device token required")
+				return
+			}
+
+			deviceID, err := authenticate(r.Context(), token)
+			if err != nil {
+				log.Printf("Device authentication failed: %v", err)
+				respondWithError(w, http.StatusUnauthorized, "Invalid device token")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), DeviceIDKey, deviceID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetDeviceID returns the authenticated device's ID.
+func GetDeviceID(ctx context.Context) (string, bool) {
+	deviceID, ok := ctx.Value(DeviceIDKey).(string)
+	return deviceID, ok
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/metrics"
+)
+
+// MonitorMiddleware records request duration and response size per route template.
+func MonitorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics.HTTPRequestsInFlight.Inc()
+		defer metrics.HTTPRequestsInFlight.Dec()
+
+		// httpsnoop keeps Flusher/Hijacker intact for streaming handlers
+		m := httpsnoop.CaptureMetrics(next, w, r)
+
+		route := routeTemplate(r)
+		metrics.HTTPRequestDuration.
+			WithLabelValues(r.Method, route, strconv.Itoa(m.Code)).
+			Observe(m.Duration.Seconds())
+		metrics.HTTPResponseBytes.WithLabelValues(route).Add(float64(m.Written))
+	})
+}
+
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "unmatched"
+	}
+	if tpl, err := route.GetPathTemplate(); err == nil {
+		return tpl
+	}
+	if tpl, err := route.GetPathRegexp(); err == nil {
+		return tpl
+	}
+	return "unknown"
+}
+
+// BasicAuthMiddleware protects the metrics endpoint. Scrapers may use HTTP basic
+// auth (METRICS_USERNAME / METRICS_PASSWORD); operators can also pass the pprof
+// secret in X-Pprof-Secret. With nothing configured the endpoint is disabled.
+func BasicAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasPprofSecret(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		wantUser := os.Getenv("METRICS_USERNAME")
+		wantPass := os.Getenv("METRICS_PASSWORD")
+		if wantUser == "" || wantPass == "" {
+			if os.Getenv("PPROF_SECRET") == "" {
+				http.NotFound(w, r)
+				return
+			}
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		user, pass, ok := r.BasicAuth()
+		if !ok || !secureEqual(user, wantUser) || !secureEqual(pass, wantPass) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// PprofSecurityMiddleware only lets requests carrying the X-Pprof-Secret header
+// through to the profiling handlers. Without PPROF_SECRET the routes 404.
+func PprofSecurityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if os.Getenv("PPROF_SECRET") == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !hasPprofSecret(r) {
+			respondWithError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasPprofSecret(r *http.Request) bool {
+	secret := os.Getenv("PPROF_SECRET")
+	if secret == "" {
+		return false
+	}
+	return secureEqual(r.Header.Get("X-Pprof-Secret"), secret)
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
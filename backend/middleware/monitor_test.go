@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/strct-org/portal/backend/internal/metrics"
+)
+
+func TestMonitorLabelsRouteTemplate(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	router := mux.NewRouter()
+	router.Use(MonitorMiddleware)
+	router.Handle("/test/devices/{id}", ok).Methods("GET")
+
+	before := testutil.CollectAndCount(metrics.HTTPResponseBytes)
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/test/devices/dev-%d", i), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("device %d: status %d", i, rec.Code)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.HTTPResponseBytes.WithLabelValues("/test/devices/{id}")); got != 6 {
+		t.Errorf("route template counted %v bytes, want 6", got)
+	}
+
+	// Paths no route matches, whether the router 404s them or a handler is
+	// monitored outside a router, share one label
+	unrouted := MonitorMiddleware(ok)
+	for i := 0; i < 3; i++ {
+		path := fmt.Sprintf("/scan/%d", i)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		unrouted.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if got := testutil.ToFloat64(metrics.HTTPResponseBytes.WithLabelValues("unmatched")); got < 6 {
+		t.Errorf("unmatched requests counted %v bytes, want at least 6", got)
+	}
+
+	if added := testutil.CollectAndCount(metrics.HTTPResponseBytes) - before; added > 2 {
+		t.Errorf("requests added %d route labels, want at most the template and unmatched", added)
+	}
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		secret   string
+		prepare  func(r *http.Request)
+		want     int
+	}{
+		{"nothing configured", "", "", "", func(r *http.Request) { r.SetBasicAuth("", "") }, http.StatusNotFound},
+		{"only the pprof secret configured", "", "", "s3cret", func(r *http.Request) { r.SetBasicAuth("prom", "pass") }, http.StatusUnauthorized},
+		{"pprof secret", "prom", "pass", "s3cret", func(r *http.Request) { r.Header.Set("X-Pprof-Secret", "s3cret") }, http.StatusOK},
+		{"wrong pprof secret", "prom", "pass", "s3cret", func(r *http.Request) { r.Header.Set("X-Pprof-Secret", "guess") }, http.StatusUnauthorized},
+		{"basic auth", "prom", "pass", "", func(r *http.Request) { r.SetBasicAuth("prom", "pass") }, http.StatusOK},
+		{"wrong password", "prom", "pass", "", func(r *http.Request) { r.SetBasicAuth("prom", "guess") }, http.StatusUnauthorized},
+		{"wrong username", "prom", "pass", "", func(r *http.Request) { r.SetBasicAuth("admin", "pass") }, http.StatusUnauthorized},
+		{"no credentials", "prom", "pass", "", func(r *http.Request) {}, http.StatusUnauthorized},
+	}
+
+	h := BasicAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("METRICS_USERNAME", tt.username)
+			t.Setenv("METRICS_PASSWORD", tt.password)
+			t.Setenv("PPROF_SECRET", tt.secret)
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			tt.prepare(req)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+			if rec.Code == http.StatusUnauthorized && tt.username != "" && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestPprofSecurityMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		want   int
+	}{
+		{"no secret configured", "", "", http.StatusNotFound},
+		{"no secret configured, header sent", "", "anything", http.StatusNotFound},
+		{"missing header", "s3cret", "", http.StatusForbidden},
+		{"wrong secret", "s3cret", "s3cre", http.StatusForbidden},
+		{"right secret", "s3cret", "s3cret", http.StatusOK},
+	}
+
+	h := PprofSecurityMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PPROF_SECRET", tt.secret)
+
+			req := httptest.NewRequest(http.MethodGet, "/debug/pprof/heap", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Pprof-Secret", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
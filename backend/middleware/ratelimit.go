@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy describes a token bucket: Rate tokens are added per second up
+// to Burst, and every request costs one token.
+type RateLimitPolicy struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// Default policies per route group. Each can be overridden with
+// RATE_LIMIT_<NAME>="<rate per second>:<burst>", e.g. RATE_LIMIT_API="10:60".
+var (
+	WebhookRateLimit     = RateLimitPolicy{Name: "webhook", Rate: 20, Burst: 100}
+	DeviceRateLimit      = RateLimitPolicy{Name: "device", Rate: 2, Burst: 30}
+	PublicShareRateLimit = RateLimitPolicy{Name: "public_share", Rate: 1, Burst: 20}
+	APIRateLimit         = RateLimitPolicy{Name: "api", Rate: 5, Burst: 60}
+	// A device's web UI loads many assets per page
+	RelayRateLimit = RateLimitPolicy{Name: "relay", Rate: 30, Burst: 200}
+)
+
+// RateLimitPolicyFromEnv applies the RATE_LIMIT_<NAME> override, if any, to p.
+func RateLimitPolicyFromEnv(p RateLimitPolicy) RateLimitPolicy {
+	key := "RATE_LIMIT_" + strings.ToUpper(p.Name)
+	raw := os.Getenv(key)
+	if raw == "" {
+		return p
+	}
+
+	rateStr, burstStr, ok := strings.Cut(raw, ":")
+	rate, rateErr := strconv.ParseFloat(rateStr, 64)
+	burst, burstErr := strconv.Atoi(burstStr)
+	if !ok || rateErr != nil || burstErr != nil || rate <= 0 || burst <= 0 {
+		log.Printf("Ignoring invalid %s=%q, expected <rate>:<burst>", key, raw)
+		return p
+	}
+
+	p.Rate = rate
+	p.Burst = burst
+	return p
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keys buckets by Clerk ID when the request is authenticated and by
+// client IP otherwise. Mount it after ClerkAuthMiddleware to get per-user limits.
+type RateLimiter struct {
+	policy RateLimitPolicy
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewRateLimiter(policy RateLimitPolicy) *RateLimiter {
+	return &RateLimiter{
+		policy:  policy,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from key's bucket. It returns the tokens left and, when
+// the request is rejected, how long until a token becomes available.
+func (l *RateLimiter) allow(key string, now time.Time) (bool, float64, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.policy.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(l.policy.Burst), b.tokens+elapsed*l.policy.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.policy.Rate * float64(time.Second))
+		return false, b.tokens, wait
+	}
+
+	b.tokens--
+	return true, b.tokens, 0
+}
+
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "ip:" + ClientIP(r)
+		if clerkID, ok := GetClerkID(r.Context()); ok && clerkID != "" {
+			key = "user:" + clerkID
+		} else if deviceID, ok := GetDeviceID(r.Context()); ok && deviceID != "" {
+			key = "device:" + deviceID
+		}
+
+		allowed, remaining, wait := l.allow(key, time.Now())
+
+		untilFull := (float64(l.policy.Burst) - remaining) / l.policy.Rate
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(l.policy.Burst))
+		h.Set("RateLimit-Remaining", strconv.Itoa(int(math.Floor(remaining))))
+		h.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(untilFull))))
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", l.policy.Burst, int(math.Ceil(float64(l.policy.Burst)/l.policy.Rate))))
+
+		if !allowed {
+			h.Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respondWithError(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run evicts buckets that have been idle long enough to be full again, until
+// ctx is cancelled.
+func (l *RateLimiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	idle := time.Duration(float64(l.policy.Burst)/l.policy.Rate*float64(time.Second)) + time.Minute
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for key, b := range l.buckets {
+				if now.Sub(b.last) > idle {
+					delete(l.buckets, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Each step runs against the same bucket, in order
+	tests := []struct {
+		name      string
+		at        time.Duration
+		want      bool
+		remaining float64
+		wait      time.Duration
+	}{
+		{"first request starts full", 0, true, 2, 0},
+		{"second", 0, true, 1, 0},
+		{"third drains the burst", 0, true, 0, 0},
+		{"empty bucket is rejected", 0, false, 0, 500 * time.Millisecond},
+		{"half a token is not enough", 250 * time.Millisecond, false, 0.5, 250 * time.Millisecond},
+		{"refilled token is spent", 500 * time.Millisecond, true, 0, 0},
+		{"refill is capped at burst", time.Hour, true, 2, 0},
+	}
+
+	l := NewRateLimiter(RateLimitPolicy{Name: "test", Rate: 2, Burst: 3})
+	for _, tt := range tests {
+		ok, remaining, wait := l.allow("ip:192.0.2.1", start.Add(tt.at))
+		if ok != tt.want || remaining != tt.remaining || wait != tt.wait {
+			t.Errorf("%s: got (%v, %v, %v), want (%v, %v, %v)", tt.name, ok, remaining, wait, tt.want, tt.remaining, tt.wait)
+		}
+	}
+
+	if ok, _, _ := l.allow("ip:192.0.2.2", start); !ok {
+		t.Error("other keys must have their own bucket")
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	l := NewRateLimiter(RateLimitPolicy{Name: "test", Rate: 1, Burst: 1})
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/plans", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(http.MethodGet); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d, want 200", rec.Code)
+	}
+	if rec := serve(http.MethodOptions); rec.Code != http.StatusOK {
+		t.Fatalf("preflight: status %d, want 200", rec.Code)
+	}
+
+	rec := serve(http.MethodGet)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+}
+
+func TestRateLimitPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		env       string
+		wantRate  float64
+		wantBurst int
+	}{
+		{"", 5, 60},
+		{"10:100", 10, 100},
+		{"0.5:5", 0.5, 5},
+
+		{"10", 5, 60},
+		{"ten:100", 5, 60},
+		{"10:-1", 5, 60},
+		{"0:100", 5, 60},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("RATE_LIMIT_API", tt.env)
+		p := RateLimitPolicyFromEnv(APIRateLimit)
+		if p.Rate != tt.wantRate || p.Burst != tt.wantBurst {
+			t.Errorf("RATE_LIMIT_API=%q: got %v:%d, want %v:%d", tt.env, p.Rate, p.Burst, tt.wantRate, tt.wantBurst)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "127.0.0.1,10.0.0.0/8")
+	trustedProxiesOnce = sync.Once{}
+	trustedProxies = nil
+	t.Cleanup(func() {
+		trustedProxiesOnce = sync.Once{}
+		trustedProxies = nil
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5555", nil, "203.0.113.7"},
+		{"direct client can't spoof", "203.0.113.7:5555", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"proxy without header", "127.0.0.1:5555", nil, "127.0.0.1"},
+		{"behind proxy", "127.0.0.1:5555", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hop left of the real client", "127.0.0.1:5555", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "127.0.0.1:5555", []string{"198.51.100.1, 10.0.0.2, 10.1.2.3"}, "198.51.100.1"},
+		{"repeated headers", "127.0.0.1:5555", []string{"198.51.100.1", "10.0.0.2"}, "198.51.100.1"},
+		{"only trusted hops", "127.0.0.1:5555", []string{"10.0.0.2"}, "10.0.0.2"},
+		{"garbage hop stops the walk", "127.0.0.1:5555", []string{"198.51.100.1, junk"}, "127.0.0.1"},
+		{"mapped IPv4", "[::ffff:203.0.113.7]:5555", nil, "203.0.113.7"},
+		{"IPv6 client", "[2001:db8::1]:5555", nil, "2001:db8::1"},
+		{"no port", "203.0.113.7", nil, "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for _, v := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if got := ClientIP(req); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/strct-org/portal/backend/internal/handlers"
+	"github.com/strct-org/portal/backend/internal/openapi"
+	"github.com/strct-org/portal/backend/internal/relay"
+	"github.com/strct-org/portal/backend/middleware"
+)
+
+// assetsDir is served at /assets/. Release uploads are written below it.
+const assetsDir = "./assets"
+
+// routerDeps is everything the router needs, kept apart from main so tests
+// can build the router without a database.
+type routerDeps struct {
+	userHandler           *handlers.UserHandler
+	webhookHandler        *handlers.WebhookHandler
+	paymentWebhookHandler *handlers.PaymentWebhookHandler
+	healthHandler         *handlers.HealthHandler
+	docHandler            *handlers.DocumentHandler
+	deletionHandler       *handlers.AccountDeletionHandler
+	exportHandler         *handlers.ExportHandler
+	subscriptionHandler   *handlers.SubscriptionHandler
+	deviceHandler         *handlers.DeviceHandler
+	shareHandler          *handlers.ShareHandler
+	orderHandler          *handlers.OrderHandler
+	releaseHandler        *handlers.ReleaseHandler
+	otaHandler            *handlers.OTAHandler
+	commandHandler        *handlers.CommandHandler
+	deviceSocketHandler   *handlers.DeviceSocketHandler
+	relayHandler          *handlers.RelayHandler
+	p2pHandler            *handlers.P2PHandler
+	vpnHandler            *handlers.VPNHandler
+	eventHandler          *handlers.EventHandler
+	notificationHandler   *handlers.NotificationHandler
+	alertHandler          *handlers.AlertHandler
+	friendHandler         *handlers.FriendHandler
+	privacyHandler        *handlers.PrivacyHandler
+
+	// authenticateDevice resolves device tokens for device-facing routes
+	authenticateDevice middleware.DeviceAuthenticator
+	// relayDomain serves each device on a host of its own
+	relayDomain *relay.Domain
+
+	webhookLimiter     *middleware.RateLimiter
+	apiLimiter         *middleware.RateLimiter
+	deviceLimiter      *middleware.RateLimiter
+	publicShareLimiter *middleware.RateLimiter
+	relayLimiter       *middleware.RateLimiter
+}
+
+// newRouter registers every route. New API routes must also be documented in
+// internal/openapi/routes.go, which TestRouterMatchesSpec enforces.
+func newRouter(d routerDeps) *mux.Router {
+	r := mux.NewRouter()
+
+	// Users' requests to their devices, proxied through the devices' tunnels.
+	// Matched first, so no portal route is ever served on a device's origin
+	relayHost := r.Host(d.relayDomain.HostTemplate()).Subrouter()
+	relayHost.Use(middleware.MonitorMiddleware)
+	relayHost.Use(d.relayHandler.Authenticate)
+	relayHost.Use(d.relayLimiter.Middleware)
+	relayHost.PathPrefix("/").HandlerFunc(d.relayHandler.Proxy)
+
+	r.HandleFunc("/health", d.healthHandler.Livez).Methods("GET")
+	r.HandleFunc("/livez", d.healthHandler.Livez).Methods("GET")
+	r.HandleFunc("/readyz", d.healthHandler.Readyz).Methods("GET")
+	r.HandleFunc("/readyz/light", d.healthHandler.ReadyzLight).Methods("GET")
+
+	standardRouter := r.PathPrefix("/").Subrouter()
+	standardRouter.Use(middleware.MonitorMiddleware)
+
+	standardRouter.Handle("/metrics", middleware.BasicAuthMiddleware(promhttp.Handler())).Methods("GET")
+	// net/http/pprof registers itself on the DefaultServeMux, which is only reachable through here
+	standardRouter.PathPrefix("/debug/pprof/").Handler(middleware.PprofSecurityMiddleware(http.DefaultServeMux))
+
+	fs := http.FileServer(http.Dir(assetsDir))
+	standardRouter.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/", fs))
+	log.Printf("Serving static files from %s at /assets/", assetsDir)
+
+	webhooks := standardRouter.PathPrefix("/webhook").Subrouter()
+	webhooks.Use(d.webhookLimiter.Middleware)
+	webhooks.HandleFunc("/clerk", d.webhookHandler.HandleClerkWebhook).Methods("POST")
+	webhooks.HandleFunc("/payments", d.paymentWebhookHandler.HandlePaymentWebhook).Methods("POST")
+
+	api := standardRouter.PathPrefix("/api/v1").Subrouter()
+
+	// Unauthenticated API routes are limited per client IP
+	public := api.PathPrefix("").Subrouter()
+	public.Use(d.apiLimiter.Middleware)
+
+	public.HandleFunc("/openapi.json", openapi.Handler).Methods("GET")
+
+	public.HandleFunc("/privacy-policy", d.docHandler.ServePrivacyPolicy).Methods("GET")
+	public.HandleFunc("/terms-of-services", d.docHandler.ServeTermsOfServices).Methods("GET")
+	public.HandleFunc("/refund-policy", d.docHandler.ServeRefundPolicy).Methods("GET")
+	public.HandleFunc("/pricing", d.docHandler.ServePricing).Methods("GET")
+
+	public.HandleFunc("/delete-account-webpage", d.deletionHandler.DeleteAccountPage).Methods("GET")
+	public.HandleFunc("/delete-account-webpage", d.deletionHandler.RequestDeletion).Methods("POST")
+	public.HandleFunc("/delete-account-webpage/verify", d.deletionHandler.VerifyDeletion).Methods("POST")
+	public.HandleFunc("/delete-account-webpage/cancel", d.deletionHandler.CancelDeletionPage).Methods("GET")
+	public.HandleFunc("/delete-account-webpage/cancel", d.deletionHandler.CancelDeletion).Methods("POST")
+	public.HandleFunc("/delete-account-details-webpage", d.deletionHandler.DeleteAccountDetailsPage).Methods("GET")
+
+	public.HandleFunc("/plans", d.subscriptionHandler.ListPlans).Methods("GET")
+
+	// Called by devices that aren't paired yet, so there is no user session
+	public.HandleFunc("/device/pairing", d.deviceHandler.RequestPairing).Methods("POST")
+	public.HandleFunc("/device/pairing/{id}", d.deviceHandler.GetPairingStatus).Methods("GET")
+
+	public.HandleFunc("/invites/{token}", d.friendHandler.ResolveInvite).Methods("GET")
+
+	public.HandleFunc("/releases/latest", d.releaseHandler.GetLatestRelease).Methods("GET")
+
+	// Public links are guessable only by brute force, so they get a tighter
+	// per-IP budget than the rest of the public API
+	publicShares := api.PathPrefix("/shares/links").Subrouter()
+	publicShares.Use(d.publicShareLimiter.Middleware)
+	publicShares.HandleFunc("/{token}", d.shareHandler.ResolveLink).Methods("GET")
+
+	// Called by paired devices with the token they got at pairing
+	devices := api.PathPrefix("/device").Subrouter()
+	devices.Use(middleware.DeviceAuthMiddleware(d.authenticateDevice))
+	// Runs after device auth so buckets are keyed by device
+	devices.Use(d.deviceLimiter.Middleware)
+
+	devices.HandleFunc("/update", d.otaHandler.CheckForUpdate).Methods("GET")
+	devices.HandleFunc("/update/status", d.otaHandler.ReportUpdateStatus).Methods("POST")
+	devices.HandleFunc("/commands", d.commandHandler.PollCommands).Methods("GET")
+	devices.HandleFunc("/commands/{id}/ack", d.commandHandler.AcknowledgeCommand).Methods("POST")
+	devices.HandleFunc("/commands/{id}/result", d.commandHandler.ReportCommandResult).Methods("POST")
+	devices.HandleFunc("/ws", d.deviceSocketHandler.Connect).Methods("GET")
+	devices.HandleFunc("/relay", d.relayHandler.Connect).Methods("GET")
+	devices.HandleFunc("/p2p/offers", d.p2pHandler.ListOffers).Methods("GET")
+	devices.HandleFunc("/p2p/{id}/answer", d.p2pHandler.Answer).Methods("POST")
+	devices.HandleFunc("/vpn", d.vpnHandler.GetDeviceConfig).Methods("GET")
+	devices.HandleFunc("/vpn", d.vpnHandler.RegisterDeviceKey).Methods("PUT")
+	devices.HandleFunc("/telemetry", d.deviceHandler.ReportTelemetry).Methods("POST")
+
+	// Browsers open the stream with a query token instead of a Bearer token;
+	// the limiter runs after auth so buckets are keyed by Clerk ID
+	api.Handle("/events", d.eventHandler.Authenticate(d.apiLimiter.Middleware(http.HandlerFunc(d.eventHandler.Stream)))).Methods("GET")
+
+	protected := api.PathPrefix("").Subrouter()
+	protected.Use(middleware.ClerkAuthMiddleware)
+	// Runs after auth so buckets are keyed by Clerk ID
+	protected.Use(d.apiLimiter.Middleware)
+
+	protected.HandleFunc("/user", d.userHandler.GetProfile).Methods("GET")
+	// protected.HandleFunc("/user", userHandler.UpdateProfile).Methods("PUT")
+	// protected.HandleFunc("/user", userHandler.DeleteAccount).Methods("DELETE")
+
+	protected.HandleFunc("/user/documents", d.docHandler.GetAcceptances).Methods("GET")
+	protected.HandleFunc("/user/documents/{slug}/accept", d.docHandler.AcceptDocument).Methods("POST")
+
+	protected.HandleFunc("/user/export", d.exportHandler.RequestExport).Methods("POST")
+	protected.HandleFunc("/user/export/{id}", d.exportHandler.GetExport).Methods("GET")
+	protected.HandleFunc("/user/export/{id}/download", d.exportHandler.DownloadExport).Methods("GET")
+
+	protected.HandleFunc("/user/subscription", d.subscriptionHandler.GetEntitlements).Methods("GET")
+
+	protected.HandleFunc("/user/notification-preferences", d.notificationHandler.GetPreferences).Methods("GET")
+	protected.HandleFunc("/user/notification-preferences", d.notificationHandler.UpdatePreferences).Methods("PUT")
+	protected.HandleFunc("/user/privacy", d.privacyHandler.GetSettings).Methods("GET")
+	protected.HandleFunc("/user/privacy", d.privacyHandler.UpdateSettings).Methods("PUT")
+	protected.HandleFunc("/user/blocks", d.privacyHandler.ListBlocks).Methods("GET")
+	protected.HandleFunc("/user/blocks/{userId}", d.privacyHandler.BlockUser).Methods("PUT")
+	protected.HandleFunc("/user/blocks/{userId}", d.privacyHandler.UnblockUser).Methods("DELETE")
+
+	protected.HandleFunc("/events/token", d.eventHandler.CreateStreamToken).Methods("POST")
+
+	protected.HandleFunc("/notifications", d.notificationHandler.ListNotifications).Methods("GET")
+	protected.HandleFunc("/notifications/read-all", d.notificationHandler.MarkAllRead).Methods("POST")
+	protected.HandleFunc("/notifications/{id}/read", d.notificationHandler.MarkRead).Methods("POST")
+
+	protected.HandleFunc("/devices", d.deviceHandler.ListDevices).Methods("GET")
+	protected.HandleFunc("/devices/pair", d.deviceHandler.ClaimDevice).Methods("POST")
+	protected.HandleFunc("/devices/pairable", d.orderHandler.ListPairableDevices).Methods("GET")
+	protected.HandleFunc("/devices/{id}", d.deviceHandler.GetDevice).Methods("GET")
+	protected.HandleFunc("/devices/{id}", d.deviceHandler.UnpairDevice).Methods("DELETE")
+	protected.HandleFunc("/devices/{id}/commands", d.commandHandler.ListCommands).Methods("GET")
+	protected.HandleFunc("/devices/{id}/commands", d.commandHandler.CreateCommand).Methods("POST")
+	protected.HandleFunc("/devices/{id}/commands/{commandId}", d.commandHandler.GetCommand).Methods("GET")
+	protected.HandleFunc("/devices/{id}/shares", d.shareHandler.ListDeviceShares).Methods("GET")
+	protected.HandleFunc("/devices/{id}/shares", d.shareHandler.CreateShare).Methods("POST")
+	protected.HandleFunc("/devices/{id}/connect", d.p2pHandler.Offer).Methods("POST")
+	protected.HandleFunc("/devices/{id}/relay-link", d.relayHandler.CreateLink).Methods("POST")
+	protected.HandleFunc("/devices/{id}/vpn", d.vpnHandler.RevokeDevice).Methods("DELETE")
+	protected.HandleFunc("/devices/{id}/vpn-config", d.vpnHandler.GetClientConfig).Methods("GET")
+	protected.HandleFunc("/devices/{id}/vpn-config", d.vpnHandler.RevokeClientConfig).Methods("DELETE")
+	protected.HandleFunc("/devices/{id}/vpn-config/rotate", d.vpnHandler.RotateClientConfig).Methods("POST")
+	protected.HandleFunc("/devices/{id}/disks", d.deviceHandler.ListDisks).Methods("GET")
+	protected.HandleFunc("/devices/{id}/alerts", d.alertHandler.ListDeviceAlerts).Methods("GET")
+
+	protected.HandleFunc("/alert-rules", d.alertHandler.ListRules).Methods("GET")
+	protected.HandleFunc("/alert-rules", d.alertHandler.CreateRule).Methods("POST")
+	protected.HandleFunc("/alert-rules/{id}", d.alertHandler.UpdateRule).Methods("PUT")
+	protected.HandleFunc("/alert-rules/{id}", d.alertHandler.DeleteRule).Methods("DELETE")
+
+	protected.HandleFunc("/users/search", d.privacyHandler.SearchUsers).Methods("GET")
+	protected.HandleFunc("/friends", d.friendHandler.ListFriends).Methods("GET")
+	protected.HandleFunc("/friends/requests", d.friendHandler.ListRequests).Methods("GET")
+	protected.HandleFunc("/friends/requests", d.friendHandler.SendRequest).Methods("POST")
+	protected.HandleFunc("/friends/requests/{userId}/accept", d.friendHandler.AcceptRequest).Methods("POST")
+	protected.HandleFunc("/friends/invites", d.friendHandler.ListInvites).Methods("GET")
+	protected.HandleFunc("/friends/invites", d.friendHandler.CreateInvite).Methods("POST")
+	protected.HandleFunc("/friends/invites/{id}", d.friendHandler.CancelInvite).Methods("DELETE")
+	protected.HandleFunc("/friends/{userId}", d.friendHandler.RemoveFriend).Methods("DELETE")
+	protected.HandleFunc("/invites/{token}/accept", d.friendHandler.AcceptInvite).Methods("POST")
+
+	protected.HandleFunc("/p2p/sessions/{id}", d.p2pHandler.GetSession).Methods("GET")
+	protected.HandleFunc("/p2p/sessions/{id}/result", d.p2pHandler.RecordResult).Methods("POST")
+
+	protected.HandleFunc("/shares", d.shareHandler.ListReceivedShares).Methods("GET")
+	protected.HandleFunc("/shares/{id}", d.shareHandler.DeleteShare).Methods("DELETE")
+
+	protected.HandleFunc("/orders", d.orderHandler.ListOrders).Methods("GET")
+	protected.HandleFunc("/orders/{id}", d.orderHandler.GetOrder).Methods("GET")
+
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.AdminAuthMiddleware)
+	admin.Use(d.apiLimiter.Middleware)
+
+	admin.HandleFunc("/orders/{id}/shipping", d.orderHandler.UpdateShipping).Methods("PUT")
+	admin.HandleFunc("/orders/{id}/units", d.orderHandler.AssignUnits).Methods("POST")
+	admin.HandleFunc("/releases", d.releaseHandler.UploadRelease).Methods("POST")
+	admin.HandleFunc("/rollouts", d.otaHandler.ListRollouts).Methods("GET")
+	admin.HandleFunc("/rollouts", d.otaHandler.CreateRollout).Methods("POST")
+	admin.HandleFunc("/rollouts/{id}", d.otaHandler.GetRollout).Methods("GET")
+	admin.HandleFunc("/rollouts/{id}", d.otaHandler.UpdateRollout).Methods("PATCH")
+	admin.HandleFunc("/devices/{id}/cohort", d.otaHandler.SetDeviceCohort).Methods("PUT")
+	admin.HandleFunc("/vpn/peers", d.vpnHandler.ListGatewayPeers).Methods("GET")
+
+	return r
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/strct-org/portal/backend/internal/handlers"
+	"github.com/strct-org/portal/backend/internal/openapi"
+	"github.com/strct-org/portal/backend/internal/relay"
+	"github.com/strct-org/portal/backend/middleware"
+)
+
+// Operational routes deliberately left out of the public API contract.
+var undocumentedRoutes = map[string]bool{
+	"GET /metrics":      true,
+	"ANY /debug/pprof/": true,
+	"ANY /assets/":      true,
+	// Proxied to the device's own API on its relay host, which the portal
+	// doesn't describe
+	"ANY /": true,
+}
+
+// testRouter builds the router without a database. Only handlers that don't
+// reach their service can be exercised through it.
+func testRouter(t *testing.T) *mux.Router {
+	t.Helper()
+
+	relayDomain, err := relay.ParseDomain("https://strct-relay.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newRouter(routerDeps{
+		relayHandler:       handlers.NewRelayHandler(relay.New(), nil, nil, relayDomain),
+		relayDomain:        relayDomain,
+		webhookLimiter:     middleware.NewRateLimiter(middleware.WebhookRateLimit),
+		apiLimiter:         middleware.NewRateLimiter(middleware.APIRateLimit),
+		deviceLimiter:      middleware.NewRateLimiter(middleware.DeviceRateLimit),
+		publicShareLimiter: middleware.NewRateLimiter(middleware.PublicShareRateLimit),
+		relayLimiter:       middleware.NewRateLimiter(middleware.RelayRateLimit),
+	})
+}
+
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+
+	r := testRouter(t)
+
+	var keys []string
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil // subrouter
+		}
+
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		tpl = openapi.NormalizePath(tpl)
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"ANY"}
+		}
+		for _, m := range methods {
+			key := m + " " + tpl
+			if !undocumentedRoutes[key] {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func TestRouterMatchesSpec(t *testing.T) {
+	registered := registeredRoutes(t)
+	documented := openapi.Operations(openapi.Routes)
+
+	inSpec := map[string]bool{}
+	for _, key := range documented {
+		inSpec[key] = true
+	}
+	inRouter := map[string]bool{}
+	for _, key := range registered {
+		inRouter[key] = true
+	}
+
+	var missing, stale []string
+	for _, key := range registered {
+		if !inSpec[key] {
+			missing = append(missing, key)
+		}
+	}
+	for _, key := range documented {
+		if !inRouter[key] {
+			stale = append(stale, key)
+		}
+	}
+
+	if len(missing) > 0 {
+		t.Errorf("routes registered but not documented in internal/openapi/routes.go:\n  %s", strings.Join(missing, "\n  "))
+	}
+	if len(stale) > 0 {
+		t.Errorf("routes documented but not registered:\n  %s", strings.Join(stale, "\n  "))
+	}
+}
+
+// Device hosts only ever reach the relay, and the portal's host never does.
+func TestRelayHostsAreSeparateFromThePortal(t *testing.T) {
+	r := testRouter(t)
+	relayDomain, _ := relay.ParseDomain("https://strct-relay.test")
+	deviceURL, _ := relayDomain.DeviceURL("dev-1")
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{"portal route on the portal", "https://api.strct.test/api/v1/openapi.json", http.StatusOK},
+		{"portal route on a device host", deviceURL + "api/v1/openapi.json", http.StatusUnauthorized},
+		{"device host without credentials", deviceURL, http.StatusUnauthorized},
+		{"unknown relay host", "https://www.strct-relay.test/", http.StatusNotFound},
+		{"old relay path on the portal", "https://api.strct.test/relay/dev-1/", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}